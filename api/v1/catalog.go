@@ -0,0 +1,135 @@
+package api
+
+import (
+	"backup2glacier/backup"
+	"backup2glacier/database"
+	"backup2glacier/database/model"
+	"context"
+	"time"
+)
+
+// ListRequest selects the backups which will be listed. Without any filter all backups are listed.
+type ListRequest struct {
+	// Status lists only the backups with one of the given states (see model.BackupStatuses)
+	Status []string
+	// Vault lists only the backups of the given vault. It is required by OlderThan and SkipNewest.
+	Vault string
+	// OlderThan lists only the backups of the vault which are created before the given time
+	OlderThan time.Time
+	// SkipNewest skips the given number of the newest backups of the vault
+	SkipNewest int
+}
+
+// BackupDetails is a backup with its volumes, replicas and the history of its status
+type BackupDetails struct {
+	Backup      *model.Backup
+	Volumes     []model.Volume
+	Replicas    []model.Replica
+	Transitions []model.BackupTransition
+}
+
+// List returns the backups of the catalog which match the request. The volumes of the backups are included.
+func (c *Client) List(ctx context.Context, request ListRequest) ([]*model.Backup, error) {
+	const op = "list"
+
+	for _, status := range request.Status {
+		if !backup.IsValidStatus(status) {
+			return nil, invalidRequest(op, "Unknown status: %s", status)
+		}
+	}
+	if request.Vault == "" && (!request.OlderThan.IsZero() || request.SkipNewest > 0) {
+		return nil, invalidRequest(op, "No vault given")
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, newError(ctx, op, 0, err)
+	}
+
+	var iter database.BackupIterator
+	switch {
+	case !request.OlderThan.IsZero():
+		iter = c.repository.GetOlderThan(request.Vault, request.OlderThan)
+	case request.SkipNewest > 0:
+		iter = c.repository.GetLast(request.Vault, request.SkipNewest)
+	case request.Vault != "":
+		iter = c.repository.GetByVault(request.Vault)
+	case len(request.Status) > 0:
+		iter = c.repository.GetByStatus(request.Status...)
+	default:
+		iter = c.repository.List()
+	}
+
+	var backups []*model.Backup
+	for {
+		dbBackup, next := iter.Next()
+		if !next {
+			break
+		}
+		if len(request.Status) > 0 && request.Vault != "" && !containsStatus(request.Status, dbBackup.Status) {
+			continue
+		}
+		backups = append(backups, dbBackup)
+	}
+	iter.Close()
+
+	//the volumes are read after the backups, because the iterator blocks the catalog
+	for _, dbBackup := range backups {
+		dbBackup.Volumes = c.repository.GetVolumesByBackupId(dbBackup.ID)
+	}
+
+	return backups, nil
+}
+
+func containsStatus(statuses []string, status string) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Show returns the backup with its volumes, replicas and the history of its status
+func (c *Client) Show(ctx context.Context, backupId uint) (*BackupDetails, error) {
+	const op = "show"
+
+	if err := ctx.Err(); err != nil {
+		return nil, newError(ctx, op, backupId, err)
+	}
+
+	dbBackup := c.repository.GetBackupById(backupId)
+	if dbBackup.ID == 0 {
+		return nil, newError(ctx, op, backupId, ErrBackupNotFound)
+	}
+
+	return &BackupDetails{
+		Backup:      dbBackup,
+		Volumes:     c.repository.GetVolumesByBackupId(backupId),
+		Replicas:    c.repository.GetReplicasByBackupId(backupId),
+		Transitions: c.repository.GetBackupTransitions(backupId),
+	}, nil
+}
+
+// Contents passes the files of the backup one by one to the given function. The files are not collected, because
+// a backup can contain millions of them.
+func (c *Client) Contents(ctx context.Context, backupId uint, onContent func(*model.Content)) error {
+	const op = "contents"
+
+	dbBackup, iter := c.repository.GetBackupContentsById(backupId)
+	defer iter.Close()
+	if dbBackup.ID == 0 {
+		return newError(ctx, op, backupId, ErrBackupNotFound)
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return newError(ctx, op, backupId, err)
+		}
+
+		content, next := iter.Next()
+		if !next {
+			return nil
+		}
+		onContent(content)
+	}
+}
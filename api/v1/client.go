@@ -0,0 +1,285 @@
+package api
+
+import (
+	"backup2glacier/backup"
+	"backup2glacier/database"
+	"context"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// Progress reports the transferred bytes of a volume
+type Progress = backup.Progress
+
+// FileEvent reports a file which is added into a volume of a backup
+type FileEvent = backup.FileEvent
+
+// StorageFactory creates the storage backend of the given type for the given location
+type StorageFactory = backup.StorageFactory
+
+// Client creates, restores and manages the backups of one catalog. It can be used concurrently.
+type Client struct {
+	repository database.Repository
+	// ownsRepository is true if the repository is opened (and so has to be closed) by the client
+	ownsRepository bool
+	// dbFile is the database file of the repository. It is only known if the client opened the repository.
+	dbFile string
+	// storageSettings are shared by all storage backends of the client, so that the account of the credentials
+	// is resolved only once
+	storageSettings *backup.StorageSettings
+	// storageFactory replaces the storage backends of the settings if it is not nil
+	storageFactory StorageFactory
+
+	concurrency  int
+	spool        backup.SpoolConfig
+	chunkSize    int64
+	tier         string
+	pollInterval time.Duration
+	workDir      string
+	onProgress   func(Progress)
+	onFile       func(FileEvent)
+}
+
+// Option configures a Client
+type Option func(*Client) error
+
+// New creates a client with the given options. Either WithDatabase or WithRepository is required.
+func New(opts ...Option) (*Client, error) {
+	c, err := newClient(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if c.repository == nil {
+		return nil, errors.New("No database given. Use WithDatabase or WithRepository.")
+	}
+
+	return c, nil
+}
+
+// newClient creates a client with the given options, which does not need a catalog
+func newClient(opts ...Option) (*Client, error) {
+	c := &Client{
+		storageSettings: backup.NewStorageSettings(),
+		concurrency:     1,
+		spool:           backup.SpoolConfig{Mode: backup.SpoolModeDisk},
+		chunkSize:       backup.DefaultDownloadChunkSize,
+		tier:            "Standard",
+		pollInterval:    15 * time.Minute,
+	}
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// WithDatabase opens the catalog in the given sqlite database file. It will be closed by Client.Close. The schema
+// of the catalog will be migrated to the current version (see database.OpenRepository).
+func WithDatabase(dbFile string) Option {
+	return func(c *Client) error {
+		repository, err := database.OpenRepository(dbFile)
+		if err != nil {
+			return errors.Wrapf(err, "Could not open database %s", dbFile)
+		}
+
+		c.repository = repository
+		c.ownsRepository = true
+		c.dbFile = dbFile
+		return nil
+	}
+}
+
+// WithRepository uses the given catalog. It will not be closed by Client.Close.
+func WithRepository(repository database.Repository) Option {
+	return func(c *Client) error {
+		c.repository = repository
+		c.ownsRepository = false
+		c.dbFile = ""
+		return nil
+	}
+}
+
+// WithStorageFactory replaces the storage backends (glacier, S3 and directory) by the ones of the factory
+func WithStorageFactory(factory StorageFactory) Option {
+	return func(c *Client) error {
+		if factory == nil {
+			return errors.New("The storage factory must not be nil")
+		}
+		c.storageFactory = factory
+		return nil
+	}
+}
+
+// WithLocation sets the region and the account of new backups and of all operations which are not related to an
+// existing backup. Empty values stand for the region of the AWS configuration and the account of the credentials
+// (or of the assumed role).
+func WithLocation(region, accountId string) Option {
+	return func(c *Client) error {
+		c.storageSettings.Location = backup.AWSLocation{Region: region, AccountId: accountId}
+		return nil
+	}
+}
+
+// WithAssumeRole lets all AWS requests use the temporary credentials of the given role. Default: the credentials
+// are used directly
+func WithAssumeRole(role backup.AssumeRole) Option {
+	return func(c *Client) error {
+		c.storageSettings.AssumeRole = role
+		return nil
+	}
+}
+
+// WithRetryPolicy sets the retries of the failed AWS requests. Default: backup.DefaultRetryPolicy
+func WithRetryPolicy(policy backup.RetryPolicy) Option {
+	return func(c *Client) error {
+		if policy.MaxAttempts < 1 {
+			return errors.New("The maximum number of attempts must be at least 1")
+		}
+		if policy.Jitter < 0 || policy.Jitter > 1 {
+			return errors.Errorf("The retry jitter must be between 0 and 1: %v", policy.Jitter)
+		}
+		c.storageSettings.RetryPolicy = policy
+		return nil
+	}
+}
+
+// WithEndpoints replaces the endpoints of glacier and S3, for example by a fake glacier server or a MinIO server.
+// An empty endpoint stands for AWS. Default: AWS
+func WithEndpoints(glacierEndpoint, s3Endpoint string) Option {
+	return func(c *Client) error {
+		c.storageSettings.GlacierEndpoint = glacierEndpoint
+		c.storageSettings.S3Endpoint = s3Endpoint
+		return nil
+	}
+}
+
+// WithBandwidthLimiter limits the uploads and downloads of all storage backends. Default: no limit
+func WithBandwidthLimiter(limiter *backup.BandwidthLimiter) Option {
+	return func(c *Client) error {
+		c.storageSettings.BandwidthLimiter = limiter
+		return nil
+	}
+}
+
+// WithRetrievalDelays sets the simulated durations of the retrieval jobs of the directory backend by their tier.
+// The delay of the empty tier is used for all other tiers. Default: no delay
+func WithRetrievalDelays(delays map[string]time.Duration) Option {
+	return func(c *Client) error {
+		c.storageSettings.RetrievalDelays = delays
+		return nil
+	}
+}
+
+// WithConcurrency sets the number of parts (or chunks) which will be uploaded (or downloaded) at the same time.
+// Default: 1
+func WithConcurrency(concurrency int) Option {
+	return func(c *Client) error {
+		if concurrency < 1 {
+			return errors.New("The concurrency must be at least 1")
+		}
+		c.concurrency = concurrency
+		return nil
+	}
+}
+
+// WithSpool sets where the parts of the uploads will be buffered. Default: in temporary files on disk
+func WithSpool(spool backup.SpoolConfig) Option {
+	return func(c *Client) error {
+		c.spool = spool
+		return nil
+	}
+}
+
+// WithChunkSize sets the size of the ranges in which the archives will be downloaded. It must be a power of two
+// multiple of 1 MiB. Default: backup.DefaultDownloadChunkSize
+func WithChunkSize(chunkSize int64) Option {
+	return func(c *Client) error {
+		if !backup.IsValidChunkSize(chunkSize) {
+			return errors.Errorf("The chunk size must be a power of two multiple of 1 MiB: %d", chunkSize)
+		}
+		c.chunkSize = chunkSize
+		return nil
+	}
+}
+
+// WithRetrieval sets the tier of the retrieval jobs and the interval in which their status is polled.
+// Default: Standard, 15 minutes
+func WithRetrieval(tier string, pollInterval time.Duration) Option {
+	return func(c *Client) error {
+		if !backup.IsValidTier(tier) {
+			return errors.Errorf("Unknown tier: %s", tier)
+		}
+		c.tier = tier
+		c.pollInterval = pollInterval
+		return nil
+	}
+}
+
+// WithPollInterval sets the interval in which the status of the retrieval and inventory jobs is polled.
+// Default: 15 minutes
+func WithPollInterval(pollInterval time.Duration) Option {
+	return func(c *Client) error {
+		c.pollInterval = pollInterval
+		return nil
+	}
+}
+
+// WithWorkDir sets the directory for the archives which are copied. Default: the directory of temporary files
+func WithWorkDir(workDir string) Option {
+	return func(c *Client) error {
+		c.workDir = workDir
+		return nil
+	}
+}
+
+// WithProgress sets the callback which receives the progress of all uploads and downloads. It will be called
+// concurrently by the uploads of a volume and its replicas.
+func WithProgress(onProgress func(Progress)) Option {
+	return func(c *Client) error {
+		c.onProgress = onProgress
+		return nil
+	}
+}
+
+// WithFileEvents sets the callback which receives each file that is added into a backup
+func WithFileEvents(onFile func(FileEvent)) Option {
+	return func(c *Client) error {
+		c.onFile = onFile
+		return nil
+	}
+}
+
+// Repository returns the catalog of the client
+func (c *Client) Repository() database.Repository {
+	return c.repository
+}
+
+// Close closes the catalog if it is opened by the client
+func (c *Client) Close() error {
+	if c.ownsRepository && c.repository != nil {
+		return c.repository.Close()
+	}
+
+	return nil
+}
+
+// manager creates the backup manager for one operation. The manager must not be closed, because the repository
+// belongs to the client.
+func (c *Client) manager(ctx context.Context, password *string, savePassword bool, partSize int, opts ...backup.ManagerOption) (backup.BackupManager, error) {
+	opts = append([]backup.ManagerOption{
+		backup.WithContext(ctx),
+		backup.WithStorageSettings(c.storageSettings),
+		backup.WithStorageFactory(c.storageFactory),
+		backup.WithConcurrency(c.concurrency),
+		backup.WithSpool(c.spool),
+		backup.WithChunkSize(c.chunkSize),
+		backup.WithWorkDir(c.workDir),
+		backup.WithProgress(c.onProgress),
+		backup.WithFileEvents(c.onFile),
+	}, opts...)
+
+	return backup.NewBackupManager(password, savePassword, partSize, c.pollInterval, c.tier, c.repository, opts...)
+}
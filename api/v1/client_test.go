@@ -0,0 +1,357 @@
+package api
+
+import (
+	"archive/zip"
+	"backup2glacier/backup"
+	"backup2glacier/database/model"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+const mib = 1024 * 1024
+
+func newTestClient(t *testing.T, opts ...Option) (*Client, string, func()) {
+	dir, err := ioutil.TempDir("", "api")
+	assert.NoError(t, err)
+
+	vault := path.Join(dir, "vault")
+	assert.NoError(t, backup.EnsureDirectoryVault(vault))
+
+	client, err := New(append([]Option{WithDatabase(path.Join(dir, "database.db"))}, opts...)...)
+	assert.NoError(t, err)
+
+	return client, vault, func() {
+		client.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestClient_CreateRestoreDelete(t *testing.T) {
+	mutex := sync.Mutex{}
+	var files []FileEvent
+	uploaded := map[int]int64{}
+	var downloaded int64
+	var storages []string
+
+	client, vault, cleanup := newTestClient(t,
+		WithRetrieval("Standard", time.Millisecond),
+		WithChunkSize(mib),
+		WithStorageFactory(func(backend string, location backup.AWSLocation) (backup.StorageBackend, error) {
+			storages = append(storages, backend)
+			return backup.NewStorageBackend(backend, location, backup.NewStorageSettings())
+		}),
+		WithFileEvents(func(event FileEvent) {
+			files = append(files, event)
+		}),
+		WithProgress(func(progress Progress) {
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			if progress.Operation == backup.OperationUpload {
+				uploaded[progress.Volume] = progress.Bytes
+			} else {
+				downloaded = progress.Bytes
+			}
+		}))
+	defer cleanup()
+
+	result, err := client.Create(context.Background(), CreateRequest{
+		Files:    []string{"./client.go", "./errors.go"},
+		Vault:    vault,
+		Backend:  backup.BackendDirectory,
+		Password: "secret",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1), result.BackupId)
+	assert.Equal(t, mib, result.PartSize)
+	assert.Len(t, result.Volumes, 1)
+
+	assert.Len(t, files, 2)
+	assert.Equal(t, uint(1), files[0].BackupId)
+	assert.Equal(t, 1, files[0].Volume)
+	assert.Equal(t, result.TotalSize, uploaded[1])
+	assert.Equal(t, model.BackupStatusCompleted, client.Repository().GetBackupById(result.BackupId).Status)
+
+	target := path.Join(filepath.Dir(vault), "backup.zip")
+	err = client.Restore(context.Background(), RestoreRequest{BackupId: result.BackupId, Target: target, Password: "secret"})
+	assert.NoError(t, err)
+	assert.Equal(t, result.TotalSize, downloaded)
+
+	unzipReader, err := zip.OpenReader(target)
+	assert.NoError(t, err)
+	assert.Len(t, unzipReader.File, 2)
+	unzipReader.Close()
+
+	assert.NoError(t, client.Delete(context.Background(), result.BackupId))
+	assert.Equal(t, int64(0), client.Repository().Count())
+
+	var history []string
+	for _, transition := range client.Repository().GetBackupTransitions(result.BackupId) {
+		history = append(history, transition.ToStatus)
+	}
+	assert.Equal(t, []string{
+		model.BackupStatusPending,
+		model.BackupStatusUploading,
+		model.BackupStatusCompleted,
+		model.BackupStatusDeleting,
+		model.BackupStatusDeleted,
+	}, history)
+	assert.Equal(t, []string{backup.BackendDirectory, backup.BackendDirectory, backup.BackendDirectory}, storages)
+}
+
+func TestClient_CreateCancelled(t *testing.T) {
+	client, vault, cleanup := newTestClient(t)
+	defer cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	result, err := client.Create(ctx, CreateRequest{
+		Files:    []string{"./client.go"},
+		Vault:    vault,
+		Backend:  backup.BackendDirectory,
+		Password: "secret",
+	})
+	assert.Error(t, err)
+	assert.True(t, IsCancelled(err))
+	assert.Equal(t, "create", err.(*Error).Op)
+
+	dbBackup := client.Repository().GetBackupById(result.BackupId)
+	assert.Equal(t, "The backup was cancelled. Its uploads are aborted: context canceled", dbBackup.Error)
+	assert.Equal(t, model.BackupStatusCancelled, dbBackup.Status)
+
+	//the cancelled backup can be continued
+	result, err = client.Resume(context.Background(), ResumeRequest{BackupId: result.BackupId, Password: "secret"})
+	assert.NoError(t, err)
+	assert.Len(t, result.Volumes, 1)
+	assert.NotNil(t, result.Volumes[0].ArchiveInfo)
+}
+
+func TestClient_CreateCancelledWhileUploading(t *testing.T) {
+	for _, keep := range []bool{false, true} {
+		ctx, cancel := context.WithCancel(context.Background())
+		client, vault, cleanup := newTestClient(t, WithProgress(func(progress Progress) {
+			//cancel after the first part
+			if progress.Bytes > mib {
+				cancel()
+			}
+		}))
+
+		source := path.Join(filepath.Dir(vault), "source")
+		data := make([]byte, 3*mib)
+		rand.Read(data)
+		assert.NoError(t, ioutil.WriteFile(source, data, 0644))
+
+		request := CreateRequest{
+			Files:        []string{source},
+			Vault:        vault,
+			Backend:      backup.BackendDirectory,
+			Password:     "secret",
+			PartSize:     mib,
+			KeepOnCancel: keep,
+		}
+		result, err := client.Create(ctx, request)
+		assert.True(t, IsCancelled(err))
+
+		volumes := client.Repository().GetVolumesByBackupId(result.BackupId)
+		assert.Len(t, volumes, 1)
+		assert.Nil(t, volumes[0].ArchiveId)
+		uploads, _ := ioutil.ReadDir(path.Join(vault, "uploads"))
+
+		if keep {
+			//the upload will be continued
+			assert.NotNil(t, volumes[0].UploadId)
+			assert.Len(t, uploads, 1)
+			assert.Contains(t, client.Repository().GetBackupById(result.BackupId).Error, "kept for a later resume")
+		} else {
+			assert.Nil(t, volumes[0].UploadId)
+			assert.Empty(t, uploads)
+		}
+
+		result, err = client.Resume(context.Background(), ResumeRequest{BackupId: result.BackupId, Password: "secret"})
+		assert.NoError(t, err)
+		assert.NotNil(t, result.Volumes[0].ArchiveInfo)
+		assert.Equal(t, "", client.Repository().GetBackupById(result.BackupId).Error)
+
+		cancel()
+		cleanup()
+	}
+}
+
+func TestClient_RestoreCancelled(t *testing.T) {
+	//the retrieval job will not be completed before the timeout
+	client, vault, cleanup := newTestClient(t, WithRetrieval("Bulk", time.Hour), WithRetrievalDelays(map[string]time.Duration{"": time.Hour}))
+	defer cleanup()
+
+	result, err := client.Create(context.Background(), CreateRequest{
+		Files:    []string{"./client.go"},
+		Vault:    vault,
+		Backend:  backup.BackendDirectory,
+		Password: "secret",
+	})
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err = client.Restore(ctx, RestoreRequest{BackupId: result.BackupId, Target: path.Join(filepath.Dir(vault), "backup.zip")})
+	assert.Error(t, err)
+	assert.True(t, IsCancelled(err))
+	assert.True(t, time.Since(start) < time.Minute)
+}
+
+func TestClient_Cleanup(t *testing.T) {
+	client, vault, cleanup := newTestClient(t)
+	defer cleanup()
+
+	repository := client.Repository()
+	longAgo := time.Now().Add(-48 * time.Hour)
+	stale := &model.Backup{Vault: vault, Status: model.BackupStatusUploading, StatusChangedAt: longAgo, HeartbeatAt: longAgo}
+	//a long running upload refreshes its heartbeat
+	running := &model.Backup{Vault: vault, Status: model.BackupStatusUploading, StatusChangedAt: longAgo, HeartbeatAt: time.Now()}
+	repository.SaveBackup(stale)
+	repository.SaveBackup(running)
+
+	//the backup is regarded as running
+	_, err := client.Resume(context.Background(), ResumeRequest{BackupId: stale.ID})
+	assert.Error(t, err)
+
+	backups, err := client.Cleanup(context.Background(), CleanupRequest{OlderThan: 24 * time.Hour, DryRun: true})
+	assert.NoError(t, err)
+	assert.Len(t, backups, 1)
+	assert.Equal(t, stale.ID, backups[0].ID)
+	assert.Equal(t, model.BackupStatusUploading, repository.GetBackupById(stale.ID).Status)
+
+	_, err = client.Cleanup(context.Background(), CleanupRequest{OlderThan: 24 * time.Hour})
+	assert.NoError(t, err)
+	assert.Equal(t, model.BackupStatusFailed, repository.GetBackupById(stale.ID).Status)
+	assert.Equal(t, backup.ErrInterrupted.Error(), repository.GetBackupById(stale.ID).Error)
+	assert.Equal(t, model.BackupStatusUploading, repository.GetBackupById(running.ID).Status)
+
+	backups, err = client.Cleanup(context.Background(), CleanupRequest{OlderThan: time.Nanosecond, Delete: true})
+	assert.NoError(t, err)
+	assert.Len(t, backups, 1)
+	assert.Equal(t, uint(0), repository.GetBackupById(running.ID).ID)
+
+	_, err = client.Cleanup(context.Background(), CleanupRequest{})
+	assert.True(t, IsInvalidRequest(err))
+}
+
+func TestClient_ListShowContents(t *testing.T) {
+	client, vault, cleanup := newTestClient(t)
+	defer cleanup()
+
+	result, err := client.Create(context.Background(), CreateRequest{
+		Files:    []string{"./client.go", "./errors.go"},
+		Vault:    vault,
+		Backend:  backup.BackendDirectory,
+		Password: "secret",
+	})
+	assert.NoError(t, err)
+	failed := &model.Backup{Vault: "other", Status: model.BackupStatusFailed}
+	client.Repository().SaveBackup(failed)
+
+	backups, err := client.List(context.Background(), ListRequest{})
+	assert.NoError(t, err)
+	assert.Len(t, backups, 2)
+
+	backups, err = client.List(context.Background(), ListRequest{Status: []string{model.BackupStatusCompleted}})
+	assert.NoError(t, err)
+	assert.Len(t, backups, 1)
+	assert.Equal(t, result.BackupId, backups[0].ID)
+	assert.Len(t, backups[0].Volumes, 1)
+
+	backups, err = client.List(context.Background(), ListRequest{Status: []string{model.BackupStatusCompleted}, Vault: "other"})
+	assert.NoError(t, err)
+	assert.Empty(t, backups)
+
+	backups, err = client.List(context.Background(), ListRequest{Vault: vault, OlderThan: time.Now().Add(time.Hour)})
+	assert.NoError(t, err)
+	assert.Len(t, backups, 1)
+
+	_, err = client.List(context.Background(), ListRequest{Status: []string{"LOST"}})
+	assert.True(t, IsInvalidRequest(err))
+	_, err = client.List(context.Background(), ListRequest{SkipNewest: 1})
+	assert.True(t, IsInvalidRequest(err))
+
+	details, err := client.Show(context.Background(), result.BackupId)
+	assert.NoError(t, err)
+	assert.Equal(t, model.BackupStatusCompleted, details.Backup.Status)
+	assert.Len(t, details.Volumes, 1)
+	assert.NotEmpty(t, details.Transitions)
+
+	var files []string
+	err = client.Contents(context.Background(), result.BackupId, func(content *model.Content) {
+		files = append(files, content.Path)
+	})
+	assert.NoError(t, err)
+	assert.Len(t, files, 2)
+
+	_, err = client.Show(context.Background(), 42)
+	assert.True(t, IsNotFound(err))
+	assert.True(t, IsNotFound(client.Contents(context.Background(), 42, func(*model.Content) {})))
+
+	//the database file of a shared repository is unknown
+	other, err := New(WithRepository(client.Repository()))
+	assert.NoError(t, err)
+	assert.Equal(t, backup.SpoolModeDisk, other.spool.Mode)
+	assert.True(t, IsInvalidRequest(other.BackupCatalog(context.Background(), CatalogBackupRequest{Vault: vault, Password: "secret", Keep: 1})))
+}
+
+func TestClient_Errors(t *testing.T) {
+	client, vault, cleanup := newTestClient(t)
+	defer cleanup()
+
+	err := client.Restore(context.Background(), RestoreRequest{BackupId: 42, Target: path.Join(vault, "backup.zip")})
+	assert.True(t, IsNotFound(err))
+	assert.Equal(t, uint(42), err.(*Error).BackupId)
+
+	_, err = client.Resume(context.Background(), ResumeRequest{BackupId: 42})
+	assert.True(t, IsNotFound(err))
+
+	assert.True(t, IsNotFound(client.Delete(context.Background(), 42)))
+	assert.True(t, IsNotFound(client.Copy(context.Background(), CopyRequest{BackupId: 42, Target: backup.CopyTarget{Vault: vault}})))
+
+	_, err = client.Create(context.Background(), CreateRequest{Vault: vault, Password: "secret"})
+	assert.True(t, IsInvalidRequest(err))
+	_, err = client.Create(context.Background(), CreateRequest{Files: []string{"./client.go"}, Vault: vault, Password: "secret", PartSize: 3 * mib})
+	assert.True(t, IsInvalidRequest(err))
+	_, err = client.Create(context.Background(), CreateRequest{Files: []string{"./client.go"}, Vault: vault, Password: "secret", Backend: "tape"})
+	assert.True(t, IsInvalidRequest(err))
+	assert.True(t, IsInvalidRequest(client.Restore(context.Background(), RestoreRequest{BackupId: 1})))
+}
+
+func TestNew(t *testing.T) {
+	_, err := New()
+	assert.Error(t, err)
+
+	_, err = New(WithDatabase("/does/not/exist/database.db"))
+	assert.Error(t, err)
+
+	client, _, cleanup := newTestClient(t)
+	defer cleanup()
+
+	_, err = New(WithRepository(client.Repository()), WithConcurrency(0))
+	assert.Error(t, err)
+	_, err = New(WithRepository(client.Repository()), WithRetrieval("Fast", time.Minute))
+	assert.Error(t, err)
+	_, err = New(WithRepository(client.Repository()), WithChunkSize(mib+1))
+	assert.Error(t, err)
+	_, err = New(WithRepository(client.Repository()), WithRetryPolicy(backup.RetryPolicy{}))
+	assert.Error(t, err)
+
+	//the repository of the other client is not closed
+	other, err := New(WithRepository(client.Repository()))
+	assert.NoError(t, err)
+	assert.NoError(t, other.Close())
+	assert.Equal(t, int64(0), client.Repository().Count())
+}
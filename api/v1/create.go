@@ -0,0 +1,165 @@
+package api
+
+import (
+	"backup2glacier/backup"
+	"context"
+	"fmt"
+	"regexp"
+)
+
+// Result is the result of a created or resumed backup. The error of the backup is returned separately.
+type Result = backup.BackupResult
+
+// CreateRequest describes a new backup
+type CreateRequest struct {
+	// Files are the files and folders which will be zipped into the backup
+	Files []string
+	// Blacklist excludes all files whose path matches one of the expressions
+	Blacklist []*regexp.Regexp
+	// Whitelist includes only the files whose path matches one of the expressions
+	Whitelist []*regexp.Regexp
+	// Description is the description of the backup. Default: the files and the vault
+	Description string
+	// Vault is the glacier vault, the S3 bucket or the directory (for backup.BackendDirectory) of the backup
+	Vault string
+	// Backend is the type of the storage backend. Default: backup.BackendGlacier
+	Backend string
+	// StorageClass is the storage class of the objects (only for backup.BackendS3). Default: backup.DefaultS3StorageClass
+	StorageClass string
+	// Replicas are further vaults which receive a copy of each volume
+	Replicas []backup.ReplicaTarget
+
+	// Password encrypts the backup
+	Password string
+	// SavePassword stores the password in the catalog, so that the backup can be restored without it
+	SavePassword bool
+
+	// PartSize is the size (in bytes) of the parts of the uploads. It must be one of backup.ValidPartSizes (in MiB).
+	// Default: the smallest part size which is large enough for the estimated size of the largest volume.
+	PartSize int
+	// VolumeSize is the maximum size (in bytes) of a volume. 0 means that the backup has only one volume.
+	VolumeSize int64
+
+	// KeepOnCancel keeps the multipart uploads if the context is cancelled, so that the backup can be continued by
+	// Resume. Otherwise the uploads will be aborted and Resume has to upload the interrupted volumes again.
+	KeepOnCancel bool
+}
+
+// Create zips, encrypts and uploads the files into a new backup. If the context is cancelled, the backup remains
+// incomplete in the catalog and can be continued with Resume. The result is returned even if the backup fails.
+func (c *Client) Create(ctx context.Context, request CreateRequest) (*Result, error) {
+	const op = "create"
+
+	if len(request.Files) == 0 {
+		return nil, invalidRequest(op, "No file given")
+	}
+	if request.Vault == "" {
+		return nil, invalidRequest(op, "No vault given")
+	}
+	if request.Password == "" {
+		return nil, invalidRequest(op, "No password given")
+	}
+	if request.VolumeSize < 0 {
+		return nil, invalidRequest(op, "The volume size must not be negative")
+	}
+	if request.Backend == "" {
+		request.Backend = backup.BackendGlacier
+	}
+	if !backup.IsValidBackend(request.Backend) {
+		return nil, invalidRequest(op, "Unknown backend: %s", request.Backend)
+	}
+	if request.Backend == backup.BackendS3 && request.StorageClass == "" {
+		request.StorageClass = backup.DefaultS3StorageClass
+	}
+	if request.Description == "" {
+		request.Description = fmt.Sprintf("Backup %v to %s", request.Files, request.Vault)
+	}
+
+	partSize, err := choosePartSize(request)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := c.manager(ctx, &request.Password, request.SavePassword, partSize,
+		backup.WithBackend(request.Backend, request.StorageClass),
+		backup.WithReplicas(request.Replicas),
+		backup.WithVolumeSize(request.VolumeSize),
+		backup.WithKeepOnCancel(request.KeepOnCancel))
+	if err != nil {
+		return nil, newError(ctx, op, 0, err)
+	}
+	result := m.Create(request.Files, request.Blacklist, request.Whitelist, request.Description, request.Vault)
+
+	return result, newError(ctx, op, result.BackupId, result.Error)
+}
+
+// ResumeRequest describes an interrupted backup which should be continued
+type ResumeRequest struct {
+	BackupId uint
+	// Password is the password of the backup. If it is empty, the stored password will be used.
+	Password string
+	// PasswordPrompt will be asked for the password if neither a password is given nor stored
+	PasswordPrompt func() string
+	// KeepOnCancel keeps the multipart uploads if the context is cancelled (see CreateRequest.KeepOnCancel)
+	KeepOnCancel bool
+}
+
+// Resume continues an interrupted backup. The sources of the backup are zipped and encrypted again: volumes
+// which are already uploaded will be skipped and interrupted uploads will be continued.
+func (c *Client) Resume(ctx context.Context, request ResumeRequest) (*Result, error) {
+	var password *string
+	if request.Password != "" {
+		password = &request.Password
+	}
+
+	m, err := c.manager(ctx, password, false, 0, backup.WithKeepOnCancel(request.KeepOnCancel))
+	if err != nil {
+		return nil, newError(ctx, "resume", request.BackupId, err)
+	}
+	result := m.Resume(request.BackupId, passwordPrompt(request.PasswordPrompt))
+
+	return result, newError(ctx, "resume", request.BackupId, result.Error)
+}
+
+// choosePartSize returns the part size of the request or chooses one for the estimated size of the largest volume
+func choosePartSize(request CreateRequest) (int, error) {
+	partSize := request.PartSize
+	if partSize == 0 {
+		estimation := backup.EstimateZip(request.Files, request.Blacklist, request.Whitelist)
+		mib, err := backup.ChoosePartSize(estimation.ArchiveSize(request.VolumeSize), backup.PartSizeSafetyMargin)
+		if err != nil {
+			return 0, &Error{Op: "create", Err: err}
+		}
+		partSize = mib * 1024 * 1024
+	} else if !isValidPartSize(partSize) && (request.Backend != backup.BackendS3 || partSize != backup.S3MinPartSize) {
+		return 0, invalidRequest("create", "The part size is not valid. Valid sizes (in MiB) are: %v", backup.ValidPartSizes)
+	}
+
+	if request.Backend == backup.BackendS3 && partSize < backup.S3MinPartSize {
+		partSize = backup.S3MinPartSize
+	}
+	if maxVolumeSize := int64(partSize) * backup.MaxPartsPerUpload; request.VolumeSize > maxVolumeSize {
+		return 0, invalidRequest("create", "The volume size is too large for the part size. It can not be larger than %d bytes.", maxVolumeSize)
+	}
+
+	return partSize, nil
+}
+
+func isValidPartSize(partSize int) bool {
+	for _, valid := range backup.ValidPartSizes {
+		if valid*1024*1024 == partSize {
+			return true
+		}
+	}
+
+	return false
+}
+
+// passwordPrompt returns the given prompt or one which returns an empty password (so that the decryption fails)
+func passwordPrompt(prompt func() string) func() string {
+	if prompt == nil {
+		return func() string { return "" }
+	}
+
+	return prompt
+}
@@ -0,0 +1,25 @@
+// Package api is the public library interface of backup2glacier. It allows to embed the creation, restoration and
+// management of backups into other Go programs:
+//
+//	client, err := api.New(api.WithDatabase("/var/lib/backups.db"), api.WithConcurrency(4))
+//	if err != nil {
+//		return err
+//	}
+//	defer client.Close()
+//
+//	result, err := client.Create(ctx, api.CreateRequest{
+//		Files:    []string{"/home/user/documents"},
+//		Vault:    "my-vault",
+//		Password: "secret",
+//	})
+//
+// All operations take a context. If it is cancelled, the running uploads, downloads and retrieval jobs will be
+// stopped and the operation returns an error for which IsCancelled is true. An interrupted backup can be continued
+// with Resume, an interrupted restore by calling Restore again.
+//
+// The package follows semantic versioning: its import path contains the major version, which will be increased
+// for incompatible changes only.
+package api
+
+// Version is the version of the library interface
+const Version = "1.0.0"
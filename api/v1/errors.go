@@ -0,0 +1,102 @@
+package api
+
+import (
+	"backup2glacier/backup"
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+)
+
+// ErrBackupNotFound will be returned if the catalog does not contain the requested backup
+var ErrBackupNotFound = backup.ErrBackupNotFound
+
+// ErrInvalidRequest is the cause of all errors which are returned for incomplete or invalid requests
+var ErrInvalidRequest = errors.New("Invalid request")
+
+// Error is the error of an operation of the client. Its cause is one of the errors of this package, the error of
+// the context or the error of the storage backend.
+type Error struct {
+	// Op is the name of the operation, for example create, restore, sync or delete vault
+	Op string
+	// BackupId is the id of the backup (if it is known)
+	BackupId uint
+	Err      error
+	// Cancelled is the error of the context if the operation failed after its context was cancelled or has
+	// expired. Err is then usually only a consequence of the cancellation.
+	Cancelled error
+}
+
+func (e *Error) Error() string {
+	err := e.Err.Error()
+	if e.Cancelled != nil {
+		err = fmt.Sprintf("%v: %s", e.Cancelled, err)
+	}
+	if e.BackupId == 0 {
+		return fmt.Sprintf("%s: %s", e.Op, err)
+	}
+
+	return fmt.Sprintf("%s backup %d: %s", e.Op, e.BackupId, err)
+}
+
+// Cause returns the underlying error (see github.com/pkg/errors)
+func (e *Error) Cause() error {
+	return e.Err
+}
+
+// Unwrap returns the underlying error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// IsCancelled returns true if the operation was stopped because its context was cancelled or has expired
+func IsCancelled(err error) bool {
+	type causer interface {
+		Cause() error
+	}
+
+	for err != nil {
+		if err == context.Canceled || err == context.DeadlineExceeded {
+			return true
+		}
+		if apiErr, ok := err.(*Error); ok && apiErr.Cancelled != nil {
+			return true
+		}
+		cause, ok := err.(causer)
+		if !ok {
+			return false
+		}
+		err = cause.Cause()
+	}
+
+	return false
+}
+
+// IsNotFound returns true if the backup of the operation does not exist
+func IsNotFound(err error) bool {
+	return errors.Cause(err) == ErrBackupNotFound
+}
+
+// IsInvalidRequest returns true if the operation was refused because of its request
+func IsInvalidRequest(err error) bool {
+	return errors.Cause(err) == ErrInvalidRequest
+}
+
+// newError returns the error of the given operation or nil if there is none. If the context is done, the error
+// of the context is kept besides the error of the operation, because that is usually only a consequence of the
+// cancellation.
+func newError(ctx context.Context, op string, backupId uint, err error) error {
+	if err == nil {
+		return nil
+	}
+	result := &Error{Op: op, BackupId: backupId, Err: err}
+	if ctxErr := ctx.Err(); ctxErr != nil && !IsCancelled(err) {
+		result.Cancelled = ctxErr
+	}
+
+	return result
+}
+
+// invalidRequest returns the error for an invalid request
+func invalidRequest(op string, format string, args ...interface{}) error {
+	return &Error{Op: op, Err: errors.Wrapf(ErrInvalidRequest, format, args...)}
+}
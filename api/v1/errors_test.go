@@ -0,0 +1,33 @@
+package api
+
+import (
+	"backup2glacier/backup"
+	"context"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestNewError(t *testing.T) {
+	assert.Nil(t, newError(context.Background(), "create", 1, nil))
+
+	//the cause of a running operation is kept
+	err := newError(context.Background(), "restore", 1, errors.Wrap(backup.ErrBackupNotFound, "load"))
+	assert.True(t, IsNotFound(err))
+	assert.False(t, IsCancelled(err))
+	assert.Equal(t, "restore backup 1: load: Backup not found", err.Error())
+
+	//the cause of a cancelled operation is kept besides the error of the context
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = newError(ctx, "restore", 1, errors.Wrap(backup.ErrBackupNotFound, "load"))
+	assert.True(t, IsNotFound(err))
+	assert.True(t, IsCancelled(err))
+	assert.True(t, IsCancelled(errors.Wrap(err, "sync")))
+	assert.Equal(t, "restore backup 1: context canceled: load: Backup not found", err.Error())
+
+	//the error of the context is not repeated
+	err = newError(ctx, "create", 0, errors.Wrap(context.Canceled, "upload"))
+	assert.True(t, IsCancelled(err))
+	assert.Equal(t, "create: upload: context canceled", err.Error())
+}
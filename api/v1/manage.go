@@ -0,0 +1,87 @@
+package api
+
+import (
+	"backup2glacier/backup"
+	"backup2glacier/database/model"
+	"context"
+	"time"
+)
+
+// Delete deletes the archives of all volumes (and replicas) of the backup and removes it from the catalog
+func (c *Client) Delete(ctx context.Context, backupId uint) error {
+	if err := ctx.Err(); err != nil {
+		return newError(ctx, "delete", backupId, err)
+	}
+
+	m, err := c.manager(ctx, nil, false, 0)
+	if err != nil {
+		return newError(ctx, "delete", backupId, err)
+	}
+
+	err = m.Delete(backupId)
+	return newError(ctx, "delete", backupId, err)
+}
+
+// CopyRequest describes the copy of a backup into another vault, region or backend
+type CopyRequest struct {
+	BackupId uint
+	// Target is the vault into which the backup will be copied. Empty values stand for the backend of the backup
+	// and the default location.
+	Target backup.CopyTarget
+	// StorageClass is the storage class of the copies (only for backup.BackendS3). Default: backup.DefaultS3StorageClass
+	StorageClass string
+	// DeleteSource deletes the original archives after the copy. The copies become the location of the backup.
+	DeleteSource bool
+}
+
+// Copy retrieves the encrypted archives of the backup and uploads them unchanged into the target. The copies are
+// attached to the backup as replicas. Volumes which are already copied by an interrupted call will be skipped.
+func (c *Client) Copy(ctx context.Context, request CopyRequest) error {
+	if request.BackupId == 0 {
+		return invalidRequest("copy", "No backup id given")
+	}
+	if request.Target.Vault == "" {
+		return invalidRequest("copy", "No target given")
+	}
+	if request.Target.Backend != "" && !backup.IsValidBackend(request.Target.Backend) {
+		return invalidRequest("copy", "Unknown backend: %s", request.Target.Backend)
+	}
+	if request.StorageClass == "" {
+		request.StorageClass = backup.DefaultS3StorageClass
+	}
+
+	m, err := c.manager(ctx, nil, false, 0, backup.WithBackend(backup.BackendGlacier, request.StorageClass))
+	if err != nil {
+		return newError(ctx, "copy", request.BackupId, err)
+	}
+	err = m.Copy(request.BackupId, request.Target, request.DeleteSource)
+
+	return newError(ctx, "copy", request.BackupId, err)
+}
+
+// CleanupRequest describes which backups are regarded as interrupted and what happens with them
+type CleanupRequest struct {
+	// OlderThan is the time after the last heartbeat of a pending or uploading backup, after which it is regarded
+	// as interrupted
+	OlderThan time.Duration
+	// Delete deletes the interrupted backups. Otherwise they are marked as failed, so that they can be resumed.
+	Delete bool
+	// DryRun only returns the interrupted backups without changing them
+	DryRun bool
+}
+
+// Cleanup handles the backups whose runs were interrupted (for example by a crash). They would remain pending or
+// uploading forever. The interrupted backups are returned.
+func (c *Client) Cleanup(ctx context.Context, request CleanupRequest) ([]*model.Backup, error) {
+	if request.OlderThan <= 0 {
+		return nil, invalidRequest("cleanup", "The age of interrupted backups must be positive")
+	}
+
+	m, err := c.manager(ctx, nil, false, 0)
+	if err != nil {
+		return nil, newError(ctx, "cleanup", 0, err)
+	}
+
+	stale, err := m.Cleanup(time.Now().Add(-request.OlderThan), request.Delete, request.DryRun)
+	return stale, newError(ctx, "cleanup", 0, err)
+}
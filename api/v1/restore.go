@@ -0,0 +1,99 @@
+package api
+
+import (
+	"backup2glacier/database/model"
+	"context"
+)
+
+// RestoreRequest describes the backup (or the volume of a backup) which should be restored
+type RestoreRequest struct {
+	BackupId uint
+	// Volume is the number of the volume which should be restored. 0 stands for all volumes.
+	Volume int
+	// Target is the file for the zip of the backup. If more than one volume is restored, each volume will be
+	// written into its own file (<target>.<volume number>).
+	Target string
+	// Password is the password of the backup. If it is empty, the stored password will be used.
+	Password string
+	// PasswordPrompt will be asked for the password if neither a password is given nor stored
+	PasswordPrompt func() string
+}
+
+// Restore retrieves, downloads and decrypts the volumes of the backup into the target. It blocks until the
+// retrieval jobs are completed, which can take several hours. An interrupted download will be continued by the
+// next call with the same target.
+func (c *Client) Restore(ctx context.Context, request RestoreRequest) error {
+	if err := validateRestore("restore", request); err != nil {
+		return err
+	}
+
+	m, err := c.manager(ctx, restorePassword(request), false, 0)
+	if err != nil {
+		return newError(ctx, "restore", request.BackupId, err)
+	}
+	err = m.Download(request.BackupId, request.Volume, request.Target, passwordPrompt(request.PasswordPrompt))
+
+	return newError(ctx, "restore", request.BackupId, err)
+}
+
+// RequestRestore initiates the retrieval jobs for the volumes of the backup without waiting for their completion.
+// The jobs are saved in the catalog, so that they can be downloaded by FetchRestores when they are ready.
+func (c *Client) RequestRestore(ctx context.Context, request RestoreRequest) ([]*model.Job, error) {
+	if err := validateRestore("request", request); err != nil {
+		return nil, err
+	}
+
+	m, err := c.manager(ctx, nil, false, 0)
+	if err != nil {
+		return nil, newError(ctx, "request", request.BackupId, err)
+	}
+	jobs, err := m.RequestDownload(request.BackupId, request.Volume, request.Target)
+
+	return jobs, newError(ctx, "request", request.BackupId, err)
+}
+
+// FetchRestores downloads the volumes of all ready retrieval jobs (of the given backup or of all backups if the id
+// is 0) into the targets of their requests. The prompt will be asked for the password of each backup which has
+// no stored password.
+func (c *Client) FetchRestores(ctx context.Context, backupId uint, prompt func() string) error {
+	m, err := c.manager(ctx, nil, false, 0)
+	if err != nil {
+		return newError(ctx, "fetch", backupId, err)
+	}
+	err = m.FetchDownloads(backupId, passwordPrompt(prompt))
+
+	return newError(ctx, "fetch", backupId, err)
+}
+
+// Jobs updates the status of all open retrieval jobs (of the given backup or of all backups if the id is 0) and
+// returns all jobs
+func (c *Client) Jobs(ctx context.Context, backupId uint) ([]*model.Job, error) {
+	m, err := c.manager(ctx, nil, false, 0)
+	if err != nil {
+		return nil, newError(ctx, "jobs", backupId, err)
+	}
+
+	return m.RefreshJobs(backupId), nil
+}
+
+func validateRestore(op string, request RestoreRequest) error {
+	if request.BackupId == 0 {
+		return invalidRequest(op, "No backup id given")
+	}
+	if request.Target == "" {
+		return invalidRequest(op, "No target given")
+	}
+	if request.Volume < 0 {
+		return invalidRequest(op, "Invalid volume: %d", request.Volume)
+	}
+
+	return nil
+}
+
+func restorePassword(request RestoreRequest) *string {
+	if request.Password == "" {
+		return nil
+	}
+
+	return &request.Password
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"backup2glacier/backup"
+	"context"
+	"os"
+)
+
+// CatalogBackupRequest describes the vault which receives the snapshots of the catalog
+type CatalogBackupRequest struct {
+	Vault string
+	// Password encrypts the snapshots. It should differ from the passwords of the backups.
+	Password string
+	// Keep is the number of the newest snapshots which are kept. The older ones will be deleted.
+	Keep int
+}
+
+// BootstrapRequest describes the snapshot from which a lost catalog is restored
+type BootstrapRequest struct {
+	// Vault contains the snapshots of the catalog
+	Vault    string
+	Password string
+	// Target is the database file of the restored catalog
+	Target string
+	// Overwrite replaces an existing target. Otherwise Bootstrap refuses to restore into it.
+	Overwrite bool
+}
+
+// BackupCatalog uploads an encrypted snapshot of the catalog into the vault and deletes the snapshots which exceed
+// the number of snapshots to keep. The client must be created with WithDatabase, because the snapshot is taken
+// from the database file.
+func (c *Client) BackupCatalog(ctx context.Context, request CatalogBackupRequest) error {
+	const op = "catalog backup"
+
+	if c.dbFile == "" {
+		return invalidRequest(op, "The database file is unknown. Use WithDatabase.")
+	}
+	if request.Vault == "" {
+		return invalidRequest(op, "No vault given")
+	}
+	if request.Password == "" {
+		return invalidRequest(op, "No password given")
+	}
+	if request.Keep < 1 {
+		return invalidRequest(op, "At least one snapshot must be kept")
+	}
+	if err := ctx.Err(); err != nil {
+		return newError(ctx, op, 0, err)
+	}
+
+	//the backuper must not be closed, because the repository belongs to the client
+	b, err := backup.NewCatalogBackuperForRepository(request.Vault, request.Password, request.Keep, c.storageSettings, c.dbFile, c.repository)
+	if err == nil {
+		err = b.Backup()
+	}
+
+	return newError(ctx, op, 0, err)
+}
+
+// Bootstrap restores the newest snapshot of the catalog from the vault into the target. It blocks until the
+// retrieval of the inventory and of the snapshot are completed, which can take several hours. Only the options
+// of the retrieval and of AWS are used: the catalog is given by the request.
+func Bootstrap(ctx context.Context, request BootstrapRequest, opts ...Option) error {
+	const op = "bootstrap"
+
+	if request.Vault == "" {
+		return invalidRequest(op, "No vault given")
+	}
+	if request.Password == "" {
+		return invalidRequest(op, "No password given")
+	}
+	if request.Target == "" {
+		return invalidRequest(op, "No target given")
+	}
+	if _, err := os.Stat(request.Target); err == nil && !request.Overwrite {
+		return invalidRequest(op, "The target %s already exists", request.Target)
+	}
+
+	c, err := newClient(opts...)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if err := ctx.Err(); err != nil {
+		return newError(ctx, op, 0, err)
+	}
+
+	r, err := backup.NewCatalogRestorer(c.tier, c.pollInterval, c.storageSettings)
+	if err == nil {
+		err = r.Restore(request.Vault, request.Password, request.Target)
+	}
+
+	return newError(ctx, op, 0, err)
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"backup2glacier/backup"
+	"backup2glacier/database/model"
+	"context"
+)
+
+// SyncReport contains the differences between the catalog and the inventory of a vault
+type SyncReport = backup.SyncReport
+
+// SyncMissing is a volume of the catalog whose archive is missing in the vault
+type SyncMissing = backup.SyncMissing
+
+// RecoverReport contains the backups which are recovered from the archive descriptions of a vault
+type RecoverReport = backup.RecoverReport
+
+// SyncRequest describes the vault which will be compared with the catalog
+type SyncRequest struct {
+	Vault string
+	// Cached uses the last cached inventory. Otherwise a new inventory will be retrieved, which can take several hours.
+	Cached bool
+}
+
+// RecoverRequest describes the vault whose archives will be recovered into the catalog
+type RecoverRequest struct {
+	Vault string
+	// Cached uses the last cached inventory. Otherwise a new inventory will be retrieved, which can take several hours.
+	Cached bool
+	// DryRun only returns the backups which can be recovered without saving them
+	DryRun bool
+}
+
+// Sync compares the catalog with the inventory of the vault. The differences can be resolved by Adopt and Prune.
+func (c *Client) Sync(ctx context.Context, request SyncRequest) (*SyncReport, error) {
+	const op = "sync"
+
+	if request.Vault == "" {
+		return nil, invalidRequest(op, "No vault given")
+	}
+	syncer, err := c.syncer(ctx)
+	if err != nil {
+		return nil, newError(ctx, op, 0, err)
+	}
+
+	report, err := syncer.Sync(request.Vault, request.Cached)
+	return report, newError(ctx, op, 0, err)
+}
+
+// Adopt creates a backup in the catalog for the given unknown archive of the vault
+func (c *Client) Adopt(ctx context.Context, vault string, archive model.InventoryArchive) (*model.Backup, error) {
+	syncer, err := c.syncer(ctx)
+	if err != nil {
+		return nil, newError(ctx, "adopt", 0, err)
+	}
+
+	return syncer.Adopt(vault, archive), nil
+}
+
+// Prune removes the given missing volume from the catalog
+func (c *Client) Prune(ctx context.Context, missing SyncMissing) error {
+	syncer, err := c.syncer(ctx)
+	if err != nil {
+		return newError(ctx, "prune", missing.Backup.ID, err)
+	}
+
+	syncer.Prune(missing)
+	return nil
+}
+
+// RecoverCatalog creates backups in the catalog for all archives of the vault which contain metadata in their
+// description but are not in the catalog yet
+func (c *Client) RecoverCatalog(ctx context.Context, request RecoverRequest) (*RecoverReport, error) {
+	const op = "recover"
+
+	if request.Vault == "" {
+		return nil, invalidRequest(op, "No vault given")
+	}
+	recoverer, err := c.recoverer(ctx)
+	if err != nil {
+		return nil, newError(ctx, op, 0, err)
+	}
+
+	report, err := recoverer.Recover(request.Vault, request.Cached, request.DryRun)
+	return report, newError(ctx, op, 0, err)
+}
+
+// RecoverContents retrieves the manifests of the volumes of the recovered backup and saves their files into the
+// catalog. This needs one retrieval job per volume.
+func (c *Client) RecoverContents(ctx context.Context, dbBackup *model.Backup, password string) error {
+	const op = "recover"
+
+	if password == "" {
+		return invalidRequest(op, "No password given")
+	}
+	recoverer, err := c.recoverer(ctx)
+	if err != nil {
+		return newError(ctx, op, dbBackup.ID, err)
+	}
+
+	err = recoverer.RecoverContents(dbBackup, password)
+	return newError(ctx, op, dbBackup.ID, err)
+}
+
+// syncer creates the vault syncer for one operation. It must not be closed, because the repository belongs to
+// the client.
+func (c *Client) syncer(ctx context.Context) (backup.VaultSyncer, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return backup.NewVaultSyncerForRepository(c.pollInterval, c.storageSettings, c.repository)
+}
+
+// recoverer creates the catalog recoverer for one operation. It must not be closed, because the repository
+// belongs to the client.
+func (c *Client) recoverer(ctx context.Context) (backup.CatalogRecoverer, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return backup.NewCatalogRecovererForRepository(c.pollInterval, c.tier, c.storageSettings, c.repository)
+}
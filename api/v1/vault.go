@@ -0,0 +1,179 @@
+package api
+
+import (
+	"backup2glacier/backup"
+	"backup2glacier/database/model"
+	"context"
+)
+
+// VaultInfo is the description of a glacier vault together with the number of its backups in the catalog
+type VaultInfo = backup.VaultInfo
+
+// VaultNotifications is the notification configuration of a glacier vault
+type VaultNotifications = backup.AWSGlacierNotifications
+
+// CreateVault creates the glacier vault
+func (c *Client) CreateVault(ctx context.Context, vaultName string) error {
+	return c.vault(ctx, "create vault", vaultName, func(v backup.VaultManager) error {
+		return v.Create(vaultName)
+	})
+}
+
+// EnsureVault creates the glacier vault if it does not exist yet
+func (c *Client) EnsureVault(ctx context.Context, vaultName string) error {
+	return c.vault(ctx, "create vault", vaultName, func(v backup.VaultManager) error {
+		return v.EnsureVault(vaultName)
+	})
+}
+
+// ListVaults returns all glacier vaults of the location of the client (see WithLocation)
+func (c *Client) ListVaults(ctx context.Context) (vaults []*VaultInfo, err error) {
+	err = c.vaults(ctx, "list vaults", func(v backup.VaultManager) (err error) {
+		vaults, err = v.List()
+		return err
+	})
+	return vaults, err
+}
+
+// DescribeVault returns the description of the glacier vault
+func (c *Client) DescribeVault(ctx context.Context, vaultName string) (vault *VaultInfo, err error) {
+	err = c.vault(ctx, "describe vault", vaultName, func(v backup.VaultManager) (err error) {
+		vault, err = v.Describe(vaultName)
+		return err
+	})
+	return vault, err
+}
+
+// DeleteVault deletes the glacier vault. It refuses if the catalog has live backups in the vault.
+func (c *Client) DeleteVault(ctx context.Context, vaultName string) error {
+	return c.vault(ctx, "delete vault", vaultName, func(v backup.VaultManager) error {
+		return v.Delete(vaultName)
+	})
+}
+
+// VaultTags returns the tags of the glacier vault
+func (c *Client) VaultTags(ctx context.Context, vaultName string) (tags map[string]string, err error) {
+	err = c.vault(ctx, "vault tags", vaultName, func(v backup.VaultManager) (err error) {
+		tags, err = v.Tags(vaultName)
+		return err
+	})
+	return tags, err
+}
+
+// TagVault adds (or overwrites) the given tags of the glacier vault
+func (c *Client) TagVault(ctx context.Context, vaultName string, tags map[string]string) error {
+	return c.vault(ctx, "tag vault", vaultName, func(v backup.VaultManager) error {
+		return v.Tag(vaultName, tags)
+	})
+}
+
+// UntagVault removes the tags with the given keys from the glacier vault
+func (c *Client) UntagVault(ctx context.Context, vaultName string, keys []string) error {
+	return c.vault(ctx, "untag vault", vaultName, func(v backup.VaultManager) error {
+		return v.Untag(vaultName, keys)
+	})
+}
+
+// VaultPolicy returns the access policy of the glacier vault or an empty string if there is none
+func (c *Client) VaultPolicy(ctx context.Context, vaultName string) (policy string, err error) {
+	err = c.vault(ctx, "vault policy", vaultName, func(v backup.VaultManager) (err error) {
+		policy, err = v.Policy(vaultName)
+		return err
+	})
+	return policy, err
+}
+
+// SetVaultPolicy sets the (JSON) access policy of the glacier vault
+func (c *Client) SetVaultPolicy(ctx context.Context, vaultName, policy string) error {
+	return c.vault(ctx, "set vault policy", vaultName, func(v backup.VaultManager) error {
+		return v.SetPolicy(vaultName, policy)
+	})
+}
+
+// DeleteVaultPolicy removes the access policy from the glacier vault
+func (c *Client) DeleteVaultPolicy(ctx context.Context, vaultName string) error {
+	return c.vault(ctx, "delete vault policy", vaultName, func(v backup.VaultManager) error {
+		return v.DeletePolicy(vaultName)
+	})
+}
+
+// VaultNotifications returns the notification configuration of the glacier vault or nil if there is none
+func (c *Client) VaultNotifications(ctx context.Context, vaultName string) (notifications *VaultNotifications, err error) {
+	err = c.vault(ctx, "vault notifications", vaultName, func(v backup.VaultManager) (err error) {
+		notifications, err = v.Notifications(vaultName)
+		return err
+	})
+	return notifications, err
+}
+
+// SetVaultNotifications sets the notification configuration of the glacier vault
+func (c *Client) SetVaultNotifications(ctx context.Context, vaultName string, notifications VaultNotifications) error {
+	return c.vault(ctx, "set vault notifications", vaultName, func(v backup.VaultManager) error {
+		return v.SetNotifications(vaultName, notifications)
+	})
+}
+
+// DeleteVaultNotifications removes the notification configuration from the glacier vault
+func (c *Client) DeleteVaultNotifications(ctx context.Context, vaultName string) error {
+	return c.vault(ctx, "delete vault notifications", vaultName, func(v backup.VaultManager) error {
+		return v.DeleteNotifications(vaultName)
+	})
+}
+
+// InitiateVaultLock installs the lock policy in the glacier vault. The lock must be completed within 24 hours.
+func (c *Client) InitiateVaultLock(ctx context.Context, vaultName, policy string) (lock *model.VaultLock, err error) {
+	err = c.vault(ctx, "initiate vault lock", vaultName, func(v backup.VaultManager) (err error) {
+		lock, err = v.InitiateLock(vaultName, policy)
+		return err
+	})
+	return lock, err
+}
+
+// VaultLockStatus returns the lock of the glacier vault or nil if there is none
+func (c *Client) VaultLockStatus(ctx context.Context, vaultName string) (lock *model.VaultLock, err error) {
+	err = c.vault(ctx, "vault lock status", vaultName, func(v backup.VaultManager) (err error) {
+		lock, err = v.LockStatus(vaultName)
+		return err
+	})
+	return lock, err
+}
+
+// CompleteVaultLock completes the initiated lock. After that the lock policy can not be changed anymore!
+func (c *Client) CompleteVaultLock(ctx context.Context, vaultName string) (lock *model.VaultLock, err error) {
+	err = c.vault(ctx, "complete vault lock", vaultName, func(v backup.VaultManager) (err error) {
+		lock, err = v.CompleteLock(vaultName)
+		return err
+	})
+	return lock, err
+}
+
+// AbortVaultLock aborts the initiated lock and removes the lock policy from the glacier vault
+func (c *Client) AbortVaultLock(ctx context.Context, vaultName string) error {
+	return c.vault(ctx, "abort vault lock", vaultName, func(v backup.VaultManager) error {
+		return v.AbortLock(vaultName)
+	})
+}
+
+// vault runs the given operation on the vault with the given name (see vaults)
+func (c *Client) vault(ctx context.Context, op, vaultName string, fn func(backup.VaultManager) error) error {
+	if vaultName == "" {
+		return invalidRequest(op, "No vault given")
+	}
+
+	return c.vaults(ctx, op, fn)
+}
+
+// vaults runs the given vault operation with a vault manager for the catalog of the client. The manager must not
+// be closed, because the repository belongs to the client.
+func (c *Client) vaults(ctx context.Context, op string, fn func(backup.VaultManager) error) error {
+	if err := ctx.Err(); err != nil {
+		return newError(ctx, op, 0, err)
+	}
+
+	v, err := backup.NewVaultManagerForRepository(c.storageSettings, c.repository)
+	if err == nil {
+		err = fn(v)
+	}
+
+	return newError(ctx, op, 0, err)
+}
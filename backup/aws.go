@@ -0,0 +1,129 @@
+package backup
+
+import (
+	"backup2glacier/database/model"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/pkg/errors"
+)
+
+// DefaultAccountId stands for the account of the credentials
+const DefaultAccountId = "-"
+
+// DefaultRoleSessionName is the name of the session of an assumed role if no one is given
+const DefaultRoleSessionName = "backup2glacier"
+
+// AWSLocation is the region and the account in which the vaults (or buckets) are located. Empty values stand for
+// the region of the AWS configuration and the account of the credentials.
+type AWSLocation struct {
+	Region    string
+	AccountId string
+}
+
+// AssumeRole is the role which should be assumed for the AWS requests. An empty role ARN means that the
+// credentials are used directly.
+type AssumeRole struct {
+	RoleARN     string
+	ExternalId  string
+	SessionName string
+}
+
+// callerAccountId returns the account of the credentials. It can be replaced by the tests.
+var callerAccountId = func(location AWSLocation, role AssumeRole) (string, error) {
+	s, config, err := newAWSSession(location, role)
+	if err != nil {
+		return "", err
+	}
+
+	result, err := sts.New(s, config).GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", err
+	}
+
+	return aws.StringValue(result.Account), nil
+}
+
+// ResolveLocation returns the location for new backups. An empty region will be resolved by the AWS configuration
+// and an empty account by the ARN of the role (if any) or by the caller identity of the credentials
+// (sts:GetCallerIdentity). The location is stored with the backup, so that the backup can be found later even if
+// the settings are changed.
+func (s *StorageSettings) ResolveLocation() (AWSLocation, error) {
+	location := s.Location
+
+	if location.Region == "" {
+		if awsSession, err := session.NewSession(); err == nil {
+			location.Region = aws.StringValue(awsSession.Config.Region)
+		}
+	}
+	if location.AccountId == "" || location.AccountId == DefaultAccountId {
+		if roleARN, err := arn.Parse(s.AssumeRole.RoleARN); err == nil {
+			location.AccountId = roleARN.AccountID
+			return location, nil
+		}
+
+		s.accountMutex.Lock()
+		defer s.accountMutex.Unlock()
+		if s.accountId == "" {
+			accountId, err := callerAccountId(location, s.AssumeRole)
+			if err != nil {
+				return location, errors.Wrap(err, "Could not resolve the AWS account of the credentials. Please give the account id")
+			}
+			s.accountId = accountId
+		}
+		location.AccountId = s.accountId
+	}
+
+	return location, nil
+}
+
+// locationOf returns the location of the given backup. Backups which are created before the location is stored
+// have an empty location and backups which are created before the account is resolved have DefaultAccountId:
+// both stand for the given default location, which is resolved by StorageSettings.ResolveLocation.
+func locationOf(dbBackup *model.Backup, defaults AWSLocation) AWSLocation {
+	return AWSLocation{Region: dbBackup.Region, AccountId: dbBackup.AccountId}.withDefaults(defaults)
+}
+
+// withDefaults returns the location in which an empty region and an empty account or DefaultAccountId are replaced
+// by the given defaults.
+func (l AWSLocation) withDefaults(defaults AWSLocation) AWSLocation {
+	if l.Region == "" {
+		l.Region = defaults.Region
+	}
+	if l.AccountId == "" || l.AccountId == DefaultAccountId {
+		l.AccountId = defaults.AccountId
+	}
+
+	return l
+}
+
+// newAWSSession creates a session for the given location and the configuration for the clients. If a role is
+// given, the clients will use its temporary credentials. The retries are done by our own retryer.
+func newAWSSession(location AWSLocation, role AssumeRole) (*session.Session, *aws.Config, error) {
+	sessionConfig := aws.NewConfig()
+	if location.Region != "" {
+		sessionConfig = sessionConfig.WithRegion(location.Region)
+	}
+
+	s, err := session.NewSession(sessionConfig)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Error while create new AWS session")
+	}
+
+	config := aws.NewConfig().WithMaxRetries(0)
+	if role.RoleARN != "" {
+		config = config.WithCredentials(stscreds.NewCredentials(s, role.RoleARN, func(p *stscreds.AssumeRoleProvider) {
+			p.RoleSessionName = role.SessionName
+			if p.RoleSessionName == "" {
+				p.RoleSessionName = DefaultRoleSessionName
+			}
+			if role.ExternalId != "" {
+				p.ExternalID = aws.String(role.ExternalId)
+			}
+		}))
+	}
+
+	return s, config, nil
+}
@@ -0,0 +1,88 @@
+package backup
+
+import (
+	"backup2glacier/database/model"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestStorageSettings_ResolveLocation(t *testing.T) {
+	//the account of the credentials is resolved once per settings
+	calls := 0
+	defer func(previous func(AWSLocation, AssumeRole) (string, error)) { callerAccountId = previous }(callerAccountId)
+	callerAccountId = func(AWSLocation, AssumeRole) (string, error) {
+		calls++
+		return "111111111111", nil
+	}
+	settings := NewStorageSettings()
+
+	for _, accountId := range []string{"", DefaultAccountId} {
+		settings.Location = AWSLocation{Region: "eu-west-1", AccountId: accountId}
+		location, err := settings.ResolveLocation()
+		assert.NoError(t, err)
+		assert.Equal(t, AWSLocation{Region: "eu-west-1", AccountId: "111111111111"}, location)
+	}
+	assert.Equal(t, 1, calls)
+
+	//the account of the assumed role
+	withRole := NewStorageSettings()
+	withRole.Location = AWSLocation{Region: "eu-west-1"}
+	withRole.AssumeRole = AssumeRole{RoleARN: "arn:aws:iam::123456789012:role/backup"}
+	location, err := withRole.ResolveLocation()
+	assert.NoError(t, err)
+	assert.Equal(t, AWSLocation{Region: "eu-west-1", AccountId: "123456789012"}, location)
+
+	//an explicit account wins
+	withRole.Location = AWSLocation{Region: "eu-west-1", AccountId: "210987654321"}
+	location, err = withRole.ResolveLocation()
+	assert.NoError(t, err)
+	assert.Equal(t, AWSLocation{Region: "eu-west-1", AccountId: "210987654321"}, location)
+	assert.Equal(t, 1, calls)
+
+	//the account must not stay unknown
+	callerAccountId = func(AWSLocation, AssumeRole) (string, error) {
+		return "", errors.New("no credentials")
+	}
+	other := NewStorageSettings()
+	other.Location = AWSLocation{Region: "eu-west-1"}
+	_, err = other.ResolveLocation()
+	assert.Error(t, err)
+}
+
+func TestIsGlacierBackup(t *testing.T) {
+	location := AWSLocation{Region: "eu-west-1", AccountId: "123456789012"}
+
+	//backups without (resolved) location are located in the default location
+	assert.True(t, isGlacierBackup(&model.Backup{}, location))
+	assert.True(t, isGlacierBackup(&model.Backup{Region: "eu-west-1", AccountId: DefaultAccountId}, location))
+	assert.False(t, isGlacierBackup(&model.Backup{Region: "us-east-1", AccountId: DefaultAccountId}, location))
+	assert.True(t, isGlacierBackup(&model.Backup{Backend: BackendGlacier, Region: "eu-west-1", AccountId: "123456789012"}, location))
+	assert.False(t, isGlacierBackup(&model.Backup{Backend: BackendS3}, location))
+	assert.False(t, isGlacierBackup(&model.Backup{Region: "us-east-1"}, location))
+	assert.False(t, isGlacierBackup(&model.Backup{AccountId: "210987654321"}, location))
+}
+
+func TestBackupManager_storage(t *testing.T) {
+	manager, fake, _, cleanup := newRestoreTestManager(t)
+	defer cleanup()
+	manager.storageSettings.Location = AWSLocation{Region: "eu-west-1", AccountId: "123456789012"}
+	var locations []AWSLocation
+	manager.storageFactory = func(_ string, location AWSLocation) (StorageBackend, error) {
+		locations = append(locations, location)
+		return fake, nil
+	}
+
+	//backups without (resolved) account share the backend of the given account
+	for _, accountId := range []string{"", DefaultAccountId, "123456789012"} {
+		storage, err := manager.storage(BackendGlacier, "eu-west-1", accountId)
+		assert.NoError(t, err)
+		assert.Equal(t, fake, storage)
+	}
+	assert.Equal(t, []AWSLocation{{Region: "eu-west-1", AccountId: "123456789012"}}, locations)
+
+	//other accounts have their own backend
+	_, err := manager.storage(BackendGlacier, "eu-west-1", "210987654321")
+	assert.NoError(t, err)
+	assert.Equal(t, AWSLocation{Region: "eu-west-1", AccountId: "210987654321"}, locations[len(locations)-1])
+}
@@ -0,0 +1,194 @@
+package backup
+
+import (
+	. "backup2glacier/log"
+	"io"
+	"sync"
+	"time"
+)
+
+// MaxUploadPause is the longest time an upload will be suspended between two time windows. Glacier aborts
+// multipart uploads which are inactive for too long. So after this time one part will be uploaded anyway.
+const MaxUploadPause = 12 * time.Hour
+
+// limitedChunkSize is the maximum number of bytes which will be read at once through a limited reader
+const limitedChunkSize = 32 * 1024
+
+// BandwidthWindow is a daily time window with its own bandwidth limit
+type BandwidthWindow struct {
+	// From is the start of the window (offset since midnight)
+	From time.Duration
+	// To is the end (exclusive) of the window (offset since midnight). If it is before From, the
+	// window lasts over midnight. If it is equal to From, the window lasts the whole day.
+	To time.Duration
+	// Rate is the limit in bytes per second. 0 means unlimited.
+	Rate int64
+}
+
+// BandwidthLimiter limits the transfer rate of all readers which are created by it. The limit can depend on
+// the time of day, so that the rate can change while a transfer is running.
+type BandwidthLimiter struct {
+	rate               int64
+	windows            []BandwidthWindow
+	pauseOutsideWindow bool
+
+	mutex sync.Mutex
+	next  time.Time
+
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+// NewBandwidthLimiter creates a new limiter. The rate (bytes per second, 0 means unlimited) applies outside
+// of the given windows. If pauseOutsideWindow is set, uploads will be suspended outside of the windows.
+func NewBandwidthLimiter(rate int64, pauseOutsideWindow bool, windows ...BandwidthWindow) *BandwidthLimiter {
+	return &BandwidthLimiter{
+		rate:               rate,
+		windows:            windows,
+		pauseOutsideWindow: pauseOutsideWindow && len(windows) > 0,
+		now:                time.Now,
+		sleep:              time.Sleep,
+	}
+}
+
+// Contains returns true if the given time is inside of this window
+func (w BandwidthWindow) Contains(t time.Time) bool {
+	offset := sinceMidnight(t)
+
+	switch {
+	case w.From == w.To:
+		return true
+	case w.From < w.To:
+		return offset >= w.From && offset < w.To
+	default:
+		return offset >= w.From || offset < w.To
+	}
+}
+
+func sinceMidnight(t time.Time) time.Duration {
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second + time.Duration(t.Nanosecond())
+}
+
+// Rate returns the limit (bytes per second, 0 means unlimited) at the given time and if the time is inside of
+// one of the windows
+func (l *BandwidthLimiter) Rate(t time.Time) (int64, bool) {
+	for _, window := range l.windows {
+		if window.Contains(t) {
+			return window.Rate, true
+		}
+	}
+
+	return l.rate, false
+}
+
+// wait blocks until the given number of bytes may be transferred
+func (l *BandwidthLimiter) wait(n int) {
+	if l == nil || n <= 0 {
+		return
+	}
+
+	l.mutex.Lock()
+	now := l.now()
+	rate, _ := l.Rate(now)
+	if rate <= 0 {
+		l.next = now
+		l.mutex.Unlock()
+		return
+	}
+
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(int64(n) * int64(time.Second) / rate))
+	delay := l.next.Sub(now)
+	l.mutex.Unlock()
+
+	l.sleep(delay)
+}
+
+// waitForWindow blocks while the current time is outside of all windows (only if uploads should be paused
+// outside of the windows). It will not block beyond the given deadline.
+func (l *BandwidthLimiter) waitForWindow(deadline time.Time) {
+	if l == nil || !l.pauseOutsideWindow {
+		return
+	}
+
+	now := l.now()
+	if _, inWindow := l.Rate(now); inWindow {
+		return
+	}
+
+	pause := l.untilNextWindow(now)
+	if until := deadline.Sub(now); until < pause {
+		pause = until
+		LogInfo("Keep the multipart upload alive: upload the next part although it is outside of the time windows")
+	}
+	if pause <= 0 {
+		return
+	}
+
+	LogInfo("Pause the upload until %s", now.Add(pause).Format("2006-01-02 15:04"))
+	l.sleep(pause)
+}
+
+// untilNextWindow returns the duration until the next window begins
+func (l *BandwidthLimiter) untilNextWindow(t time.Time) time.Duration {
+	offset := sinceMidnight(t)
+	next := 24 * time.Hour
+
+	for _, window := range l.windows {
+		until := window.From - offset
+		if until <= 0 {
+			until += 24 * time.Hour
+		}
+		if until < next {
+			next = until
+		}
+	}
+
+	return next
+}
+
+// Reader returns a reader which reads from the given one within the bandwidth limit
+func (l *BandwidthLimiter) Reader(r io.Reader) io.Reader {
+	if l == nil {
+		return r
+	}
+
+	return &limitedReader{r, l}
+}
+
+// ReadSeeker returns a ReadSeeker which reads from the given one within the bandwidth limit
+func (l *BandwidthLimiter) ReadSeeker(r io.ReadSeeker) io.ReadSeeker {
+	if l == nil {
+		return r
+	}
+
+	return &limitedReadSeeker{r, l}
+}
+
+type limitedReader struct {
+	reader  io.Reader
+	limiter *BandwidthLimiter
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	if len(p) > limitedChunkSize {
+		p = p[:limitedChunkSize]
+	}
+
+	n, err := r.reader.Read(p)
+	r.limiter.wait(n)
+
+	return n, err
+}
+
+type limitedReadSeeker struct {
+	io.ReadSeeker
+	limiter *BandwidthLimiter
+}
+
+func (r *limitedReadSeeker) Read(p []byte) (int, error) {
+	return (&limitedReader{r.ReadSeeker, r.limiter}).Read(p)
+}
@@ -0,0 +1,131 @@
+package backup
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	current time.Time
+	slept   time.Duration
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.current
+}
+
+func (c *fakeClock) sleep(d time.Duration) {
+	c.slept += d
+	c.current = c.current.Add(d)
+}
+
+func newFakeClockLimiter(clock *fakeClock, rate int64, pause bool, windows ...BandwidthWindow) *BandwidthLimiter {
+	limiter := NewBandwidthLimiter(rate, pause, windows...)
+	limiter.now = clock.now
+	limiter.sleep = clock.sleep
+
+	return limiter
+}
+
+func TestBandwidthWindow_Contains(t *testing.T) {
+	day := BandwidthWindow{From: 8 * time.Hour, To: 18 * time.Hour}
+	night := BandwidthWindow{From: 18 * time.Hour, To: 8 * time.Hour}
+	always := BandwidthWindow{From: 0, To: 0}
+
+	at := func(hour, minute int) time.Time {
+		return time.Date(2019, 7, 1, hour, minute, 0, 0, time.Local)
+	}
+
+	assert.True(t, day.Contains(at(8, 0)))
+	assert.True(t, day.Contains(at(17, 59)))
+	assert.False(t, day.Contains(at(18, 0)))
+	assert.False(t, day.Contains(at(7, 59)))
+
+	assert.True(t, night.Contains(at(18, 0)))
+	assert.True(t, night.Contains(at(0, 30)))
+	assert.False(t, night.Contains(at(8, 0)))
+	assert.False(t, night.Contains(at(12, 0)))
+
+	assert.True(t, always.Contains(at(12, 0)))
+}
+
+func TestBandwidthLimiter_Rate(t *testing.T) {
+	limiter := NewBandwidthLimiter(100, false,
+		BandwidthWindow{From: 8 * time.Hour, To: 18 * time.Hour, Rate: 2 * mib},
+		BandwidthWindow{From: 18 * time.Hour, To: 20 * time.Hour, Rate: 0},
+	)
+
+	rate, inWindow := limiter.Rate(time.Date(2019, 7, 1, 9, 0, 0, 0, time.Local))
+	assert.Equal(t, int64(2*mib), rate)
+	assert.True(t, inWindow)
+
+	rate, inWindow = limiter.Rate(time.Date(2019, 7, 1, 19, 0, 0, 0, time.Local))
+	assert.Equal(t, int64(0), rate)
+	assert.True(t, inWindow)
+
+	rate, inWindow = limiter.Rate(time.Date(2019, 7, 1, 22, 0, 0, 0, time.Local))
+	assert.Equal(t, int64(100), rate)
+	assert.False(t, inWindow)
+}
+
+func TestBandwidthLimiter_Reader(t *testing.T) {
+	clock := &fakeClock{current: time.Date(2019, 7, 1, 12, 0, 0, 0, time.Local)}
+	limiter := newFakeClockLimiter(clock, 1024, false)
+
+	content, err := ioutil.ReadAll(limiter.Reader(bytes.NewReader(make([]byte, 10*1024))))
+
+	assert.NoError(t, err)
+	assert.Len(t, content, 10*1024)
+	assert.Equal(t, 10*time.Second, clock.slept)
+}
+
+func TestBandwidthLimiter_Reader_ChangeRate(t *testing.T) {
+	//the rate changes while reading: the first window ends after 1 second
+	clock := &fakeClock{current: time.Date(2019, 7, 1, 7, 59, 59, 0, time.Local)}
+	limiter := newFakeClockLimiter(clock, 0, false,
+		BandwidthWindow{From: 18 * time.Hour, To: 8 * time.Hour, Rate: 1024},
+	)
+
+	content, err := ioutil.ReadAll(limiter.Reader(bytes.NewReader(make([]byte, 100*1024))))
+
+	assert.NoError(t, err)
+	assert.Len(t, content, 100*1024)
+	assert.True(t, clock.slept < 2*time.Minute, "slept %s", clock.slept)
+}
+
+func TestBandwidthLimiter_Unlimited(t *testing.T) {
+	var limiter *BandwidthLimiter
+	reader := bytes.NewReader([]byte("content"))
+
+	assert.Equal(t, reader, limiter.Reader(reader))
+	assert.Equal(t, reader, limiter.ReadSeeker(reader))
+	limiter.waitForWindow(time.Now().Add(time.Hour))
+}
+
+func TestBandwidthLimiter_waitForWindow(t *testing.T) {
+	clock := &fakeClock{current: time.Date(2019, 7, 1, 20, 0, 0, 0, time.Local)}
+	limiter := newFakeClockLimiter(clock, 0, true,
+		BandwidthWindow{From: 22 * time.Hour, To: 6 * time.Hour, Rate: 0},
+	)
+
+	limiter.waitForWindow(clock.now().Add(MaxUploadPause))
+	assert.Equal(t, 2*time.Hour, clock.slept)
+
+	//inside of the window there is no pause
+	limiter.waitForWindow(clock.now().Add(MaxUploadPause))
+	assert.Equal(t, 2*time.Hour, clock.slept)
+}
+
+func TestBandwidthLimiter_waitForWindow_KeepAlive(t *testing.T) {
+	clock := &fakeClock{current: time.Date(2019, 7, 1, 6, 0, 0, 0, time.Local)}
+	limiter := newFakeClockLimiter(clock, 0, true,
+		BandwidthWindow{From: 22 * time.Hour, To: 6 * time.Hour, Rate: 0},
+	)
+
+	//the next window begins in 16 hours: but the upload must not be paused so long
+	limiter.waitForWindow(clock.now().Add(MaxUploadPause))
+	assert.Equal(t, MaxUploadPause, clock.slept)
+}
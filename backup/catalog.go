@@ -0,0 +1,353 @@
+package backup
+
+import (
+	"backup2glacier/database"
+	"backup2glacier/database/model"
+	. "backup2glacier/log"
+	"bytes"
+	"crypto/aes"
+	"crypto/rand"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+// CatalogFormatVersion is the version of the catalog snapshots which are written by this version
+const CatalogFormatVersion = 1
+
+// sqliteHeader is the beginning of each sqlite database file
+var sqliteHeader = []byte("SQLite format 3\x00")
+
+// CatalogMetadata is written (as JSON) into the description of an archive which contains a catalog snapshot.
+// So the snapshots can be distinguished from the backups.
+type CatalogMetadata struct {
+	Format  int       `json:"b2g-catalog"`
+	Created time.Time `json:"created"`
+	Host    string    `json:"host,omitempty"`
+}
+
+// ArchiveDescription encodes the metadata for the description of an archive
+func (m *CatalogMetadata) ArchiveDescription() string {
+	return encodeDescription(m)
+}
+
+// ParseCatalogDescription reads the metadata of an archive description. If the archive does not contain a
+// catalog snapshot, false will be returned.
+func ParseCatalogDescription(description string) (*CatalogMetadata, bool) {
+	if !strings.HasPrefix(description, "{") {
+		return nil, false
+	}
+
+	metadata := &CatalogMetadata{}
+	if err := json.Unmarshal([]byte(description), metadata); err != nil {
+		return nil, false
+	}
+	if metadata.Format < 1 || metadata.Format > CatalogFormatVersion {
+		return nil, false
+	}
+
+	return metadata, true
+}
+
+// encryptCatalog encrypts the snapshot with the catalog password. All snapshots share the same key: so each
+// one gets a random IV which is written in front of it.
+func encryptCatalog(password string, src io.Reader, dst io.Writer) error {
+	var iv [aes.BlockSize]byte
+	if _, err := rand.Read(iv[:]); err != nil {
+		return errors.Wrap(err, "Could not generate IV")
+	}
+	if _, err := dst.Write(iv[:]); err != nil {
+		return err
+	}
+
+	return newCryptModule(password, iv).Encrypt(src, dst)
+}
+
+// decryptCatalog decrypts a snapshot which was encrypted by encryptCatalog
+func decryptCatalog(password string, src io.Reader, dst io.Writer) error {
+	var iv [aes.BlockSize]byte
+	if _, err := io.ReadFull(src, iv[:]); err != nil {
+		return errors.Wrap(err, "Could not read IV")
+	}
+
+	return newCryptModule(password, iv).Decrypt(src, dst)
+}
+
+type CatalogBackuper interface {
+	io.Closer
+
+	// Backup takes a consistent snapshot of the catalog, uploads it (encrypted) into the vault and removes
+	// the older snapshots which exceed the number of snapshots to keep.
+	Backup() error
+}
+
+type CatalogRestorer interface {
+	// Restore downloads the newest catalog snapshot of the vault and writes it (decrypted) into the target.
+	Restore(vault, password, target string) error
+}
+
+type catalogBackuper struct {
+	dbRepository database.Repository
+	glacier      AWSGlacier
+	dbFile       string
+	vault        string
+	password     string
+	keep         int
+}
+
+type catalogRestorer struct {
+	glacier      AWSGlacier
+	tier         string
+	pollInterval time.Duration
+}
+
+func NewCatalogBackuper(vault, password string, keep int, settings *StorageSettings, dbUrl string) (CatalogBackuper, error) {
+	return NewCatalogBackuperForRepository(vault, password, keep, settings, dbUrl, database.NewRepository(dbUrl))
+}
+
+// NewCatalogBackuperForRepository creates a CatalogBackuper which saves the snapshots into the given repository.
+// The repository must be the catalog in the given database file.
+func NewCatalogBackuperForRepository(vault, password string, keep int, settings *StorageSettings, dbUrl string, dbRepo database.Repository) (CatalogBackuper, error) {
+	g, err := NewAWSGlacier(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	return &catalogBackuper{
+		dbRepository: dbRepo,
+		glacier:      g,
+		dbFile:       dbUrl,
+		vault:        vault,
+		password:     password,
+		keep:         keep,
+	}, nil
+}
+
+func NewCatalogRestorer(tier string, pollInterval time.Duration, settings *StorageSettings) (CatalogRestorer, error) {
+	g, err := NewAWSGlacier(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	return &catalogRestorer{
+		glacier:      g,
+		tier:         tier,
+		pollInterval: pollInterval,
+	}, nil
+}
+
+func (c *catalogBackuper) Close() error {
+	return c.dbRepository.Close()
+}
+
+func (c *catalogBackuper) Backup() error {
+	tmpFile, err := ioutil.TempFile("", "catalog")
+	if err != nil {
+		return errors.Wrap(err, "Could not create temporary file")
+	}
+	tmpFile.Close()
+	defer os.Remove(tmpFile.Name())
+
+	if err := database.Snapshot(c.dbFile, tmpFile.Name()); err != nil {
+		return errors.Wrap(err, "Could not take a snapshot of the catalog")
+	}
+
+	snapshot, err := os.Open(tmpFile.Name())
+	if err != nil {
+		return errors.Wrap(err, "Could not open snapshot")
+	}
+	defer snapshot.Close()
+
+	stat, err := snapshot.Stat()
+	if err != nil {
+		return errors.Wrap(err, "Could not read snapshot")
+	}
+	partSize, err := ChoosePartSize(stat.Size(), PartSizeSafetyMargin)
+	if err != nil {
+		return err
+	}
+
+	host, _ := os.Hostname()
+	metadata := &CatalogMetadata{
+		Format:  CatalogFormatVersion,
+		Created: time.Now().UTC().Truncate(time.Second),
+		Host:    host,
+	}
+
+	// snapshot -> encrypt -> glacier
+	srcCrypt, dstCrypt := io.Pipe()
+	go func() {
+		dstCrypt.CloseWithError(encryptCatalog(c.password, snapshot, dstCrypt))
+	}()
+
+	result, _, err := c.glacier.Upload(AWSGlacierUpload{
+		Source:      srcCrypt,
+		VaultName:   c.vault,
+		ArchiveDesc: metadata.ArchiveDescription(),
+		PartSize:    partSize * 1024 * 1024,
+		Concurrency: 1,
+		Spool:       SpoolConfig{Mode: SpoolModeMemory},
+	})
+	srcCrypt.Close()
+	if err != nil {
+		return errors.Wrap(err, "Could not upload the catalog snapshot")
+	}
+
+	c.dbRepository.SaveCatalogSnapshot(&model.CatalogSnapshot{
+		Vault:     c.vault,
+		ArchiveId: *result.CreationResult.ArchiveId,
+		Checksum:  *result.CreationResult.Checksum,
+		Length:    result.TotalSize,
+	})
+	LogInfo("Uploaded catalog snapshot (%d bytes) into %s", result.TotalSize, c.vault)
+
+	c.rotate()
+
+	return nil
+}
+
+// rotate deletes all snapshots except the newest ones
+func (c *catalogBackuper) rotate() {
+	snapshots := c.dbRepository.GetCatalogSnapshots(c.vault)
+
+	for i := c.keep; i < len(snapshots); i++ {
+		err := c.glacier.Delete(AWSGlacierDelete{
+			VaultName: c.vault,
+			ArchiveId: snapshots[i].ArchiveId,
+		})
+		if err != nil {
+			LogError("Could not delete the catalog snapshot %s: %v", snapshots[i].ArchiveId, err)
+			continue
+		}
+
+		c.dbRepository.DeleteCatalogSnapshot(&snapshots[i])
+		LogInfo("Deleted catalog snapshot of %s", snapshots[i].CreatedAt.Format(time.RFC3339))
+	}
+}
+
+func (c *catalogRestorer) Restore(vault, password, target string) error {
+	inventory, err := c.glacier.Inventory(AWSGlacierInventory{
+		VaultName:    vault,
+		PollInterval: c.pollInterval,
+	})
+	if err != nil {
+		return errors.Wrap(err, "Could not retrieve the inventory")
+	}
+
+	var newest *InventoryArchive
+	var newestMetadata *CatalogMetadata
+	var snapshots []InventoryArchive
+	for i, archive := range inventory.ArchiveList {
+		metadata, ok := ParseCatalogDescription(archive.ArchiveDescription)
+		if !ok {
+			continue
+		}
+
+		snapshots = append(snapshots, archive)
+		if newest == nil || metadata.Created.After(newestMetadata.Created) {
+			newest = &inventory.ArchiveList[i]
+			newestMetadata = metadata
+		}
+	}
+	if newest == nil {
+		return errors.Errorf("There is no catalog snapshot in the vault %s", vault)
+	}
+	LogInfo("Restore catalog snapshot of %s (host: %s)", newestMetadata.Created.Format(time.RFC3339), newestMetadata.Host)
+
+	// glacier -> save encrypted -> decrypt -> target
+	encrypted := target + ".encrypted"
+	err = c.glacier.Download(AWSGlacierDownload{
+		VaultName:    vault,
+		ArchiveId:    newest.ArchiveId,
+		Checksum:     newest.SHA256TreeHash,
+		Target:       encrypted,
+		Tier:         c.tier,
+		PollInterval: c.pollInterval,
+	})
+	if err != nil {
+		return errors.Wrap(err, "Error while downloading from glacier")
+	}
+
+	if err := c.decrypt(password, encrypted, target); err != nil {
+		return errors.Wrapf(err, "The encrypted snapshot remains in %s", encrypted)
+	}
+	if err := os.Remove(encrypted); err != nil {
+		LogError("Could not remove the encrypted snapshot %s: %v", encrypted, err)
+	}
+
+	//the snapshot does not know itself (and maybe some newer ones): but they should be rotated later, too
+	dbRepository, err := database.OpenRepository(target)
+	if err != nil {
+		return errors.Wrapf(err, "The restored catalog %s can not be opened", target)
+	}
+	defer dbRepository.Close()
+
+	inVault := map[string]bool{}
+	for _, archive := range snapshots {
+		inVault[archive.ArchiveId] = true
+	}
+	known := map[string]bool{}
+	existing := dbRepository.GetCatalogSnapshots(vault)
+	for i := range existing {
+		snapshot := &existing[i]
+
+		//the snapshot was rotated after it was taken
+		if !inVault[snapshot.ArchiveId] && snapshot.CreatedAt.Before(inventory.InventoryDate) {
+			dbRepository.DeleteCatalogSnapshot(snapshot)
+			continue
+		}
+		known[snapshot.ArchiveId] = true
+	}
+	for _, archive := range snapshots {
+		if known[archive.ArchiveId] {
+			continue
+		}
+
+		snapshot := &model.CatalogSnapshot{
+			Vault:     vault,
+			ArchiveId: archive.ArchiveId,
+			Checksum:  archive.SHA256TreeHash,
+			Length:    archive.Size,
+		}
+		snapshot.CreatedAt = archive.CreationDate
+		dbRepository.SaveCatalogSnapshot(snapshot)
+	}
+
+	return nil
+}
+
+// decrypt decrypts the encrypted snapshot into the target. The target will only be written if the snapshot
+// could be decrypted to a database.
+func (c *catalogRestorer) decrypt(password, encrypted, target string) error {
+	fSource, err := os.Open(encrypted)
+	if err != nil {
+		return errors.Wrap(err, "Could not open downloaded snapshot")
+	}
+	defer fSource.Close()
+
+	tmpTarget := target + ".tmp"
+	fTarget, err := os.OpenFile(tmpTarget, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return errors.Wrap(err, "Could not create catalog")
+	}
+	defer os.Remove(tmpTarget)
+	defer fTarget.Close()
+
+	if err := decryptCatalog(password, fSource, fTarget); err != nil {
+		return errors.Wrap(err, "Could not decrypt snapshot")
+	}
+
+	header := make([]byte, len(sqliteHeader))
+	if _, err := fTarget.ReadAt(header, 0); err != nil || !bytes.Equal(header, sqliteHeader) {
+		return errors.New("The decrypted snapshot is no database. Is the password correct?")
+	}
+
+	if err := fTarget.Close(); err != nil {
+		return errors.Wrap(err, "Could not write catalog")
+	}
+	return os.Rename(tmpTarget, target)
+}
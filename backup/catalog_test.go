@@ -0,0 +1,130 @@
+package backup
+
+import (
+	"backup2glacier/database"
+	"backup2glacier/database/model"
+	"bytes"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/glacier"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func (f *fakeAWSGlacier) Upload(upload AWSGlacierUpload) (*AWSGlacierUploadResult, *string, error) {
+	content, err := ioutil.ReadAll(upload.Source)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	archiveId := fmt.Sprintf("archive-%d", len(f.archives)+1)
+	f.archives[archiveId] = content
+	f.descriptions = append(f.descriptions, upload.ArchiveDesc)
+
+	return &AWSGlacierUploadResult{
+		CreationResult: &glacier.ArchiveCreationOutput{
+			ArchiveId: aws.String(archiveId),
+			Checksum:  aws.String(archiveId + "-hash"),
+		},
+		TotalSize: int64(len(content)),
+	}, aws.String("upload"), nil
+}
+
+func (f *fakeAWSGlacier) Delete(delete AWSGlacierDelete) error {
+	f.deleted = append(f.deleted, delete.ArchiveId)
+	return nil
+}
+
+func TestCatalogCrypt(t *testing.T) {
+	content := []byte("SQLite format 3\x00 the catalog")
+
+	first, second := new(bytes.Buffer), new(bytes.Buffer)
+	assert.NoError(t, encryptCatalog("secret", bytes.NewReader(content), first))
+	assert.NoError(t, encryptCatalog("secret", bytes.NewReader(content), second))
+
+	//each snapshot has its own IV
+	assert.NotEqual(t, first.Bytes(), second.Bytes())
+
+	decrypted := new(bytes.Buffer)
+	assert.NoError(t, decryptCatalog("secret", first, decrypted))
+	assert.Equal(t, content, decrypted.Bytes())
+}
+
+func TestParseCatalogDescription(t *testing.T) {
+	metadata := &CatalogMetadata{Format: CatalogFormatVersion, Created: time.Now().UTC().Truncate(time.Second), Host: "host"}
+
+	parsed, ok := ParseCatalogDescription(metadata.ArchiveDescription())
+	assert.True(t, ok)
+	assert.Equal(t, metadata, parsed)
+
+	_, ok = ParseCatalogDescription(NewArchiveMetadata(1, 1, time.Now(), "backup", nil).ArchiveDescription())
+	assert.False(t, ok)
+	_, ok = ParseArchiveDescription(metadata.ArchiveDescription())
+	assert.False(t, ok)
+}
+
+func TestCatalogBackuper_BackupAndRestore(t *testing.T) {
+	//given
+	dir, err := ioutil.TempDir("", "catalog")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	dbFile := path.Join(dir, "database.db")
+	fake := newFakeAWSGlacier()
+	backuper := &catalogBackuper{
+		dbRepository: database.NewRepository(dbFile),
+		glacier:      fake,
+		dbFile:       dbFile,
+		vault:        "vault",
+		password:     "catalog-secret",
+		keep:         2,
+	}
+	backuper.dbRepository.SaveBackup(&model.Backup{Vault: "vault", Description: "my backup"})
+
+	//when
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, backuper.Backup())
+		//the snapshots must be distinguishable by their creation date
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	//then: the oldest snapshot is rotated
+	assert.Len(t, fake.archives, 3)
+	assert.Equal(t, []string{"archive-1"}, fake.deleted)
+	snapshots := backuper.dbRepository.GetCatalogSnapshots("vault")
+	assert.Len(t, snapshots, 2)
+	assert.Equal(t, "archive-3", snapshots[0].ArchiveId)
+	backuper.Close()
+
+	//when: restore into an empty place
+	fake.inventory = &VaultInventory{InventoryDate: time.Now()}
+	for i, description := range fake.descriptions[1:] {
+		archiveId := fmt.Sprintf("archive-%d", i+2)
+		fake.inventory.ArchiveList = append(fake.inventory.ArchiveList, InventoryArchive{
+			ArchiveId:          archiveId,
+			ArchiveDescription: description,
+			CreationDate:       time.Now().Add(time.Duration(i) * time.Second),
+		})
+	}
+	fake.inventory.ArchiveList = append(fake.inventory.ArchiveList, InventoryArchive{ArchiveId: "backup", ArchiveDescription: "a backup"})
+
+	restorer := &catalogRestorer{glacier: fake}
+	target := path.Join(dir, "restored.db")
+
+	assert.Error(t, restorer.Restore("vault", "wrong", target))
+	_, err = os.Stat(target)
+	assert.True(t, os.IsNotExist(err))
+
+	err = restorer.Restore("vault", "catalog-secret", target)
+
+	//then
+	assert.NoError(t, err)
+	restored := database.NewRepository(target)
+	defer restored.Close()
+	assert.Equal(t, "my backup", restored.GetBackupById(1).Description)
+	assert.Len(t, restored.GetCatalogSnapshots("vault"), 2)
+}
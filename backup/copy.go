@@ -0,0 +1,316 @@
+package backup
+
+import (
+	"backup2glacier/database"
+	"backup2glacier/database/model"
+	. "backup2glacier/log"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"path"
+	"time"
+)
+
+// CopyTarget is the vault (or bucket or directory vault) into which a backup will be copied. An empty backend
+// stands for the backend of the backup. Empty region and account stand for the defaults.
+type CopyTarget struct {
+	Backend   string
+	Vault     string
+	Region    string
+	AccountId string
+}
+
+func (c CopyTarget) String() string {
+	if c.Region == "" {
+		return c.Vault
+	}
+
+	return c.Vault + "@" + c.Region
+}
+
+type BackupCopier interface {
+	io.Closer
+
+	// Copy retrieves the encrypted archives of all volumes of the backup and uploads them unchanged into the
+	// target. The copies are attached to the backup as replicas. If deleteSource is true, the original archives
+	// will be deleted afterwards and the copies become the location of the backup. Volumes which are already
+	// copied into the target (by an earlier run) will be skipped.
+	Copy(backupId uint, target CopyTarget, deleteSource bool) error
+}
+
+// NewBackupCopier creates a copier which retrieves the archives with the given tier and downloads them into the
+// work directory before they are uploaded. An empty work directory stands for the directory of temporary files.
+func NewBackupCopier(tier string, pollInterval time.Duration, storageClass, workDir, dbUrl string, opts ...ManagerOption) (BackupCopier, error) {
+	return NewBackupManager(nil, false, 0, pollInterval, tier, database.NewRepository(dbUrl), append([]ManagerOption{
+		WithBackend(BackendGlacier, storageClass),
+		WithConcurrency(1),
+		WithWorkDir(workDir)}, opts...)...)
+}
+
+func (b *backupManager) Copy(backupId uint, target CopyTarget, deleteSource bool) error {
+	dbBackup := b.dbRepository.GetBackupById(backupId)
+	if dbBackup.ID != backupId {
+		return ErrBackupNotFound
+	}
+
+	target, defaults, err := b.resolveCopyTarget(dbBackup, target)
+	if err != nil {
+		return err
+	}
+	targetLocation := AWSLocation{Region: target.Region, AccountId: target.AccountId}
+	if target.Backend == backendOf(dbBackup) && target.Vault == dbBackup.Vault &&
+		(!isAWSBackend(target.Backend) || locationOf(dbBackup, defaults) == targetLocation) {
+		return errors.New("The target is the location of the backup itself")
+	}
+
+	storage, err := b.storage(target.Backend, target.Region, target.AccountId)
+	if err != nil {
+		return err
+	}
+
+	volumes := b.dbRepository.GetVolumesByBackupId(backupId)
+	if len(volumes) == 0 {
+		return errors.New("No volume found for backup")
+	}
+
+	//the retrievals of all volumes are requested up front, so that they are prepared at the same time
+	copies := make([]*model.Replica, len(volumes))
+	sources := make([][]archiveCopy, len(volumes))
+	for i := range volumes {
+		if volumes[i].ID == 0 {
+			return errors.New("The backup was created before the volumes were introduced. Resume or recreate it at first.")
+		}
+		if err := b.ctx.Err(); err != nil {
+			return err
+		}
+
+		copies[i] = b.copyReplica(dbBackup, &volumes[i], target)
+		if copies[i].ArchiveId != nil {
+			LogInfo("Skip volume %d: it is already copied into %s", volumes[i].Number, target)
+			continue
+		}
+
+		sources[i], err = b.requestCopySources(dbBackup, &volumes[i])
+		if err != nil {
+			return errors.Wrapf(err, "Could not request the retrieval of volume %d", volumes[i].Number)
+		}
+	}
+
+	for i := range volumes {
+		if copies[i].ArchiveId != nil {
+			continue
+		}
+
+		if err := b.copyVolume(dbBackup, &volumes[i], copies[i], sources[i], storage, target); err != nil {
+			return errors.Wrapf(err, "Could not copy volume %d", volumes[i].Number)
+		}
+	}
+
+	if deleteSource {
+		return b.moveBackup(dbBackup, volumes, copies, target)
+	}
+	return nil
+}
+
+// resolveCopyTarget fills the empty values of the target with the backend of the backup and the default location.
+// The resolved default location is returned, too.
+func (b *backupManager) resolveCopyTarget(dbBackup *model.Backup, target CopyTarget) (CopyTarget, AWSLocation, error) {
+	if target.Backend == "" {
+		target.Backend = backendOf(dbBackup)
+	}
+	if !isAWSBackend(target.Backend) {
+		target.Region = ""
+		target.AccountId = ""
+		return target, AWSLocation{}, nil
+	}
+
+	location, err := b.storageSettings.ResolveLocation()
+	if err != nil {
+		return target, location, err
+	}
+	if target.Region == "" {
+		target.Region = location.Region
+	}
+	if target.AccountId == "" || target.AccountId == DefaultAccountId {
+		target.AccountId = location.AccountId
+	}
+
+	return target, location, nil
+}
+
+// copyReplica returns the replica of the volume in the target. It will be created if there is none yet.
+func (b *backupManager) copyReplica(dbBackup *model.Backup, volume *model.Volume, target CopyTarget) *model.Replica {
+	var dbReplica *model.Replica
+	for _, replica := range b.dbRepository.GetReplicasByBackupId(dbBackup.ID) {
+		if replica.VolumeID == volume.ID && replica.Backend == target.Backend && replica.Vault == target.Vault &&
+			replica.Region == target.Region && replica.AccountId == target.AccountId {
+			replica := replica
+			dbReplica = &replica
+		}
+	}
+	if dbReplica == nil {
+		dbReplica = &model.Replica{
+			BackupID:  dbBackup.ID,
+			VolumeID:  volume.ID,
+			Backend:   target.Backend,
+			Vault:     target.Vault,
+			Region:    target.Region,
+			AccountId: target.AccountId,
+		}
+		b.dbRepository.SaveReplica(dbReplica)
+	}
+
+	return dbReplica
+}
+
+// requestCopySources requests the retrieval of the volume and returns the copies of the volume from which it can
+// be downloaded. The requested copy comes first, the others are the fallbacks.
+func (b *backupManager) requestCopySources(dbBackup *model.Backup, volume *model.Volume) ([]archiveCopy, error) {
+	copies := b.volumeCopies(dbBackup, volume)
+	if len(copies) == 0 {
+		return nil, errors.New("The volume has no archive")
+	}
+
+	requested, jobId, err := b.requestRetrieval(volume, copies)
+	if err != nil {
+		return nil, err
+	}
+	LogInfo("Requested retrieval of volume %d from %s (job %s)", volume.Number, requested, jobId)
+
+	sources := []archiveCopy{requested}
+	for _, source := range copies {
+		if source != requested {
+			sources = append(sources, source)
+		}
+	}
+
+	return sources, nil
+}
+
+// copyVolume downloads the archive of the volume from the first available source and uploads it into the target.
+// The result is saved in the given replica.
+func (b *backupManager) copyVolume(dbBackup *model.Backup, volume *model.Volume, dbReplica *model.Replica, sources []archiveCopy, storage StorageBackend, target CopyTarget) error {
+	//the download verifies the tree hash and will be continued if it is interrupted
+	encrypted := path.Join(b.workDir, fmt.Sprintf("backup2glacier-copy-%d-%d.encrypted", dbBackup.ID, volume.Number))
+	if b.workDir == "" {
+		encrypted = path.Join(os.TempDir(), path.Base(encrypted))
+	}
+	var err error
+	for i, source := range sources {
+		if err = b.downloadArchive(source, volume, encrypted, ""); err == nil || b.ctx.Err() != nil {
+			break
+		}
+		if i < len(sources)-1 {
+			LogError("Could not download volume %d from %s: %v. Try the replica %s.", volume.Number, source, err, sources[i+1])
+		}
+	}
+	if err != nil {
+		return errors.Wrap(err, "Error while downloading the archive")
+	}
+
+	source, err := os.Open(encrypted)
+	if err != nil {
+		return errors.Wrap(err, "Could not open downloaded archive")
+	}
+	defer source.Close()
+
+	partSize, err := ChoosePartSize(volume.Length, 0)
+	if err != nil {
+		return err
+	}
+	partSize *= 1024 * 1024
+	if target.Backend == BackendS3 && partSize < S3MinPartSize {
+		partSize = S3MinPartSize
+	}
+
+	retries := storage.Retries()
+	uploadResult, uploadId, err := b.uploadArchive(storage, b.progressOf(source, dbBackup.ID, volume.Number, target.Vault), dbReplica.UploadId, target.Vault, archiveDescription(dbBackup, volume.Number), volume.Number, partSize)
+	result := &VolumeResult{
+		Number:      volume.Number,
+		UploadId:    uploadId,
+		ArchiveInfo: uploadResult.CreationResult,
+		TotalSize:   uploadResult.TotalSize,
+		Retries:     storage.Retries() - retries,
+		Error:       err,
+	}
+	if err == nil && volume.Checksum != nil && aws.StringValue(uploadResult.CreationResult.Checksum) != *volume.Checksum {
+		result.Error = errors.Errorf("The tree hash of the copy (%s) differs from the one of the volume (%s)",
+			aws.StringValue(uploadResult.CreationResult.Checksum), *volume.Checksum)
+
+		//the broken copy must not be used
+		err := storage.Delete(AWSGlacierDelete{VaultName: target.Vault, ArchiveId: aws.StringValue(uploadResult.CreationResult.ArchiveId)})
+		if err != nil {
+			LogError("Could not delete the broken copy of volume %d: %v", volume.Number, err)
+		}
+		result.ArchiveInfo = nil
+		result.UploadId = nil
+	}
+	b.updateReplica(result, dbReplica)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	source.Close()
+	if err := os.Remove(encrypted); err != nil {
+		LogError("Could not remove the encrypted archive %s: %v", encrypted, err)
+	}
+	LogInfo("Copied volume %d into %s (archive %s)", volume.Number, target, *dbReplica.ArchiveId)
+
+	return nil
+}
+
+// moveBackup makes the copies to the location of the backup and deletes the original archives afterwards. The
+// original archives become replicas until they are deleted, so that the catalog is consistent even if a deletion fails.
+func (b *backupManager) moveBackup(dbBackup *model.Backup, volumes []model.Volume, copies []*model.Replica, target CopyTarget) error {
+	for i := range volumes {
+		volume, dbReplica := &volumes[i], copies[i]
+		original := *volume
+
+		volume.UploadId = nil
+		volume.ArchiveId = dbReplica.ArchiveId
+		volume.Checksum = dbReplica.Checksum
+		volume.Location = dbReplica.Location
+		volume.Length = dbReplica.Length
+		b.dbRepository.UpdateVolume(volume)
+
+		dbReplica.Backend = dbBackup.Backend
+		dbReplica.Vault = dbBackup.Vault
+		dbReplica.Region = dbBackup.Region
+		dbReplica.AccountId = dbBackup.AccountId
+		dbReplica.UploadId = nil
+		dbReplica.ArchiveId = original.ArchiveId
+		dbReplica.Checksum = original.Checksum
+		dbReplica.Location = original.Location
+		dbReplica.Length = original.Length
+		b.dbRepository.UpdateReplica(dbReplica)
+	}
+
+	source := archiveCopy{backend: dbBackup.Backend, vault: dbBackup.Vault, region: dbBackup.Region}
+	dbBackup.Backend = target.Backend
+	dbBackup.Vault = target.Vault
+	dbBackup.Region = target.Region
+	dbBackup.AccountId = target.AccountId
+	b.dbRepository.UpdateBackup(dbBackup)
+	LogInfo("Moved backup %d into %s", dbBackup.ID, target)
+
+	for _, dbReplica := range copies {
+		if err := b.deleteReplica(dbReplica); err != nil {
+			return errors.Wrapf(err, "Could not delete the source archive in %s. It remains as replica.", source)
+		}
+		b.dbRepository.DeleteReplica(dbReplica)
+	}
+
+	return nil
+}
+
+// backendOf returns the backend of the backup. Backups which are created before the introduction of the
+// storage backends are stored in glacier.
+func backendOf(dbBackup *model.Backup) string {
+	if dbBackup.Backend == "" {
+		return BackendGlacier
+	}
+
+	return dbBackup.Backend
+}
@@ -0,0 +1,60 @@
+package backup
+
+import (
+	"backup2glacier/database/model"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/assert"
+	"path"
+	"testing"
+)
+
+// recordingStorage records the retrievals and downloads of the wrapped storage backend
+type recordingStorage struct {
+	StorageBackend
+	calls []string
+}
+
+func (r *recordingStorage) RequestRetrieval(retrieval AWSGlacierRetrieval) (string, error) {
+	r.calls = append(r.calls, "request "+retrieval.ArchiveId)
+	return r.StorageBackend.RequestRetrieval(retrieval)
+}
+
+func (r *recordingStorage) Download(download AWSGlacierDownload) error {
+	r.calls = append(r.calls, "download "+download.ArchiveId)
+	return r.StorageBackend.Download(download)
+}
+
+func TestBackupManager_Copy(t *testing.T) {
+	//given
+	manager, fake, dir, cleanup := newRestoreTestManager(t)
+	defer cleanup()
+
+	storage := &recordingStorage{StorageBackend: fake}
+	manager.backends[storageKey{backend: BackendGlacier}] = storage
+	manager.storageFactory = NewStorageFactory(manager.storageSettings)
+	manager.concurrency = 1
+	manager.workDir = dir
+	vault := path.Join(dir, "vault")
+	assert.NoError(t, EnsureDirectoryVault(vault))
+
+	dbBackup := &model.Backup{Vault: "vault"}
+	manager.dbRepository.SaveBackup(dbBackup)
+	for i, content := range []string{"first volume", "second volume"} {
+		archiveId := []string{"archive-1", "archive-2"}[i]
+		fake.archives[archiveId] = []byte(content)
+		manager.dbRepository.SaveVolume(dbBackup, &model.Volume{Number: i + 1, ArchiveId: aws.String(archiveId), Length: int64(len(content))})
+	}
+
+	//when
+	err := manager.Copy(dbBackup.ID, CopyTarget{Backend: BackendDirectory, Vault: vault}, false)
+
+	//then: all retrievals are requested before the first download
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"request archive-1", "request archive-2", "download archive-1", "download archive-2"}, storage.calls)
+	replicas := manager.dbRepository.GetReplicasByBackupId(dbBackup.ID)
+	assert.Len(t, replicas, 2)
+	for _, replica := range replicas {
+		assert.NotNil(t, replica.ArchiveId)
+	}
+	assert.Equal(t, 0, manager.partSize)
+}
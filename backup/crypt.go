@@ -5,6 +5,7 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/sha256"
+	"encoding/binary"
 	"encoding/hex"
 	"fmt"
 	"io"
@@ -17,10 +18,37 @@ type CryptModule interface {
 
 type cryptModule struct {
 	key         []byte
+	iv          [aes.BlockSize]byte
 	cipherBlock cipher.Block
 }
 
 func NewCryptModule(password string) CryptModule {
+	return newCryptModule(password, [aes.BlockSize]byte{})
+}
+
+// NewVolumeCryptModule creates a CryptModule for the given volume (starting by 1) of a backup. All volumes
+// share the same key, so each volume needs its own IV. The first volume uses the zero IV so that it is
+// compatible with backups which consists of only one archive.
+func NewVolumeCryptModule(password string, volume int) CryptModule {
+	var iv [aes.BlockSize]byte
+	if volume > 1 {
+		binary.BigEndian.PutUint64(iv[aes.BlockSize-8:], uint64(volume-1))
+	}
+
+	return newCryptModule(password, iv)
+}
+
+// NewManifestCryptModule creates a CryptModule for the manifest of the given volume (starting by 1). The manifest
+// is encrypted with the key of the backup, so it needs an IV which differs from the IVs of all volumes.
+func NewManifestCryptModule(password string, volume int) CryptModule {
+	var iv [aes.BlockSize]byte
+	iv[0] = 'M'
+	binary.BigEndian.PutUint64(iv[aes.BlockSize-8:], uint64(volume))
+
+	return newCryptModule(password, iv)
+}
+
+func newCryptModule(password string, iv [aes.BlockSize]byte) CryptModule {
 	hash := sha256.New()
 	io.WriteString(hash, password)
 
@@ -36,14 +64,15 @@ func NewCryptModule(password string) CryptModule {
 
 	return &cryptModule{
 		key:         key,
+		iv:          iv,
 		cipherBlock: block,
 	}
 }
 
 func (c *cryptModule) Encrypt(src io.Reader, dst io.Writer) error {
 	// If the key is unique for each ciphertext, then it's ok to use a zero
-	// IV.
-	var iv [aes.BlockSize]byte
+	// IV. Volumes of the same backup share the key, so they use their own IV.
+	iv := c.iv
 	stream := cipher.NewOFB(c.cipherBlock, iv[:])
 
 	writer := &cipher.StreamWriter{S: stream, W: dst}
@@ -55,8 +84,8 @@ func (c *cryptModule) Encrypt(src io.Reader, dst io.Writer) error {
 
 func (c *cryptModule) Decrypt(src io.Reader, dst io.Writer) error {
 	// If the key is unique for each ciphertext, then it's ok to use a zero
-	// IV.
-	var iv [aes.BlockSize]byte
+	// IV. Volumes of the same backup share the key, so they use their own IV.
+	iv := c.iv
 	stream := cipher.NewOFB(c.cipherBlock, iv[:])
 
 	reader := &cipher.StreamReader{S: stream, R: src}
@@ -75,3 +75,25 @@ func TestCryptModule(t *testing.T) {
 	assert.NoError(t, decErr)
 	assert.Equal(t, outBuf.String(), testText)
 }
+
+func TestVolumeCryptModule(t *testing.T) {
+	//given
+	testText := `This is a test text!`
+
+	legacy := new(bytes.Buffer)
+	firstVolume := new(bytes.Buffer)
+	secondVolume := new(bytes.Buffer)
+	decrypted := new(bytes.Buffer)
+
+	//when
+	NewCryptModule("somePassword").Encrypt(bytes.NewBufferString(testText), legacy)
+	NewVolumeCryptModule("somePassword", 1).Encrypt(bytes.NewBufferString(testText), firstVolume)
+	NewVolumeCryptModule("somePassword", 2).Encrypt(bytes.NewBufferString(testText), secondVolume)
+	decErr := NewVolumeCryptModule("somePassword", 2).Decrypt(bytes.NewReader(secondVolume.Bytes()), decrypted)
+
+	//then
+	assert.Equal(t, legacy.Bytes(), firstVolume.Bytes())
+	assert.NotEqual(t, firstVolume.Bytes(), secondVolume.Bytes())
+	assert.NoError(t, decErr)
+	assert.Equal(t, testText, decrypted.String())
+}
@@ -0,0 +1,688 @@
+package backup
+
+import (
+	. "backup2glacier/log"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/glacier"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The sub directories of a directory vault
+const (
+	directoryArchives = "archives"
+	directoryUploads  = "uploads"
+	directoryJobs     = "jobs"
+)
+
+// directoryUploadFile is the file (inside the directory of an upload) which holds the parameters of the upload
+const directoryUploadFile = "upload.json"
+
+// directoryBackend stores the archives in a local (or mounted) directory. The vault name is the path of the
+// directory. It simulates the behaviour of glacier: the archives are uploaded in parts, identified by random
+// ids and can only be downloaded by retrieval jobs which are completed after a configurable delay.
+type directoryBackend struct {
+	delays  map[string]time.Duration
+	limiter *BandwidthLimiter
+}
+
+// directoryUpload is the content of the upload file of a multipart upload
+type directoryUpload struct {
+	ArchiveDescription string
+	PartSize           int
+	CreationDate       time.Time
+}
+
+// directoryArchive is the metadata of an archive. It will be saved next to the content of the archive.
+type directoryArchive struct {
+	ArchiveId          string
+	ArchiveDescription string
+	CreationDate       time.Time
+	Size               int64
+	SHA256TreeHash     string
+}
+
+// directoryJob is a (simulated) retrieval job
+type directoryJob struct {
+	JobId              string
+	ArchiveId          string
+	Tier               string
+	RetrievalByteRange string
+	CreationDate       time.Time
+	CompletionDate     time.Time
+}
+
+// NewDirectoryBackend creates a directory backend whose retrieval jobs need the retrieval delays of the settings
+// until they are completed
+func NewDirectoryBackend(settings *StorageSettings) (StorageBackend, error) {
+	return &directoryBackend{
+		settings.RetrievalDelays,
+		settings.BandwidthLimiter,
+	}, nil
+}
+
+// EnsureDirectoryVault creates the directory of the given directory vault if it does not exist
+func EnsureDirectoryVault(vaultName string) error {
+	for _, dir := range []string{directoryArchives, directoryUploads, directoryJobs} {
+		if err := os.MkdirAll(filepath.Join(vaultName, dir), 0755); err != nil {
+			return errors.Wrapf(err, "Could not create directory vault %s", vaultName)
+		}
+	}
+
+	return nil
+}
+
+// Retries returns always 0, because the operations on the file system will not be retried
+func (d *directoryBackend) Retries() int64 {
+	return 0
+}
+
+// newDirectoryId returns a new random id for an archive, upload or job
+func newDirectoryId() (string, error) {
+	random := make([]byte, 24)
+	if _, err := rand.Read(random); err != nil {
+		return "", errors.Wrap(err, "Could not generate id")
+	}
+
+	return hex.EncodeToString(random), nil
+}
+
+// checkVault returns an error if the directory of the vault does not exist. The directory will not be created
+// implicitly, otherwise an unmounted directory would be filled silently.
+func checkVault(vaultName string) error {
+	if info, err := os.Stat(filepath.Join(vaultName, directoryArchives)); err != nil || !info.IsDir() {
+		return errors.Errorf("The directory vault %s does not exist", vaultName)
+	}
+
+	return nil
+}
+
+func (d *directoryBackend) Upload(upload AWSGlacierUpload) (*AWSGlacierUploadResult, *string, error) {
+	if err := checkVault(upload.VaultName); err != nil {
+		return nil, nil, err
+	}
+
+	uploadId, err := newDirectoryId()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	uploadDir := filepath.Join(upload.VaultName, directoryUploads, uploadId)
+	if err := os.MkdirAll(uploadDir, 0755); err != nil {
+		return nil, nil, errors.Wrap(err, "Could not init multipart upload")
+	}
+	err = writeJSON(filepath.Join(uploadDir, directoryUploadFile), &directoryUpload{
+		ArchiveDescription: upload.ArchiveDesc,
+		PartSize:           upload.PartSize,
+		CreationDate:       time.Now().UTC(),
+	})
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Could not init multipart upload")
+	}
+	LogInfo("Initialise multipart upload: %s", uploadId)
+
+	return d.continueUpload(upload, &uploadId, nil)
+}
+
+// Resume continues an interrupted multipart upload. The parts which are already written will be verified
+// against the source.
+func (d *directoryBackend) Resume(resume AWSGlacierResume) (*AWSGlacierUploadResult, error) {
+	uploadDir := filepath.Join(resume.VaultName, directoryUploads, resume.UploadId)
+
+	meta := &directoryUpload{}
+	if err := readJSON(filepath.Join(uploadDir, directoryUploadFile), meta); os.IsNotExist(errors.Cause(err)) {
+		return nil, ErrUploadNotFound
+	} else if err != nil {
+		return nil, errors.Wrap(err, "Could not read the multipart upload")
+	}
+
+	uploaded, err := d.listParts(uploadDir)
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not list the parts of the multipart upload")
+	}
+	LogInfo("Resume multipart upload %s: %d parts are already uploaded", resume.UploadId, len(uploaded))
+
+	result, _, err := d.continueUpload(AWSGlacierUpload{
+		Source:       resume.Source,
+		VaultName:    resume.VaultName,
+		ArchiveDesc:  meta.ArchiveDescription,
+		PartSize:     meta.PartSize,
+		Concurrency:  resume.Concurrency,
+		Spool:        resume.Spool,
+		KeepOnCancel: resume.KeepOnCancel,
+		Context:      resume.Context,
+	}, &resume.UploadId, uploaded)
+
+	return result, err
+}
+
+// continueUpload writes all parts which are not written yet and joins them to the archive. If an error occurred,
+// the parts will be kept. So that the upload can be resumed later. Only a cancelled upload will be aborted
+// (unless it should be kept).
+func (d *directoryBackend) continueUpload(upload AWSGlacierUpload, uploadId *string, uploaded map[string]string) (*AWSGlacierUploadResult, *string, error) {
+	uploadDir := filepath.Join(upload.VaultName, directoryUploads, *uploadId)
+
+	totalBytes, hashes, err := uploadMultipartParts(upload, d.limiter, uploaded, treeHashOfPart, func(part *glacierPart) error {
+		return d.writePart(part, uploadDir)
+	})
+	if err != nil && isCancelled(err) && !upload.KeepOnCancel {
+		if rmErr := os.RemoveAll(uploadDir); rmErr != nil {
+			LogError("Could not abort multipart upload %s: %v", *uploadId, rmErr)
+		}
+		return nil, uploadId, errors.Wrap(err, "Failed to write into the directory vault. Upload aborted")
+	}
+	if err != nil {
+		LogInfo("Keep multipart upload for a later resume: %s", *uploadId)
+		return nil, uploadId, errors.Wrap(err, "Failed to write into the directory vault. Upload is kept for a later resume")
+	}
+
+	archive, err := d.completeUpload(upload.VaultName, uploadDir, upload.ArchiveDesc, hashes, totalBytes)
+	if err != nil {
+		LogInfo("Keep multipart upload for a later resume: %s", *uploadId)
+		return nil, uploadId, errors.Wrap(err, "Error while completing multipart upload. Upload is kept for a later resume")
+	}
+	LogInfo("Complete multipart upload: %+v", archive)
+
+	return &AWSGlacierUploadResult{
+		ArchiveDesc: upload.ArchiveDesc,
+		PartSize:    upload.PartSize,
+		CreationResult: &glacier.ArchiveCreationOutput{
+			ArchiveId: aws.String(archive.ArchiveId),
+			Checksum:  aws.String(archive.SHA256TreeHash),
+			Location:  aws.String(filepath.Join(upload.VaultName, directoryArchives, archive.ArchiveId)),
+		},
+		TotalSize: totalBytes,
+	}, uploadId, nil
+}
+
+// writePart writes the part into its own file (named by its range) in the directory of the upload
+func (d *directoryBackend) writePart(part *glacierPart, uploadDir string) error {
+	if _, err := part.buffer.Seek(0, io.SeekStart); err != nil {
+		return errors.Wrap(err, "Could not read the buffer of the part")
+	}
+
+	start := time.Now()
+	partFile := filepath.Join(uploadDir, part.Range())
+	err := writeFile(partFile, d.limiter.Reader(part.buffer))
+	if err != nil {
+		return errors.Wrap(err, "Error while writing part")
+	}
+	LogInfo("Uploaded multipart part %d (%d bytes) in %s: %s", part.index, part.length, time.Since(start).Round(time.Millisecond), throughput(part.length, time.Since(start)))
+
+	return nil
+}
+
+// listParts returns all already written parts (range -> tree hash) of the given upload
+func (d *directoryBackend) listParts(uploadDir string) (map[string]string, error) {
+	files, err := ioutil.ReadDir(uploadDir)
+	if err != nil {
+		return nil, err
+	}
+
+	uploaded := map[string]string{}
+	for _, file := range files {
+		var first, last int64
+		if n, _ := fmt.Sscanf(file.Name(), "%d-%d", &first, &last); n != 2 || file.Name() != fmt.Sprintf("%d-%d", first, last) {
+			continue
+		}
+
+		treeHash, err := treeHashOfFile(filepath.Join(uploadDir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		uploaded[file.Name()] = treeHash
+	}
+
+	return uploaded, nil
+}
+
+// completeUpload joins the parts of the upload to the archive. The tree hash of the archive will be compared with
+// the tree hash of the given part hashes.
+func (d *directoryBackend) completeUpload(vaultName, uploadDir, archiveDesc string, hashes [][]byte, totalBytes int64) (*directoryArchive, error) {
+	var partFiles []string
+	for offset, index := int64(0), 0; index < len(hashes); index++ {
+		matches, err := filepath.Glob(filepath.Join(uploadDir, fmt.Sprintf("%d-*", offset)))
+		if err != nil || len(matches) != 1 {
+			return nil, errors.Errorf("The part %d (offset %d) is missing", index, offset)
+		}
+
+		var first, last int64
+		fmt.Sscanf(filepath.Base(matches[0]), "%d-%d", &first, &last)
+		partFiles = append(partFiles, matches[0])
+		offset = last + 1
+	}
+
+	archiveId, err := newDirectoryId()
+	if err != nil {
+		return nil, err
+	}
+	archiveFile := filepath.Join(vaultName, directoryArchives, archiveId)
+
+	parts := &multiFileReader{files: partFiles}
+	defer parts.Close()
+
+	treeHash := NewTreeHashWriter()
+	counter := &countingWriter{w: treeHash}
+	if err := writeFile(archiveFile, io.TeeReader(parts, counter)); err != nil {
+		return nil, errors.Wrap(err, "Could not write the archive")
+	}
+
+	expected := hex.EncodeToString(glacier.ComputeTreeHash(hashes))
+	if counter.written != totalBytes || treeHash.HexTreeHash() != expected {
+		os.Remove(archiveFile)
+		return nil, errors.Errorf("The checksum of the archive (%s, %d bytes) does not match the local one (%s, %d bytes)", treeHash.HexTreeHash(), counter.written, expected, totalBytes)
+	}
+
+	archive := &directoryArchive{
+		ArchiveId:          archiveId,
+		ArchiveDescription: archiveDesc,
+		CreationDate:       time.Now().UTC(),
+		Size:               totalBytes,
+		SHA256TreeHash:     expected,
+	}
+	if err := writeJSON(archiveFile+".json", archive); err != nil {
+		os.Remove(archiveFile)
+		return nil, errors.Wrap(err, "Could not write the metadata of the archive")
+	}
+
+	if err := os.RemoveAll(uploadDir); err != nil {
+		LogError("Could not remove the parts of the upload: %v", err)
+	}
+
+	return archive, nil
+}
+
+func (d *directoryBackend) Download(download AWSGlacierDownload) error {
+	jobId := download.JobId
+	if jobId == "" {
+		var err error
+		jobId, err = d.RequestRetrieval(AWSGlacierRetrieval{
+			VaultName:          download.VaultName,
+			ArchiveId:          download.ArchiveId,
+			Tier:               download.Tier,
+			RetrievalByteRange: download.RetrievalByteRange,
+		})
+		if err != nil {
+			return errors.Wrap(err, "Could not init download job")
+		}
+
+		if err := d.waitForJob(download.context(), download.VaultName, jobId, download.PollInterval); err != nil {
+			return errors.Wrap(err, "Error while waiting for job completion")
+		}
+	}
+
+	job, err := d.DescribeJob(download.VaultName, jobId)
+	if err != nil {
+		return errors.Wrap(err, "Could not get job status")
+	}
+	if !job.Completed {
+		return errors.Errorf("The job %s is not completed yet", jobId)
+	}
+	if !job.Succeeded {
+		return errors.Errorf("The job %s has failed: %s", jobId, job.StatusMessage)
+	}
+
+	dirJob := &directoryJob{}
+	if err := readJSON(d.jobFile(download.VaultName, jobId), dirJob); err != nil {
+		return errors.Wrap(err, "Could not read job")
+	}
+	archive := &directoryArchive{}
+	if err := readJSON(d.archiveFile(download.VaultName, dirJob.ArchiveId)+".json", archive); err != nil {
+		return errors.Wrap(err, "Could not read the metadata of the archive")
+	}
+
+	output := retrievalOutput{
+		jobId: jobId,
+		size:  archive.Size,
+	}
+	first := int64(0)
+	if dirJob.RetrievalByteRange == "" {
+		output.treeHash = &archive.SHA256TreeHash
+	} else {
+		var last int64
+		if n, _ := fmt.Sscanf(dirJob.RetrievalByteRange, "%d-%d", &first, &last); n != 2 {
+			return errors.Errorf("Invalid byte range: %s", dirJob.RetrievalByteRange)
+		}
+		output.size = last - first + 1
+	}
+	output.fetch = func(target io.WriterAt, chunk downloadChunk) ([]byte, error) {
+		return d.readChunk(d.archiveFile(download.VaultName, dirJob.ArchiveId), first, target, chunk)
+	}
+
+	if err := downloadOutput(download, output); err != nil {
+		return errors.Wrap(err, "Error while downloading job output")
+	}
+
+	return nil
+}
+
+// readChunk copies the given chunk of the archive into the target. The offset of the chunk is relative to
+// the given first byte. It returns the tree hash of the chunk.
+func (d *directoryBackend) readChunk(archiveFile string, first int64, target io.WriterAt, chunk downloadChunk) ([]byte, error) {
+	file, err := os.Open(archiveFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not open archive")
+	}
+	defer file.Close()
+
+	treeHash := NewTreeHashWriter()
+	section := io.NewSectionReader(file, first+chunk.offset, chunk.length)
+	written, err := io.Copy(io.MultiWriter(&offsetWriter{target, chunk.offset}, treeHash), d.limiter.Reader(section))
+	if err != nil {
+		return nil, errors.Wrap(err, "Error while reading archive")
+	}
+	if written != chunk.length {
+		return nil, errors.Errorf("Read %d bytes instead of %d", written, chunk.length)
+	}
+	LogInfo("Downloaded chunk %d (%d bytes)", chunk.index, chunk.length)
+
+	return treeHash.TreeHash(), nil
+}
+
+// waitForJob waits until the given job is completed. Because the completion date is known in advance, it sleeps
+// at most until then.
+func (d *directoryBackend) waitForJob(ctx context.Context, vaultName, jobId string, pollInterval time.Duration) error {
+	for {
+		dirJob := &directoryJob{}
+		if err := readJSON(d.jobFile(vaultName, jobId), dirJob); err != nil {
+			return errors.Wrap(err, "Could not read job")
+		}
+
+		wait := time.Until(dirJob.CompletionDate)
+		if wait <= 0 {
+			return nil
+		}
+		if pollInterval > 0 && pollInterval < wait {
+			wait = pollInterval
+		}
+
+		LogInfo("Job is not completed yet. Wait for %s", wait.Round(time.Second))
+		if err := sleepContext(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+// RequestRetrieval initiates a retrieval job which will be completed after the delay of its tier. If there is
+// already a job for the given range of the archive, it will be returned instead.
+func (d *directoryBackend) RequestRetrieval(retrieval AWSGlacierRetrieval) (string, error) {
+	archive := &directoryArchive{}
+	if err := readJSON(d.archiveFile(retrieval.VaultName, retrieval.ArchiveId)+".json", archive); err != nil {
+		return "", errors.Wrapf(err, "The archive %s does not exist", retrieval.ArchiveId)
+	}
+
+	byteRange := retrieval.RetrievalByteRange
+	if byteRange == fmt.Sprintf("0-%d", archive.Size-1) {
+		byteRange = ""
+	}
+
+	//check if we have a running Retrieval-Job
+	jobs, err := d.listJobs(retrieval.VaultName)
+	if err != nil {
+		return "", errors.Wrap(err, "Could not get list of jobs")
+	}
+	for _, job := range jobs {
+		if job.ArchiveId == retrieval.ArchiveId && job.RetrievalByteRange == byteRange {
+			return job.JobId, nil
+		}
+	}
+
+	jobId, err := newDirectoryId()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now().UTC()
+	job := &directoryJob{
+		JobId:              jobId,
+		ArchiveId:          retrieval.ArchiveId,
+		Tier:               retrieval.Tier,
+		RetrievalByteRange: byteRange,
+		CreationDate:       now,
+		CompletionDate:     now.Add(d.delay(retrieval.Tier)),
+	}
+	if err := writeJSON(d.jobFile(retrieval.VaultName, jobId), job); err != nil {
+		return "", errors.Wrap(err, "Error while initialise the archive download job")
+	}
+	LogInfo("Initiated retrieval job %s: it will be completed at %s", jobId, job.CompletionDate.Local().Format(time.RFC3339))
+
+	return jobId, nil
+}
+
+// delay returns the simulated duration of a retrieval job of the given tier
+func (d *directoryBackend) delay(tier string) time.Duration {
+	if delay, ok := d.delays[tier]; ok {
+		return delay
+	}
+
+	return d.delays[""]
+}
+
+// DescribeJob returns the status of the given job. A job which is completed since more than JobOutputAvailability
+// is expired like a glacier job and will be removed.
+func (d *directoryBackend) DescribeJob(vaultName, jobId string) (*AWSGlacierJob, error) {
+	dirJob := &directoryJob{}
+	if err := readJSON(d.jobFile(vaultName, jobId), dirJob); os.IsNotExist(errors.Cause(err)) {
+		return nil, ErrJobNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if now.After(dirJob.CompletionDate.Add(JobOutputAvailability)) {
+		if err := os.Remove(d.jobFile(vaultName, jobId)); err != nil {
+			LogError("Could not remove the expired job %s: %v", jobId, err)
+		}
+		return nil, ErrJobNotFound
+	}
+
+	job := &AWSGlacierJob{JobId: jobId}
+	if now.Before(dirJob.CompletionDate) {
+		return job, nil
+	}
+
+	job.Completed = true
+	job.CompletionDate = &dirJob.CompletionDate
+	if _, err := os.Stat(d.archiveFile(vaultName, dirJob.ArchiveId)); err != nil {
+		job.StatusMessage = fmt.Sprintf("The archive %s does not exist", dirJob.ArchiveId)
+		return job, nil
+	}
+	job.Succeeded = true
+
+	return job, nil
+}
+
+// listJobs returns all retrieval jobs of the vault which are not expired yet
+func (d *directoryBackend) listJobs(vaultName string) ([]*directoryJob, error) {
+	files, err := filepath.Glob(filepath.Join(vaultName, directoryJobs, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var jobs []*directoryJob
+	for _, file := range files {
+		jobId := strings.TrimSuffix(filepath.Base(file), ".json")
+		if _, err := d.DescribeJob(vaultName, jobId); err == ErrJobNotFound {
+			continue
+		}
+
+		job := &directoryJob{}
+		if err := readJSON(file, job); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+
+	return jobs, nil
+}
+
+func (d *directoryBackend) Delete(delete AWSGlacierDelete) error {
+	archiveFile := d.archiveFile(delete.VaultName, delete.ArchiveId)
+	if _, err := os.Stat(archiveFile); err != nil {
+		return errors.Wrapf(err, "Could not delete archive")
+	}
+
+	if err := os.Remove(archiveFile); err != nil {
+		return errors.Wrap(err, "Could not delete archive")
+	}
+	if err := os.Remove(archiveFile + ".json"); err != nil && !os.IsNotExist(err) {
+		LogError("Could not remove the metadata of the archive %s: %v", delete.ArchiveId, err)
+	}
+	LogInfo("Complete DeleteArchive: %s", delete.ArchiveId)
+
+	return nil
+}
+
+// Inventory lists all archives of the directory vault. In contrast to glacier the list is always up to date.
+func (d *directoryBackend) Inventory(inventory AWSGlacierInventory) (*VaultInventory, error) {
+	if err := checkVault(inventory.VaultName); err != nil {
+		return nil, err
+	}
+
+	files, err := filepath.Glob(filepath.Join(inventory.VaultName, directoryArchives, "*.json"))
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not list archives")
+	}
+	sort.Strings(files)
+
+	result := &VaultInventory{
+		VaultARN:      "file://" + inventory.VaultName,
+		InventoryDate: time.Now().UTC(),
+	}
+	for _, file := range files {
+		archive := &directoryArchive{}
+		if err := readJSON(file, archive); err != nil {
+			return nil, errors.Wrapf(err, "Could not read the metadata of the archive %s", file)
+		}
+
+		result.ArchiveList = append(result.ArchiveList, InventoryArchive{
+			ArchiveId:          archive.ArchiveId,
+			ArchiveDescription: archive.ArchiveDescription,
+			CreationDate:       archive.CreationDate,
+			Size:               archive.Size,
+			SHA256TreeHash:     archive.SHA256TreeHash,
+		})
+	}
+	LogInfo("Listed %d archives of directory vault %s", len(result.ArchiveList), inventory.VaultName)
+
+	return result, nil
+}
+
+func (d *directoryBackend) archiveFile(vaultName, archiveId string) string {
+	return filepath.Join(vaultName, directoryArchives, filepath.Base(archiveId))
+}
+
+func (d *directoryBackend) jobFile(vaultName, jobId string) string {
+	return filepath.Join(vaultName, directoryJobs, filepath.Base(jobId)+".json")
+}
+
+// treeHashOfFile returns the (hex) tree hash of the content of the given file
+func treeHashOfFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	treeHash := NewTreeHashWriter()
+	if _, err := io.Copy(treeHash, file); err != nil {
+		return "", err
+	}
+
+	return treeHash.HexTreeHash(), nil
+}
+
+// writeFile writes the content of the reader into the given file. The content is written into a temporary file
+// first, so that an interruption will never leave an incomplete file.
+func writeFile(path string, content io.Reader) error {
+	tmpFile := path + ".tmp"
+	file, err := os.Create(tmpFile)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(file, content)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpFile)
+		return err
+	}
+
+	return os.Rename(tmpFile, path)
+}
+
+func writeJSON(path string, value interface{}) error {
+	content, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	return writeFile(path, strings.NewReader(string(content)))
+}
+
+func readJSON(path string, value interface{}) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return json.Unmarshal(content, value)
+}
+
+// multiFileReader reads the given files one after another
+type multiFileReader struct {
+	files   []string
+	current *os.File
+}
+
+func (r *multiFileReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if len(r.files) == 0 {
+				return 0, io.EOF
+			}
+
+			file, err := os.Open(r.files[0])
+			if err != nil {
+				return 0, err
+			}
+			r.current = file
+			r.files = r.files[1:]
+		}
+
+		n, err := r.current.Read(p)
+		if err == io.EOF {
+			r.current.Close()
+			r.current = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+
+		return n, err
+	}
+}
+
+func (r *multiFileReader) Close() error {
+	if r.current == nil {
+		return nil
+	}
+
+	return r.current.Close()
+}
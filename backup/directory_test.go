@@ -0,0 +1,263 @@
+package backup
+
+import (
+	"archive/zip"
+	"backup2glacier/database"
+	"bytes"
+	"fmt"
+	"github.com/aws/aws-sdk-go/service/glacier"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func newDirectoryTestBackend(t *testing.T, delays map[string]time.Duration) (*directoryBackend, string, func()) {
+	dir, err := ioutil.TempDir("", "directory")
+	assert.NoError(t, err)
+
+	vault := path.Join(dir, "vault")
+	assert.NoError(t, EnsureDirectoryVault(vault))
+
+	return &directoryBackend{delays: delays}, vault, func() {
+		os.RemoveAll(dir)
+	}
+}
+
+func TestDirectoryBackend_UploadDownload(t *testing.T) {
+	toTest, vault, cleanup := newDirectoryTestBackend(t, nil)
+	defer cleanup()
+
+	data := make([]byte, 2*mib+17)
+	rand.Read(data)
+
+	result, _, err := toTest.Upload(AWSGlacierUpload{
+		Source:      bytes.NewReader(data),
+		VaultName:   vault,
+		ArchiveDesc: "description",
+		PartSize:    mib,
+		Concurrency: 2,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(data)), result.TotalSize)
+	assert.Equal(t, fmt.Sprintf("%x", glacier.ComputeHashes(bytes.NewReader(data)).TreeHash), *result.CreationResult.Checksum)
+
+	//the parts are joined and removed
+	uploads, _ := ioutil.ReadDir(path.Join(vault, directoryUploads))
+	assert.Empty(t, uploads)
+
+	target := path.Join(path.Dir(vault), "download")
+	err = toTest.Download(AWSGlacierDownload{
+		Target:    target,
+		ChunkSize: mib,
+		VaultName: vault,
+		ArchiveId: *result.CreationResult.ArchiveId,
+		Checksum:  *result.CreationResult.Checksum,
+	})
+	assert.NoError(t, err)
+
+	downloaded, err := ioutil.ReadFile(target)
+	assert.NoError(t, err)
+	assert.Equal(t, data, downloaded)
+
+	//only a range of the archive
+	err = toTest.Download(AWSGlacierDownload{
+		Target:             target + ".range",
+		ChunkSize:          mib,
+		VaultName:          vault,
+		ArchiveId:          *result.CreationResult.ArchiveId,
+		RetrievalByteRange: fmt.Sprintf("%d-%d", mib, 2*mib-1),
+	})
+	assert.NoError(t, err)
+
+	downloaded, err = ioutil.ReadFile(target + ".range")
+	assert.NoError(t, err)
+	assert.Equal(t, data[mib:2*mib], downloaded)
+
+	inventory, err := toTest.Inventory(AWSGlacierInventory{VaultName: vault})
+	assert.NoError(t, err)
+	assert.Len(t, inventory.ArchiveList, 1)
+	assert.Equal(t, *result.CreationResult.ArchiveId, inventory.ArchiveList[0].ArchiveId)
+	assert.Equal(t, "description", inventory.ArchiveList[0].ArchiveDescription)
+	assert.Equal(t, int64(len(data)), inventory.ArchiveList[0].Size)
+	assert.Equal(t, *result.CreationResult.Checksum, inventory.ArchiveList[0].SHA256TreeHash)
+
+	assert.NoError(t, toTest.Delete(AWSGlacierDelete{VaultName: vault, ArchiveId: *result.CreationResult.ArchiveId}))
+	assert.Error(t, toTest.Delete(AWSGlacierDelete{VaultName: vault, ArchiveId: *result.CreationResult.ArchiveId}))
+
+	inventory, err = toTest.Inventory(AWSGlacierInventory{VaultName: vault})
+	assert.NoError(t, err)
+	assert.Empty(t, inventory.ArchiveList)
+}
+
+func TestDirectoryBackend_Upload_MissingVault(t *testing.T) {
+	toTest, vault, cleanup := newDirectoryTestBackend(t, nil)
+	defer cleanup()
+
+	_, _, err := toTest.Upload(AWSGlacierUpload{
+		Source:    bytes.NewReader([]byte("content")),
+		VaultName: path.Join(vault, "unmounted"),
+		PartSize:  mib,
+	})
+	assert.Error(t, err)
+}
+
+func TestDirectoryBackend_Resume(t *testing.T) {
+	toTest, vault, cleanup := newDirectoryTestBackend(t, nil)
+	defer cleanup()
+
+	data := make([]byte, 3*mib)
+	rand.Read(data)
+
+	//the source breaks after the first part: the written part is kept
+	_, uploadId, err := toTest.Upload(AWSGlacierUpload{
+		Source:    io.MultiReader(bytes.NewReader(data[:mib+10]), &failingReader{}),
+		VaultName: vault,
+		PartSize:  mib,
+	})
+	assert.Error(t, err)
+	assert.NotNil(t, uploadId)
+
+	parts, err := toTest.listParts(path.Join(vault, directoryUploads, *uploadId))
+	assert.NoError(t, err)
+	assert.Len(t, parts, 1)
+
+	//a different source will be detected
+	other := make([]byte, len(data))
+	rand.Read(other)
+	_, err = toTest.Resume(AWSGlacierResume{
+		Source:    bytes.NewReader(other),
+		VaultName: vault,
+		UploadId:  *uploadId,
+	})
+	assert.Error(t, err)
+
+	result, err := toTest.Resume(AWSGlacierResume{
+		Source:    bytes.NewReader(data),
+		VaultName: vault,
+		UploadId:  *uploadId,
+	})
+	assert.NoError(t, err)
+
+	content, err := ioutil.ReadFile(toTest.archiveFile(vault, *result.CreationResult.ArchiveId))
+	assert.NoError(t, err)
+	assert.Equal(t, data, content)
+
+	//the upload does not exist anymore
+	_, err = toTest.Resume(AWSGlacierResume{
+		Source:    bytes.NewReader(data),
+		VaultName: vault,
+		UploadId:  *uploadId,
+	})
+	assert.Equal(t, ErrUploadNotFound, err)
+}
+
+func TestDirectoryBackend_RetrievalDelay(t *testing.T) {
+	toTest, vault, cleanup := newDirectoryTestBackend(t, map[string]time.Duration{"": time.Hour, "Expedited": 0})
+	defer cleanup()
+
+	result, _, err := toTest.Upload(AWSGlacierUpload{
+		Source:    bytes.NewReader([]byte("content")),
+		VaultName: vault,
+		PartSize:  mib,
+	})
+	assert.NoError(t, err)
+	archiveId := *result.CreationResult.ArchiveId
+
+	jobId, err := toTest.RequestRetrieval(AWSGlacierRetrieval{VaultName: vault, ArchiveId: archiveId, Tier: "Bulk"})
+	assert.NoError(t, err)
+
+	job, err := toTest.DescribeJob(vault, jobId)
+	assert.NoError(t, err)
+	assert.False(t, job.Completed)
+
+	//the running job will be reused
+	sameJobId, err := toTest.RequestRetrieval(AWSGlacierRetrieval{VaultName: vault, ArchiveId: archiveId, Tier: "Bulk"})
+	assert.NoError(t, err)
+	assert.Equal(t, jobId, sameJobId)
+
+	err = toTest.Download(AWSGlacierDownload{Target: path.Join(path.Dir(vault), "download"), VaultName: vault, ArchiveId: archiveId, JobId: jobId})
+	assert.Error(t, err)
+
+	//the job is completed
+	setJobCompletion(t, toTest, vault, jobId, time.Now().Add(-time.Minute))
+	job, err = toTest.DescribeJob(vault, jobId)
+	assert.NoError(t, err)
+	assert.True(t, job.Completed)
+	assert.True(t, job.Succeeded)
+
+	err = toTest.Download(AWSGlacierDownload{Target: path.Join(path.Dir(vault), "download"), VaultName: vault, ArchiveId: archiveId, JobId: jobId})
+	assert.NoError(t, err)
+
+	//the output is expired
+	setJobCompletion(t, toTest, vault, jobId, time.Now().Add(-JobOutputAvailability-time.Minute))
+	_, err = toTest.DescribeJob(vault, jobId)
+	assert.Equal(t, ErrJobNotFound, err)
+
+	//an expedited job has no delay
+	jobId, err = toTest.RequestRetrieval(AWSGlacierRetrieval{VaultName: vault, ArchiveId: archiveId, Tier: "Expedited"})
+	assert.NoError(t, err)
+	job, err = toTest.DescribeJob(vault, jobId)
+	assert.NoError(t, err)
+	assert.True(t, job.Completed)
+
+	//the archive was deleted in the meantime
+	assert.NoError(t, toTest.Delete(AWSGlacierDelete{VaultName: vault, ArchiveId: archiveId}))
+	job, err = toTest.DescribeJob(vault, jobId)
+	assert.NoError(t, err)
+	assert.True(t, job.Completed)
+	assert.False(t, job.Succeeded)
+}
+
+func setJobCompletion(t *testing.T, toTest *directoryBackend, vault, jobId string, completion time.Time) {
+	job := &directoryJob{}
+	assert.NoError(t, readJSON(toTest.jobFile(vault, jobId), job))
+	job.CompletionDate = completion
+	assert.NoError(t, writeJSON(toTest.jobFile(vault, jobId), job))
+}
+
+func TestBackupManager_DirectoryBackend(t *testing.T) {
+	_, vault, cleanup := newDirectoryTestBackend(t, nil)
+	defer cleanup()
+	dbFile := path.Join(path.Dir(vault), "database.db")
+
+	//create
+	creater, err := NewBackupCreater("secret", false, mib, 0, 1, SpoolConfig{Mode: SpoolModeMemory}, BackendDirectory, "", nil, dbFile)
+	assert.NoError(t, err)
+	result := creater.Create([]string{"./directory_test.go"}, []*regexp.Regexp{}, []*regexp.Regexp{}, "description", vault)
+	creater.Close()
+	assert.NoError(t, result.Error)
+	assert.Len(t, result.Volumes, 1)
+
+	repository := database.NewRepository(dbFile)
+	dbBackup := repository.GetBackupById(1)
+	repository.Close()
+	assert.Equal(t, BackendDirectory, dbBackup.Backend)
+
+	//get
+	getter, err := NewBackupGetter(nil, "Standard", time.Millisecond, 0, 1, dbFile)
+	assert.NoError(t, err)
+	target := path.Join(path.Dir(vault), "backup.zip")
+	err = getter.Download(dbBackup.ID, 0, target, func() string { return "secret" })
+	getter.Close()
+	assert.NoError(t, err)
+
+	unzipReader, err := zip.OpenReader(target)
+	assert.NoError(t, err)
+	assert.Len(t, unzipReader.File, 1)
+	unzipReader.Close()
+
+	//delete
+	deleter, err := NewBackupDeleter(dbFile)
+	assert.NoError(t, err)
+	assert.NoError(t, deleter.Delete(dbBackup.ID))
+	deleter.(*backupManager).Close()
+
+	archives, _ := ioutil.ReadDir(path.Join(vault, directoryArchives))
+	assert.Empty(t, archives)
+}
@@ -0,0 +1,381 @@
+package backup
+
+import (
+	. "backup2glacier/log"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/glacier"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultDownloadChunkSize is the size of the ranges in which the job output will be downloaded
+const DefaultDownloadChunkSize = 64 * 1024 * 1024
+
+// downloadProgress contains all chunks of a job output which are already downloaded and verified. It will be
+// saved next to the target file, so that an interrupted download can be continued.
+type downloadProgress struct {
+	ArchiveId string
+	JobId     string
+	Size      int64
+	ChunkSize int64
+	// Chunks contains the tree hash of each downloaded chunk (by chunk index)
+	Chunks map[int]string
+}
+
+type downloadChunk struct {
+	index  int
+	offset int64
+	length int64
+}
+
+// ProgressFile returns the path of the file which holds the progress of the download into the given target
+func ProgressFile(target string) string {
+	return target + ".progress"
+}
+
+// IsValidChunkSize checks if the chunk size is a power of two multiple of 1 MiB. Only then glacier sends the
+// tree hash of each chunk and the tree hashes of the chunks can be combined to the tree hash of the archive.
+func IsValidChunkSize(chunkSize int64) bool {
+	mibs := chunkSize / (1024 * 1024)
+	return chunkSize%(1024*1024) == 0 && mibs > 0 && mibs&(mibs-1) == 0
+}
+
+// Range returns the byte range (inclusive of the upper value) of this chunk
+func (c downloadChunk) Range() string {
+	return fmt.Sprintf("bytes=%d-%d", c.offset, c.offset+c.length-1)
+}
+
+// retrievalOutput is the retrieved content of an archive (or of a range of it) which can be downloaded in chunks
+type retrievalOutput struct {
+	jobId string
+	size  int64
+	// treeHash is the tree hash of the whole output which is known by the storage backend. It is nil if the
+	// storage backend does not know it.
+	treeHash *string
+	// fetch downloads the given chunk of the output into the target and returns the tree hash of the chunk
+	fetch func(target io.WriterAt, chunk downloadChunk) ([]byte, error)
+}
+
+// downloadJobOutput downloads the output of the given (completed) glacier job into the target file
+func (a *awsGlacier) downloadJobOutput(download AWSGlacierDownload, job *glacier.JobDescription) error {
+	jobId := aws.StringValue(job.JobId)
+
+	return downloadOutput(download, retrievalOutput{
+		jobId:    jobId,
+		size:     jobOutputSize(job),
+		treeHash: job.SHA256TreeHash,
+		fetch: func(target io.WriterAt, chunk downloadChunk) ([]byte, error) {
+			return a.downloadChunk(download.context(), download.VaultName, jobId, target, chunk)
+		},
+	})
+}
+
+// context returns the context of the download or the background context if there is none
+func (d AWSGlacierDownload) context() context.Context {
+	if d.Context == nil {
+		return context.Background()
+	}
+
+	return d.Context
+}
+
+// sleepContext waits for the given duration. It returns the error of the context if it is cancelled before.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// downloadOutput downloads the given output in ranged chunks into the target file. Up to concurrency chunks
+// will be downloaded at the same time. Each chunk will be verified by its tree hash. Chunks which are already
+// downloaded by a previous (interrupted) run will be verified and skipped. At the end the tree hash of the
+// whole output will be compared with the expected checksum and the checksum of the output.
+func downloadOutput(download AWSGlacierDownload, output retrievalOutput) error {
+	chunkSize := download.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultDownloadChunkSize
+	}
+	if !IsValidChunkSize(chunkSize) {
+		return errors.Errorf("The chunk size must be a power of two multiple of 1 MiB: %d", chunkSize)
+	}
+	concurrency := download.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	size := output.size
+	jobId := output.jobId
+
+	progress := loadProgress(download.Target, download.ArchiveId, size, chunkSize)
+	progress.JobId = jobId
+
+	target, err := os.OpenFile(download.Target, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return errors.Wrap(err, "Could not open target file")
+	}
+	defer target.Close()
+
+	if len(progress.Chunks) == 0 {
+		if err := target.Truncate(0); err != nil {
+			return errors.Wrap(err, "Could not truncate target file")
+		}
+	}
+	if err := target.Truncate(size); err != nil {
+		return errors.Wrap(err, "Could not allocate target file")
+	}
+
+	var chunks []downloadChunk
+	for offset := int64(0); offset < size; offset += chunkSize {
+		length := chunkSize
+		if offset+length > size {
+			length = size - offset
+		}
+		chunks = append(chunks, downloadChunk{index: len(chunks), offset: offset, length: length})
+	}
+
+	hashes := make([][]byte, len(chunks))
+	var pending []downloadChunk
+	for _, chunk := range chunks {
+		hash, err := verifyChunk(target, chunk, progress.Chunks[chunk.index])
+		if err != nil {
+			LogInfo("Chunk %d (%s) has to be downloaded again: %v", chunk.index, chunk.Range(), err)
+			delete(progress.Chunks, chunk.index)
+			pending = append(pending, chunk)
+			continue
+		}
+		if hash == nil {
+			pending = append(pending, chunk)
+			continue
+		}
+		hashes[chunk.index] = hash
+	}
+	if len(pending) < len(chunks) {
+		LogInfo("Continue download of job %s: %d of %d chunks are already downloaded", jobId, len(chunks)-len(pending), len(chunks))
+	}
+
+	ctx := download.context()
+	var downloaded int64
+	for _, chunk := range chunks {
+		if hashes[chunk.index] != nil {
+			downloaded += chunk.length
+		}
+	}
+
+	var downloadErr error
+	mutex := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	slots := make(chan bool, concurrency)
+	start := time.Now()
+	var transferred int64
+
+	for _, chunk := range pending {
+		slots <- true
+
+		mutex.Lock()
+		if downloadErr == nil && ctx.Err() != nil {
+			downloadErr = ctx.Err()
+		}
+		failed := downloadErr != nil
+		mutex.Unlock()
+		if failed {
+			<-slots
+			break
+		}
+
+		wg.Add(1)
+		go func(chunk downloadChunk) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			hash, err := output.fetch(target, chunk)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			if err != nil {
+				if downloadErr == nil {
+					downloadErr = errors.Wrapf(err, "Failed to download chunk %d", chunk.index)
+				}
+				return
+			}
+
+			hashes[chunk.index] = hash
+			transferred += chunk.length
+			downloaded += chunk.length
+			progress.Chunks[chunk.index] = hex.EncodeToString(hash)
+			if err := saveProgress(download.Target, progress); err != nil {
+				LogError("Could not save the download progress: %v", err)
+			}
+			if download.Progress != nil {
+				download.Progress(downloaded)
+			}
+		}(chunk)
+	}
+
+	wg.Wait()
+
+	if downloadErr != nil {
+		return downloadErr
+	}
+	LogInfo("Downloaded %d chunks (%d bytes) in %s: %s", len(pending), transferred, time.Since(start).Round(time.Second), throughput(transferred, time.Since(start)))
+
+	treeHash := hex.EncodeToString(glacier.ComputeTreeHash(hashes))
+	if size == 0 {
+		treeHash = hex.EncodeToString(NewTreeHashWriter().TreeHash())
+	}
+	if output.treeHash != nil && *output.treeHash != treeHash {
+		return errors.Errorf("The checksum of the job output (%s) does not match the checksum of the downloaded content (%s)", *output.treeHash, treeHash)
+	}
+	if download.Checksum != "" && download.Checksum != treeHash {
+		return errors.Errorf("The checksum of the downloaded content (%s) does not match the checksum of the archive (%s)", treeHash, download.Checksum)
+	}
+	LogInfo("The checksum of the downloaded content is valid: %s", treeHash)
+
+	if err := os.Remove(ProgressFile(download.Target)); err != nil && !os.IsNotExist(err) {
+		LogError("Could not remove the download progress file: %v", err)
+	}
+
+	return nil
+}
+
+// jobOutputSize returns the size of the output of the given retrieval job. This is the size of the archive or
+// of the retrieved range of it.
+func jobOutputSize(job *glacier.JobDescription) int64 {
+	var first, last int64
+	if n, _ := fmt.Sscanf(aws.StringValue(job.RetrievalByteRange), "%d-%d", &first, &last); n == 2 {
+		return last - first + 1
+	}
+
+	return aws.Int64Value(job.ArchiveSizeInBytes)
+}
+
+// downloadChunk downloads the given range of the job output into the target. It returns the tree hash of the chunk.
+func (a *awsGlacier) downloadChunk(ctx context.Context, vaultName, jobId string, target io.WriterAt, chunk downloadChunk) ([]byte, error) {
+	var hash []byte
+
+	err := a.retryer.do(ctx, fmt.Sprintf("GetJobOutput %s", chunk.Range()), func() error {
+		request := &glacier.GetJobOutputInput{
+			AccountId: a.accountId(),
+			VaultName: aws.String(vaultName),
+			JobId:     aws.String(jobId),
+			Range:     aws.String(chunk.Range()),
+		}
+		LogDebug("Send GetJobOutput: %+v", request)
+
+		result, err := a.glacier.GetJobOutputWithContext(ctx, request)
+		if err != nil {
+			return err
+		}
+		defer result.Body.Close()
+
+		treeHash := NewTreeHashWriter()
+		written, err := io.Copy(io.MultiWriter(&offsetWriter{target, chunk.offset}, treeHash), a.limiter.Reader(result.Body))
+		if err != nil {
+			//a dropped connection is worth a retry
+			return awserr.New("RequestError", "Error while reading job output", err)
+		}
+		if written != chunk.length {
+			return awserr.New("RequestError", fmt.Sprintf("Received %d bytes instead of %d", written, chunk.length), nil)
+		}
+		if result.Checksum != nil && *result.Checksum != treeHash.HexTreeHash() {
+			return errors.Errorf("The checksum of the chunk %s (%s) does not match the checksum of the downloaded content (%s)", chunk.Range(), *result.Checksum, treeHash.HexTreeHash())
+		}
+
+		hash = treeHash.TreeHash()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	LogInfo("Downloaded chunk %d (%d bytes)", chunk.index, chunk.length)
+
+	return hash, nil
+}
+
+// verifyChunk checks if the given chunk of the target has the expected tree hash. If there is no expected
+// tree hash (the chunk is not downloaded yet) nil will be returned.
+func verifyChunk(target io.ReaderAt, chunk downloadChunk, expected string) ([]byte, error) {
+	if expected == "" {
+		return nil, nil
+	}
+
+	treeHash := NewTreeHashWriter()
+	if _, err := io.Copy(treeHash, io.NewSectionReader(target, chunk.offset, chunk.length)); err != nil {
+		return nil, errors.Wrap(err, "Could not read chunk")
+	}
+	if treeHash.HexTreeHash() != expected {
+		return nil, errors.Errorf("The checksum of the chunk (%s) does not match the expected one (%s)", treeHash.HexTreeHash(), expected)
+	}
+
+	return treeHash.TreeHash(), nil
+}
+
+// loadProgress reads the progress of a previous download into the given target. If there is no (matching)
+// progress, an empty one will be returned.
+func loadProgress(target, archiveId string, size, chunkSize int64) *downloadProgress {
+	empty := &downloadProgress{
+		ArchiveId: archiveId,
+		Size:      size,
+		ChunkSize: chunkSize,
+		Chunks:    map[int]string{},
+	}
+
+	content, err := ioutil.ReadFile(ProgressFile(target))
+	if err != nil {
+		return empty
+	}
+
+	progress := &downloadProgress{}
+	if err := json.Unmarshal(content, progress); err != nil {
+		LogError("Could not read the download progress: %v", err)
+		return empty
+	}
+	if progress.ArchiveId != archiveId || progress.Size != size || progress.ChunkSize != chunkSize || progress.Chunks == nil {
+		LogInfo("The download progress belongs to an other download. Start from the beginning.")
+		return empty
+	}
+
+	return progress
+}
+
+// saveProgress writes the progress of the download into the given target
+func saveProgress(target string, progress *downloadProgress) error {
+	content, err := json.Marshal(progress)
+	if err != nil {
+		return err
+	}
+
+	//write into a temporary file first, so that an interruption will not leave a broken progress file
+	tmpFile := ProgressFile(target) + ".tmp"
+	if err := ioutil.WriteFile(tmpFile, content, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpFile, ProgressFile(target))
+}
+
+type offsetWriter struct {
+	target io.WriterAt
+	offset int64
+}
+
+func (w *offsetWriter) Write(p []byte) (int, error) {
+	n, err := w.target.WriteAt(p, w.offset)
+	w.offset += int64(n)
+
+	return n, err
+}
@@ -0,0 +1,177 @@
+package backup
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/glacier"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func newDownloadTestData(t *testing.T, size int) ([]byte, string, func()) {
+	data := make([]byte, size)
+	rand.Read(data)
+
+	dir, err := ioutil.TempDir("", "download")
+	assert.NoError(t, err)
+
+	return data, path.Join(dir, "archive"), func() { os.RemoveAll(dir) }
+}
+
+func completedJob(data []byte) *glacier.JobDescription {
+	return &glacier.JobDescription{
+		JobId:              aws.String("job"),
+		ArchiveSizeInBytes: aws.Int64(int64(len(data))),
+		SHA256TreeHash:     aws.String(fmt.Sprintf("%x", computeTreeHash(data))),
+	}
+}
+
+func computeTreeHash(data []byte) []byte {
+	treeHash := NewTreeHashWriter()
+	treeHash.Write(data)
+
+	return treeHash.TreeHash()
+}
+
+func TestAwsGlacier_downloadJobOutput(t *testing.T) {
+	//given
+	data, target, cleanup := newDownloadTestData(t, 5*mib+5)
+	defer cleanup()
+
+	client := newFakeGlacierClient()
+	client.jobOutput = data
+	toTest := &awsGlacier{glacier: client, retryer: newRetryer(RetryPolicy{MaxAttempts: 1})}
+
+	//when
+	err := toTest.downloadJobOutput(AWSGlacierDownload{
+		VaultName:   "vault",
+		ArchiveId:   "archive",
+		Target:      target,
+		Checksum:    fmt.Sprintf("%x", computeTreeHash(data)),
+		ChunkSize:   mib,
+		Concurrency: 3,
+	}, completedJob(data))
+
+	//then
+	assert.NoError(t, err)
+	downloaded, _ := ioutil.ReadFile(target)
+	assert.Equal(t, data, downloaded)
+	assert.Len(t, client.requestedRanges, 6)
+	assert.Contains(t, client.requestedRanges, fmt.Sprintf("bytes=%d-%d", 5*mib, 5*mib+4))
+
+	_, err = os.Stat(ProgressFile(target))
+	assert.True(t, os.IsNotExist(err), "the progress file should be removed")
+}
+
+func TestAwsGlacier_downloadJobOutput_ChecksumMismatch(t *testing.T) {
+	data, target, cleanup := newDownloadTestData(t, 1024)
+	defer cleanup()
+
+	client := newFakeGlacierClient()
+	client.jobOutput = data
+	toTest := &awsGlacier{glacier: client, retryer: newRetryer(RetryPolicy{MaxAttempts: 1})}
+
+	err := toTest.downloadJobOutput(AWSGlacierDownload{
+		Target:   target,
+		Checksum: "0123456789abcdef",
+	}, completedJob(data))
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "does not match the checksum of the archive")
+}
+
+func TestAwsGlacier_downloadJobOutput_RetryDroppedConnection(t *testing.T) {
+	data, target, cleanup := newDownloadTestData(t, 2*mib)
+	defer cleanup()
+
+	client := newFakeGlacierClient()
+	client.jobOutput = data
+	client.dropConnections = map[string]int{fmt.Sprintf("bytes=%d-%d", mib, 2*mib-1): 1}
+	toTest := &awsGlacier{glacier: client, retryer: newRetryer(RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond})}
+
+	err := toTest.downloadJobOutput(AWSGlacierDownload{
+		Target:    target,
+		ChunkSize: mib,
+	}, completedJob(data))
+
+	assert.NoError(t, err)
+	downloaded, _ := ioutil.ReadFile(target)
+	assert.Equal(t, data, downloaded)
+	assert.Equal(t, int64(1), toTest.Retries())
+}
+
+func TestAwsGlacier_downloadJobOutput_Resume(t *testing.T) {
+	//given: the first run is interrupted at the third chunk
+	data, target, cleanup := newDownloadTestData(t, 4*mib)
+	defer cleanup()
+
+	client := newFakeGlacierClient()
+	client.jobOutput = data
+	client.dropConnections = map[string]int{fmt.Sprintf("bytes=%d-%d", 2*mib, 3*mib-1): 1}
+	toTest := &awsGlacier{glacier: client, retryer: newRetryer(RetryPolicy{MaxAttempts: 1})}
+	download := AWSGlacierDownload{
+		ArchiveId: "archive",
+		Target:    target,
+		ChunkSize: mib,
+	}
+
+	err := toTest.downloadJobOutput(download, completedJob(data))
+	assert.Error(t, err)
+	_, err = os.Stat(ProgressFile(target))
+	assert.NoError(t, err, "the progress file should be kept")
+
+	//when
+	client.requestedRanges = nil
+	err = toTest.downloadJobOutput(download, completedJob(data))
+
+	//then
+	assert.NoError(t, err)
+	downloaded, _ := ioutil.ReadFile(target)
+	assert.Equal(t, data, downloaded)
+	assert.Equal(t, []string{
+		fmt.Sprintf("bytes=%d-%d", 2*mib, 3*mib-1),
+		fmt.Sprintf("bytes=%d-%d", 3*mib, 4*mib-1),
+	}, client.requestedRanges)
+}
+
+func TestAwsGlacier_downloadJobOutput_ResumeCorruptedChunk(t *testing.T) {
+	data, target, cleanup := newDownloadTestData(t, 2*mib)
+	defer cleanup()
+
+	client := newFakeGlacierClient()
+	client.jobOutput = data
+	toTest := &awsGlacier{glacier: client, retryer: newRetryer(RetryPolicy{MaxAttempts: 1})}
+
+	//the first chunk is marked as downloaded but its content is broken
+	assert.NoError(t, ioutil.WriteFile(target, make([]byte, 2*mib), 0644))
+	assert.NoError(t, saveProgress(target, &downloadProgress{
+		ArchiveId: "archive",
+		Size:      2 * mib,
+		ChunkSize: mib,
+		Chunks:    map[int]string{0: fmt.Sprintf("%x", computeTreeHash(data[:mib]))},
+	}))
+
+	err := toTest.downloadJobOutput(AWSGlacierDownload{
+		ArchiveId: "archive",
+		Target:    target,
+		ChunkSize: mib,
+	}, completedJob(data))
+
+	assert.NoError(t, err)
+	downloaded, _ := ioutil.ReadFile(target)
+	assert.Equal(t, data, downloaded)
+	assert.Len(t, client.requestedRanges, 2)
+}
+
+func TestIsValidChunkSize(t *testing.T) {
+	assert.True(t, IsValidChunkSize(mib))
+	assert.True(t, IsValidChunkSize(64*mib))
+	assert.False(t, IsValidChunkSize(0))
+	assert.False(t, IsValidChunkSize(1024))
+	assert.False(t, IsValidChunkSize(3*mib))
+}
@@ -0,0 +1,393 @@
+package backup
+
+import (
+	"archive/zip"
+	"backup2glacier/database"
+	"backup2glacier/database/model"
+	"backup2glacier/glaciertest"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+const e2eVault = "e2e-vault"
+
+// newE2ETest starts a fake glacier server and returns the storage settings whose glacier clients talk to it. It
+// returns a temporary directory which contains a file to backup (source) and the path of the database, too.
+func newE2ETest(t *testing.T) (*glaciertest.Server, *StorageSettings, string, string, func()) {
+	server := glaciertest.NewServer()
+	server.CreateVault(e2eVault)
+
+	//the requests are signed, so that there must be any credentials
+	env := map[string]string{
+		"AWS_ACCESS_KEY_ID":     "fake",
+		"AWS_SECRET_ACCESS_KEY": "fake",
+		"AWS_REGION":            "eu-central-1",
+		"AWS_PROFILE":           "",
+	}
+	previous := map[string]string{}
+	for key, value := range env {
+		previous[key] = os.Getenv(key)
+		os.Setenv(key, value)
+	}
+
+	dir, err := ioutil.TempDir("", "e2e")
+	assert.NoError(t, err)
+
+	//random content can not be compressed, so that the archive consists of multiple parts
+	content := make([]byte, 5*mib/2)
+	rand.Read(content)
+	assert.NoError(t, ioutil.WriteFile(path.Join(dir, "source"), content, 0644))
+
+	return server, newE2ESettings(server), dir, path.Join(dir, "database.db"), func() {
+		server.Close()
+		os.RemoveAll(dir)
+
+		for key, value := range previous {
+			os.Setenv(key, value)
+		}
+	}
+}
+
+// newE2ESettings returns storage settings for the default location whose glacier clients talk to the given server
+func newE2ESettings(server *glaciertest.Server) *StorageSettings {
+	settings := NewStorageSettings()
+	settings.GlacierEndpoint = server.URL
+	settings.RetryPolicy = RetryPolicy{MaxAttempts: 1}
+
+	return settings
+}
+
+func e2eCreate(t *testing.T, settings *StorageSettings, dir, dbFile string, replicas ...ReplicaTarget) uint {
+	creater, err := NewBackupCreater("secret", true, mib, 0, 2, SpoolConfig{Mode: SpoolModeMemory}, BackendGlacier, "", replicas, dbFile, WithStorageSettings(settings))
+	assert.NoError(t, err)
+	defer creater.Close()
+
+	result := creater.Create([]string{path.Join(dir, "source")}, []*regexp.Regexp{}, []*regexp.Regexp{}, "e2e", e2eVault)
+	assert.NoError(t, result.Error)
+	assert.Len(t, result.Volumes, 1)
+	assert.True(t, result.TotalSize > 2*mib)
+
+	repository := database.NewRepository(dbFile)
+	defer repository.Close()
+	dbBackup := repository.GetBackupById(1)
+	assert.Equal(t, e2eVault, dbBackup.Vault)
+
+	return dbBackup.ID
+}
+
+// assertRestored checks if the downloaded zip contains the source file
+func assertRestored(t *testing.T, dir, target string) {
+	expected, err := ioutil.ReadFile(path.Join(dir, "source"))
+	assert.NoError(t, err)
+
+	unzipReader, err := zip.OpenReader(target)
+	assert.NoError(t, err)
+	if err != nil {
+		return
+	}
+	defer unzipReader.Close()
+
+	assert.Len(t, unzipReader.File, 1)
+	file, err := unzipReader.File[0].Open()
+	assert.NoError(t, err)
+	defer file.Close()
+
+	restored, err := ioutil.ReadAll(file)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, restored)
+}
+
+func TestEndToEnd_CreateGetDelete(t *testing.T) {
+	server, settings, dir, dbFile, cleanup := newE2ETest(t)
+	defer cleanup()
+	server.AutoComplete = true
+
+	//create
+	backupId := e2eCreate(t, settings, dir, dbFile)
+	assert.Len(t, server.ArchiveIds(e2eVault), 1)
+	assert.Empty(t, server.UploadIds(e2eVault))
+
+	//the account of the credentials is stored instead of DefaultAccountId
+	repository := database.NewRepository(dbFile)
+	assert.Equal(t, testAccountId, repository.GetBackupById(backupId).AccountId)
+	repository.Close()
+
+	//the archive can be found in the inventory
+	client, err := NewAWSGlacier(settings)
+	assert.NoError(t, err)
+	inventory, err := client.Inventory(AWSGlacierInventory{VaultName: e2eVault, PollInterval: time.Millisecond})
+	assert.NoError(t, err)
+	assert.Len(t, inventory.ArchiveList, 1)
+	metadata, ok := ParseArchiveDescription(inventory.ArchiveList[0].ArchiveDescription)
+	assert.True(t, ok)
+	assert.Equal(t, backupId, metadata.BackupId)
+
+	//get
+	getter, err := NewBackupGetter(nil, "Standard", time.Millisecond, mib, 2, dbFile, WithStorageSettings(settings))
+	assert.NoError(t, err)
+	target := path.Join(dir, "backup.zip")
+	err = getter.Download(backupId, 0, target, nil)
+	getter.Close()
+	assert.NoError(t, err)
+	assertRestored(t, dir, target)
+
+	//delete
+	deleter, err := NewBackupDeleter(dbFile, WithStorageSettings(settings))
+	assert.NoError(t, err)
+	assert.NoError(t, deleter.Delete(backupId))
+	deleter.(*backupManager).Close()
+	assert.Empty(t, server.ArchiveIds(e2eVault))
+}
+
+func TestEndToEnd_RequestAndFetch(t *testing.T) {
+	server, settings, dir, dbFile, cleanup := newE2ETest(t)
+	defer cleanup()
+
+	backupId := e2eCreate(t, settings, dir, dbFile)
+
+	getter, err := NewBackupGetter(nil, "Bulk", time.Millisecond, mib, 1, dbFile, WithStorageSettings(settings))
+	assert.NoError(t, err)
+	defer getter.Close()
+	target := path.Join(dir, "backup.zip")
+
+	jobs, err := getter.RequestDownload(backupId, 0, target)
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 1)
+	assert.Equal(t, []string{jobs[0].JobId}, server.JobIds(e2eVault))
+
+	//the job is not completed yet
+	assert.NoError(t, getter.FetchDownloads(0, nil))
+	_, err = os.Stat(target)
+	assert.True(t, os.IsNotExist(err))
+
+	assert.Equal(t, 1, server.CompleteJobs(e2eVault))
+	assert.NoError(t, getter.FetchDownloads(0, nil))
+	assertRestored(t, dir, target)
+}
+
+func TestEndToEnd_FailedJob(t *testing.T) {
+	server, settings, dir, dbFile, cleanup := newE2ETest(t)
+	defer cleanup()
+
+	backupId := e2eCreate(t, settings, dir, dbFile)
+
+	getter, err := NewBackupGetter(nil, "Bulk", time.Millisecond, mib, 1, dbFile, WithStorageSettings(settings))
+	assert.NoError(t, err)
+	defer getter.Close()
+
+	jobs, err := getter.RequestDownload(backupId, 0, path.Join(dir, "backup.zip"))
+	assert.NoError(t, err)
+	assert.True(t, server.FailJob(e2eVault, jobs[0].JobId, "broken"))
+
+	refreshed := getter.RefreshJobs(backupId)
+	assert.Len(t, refreshed, 1)
+	assert.Equal(t, model.JobStatusFailed, refreshed[0].Status)
+}
+
+func TestEndToEnd_StoredLocation(t *testing.T) {
+	server, settings, dir, dbFile, cleanup := newE2ETest(t)
+	defer cleanup()
+	server.AutoComplete = true
+
+	settings.Location = AWSLocation{Region: "us-west-2", AccountId: "123456789012"}
+	backupId := e2eCreate(t, settings, dir, dbFile)
+
+	repository := database.NewRepository(dbFile)
+	dbBackup := repository.GetBackupById(backupId)
+	repository.Close()
+	assert.Equal(t, "us-west-2", dbBackup.Region)
+	assert.Equal(t, "123456789012", dbBackup.AccountId)
+
+	//the settings are changed: GET and DELETE must still use the location of the backup
+	settings = newE2ESettings(server)
+	before := len(server.Requests())
+
+	getter, err := NewBackupGetter(nil, "Standard", time.Millisecond, mib, 2, dbFile, WithStorageSettings(settings))
+	assert.NoError(t, err)
+	err = getter.Download(backupId, 0, path.Join(dir, "backup.zip"), nil)
+	getter.Close()
+	assert.NoError(t, err)
+
+	deleter, err := NewBackupDeleter(dbFile, WithStorageSettings(settings))
+	assert.NoError(t, err)
+	assert.NoError(t, deleter.Delete(backupId))
+	deleter.(*backupManager).Close()
+	assert.Empty(t, server.ArchiveIds(e2eVault))
+
+	requests := server.Requests()[before:]
+	assert.NotEmpty(t, requests)
+	for _, request := range requests {
+		assert.Equal(t, "123456789012", request.AccountId, request.Path)
+		assert.Equal(t, "us-west-2", request.Region, request.Path)
+	}
+
+	//new clients use the new settings
+	client, err := NewAWSGlacier(settings)
+	assert.NoError(t, err)
+	_, err = client.ListVaults()
+	assert.NoError(t, err)
+	last := server.Requests()[len(server.Requests())-1]
+	assert.Equal(t, DefaultAccountId, last.AccountId)
+	assert.Equal(t, "eu-central-1", last.Region)
+}
+
+const e2eReplicaVault = "e2e-replica"
+
+func TestEndToEnd_Replicas(t *testing.T) {
+	server, settings, dir, dbFile, cleanup := newE2ETest(t)
+	defer cleanup()
+	server.AutoComplete = true
+	server.CreateVault(e2eReplicaVault)
+
+	backupId := e2eCreate(t, settings, dir, dbFile, ReplicaTarget{Vault: e2eReplicaVault, Region: "us-west-2"})
+
+	//both vaults contain the same archive
+	assert.Len(t, server.ArchiveIds(e2eVault), 1)
+	assert.Len(t, server.ArchiveIds(e2eReplicaVault), 1)
+	primary, _ := server.Archive(e2eVault, server.ArchiveIds(e2eVault)[0])
+	replica, _ := server.Archive(e2eReplicaVault, server.ArchiveIds(e2eReplicaVault)[0])
+	assert.Equal(t, primary, replica)
+
+	repository := database.NewRepository(dbFile)
+	replicas := repository.GetReplicasByBackupId(backupId)
+	repository.Close()
+	assert.Len(t, replicas, 1)
+	assert.Equal(t, e2eReplicaVault, replicas[0].Vault)
+	assert.Equal(t, "us-west-2", replicas[0].Region)
+	assert.Equal(t, server.ArchiveIds(e2eReplicaVault)[0], *replicas[0].ArchiveId)
+	assert.Empty(t, replicas[0].Error)
+
+	for _, request := range server.Requests() {
+		if strings.Contains(request.Path, e2eReplicaVault) {
+			assert.Equal(t, "us-west-2", request.Region, request.Path)
+		}
+	}
+
+	//delete removes all replicas
+	deleter, err := NewBackupDeleter(dbFile, WithStorageSettings(settings))
+	assert.NoError(t, err)
+	assert.NoError(t, deleter.Delete(backupId))
+	deleter.(*backupManager).Close()
+	assert.Empty(t, server.ArchiveIds(e2eVault))
+	assert.Empty(t, server.ArchiveIds(e2eReplicaVault))
+}
+
+func TestEndToEnd_ReplicaFallback(t *testing.T) {
+	server, settings, dir, dbFile, cleanup := newE2ETest(t)
+	defer cleanup()
+	server.AutoComplete = true
+	server.CreateVault(e2eReplicaVault)
+
+	backupId := e2eCreate(t, settings, dir, dbFile, ReplicaTarget{Vault: e2eReplicaVault})
+
+	//the archive of the backup itself is lost
+	client, err := NewAWSGlacier(settings)
+	assert.NoError(t, err)
+	assert.NoError(t, client.Delete(AWSGlacierDelete{VaultName: e2eVault, ArchiveId: server.ArchiveIds(e2eVault)[0]}))
+
+	getter, err := NewBackupGetter(nil, "Standard", time.Millisecond, mib, 2, dbFile, WithStorageSettings(settings))
+	assert.NoError(t, err)
+	defer getter.Close()
+	target := path.Join(dir, "backup.zip")
+	assert.NoError(t, getter.Download(backupId, 0, target, nil))
+	assertRestored(t, dir, target)
+
+	//a requested retrieval uses the replica, too
+	assert.NoError(t, os.Remove(target))
+	jobs, err := getter.RequestDownload(backupId, 0, target)
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 1)
+	assert.Equal(t, e2eReplicaVault, jobs[0].Vault)
+	assert.NoError(t, getter.FetchDownloads(0, nil))
+	assertRestored(t, dir, target)
+}
+
+func TestEndToEnd_Copy(t *testing.T) {
+	server, settings, dir, dbFile, cleanup := newE2ETest(t)
+	defer cleanup()
+	server.AutoComplete = true
+	server.CreateVault(e2eReplicaVault)
+	directoryVault := path.Join(dir, "vault")
+	assert.NoError(t, EnsureDirectoryVault(directoryVault))
+
+	backupId := e2eCreate(t, settings, dir, dbFile)
+	original, _ := server.Archive(e2eVault, server.ArchiveIds(e2eVault)[0])
+
+	copier, err := NewBackupCopier("Standard", time.Millisecond, "", dir, dbFile, WithStorageSettings(settings))
+	assert.NoError(t, err)
+	defer copier.Close()
+
+	//copy into another backend: the encrypted archive is unchanged
+	target := CopyTarget{Backend: BackendDirectory, Vault: directoryVault}
+	assert.NoError(t, copier.Copy(backupId, target, false))
+	archives, _ := ioutil.ReadDir(path.Join(directoryVault, directoryArchives))
+	assert.Len(t, archives, 2) //the archive and its metadata
+	assert.Error(t, copier.Copy(backupId, CopyTarget{Vault: e2eVault}, false))
+
+	manager := copier.(*backupManager)
+	replicas := manager.dbRepository.GetReplicasByBackupId(backupId)
+	assert.Len(t, replicas, 1)
+	copied, err := ioutil.ReadFile((&directoryBackend{}).archiveFile(directoryVault, *replicas[0].ArchiveId))
+	assert.NoError(t, err)
+	assert.Equal(t, original, copied)
+
+	//a second run skips the copied volume
+	assert.NoError(t, copier.Copy(backupId, target, false))
+	assert.Len(t, manager.dbRepository.GetReplicasByBackupId(backupId), 1)
+
+	//move into another vault: the source will be deleted
+	assert.NoError(t, copier.Copy(backupId, CopyTarget{Vault: e2eReplicaVault}, true))
+	assert.Empty(t, server.ArchiveIds(e2eVault))
+	assert.Len(t, server.ArchiveIds(e2eReplicaVault), 1)
+	dbBackup := manager.dbRepository.GetBackupById(backupId)
+	assert.Equal(t, e2eReplicaVault, dbBackup.Vault)
+	assert.Equal(t, BackendGlacier, dbBackup.Backend)
+	volumes := manager.dbRepository.GetVolumesByBackupId(backupId)
+	assert.Equal(t, server.ArchiveIds(e2eReplicaVault)[0], *volumes[0].ArchiveId)
+	assert.Len(t, manager.dbRepository.GetReplicasByBackupId(backupId), 1)
+
+	getter, err := NewBackupGetter(nil, "Standard", time.Millisecond, mib, 2, dbFile, WithStorageSettings(settings))
+	assert.NoError(t, err)
+	restored := path.Join(dir, "backup.zip")
+	err = getter.Download(backupId, 0, restored, nil)
+	getter.Close()
+	assert.NoError(t, err)
+	assertRestored(t, dir, restored)
+
+	//delete removes the copies, too
+	assert.NoError(t, manager.Delete(backupId))
+	assert.Empty(t, server.ArchiveIds(e2eReplicaVault))
+	archives, _ = ioutil.ReadDir(path.Join(directoryVault, directoryArchives))
+	assert.Empty(t, archives)
+}
+
+func TestEndToEnd_Vaults(t *testing.T) {
+	_, settings, _, _, cleanup := newE2ETest(t)
+	defer cleanup()
+
+	client, err := NewAWSGlacier(settings)
+	assert.NoError(t, err)
+
+	_, err = client.DescribeVault("other")
+	assert.Equal(t, ErrVaultNotFound, err)
+
+	assert.NoError(t, client.CreateVault("other"))
+	vault, err := client.DescribeVault("other")
+	assert.NoError(t, err)
+	assert.Equal(t, "other", vault.VaultName)
+
+	vaults, err := client.ListVaults()
+	assert.NoError(t, err)
+	assert.Len(t, vaults, 2)
+
+	assert.NoError(t, client.DeleteVault("other"))
+	_, err = client.DescribeVault("other")
+	assert.Equal(t, ErrVaultNotFound, err)
+}
@@ -0,0 +1,79 @@
+package backup
+
+import (
+	"github.com/pkg/errors"
+	"os"
+	"regexp"
+)
+
+// ValidPartSizes are all part sizes (in MiB) which are allowed by glacier
+var ValidPartSizes = []int{1, 2, 4, 8, 16, 32, 64, 128, 256, 512, 1024, 2048, 4096}
+
+// PartSizeSafetyMargin is the fraction which will be added to an estimated archive size before
+// a part size is chosen for it. It should cover the estimation error.
+const PartSizeSafetyMargin = 0.1
+
+const (
+	//local file header + data descriptor + central directory header (without the file name)
+	zipOverheadPerFile = 30 + 24 + 46
+	//end of central directory record
+	zipOverheadPerArchive = 22
+)
+
+type ZipEstimation struct {
+	Files int
+	// Size is the estimated size of the zip (without compression)
+	Size int64
+	// LargestFile is the estimated size of the largest file in the zip (without compression)
+	LargestFile int64
+}
+
+// EstimateZip walks through the given files/folders (with the same filters as Zip) and estimates the size of
+// the resulting zip. Because the compression can not be estimated, the result is the size of an uncompressed zip.
+func EstimateZip(filePaths []string, blacklist, whitelist []*regexp.Regexp) *ZipEstimation {
+	estimation := &ZipEstimation{
+		Size: zipOverheadPerArchive,
+	}
+
+	walkFiles(filePaths, blacklist, whitelist, false, func(filePath, zipPath string) error {
+		fileInfo, err := os.Stat(filePath)
+		if err != nil {
+			return nil
+		}
+
+		fileSize := fileInfo.Size() + zipOverheadPerFile + 2*int64(len(zipPath))
+
+		estimation.Files++
+		estimation.Size += fileSize
+		if fileSize > estimation.LargestFile {
+			estimation.LargestFile = fileSize
+		}
+		return nil
+	})
+
+	return estimation
+}
+
+// ArchiveSize returns the estimated size of the largest archive. If the zip is split in volumes, a volume can be
+// larger than the volume size by the size of one file.
+func (z *ZipEstimation) ArchiveSize(volumeSize int64) int64 {
+	if volumeSize > 0 && volumeSize+z.LargestFile < z.Size {
+		return volumeSize + z.LargestFile
+	}
+
+	return z.Size
+}
+
+// ChoosePartSize returns the smallest valid part size (in MiB) for an archive of the given size. So that the
+// archive (plus a safety margin) does not need more than MaxPartsPerUpload parts.
+func ChoosePartSize(archiveSize int64, margin float64) (int, error) {
+	size := float64(archiveSize) * (1 + margin)
+
+	for _, partSize := range ValidPartSizes {
+		if size <= float64(partSize)*1024*1024*MaxPartsPerUpload {
+			return partSize, nil
+		}
+	}
+
+	return 0, errors.Errorf("The archive is too large (~%d bytes). Even the largest part size is too small.", archiveSize)
+}
@@ -0,0 +1,68 @@
+package backup
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"testing"
+)
+
+func TestEstimateZip(t *testing.T) {
+	//given
+	tmpDir, err := ioutil.TempDir("", "estimate")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	ioutil.WriteFile(tmpDir+"/a.txt", make([]byte, 1000), 0644)
+	ioutil.WriteFile(tmpDir+"/b.txt", make([]byte, 3000), 0644)
+	ioutil.WriteFile(tmpDir+"/c.log", make([]byte, 5000), 0644)
+
+	//when
+	result := EstimateZip([]string{tmpDir}, []*regexp.Regexp{regexp.MustCompile(`\.log$`)}, []*regexp.Regexp{})
+
+	//then
+	assert.Equal(t, 2, result.Files)
+	assert.True(t, result.Size > 4000)
+	assert.True(t, result.Size < 5000)
+	assert.True(t, result.LargestFile > 3000)
+	assert.True(t, result.LargestFile < 4000)
+}
+
+func TestZipEstimation_ArchiveSize(t *testing.T) {
+	toTest := &ZipEstimation{Size: 1000, LargestFile: 100}
+
+	assert.Equal(t, int64(1000), toTest.ArchiveSize(0))
+	assert.Equal(t, int64(600), toTest.ArchiveSize(500))
+	assert.Equal(t, int64(1000), toTest.ArchiveSize(950))
+}
+
+func TestChoosePartSize(t *testing.T) {
+	tests := []struct {
+		name     string
+		size     int64
+		expected int
+	}{
+		{"empty", 0, 1},
+		{"small", 1024, 1},
+		{"limit of 1MiB", 9000 * 1024 * 1024, 1},
+		{"above limit of 1MiB", 9500 * 1024 * 1024, 2},
+		{"100GiB", 100 * 1024 * 1024 * 1024, 16},
+		{"1TiB", 1024 * 1024 * 1024 * 1024, 128},
+		{"30TiB", 30 * 1024 * 1024 * 1024 * 1024, 4096},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := ChoosePartSize(test.size, PartSizeSafetyMargin)
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, result)
+		})
+	}
+}
+
+func TestChoosePartSize_TooLarge(t *testing.T) {
+	_, err := ChoosePartSize(40*1024*1024*1024*1024, PartSizeSafetyMargin)
+
+	assert.Error(t, err)
+}
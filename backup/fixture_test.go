@@ -0,0 +1,24 @@
+package backup
+
+import (
+	"backup2glacier/database"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+// newTestFixture returns a fake glacier and a new catalog in a temporary directory. The returned function closes
+// the catalog and removes the directory.
+func newTestFixture(t *testing.T, name string) (database.Repository, *fakeAWSGlacier, string, func()) {
+	dir, err := ioutil.TempDir("", name)
+	assert.NoError(t, err)
+
+	dbRepository := database.NewRepository(path.Join(dir, "database.db"))
+
+	return dbRepository, newFakeAWSGlacier(), dir, func() {
+		dbRepository.Close()
+		os.RemoveAll(dir)
+	}
+}
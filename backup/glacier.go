@@ -2,19 +2,36 @@ package backup
 
 import (
 	. "backup2glacier/log"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/glacier"
+	"github.com/aws/aws-sdk-go/service/glacier/glacieriface"
 	"github.com/pkg/errors"
 	"io"
-	"io/ioutil"
-	"os"
 	"strconv"
+	"sync"
 	"time"
 )
 
+// ErrUploadNotFound will be returned if a multipart upload should be resumed which does not exist (anymore)
+var ErrUploadNotFound = errors.New("The multipart upload does not exist")
+
+// ErrJobNotFound will be returned if a job does not exist (anymore)
+var ErrJobNotFound = errors.New("The job does not exist")
+
+// JobOutputAvailability is the time after the completion of a job in which its output can be downloaded
+const JobOutputAvailability = 24 * time.Hour
+
+// MaxPartsPerUpload is the maximum number of parts which glacier allows for one multipart upload
+const MaxPartsPerUpload = 10000
+
 type AWSGlacierUploadResult struct {
 	CreationResult *glacier.ArchiveCreationOutput
 	ArchiveDesc    string
@@ -27,14 +44,89 @@ type AWSGlacierUpload struct {
 	VaultName   string
 	ArchiveDesc string
 	PartSize    int
+	Concurrency int
+	Spool       SpoolConfig
+	// StorageClass is the S3 storage class of the archive. It will be ignored by glacier.
+	StorageClass string
+	// KeepOnCancel keeps the multipart upload for a later resume if the source fails because its context is
+	// cancelled. Otherwise the upload will be aborted.
+	KeepOnCancel bool
+	// Context stops the waiting for the retries of the requests if it is cancelled. Default: no cancellation
+	Context context.Context
+}
+
+type AWSGlacierResume struct {
+	Source      io.Reader
+	VaultName   string
+	UploadId    string
+	Concurrency int
+	Spool       SpoolConfig
+	// KeepOnCancel keeps the multipart upload if the source fails because its context is cancelled
+	KeepOnCancel bool
+	// Context stops the waiting for the retries of the requests if it is cancelled. Default: no cancellation
+	Context context.Context
+}
+
+// context returns the context of the upload or the background context if there is none
+func (u AWSGlacierUpload) context() context.Context {
+	if u.Context == nil {
+		return context.Background()
+	}
+
+	return u.Context
+}
+
+// context returns the context of the resume or the background context if there is none
+func (r AWSGlacierResume) context() context.Context {
+	if r.Context == nil {
+		return context.Background()
+	}
+
+	return r.Context
 }
 
 type AWSGlacierDownload struct {
-	Target       io.Writer
+	// Target is the path of the file for the archive content. If there is an interrupted download into
+	// this file, it will be continued.
+	Target string
+	// ChunkSize is the size of the ranges in which the archive will be downloaded. It must be a power of two
+	// multiple of 1 MiB. Default: DefaultDownloadChunkSize
+	ChunkSize int64
+	// Concurrency is the number of chunks which will be downloaded at the same time
+	Concurrency  int
 	PollInterval time.Duration
 	VaultName    string
 	ArchiveId    string
 	Tier         string
+	// Checksum is the expected tree hash of the archive. If it is empty, the archive will not be verified.
+	Checksum string
+	// JobId is the id of an already completed retrieval job. If it is set, no new job will be initiated.
+	JobId string
+	// RetrievalByteRange is the range ("<first>-<last>" inclusive) of the archive which should be retrieved. It
+	// must be megabyte aligned. If it is empty, the whole archive will be retrieved.
+	RetrievalByteRange string
+	// Context stops the waiting for the retrieval job and the download if it is cancelled. Default: no cancellation
+	Context context.Context
+	// Progress receives the number of downloaded bytes after each chunk
+	Progress func(downloaded int64)
+}
+
+type AWSGlacierRetrieval struct {
+	VaultName string
+	ArchiveId string
+	Tier      string
+	// RetrievalByteRange is the (megabyte aligned) range of the archive. If it is empty, the whole archive
+	// will be retrieved.
+	RetrievalByteRange string
+}
+
+type AWSGlacierJob struct {
+	JobId     string
+	Completed bool
+	// Succeeded is false if glacier could not complete the job
+	Succeeded      bool
+	StatusMessage  string
+	CompletionDate *time.Time
 }
 
 type AWSGlacierDelete struct {
@@ -42,45 +134,144 @@ type AWSGlacierDelete struct {
 	ArchiveId string
 }
 
+// AWSGlacier is the storage backend of glacier. In addition it manages the vaults.
 type AWSGlacier interface {
-	Upload(AWSGlacierUpload) (*AWSGlacierUploadResult, *string, error)
-	Download(AWSGlacierDownload) error
-	Delete(AWSGlacierDelete) error
+	StorageBackend
+
+	CreateVault(vaultName string) error
+	ListVaults() ([]*AWSGlacierVault, error)
+	// DescribeVault returns the information of the vault. If the vault does not exist, ErrVaultNotFound will be returned.
+	DescribeVault(vaultName string) (*AWSGlacierVault, error)
+	DeleteVault(vaultName string) error
+
+	GetVaultTags(vaultName string) (map[string]string, error)
+	AddVaultTags(vaultName string, tags map[string]string) error
+	RemoveVaultTags(vaultName string, keys []string) error
+	// GetVaultAccessPolicy returns the access policy (JSON) of the vault or an empty string if there is none
+	GetVaultAccessPolicy(vaultName string) (string, error)
+	SetVaultAccessPolicy(vaultName, policy string) error
+	DeleteVaultAccessPolicy(vaultName string) error
+	// GetVaultNotifications returns the notification configuration of the vault or nil if there is none
+	GetVaultNotifications(vaultName string) (*AWSGlacierNotifications, error)
+	SetVaultNotifications(vaultName string, notifications AWSGlacierNotifications) error
+	DeleteVaultNotifications(vaultName string) error
+	// InitiateVaultLock installs the lock policy and returns the lock id which is needed for the completion
+	InitiateVaultLock(vaultName, policy string) (string, error)
+	// GetVaultLock returns the state of the vault lock or nil if there is no lock
+	GetVaultLock(vaultName string) (*AWSGlacierVaultLock, error)
+	CompleteVaultLock(vaultName, lockId string) error
+	AbortVaultLock(vaultName string) error
 }
 
 type awsGlacier struct {
 	session *session.Session
-	glacier *glacier.Glacier
+	glacier glacieriface.GlacierAPI
+	retryer *retryer
+	limiter *BandwidthLimiter
+	// account is the id of the account which owns the vaults. An empty account means the account of the credentials.
+	account string
 }
 
-func NewAWSGlacier() (AWSGlacier, error) {
-	s, err := session.NewSession()
+// NewAWSGlacier creates a glacier client for the region and the account of the settings
+func NewAWSGlacier(settings *StorageSettings) (AWSGlacier, error) {
+	return NewAWSGlacierAt(settings.Location, settings)
+}
+
+// NewAWSGlacierAt creates a glacier client for the vaults of the given region and account
+func NewAWSGlacierAt(location AWSLocation, settings *StorageSettings) (AWSGlacier, error) {
+	s, config, err := newAWSSession(location, settings.AssumeRole)
 	if err != nil {
-		return nil, errors.Wrap(err, "Error while create new AWS session")
+		return nil, err
+	}
+	if settings.GlacierEndpoint != "" {
+		config = config.WithEndpoint(settings.GlacierEndpoint)
 	}
 
 	return &awsGlacier{
 		s,
-		glacier.New(s),
+		glacier.New(s, config),
+		newRetryer(settings.RetryPolicy),
+		settings.BandwidthLimiter,
+		location.AccountId,
 	}, nil
 }
 
+// accountId returns the account id for the glacier requests. Glacier uses "-" for the account of the credentials.
+func (a *awsGlacier) accountId() *string {
+	if a.account == "" {
+		return aws.String(DefaultAccountId)
+	}
+
+	return aws.String(a.account)
+}
+
+func (a *awsGlacier) Retries() int64 {
+	return a.retryer.Retries()
+}
+
 func (a *awsGlacier) Upload(upload AWSGlacierUpload) (*AWSGlacierUploadResult, *string, error) {
-	initResult, err := a.initUpload(upload.VaultName, upload.ArchiveDesc, upload.PartSize)
+	initResult, err := a.initUpload(upload.context(), upload.VaultName, upload.ArchiveDesc, upload.PartSize)
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "Could not init multipart upload")
 	}
 	LogInfo("Initialise multipart upload: %+v", initResult)
 
+	return a.continueUpload(upload, initResult.UploadId, nil)
+}
+
+// Resume continues an interrupted multipart upload. The source must deliver exactly the same content as the
+// source of the interrupted upload. All parts which are already uploaded will be verified against the source.
+// Only the missing parts will be uploaded.
+func (a *awsGlacier) Resume(resume AWSGlacierResume) (*AWSGlacierUploadResult, error) {
+	listResult, uploaded, err := a.listParts(resume.context(), resume.VaultName, resume.UploadId)
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == glacier.ErrCodeResourceNotFoundException {
+		return nil, ErrUploadNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not list the parts of the multipart upload. Maybe the upload is already expired")
+	}
+	LogInfo("Resume multipart upload %s: %d parts are already uploaded", resume.UploadId, len(uploaded))
+
+	result, _, err := a.continueUpload(AWSGlacierUpload{
+		Source:       resume.Source,
+		VaultName:    resume.VaultName,
+		ArchiveDesc:  aws.StringValue(listResult.ArchiveDescription),
+		PartSize:     int(aws.Int64Value(listResult.PartSizeInBytes)),
+		Concurrency:  resume.Concurrency,
+		Spool:        resume.Spool,
+		KeepOnCancel: resume.KeepOnCancel,
+		Context:      resume.Context,
+	}, aws.String(resume.UploadId), uploaded)
+
+	return result, err
+}
+
+// continueUpload uploads all parts which are not contained in the uploaded parts (range -> tree hash) and completes
+// the multipart upload. If an error occurred which is retryable, the multipart upload will not be aborted. So that
+// the upload can be resumed later.
+func (a *awsGlacier) continueUpload(upload AWSGlacierUpload, uploadId *string, uploaded map[string]string) (*AWSGlacierUploadResult, *string, error) {
 	//closure for reusing purposes
 	abortMultipartUpload := func() {
 		request := &glacier.AbortMultipartUploadInput{
-			AccountId: aws.String("-"),
+			AccountId: a.accountId(),
 			VaultName: aws.String(upload.VaultName),
-			UploadId:  initResult.UploadId,
+			UploadId:  uploadId,
 		}
 		LogDebug("Send AbortMultipartUpload: %+v", request)
-		a.glacier.AbortMultipartUpload(request)
+		//the upload is also aborted after the cancellation of its context
+		a.retryer.do(context.Background(), "AbortMultipartUpload", func() error {
+			_, err := a.glacier.AbortMultipartUpload(request)
+			return err
+		})
+	}
+	abortOrKeep := func(err error) string {
+		if a.retryer.policy.IsRetryable(err) || (upload.KeepOnCancel && isCancelled(err)) {
+			LogInfo("Keep multipart upload for a later resume: %s", *uploadId)
+			return "Upload is kept for a later resume"
+		}
+
+		abortMultipartUpload()
+		return "Upload aborted"
 	}
 
 	//if any panic occurred: try to abort the upload
@@ -91,16 +282,18 @@ func (a *awsGlacier) Upload(upload AWSGlacierUpload) (*AWSGlacierUploadResult, *
 		}
 	}()
 
-	totalBytes, hashes, err := a.uploadParts(upload.Source, upload.VaultName, initResult.UploadId, upload.PartSize)
+	totalBytes, hashes, err := a.uploadParts(upload, uploadId, uploaded)
 	if err != nil {
-		abortMultipartUpload()
-		return nil, initResult.UploadId, errors.Wrap(err, "Failed to upload to glacier. Upload aborted")
+		return nil, uploadId, errors.Wrap(err, "Failed to upload to glacier. "+abortOrKeep(err))
 	}
 
-	completeResult, err := a.completeUpload(upload.VaultName, initResult.UploadId, hashes, totalBytes)
+	completeResult, err := a.completeUpload(upload.context(), upload.VaultName, uploadId, hashes, totalBytes)
+	if err != nil && completeResult != nil {
+		//the multipart upload is already completed: there is nothing to abort or to resume anymore
+		return nil, nil, errors.Wrap(err, "Error while completing multipart upload")
+	}
 	if err != nil {
-		abortMultipartUpload()
-		return nil, initResult.UploadId, errors.Wrap(err, "Error while completing multipart upload")
+		return nil, uploadId, errors.Wrap(err, "Error while completing multipart upload. "+abortOrKeep(err))
 	}
 	LogInfo("Complete multipart upload: %+v", completeResult)
 
@@ -109,111 +302,397 @@ func (a *awsGlacier) Upload(upload AWSGlacierUpload) (*AWSGlacierUploadResult, *
 		PartSize:       upload.PartSize,
 		CreationResult: completeResult,
 		TotalSize:      totalBytes,
-	}, initResult.UploadId, nil
+	}, uploadId, nil
 }
 
-func (a *awsGlacier) initUpload(vaultName, archiveDesc string, partSize int) (*glacier.InitiateMultipartUploadOutput, error) {
+// listParts returns all already uploaded parts (range -> tree hash) of the given multipart upload
+func (a *awsGlacier) listParts(ctx context.Context, vaultName, uploadId string) (*glacier.ListPartsOutput, map[string]string, error) {
+	uploaded := map[string]string{}
+	var firstResult *glacier.ListPartsOutput
+	var marker *string
+
+	for {
+		request := &glacier.ListPartsInput{
+			AccountId: a.accountId(),
+			VaultName: aws.String(vaultName),
+			UploadId:  aws.String(uploadId),
+			Marker:    marker,
+		}
+		LogDebug("Send ListParts: %+v", request)
+		var result *glacier.ListPartsOutput
+		err := a.retryer.do(ctx, "ListParts", func() (err error) {
+			result, err = a.glacier.ListParts(request)
+			return err
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if firstResult == nil {
+			firstResult = result
+		}
+		for _, part := range result.Parts {
+			uploaded[aws.StringValue(part.RangeInBytes)] = aws.StringValue(part.SHA256TreeHash)
+		}
+
+		if aws.StringValue(result.Marker) == "" {
+			break
+		}
+		marker = result.Marker
+	}
+
+	return firstResult, uploaded, nil
+}
+
+func (a *awsGlacier) initUpload(ctx context.Context, vaultName, archiveDesc string, partSize int) (*glacier.InitiateMultipartUploadOutput, error) {
 	request := &glacier.InitiateMultipartUploadInput{
-		AccountId:          aws.String("-"),
+		AccountId:          a.accountId(),
 		PartSize:           aws.String(strconv.Itoa(partSize)),
 		VaultName:          aws.String(vaultName),
 		ArchiveDescription: aws.String(archiveDesc),
 	}
 	LogDebug("Send InitiateMultipartUpload: %+v", request)
-	result, err := a.glacier.InitiateMultipartUpload(request)
+	var result *glacier.InitiateMultipartUploadOutput
+	err := a.retryer.do(ctx, "InitiateMultipartUpload", func() (err error) {
+		result, err = a.glacier.InitiateMultipartUpload(request)
+		return err
+	})
 
 	return result, err
 }
 
-func (a *awsGlacier) uploadParts(src io.Reader, vaultName string, uploadId *string, partSize int) (int64, [][]byte, error) {
+// glacierPart is a part of a multipart upload (of any storage backend) which is buffered in a part buffer of the spool
+type glacierPart struct {
+	index       int
+	offset      int64
+	length      int64
+	treeHash    []byte
+	contentHash []byte
+	md5Hash     []byte
+	buffer      partBuffer
+	spool       *spool
+}
+
+// uploadParts uploads the parts of the given multipart upload to glacier. Parts which are contained in uploaded
+// (range -> tree hash) will only be verified.
+func (a *awsGlacier) uploadParts(upload AWSGlacierUpload, uploadId *string, uploaded map[string]string) (int64, [][]byte, error) {
+	return uploadMultipartParts(upload, a.limiter, uploaded, treeHashOfPart, func(part *glacierPart) error {
+		_, err := a.uploadPart(upload.context(), part, upload.VaultName, uploadId)
+		return err
+	})
+}
+
+// uploadMultipartParts reads the parts from the given source and uploads them with the given send function. Up to
+// concurrency parts will be uploaded at the same time. Each part is buffered in its own part buffer, so there
+// are never more than concurrency buffers at once. Parts which are contained in uploaded (range -> checksum)
+// will not be uploaded again. Instead they will be verified against the checksum of the already uploaded part.
+// The checksum function returns the checksum of a part in the same form as the storage backend does. The tree
+// hashes of all parts will be returned.
+func uploadMultipartParts(upload AWSGlacierUpload, limiter *BandwidthLimiter, uploaded map[string]string, checksum func(*glacierPart) string, send func(*glacierPart) error) (int64, [][]byte, error) {
+	src := upload.Source
+	partSize := upload.PartSize
+	concurrency := upload.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	partSpool := newSpool(upload.Spool, partSize, concurrency)
+	defer partSpool.Close()
+
 	var hashes [][]byte
 	var readBytes int64
 	readBytes = 0
 
-	for {
-		written, result, err := a.uploadPart(src, vaultName, uploadId, partSize, readBytes)
-		if err != nil {
-			if err != io.EOF {
-				return -1, nil, errors.Wrap(err, "Failed upload part to glacier")
+	var uploadErr error
+	mutex := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	slots := make(chan bool, concurrency)
+	start := time.Now()
+	lastActivity := start
+
+	failed := func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		return uploadErr != nil
+	}
+
+	for !failed() {
+		if len(hashes) == MaxPartsPerUpload {
+			//a single read may return no byte without reaching the end
+			_, err := io.ReadFull(src, make([]byte, 1))
+			mutex.Lock()
+			if err == nil {
+				uploadErr = errors.Errorf("The archive exceeds the maximum of %d parts with a part size of %d bytes", MaxPartsPerUpload, partSize)
+			} else if err != io.EOF {
+				uploadErr = err
+			}
+			mutex.Unlock()
+			break
+		}
+
+		//wait for a free upload slot
+		slots <- true
+
+		//outside of the time windows the upload may be suspended
+		mutex.Lock()
+		deadline := lastActivity.Add(MaxUploadPause)
+		mutex.Unlock()
+		limiter.waitForWindow(deadline)
+
+		part, err := readPart(src, partSpool, partSize, len(hashes), readBytes)
+		if err != nil || part == nil {
+			<-slots
+			if err != nil {
+				mutex.Lock()
+				uploadErr = err
+				mutex.Unlock()
 			}
 			break
 		}
 
-		readBytes += int64(written)
+		readBytes += part.length
+		mutex.Lock()
+		hashes = append(hashes, nil)
+		mutex.Unlock()
+
+		if uploadedHash, isUploaded := uploaded[part.Range()]; isUploaded {
+			err := verifyPart(part, checksum(part), uploadedHash)
+			part.Close()
+			<-slots
+
+			mutex.Lock()
+			if err != nil {
+				uploadErr = err
+			} else {
+				hashes[part.index] = part.treeHash
+			}
+			mutex.Unlock()
+			continue
+		}
+
+		wg.Add(1)
+		go func(part *glacierPart) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			defer part.Close()
+
+			err := send(part)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			if err != nil {
+				if uploadErr == nil {
+					uploadErr = errors.Wrapf(err, "Failed upload part %d", part.index)
+				}
+				return
+			}
+
+			hashes[part.index] = part.treeHash
+			lastActivity = time.Now()
+		}(part)
+	}
+
+	//wait for all running uploads
+	wg.Wait()
 
-		hash, _ := hex.DecodeString(*result.Checksum)
-		hashes = append(hashes, hash)
+	if uploadErr != nil {
+		return -1, nil, uploadErr
 	}
 
+	LogInfo("Uploaded %d parts (%d bytes) in %s: %s", len(hashes), readBytes, time.Since(start).Round(time.Second), throughput(readBytes, time.Since(start)))
+
 	return readBytes, hashes, nil
 }
 
-func (a *awsGlacier) uploadPart(src io.Reader, vaultName string, uploadId *string, partSize int, totalWritten int64) (int64, *glacier.UploadMultipartPartOutput, error) {
-	tmpFile, err := ioutil.TempFile("", "aws-glacier-part")
+// readPart reads the next part from the source into a part buffer. If there is no more data, nil will be returned.
+func readPart(src io.Reader, partSpool *spool, partSize int, index int, offset int64) (*glacierPart, error) {
+	buffer, err := partSpool.Get()
 	if err != nil {
-		return 0, nil, errors.Wrap(err, "Could not create temporary file for part upload")
+		return nil, errors.Wrap(err, "Could not get a buffer for the part")
 	}
-	defer os.Remove(tmpFile.Name())
 
-	written, err := io.CopyN(tmpFile, src, int64(partSize))
-	if written == 0 {
-		//maybe we have reached the EOF
-		return written, nil, err
+	part := &glacierPart{
+		index:  index,
+		offset: offset,
+		buffer: buffer,
+		spool:  partSpool,
 	}
 
-	tmpFile.Seek(0, 0)
-
-	request := &glacier.UploadMultipartPartInput{
-		AccountId: aws.String("-"),
-		VaultName: aws.String(vaultName),
-		UploadId:  uploadId,
-		Range:     aws.String(fmt.Sprintf("bytes %d-%d/*", totalWritten, totalWritten+written-1)),
-		Body:      tmpFile,
+	treeHash := NewTreeHashWriter()
+	contentHash := sha256.New()
+	md5Hash := md5.New()
+	part.length, err = io.CopyN(io.MultiWriter(buffer, treeHash, contentHash, md5Hash), src, int64(partSize))
+	if err != nil && err != io.EOF {
+		part.Close()
+		return nil, errors.Wrap(err, "Could not read part")
 	}
+	if part.length == 0 {
+		//we have reached the EOF
+		part.Close()
+		return nil, nil
+	}
+	part.treeHash = treeHash.TreeHash()
+	part.contentHash = contentHash.Sum(nil)
+	part.md5Hash = md5Hash.Sum(nil)
+
+	return part, nil
+}
+
+func (a *awsGlacier) uploadPart(ctx context.Context, part *glacierPart, vaultName string, uploadId *string) (*glacier.UploadMultipartPartOutput, error) {
+	var result *glacier.UploadMultipartPartOutput
+	var start time.Time
+
+	err := a.retryer.do(ctx, fmt.Sprintf("UploadMultipartPart %d", part.index), func() error {
+		//on each attempt the part must be read again from the beginning
+		if _, err := part.buffer.Seek(0, io.SeekStart); err != nil {
+			return errors.Wrap(err, "Could not read the buffer of the part")
+		}
+
+		request := &glacier.UploadMultipartPartInput{
+			AccountId: a.accountId(),
+			VaultName: aws.String(vaultName),
+			UploadId:  uploadId,
+			Range:     aws.String(fmt.Sprintf("bytes %s/*", part.Range())),
+			Checksum:  aws.String(hex.EncodeToString(part.treeHash)),
+			Body:      a.limiter.ReadSeeker(part.buffer),
+		}
 
-	LogDebug("Send UploadMultipartPart: %+v", request)
-	result, err := a.glacier.UploadMultipartPart(request)
+		LogDebug("Send UploadMultipartPart: %+v", request)
+		start = time.Now()
+
+		var err error
+		result, err = a.glacier.UploadMultipartPartWithContext(ctx, request, withContentHash(part.contentHash))
+		return err
+	})
 
 	if err != nil {
-		return 0, nil, errors.Wrap(err, "Error while uploading part")
+		return nil, errors.Wrap(err, "Error while uploading part")
+	}
+	if aws.StringValue(result.Checksum) != hex.EncodeToString(part.treeHash) {
+		return nil, errors.Errorf("The checksum of the uploaded part %d (%s) does not match the local one (%x)", part.index, aws.StringValue(result.Checksum), part.treeHash)
 	}
-	LogInfo("Uploaded multipart part: %+v", result)
+	LogInfo("Uploaded multipart part %d (%d bytes) in %s: %s", part.index, part.length, time.Since(start).Round(time.Millisecond), throughput(part.length, time.Since(start)))
+	LogDebug("Complete UploadMultipartPart: %+v", result)
+
+	return result, nil
+}
 
-	return written, result, nil
+// withContentHash sets the (already known) sha256 of the request body. Otherwise the body would be read
+// an additional time for signing the request.
+func withContentHash(contentHash []byte) request.Option {
+	return func(r *request.Request) {
+		r.HTTPRequest.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(contentHash))
+	}
 }
 
-func (a *awsGlacier) completeUpload(vaultName string, uploadId *string, hashes [][]byte, totalBytes int64) (*glacier.ArchiveCreationOutput, error) {
+// treeHashOfPart returns the checksum of the part in the form of glacier
+func treeHashOfPart(part *glacierPart) string {
+	return hex.EncodeToString(part.treeHash)
+}
+
+// verifyPart checks if the checksum of the given part is the checksum of the already uploaded part
+func verifyPart(part *glacierPart, checksum, uploadedChecksum string) error {
+	if checksum != uploadedChecksum {
+		return errors.Errorf("The part %d (%s) differs from the already uploaded one. Has the source changed?", part.index, part.Range())
+	}
+	LogInfo("Skip multipart part %d (%s): it is already uploaded", part.index, part.Range())
+
+	return nil
+}
+
+// Range returns the byte range (inclusive of the upper value) of this part
+func (p *glacierPart) Range() string {
+	return fmt.Sprintf("%d-%d", p.offset, p.offset+p.length-1)
+}
+
+// Close gives the buffer of the part back to the spool
+func (p *glacierPart) Close() error {
+	p.spool.Put(p.buffer)
+	return nil
+}
+
+func throughput(bytes int64, duration time.Duration) string {
+	if duration <= 0 {
+		return "-"
+	}
+
+	return fmt.Sprintf("%.2f MiB/s", float64(bytes)/1024/1024/duration.Seconds())
+}
+
+// completeUpload completes the multipart upload and compares the tree hash of the created archive with the local one.
+// If they do not match, the archive will be deleted. The result is only returned if the archive was created.
+func (a *awsGlacier) completeUpload(ctx context.Context, vaultName string, uploadId *string, hashes [][]byte, totalBytes int64) (*glacier.ArchiveCreationOutput, error) {
 	treeHash := glacier.ComputeTreeHash(hashes)
 	request := &glacier.CompleteMultipartUploadInput{
-		AccountId:   aws.String("-"),
+		AccountId:   a.accountId(),
 		VaultName:   aws.String(vaultName),
 		UploadId:    uploadId,
 		ArchiveSize: aws.String(fmt.Sprintf("%d", totalBytes)),
 		Checksum:    aws.String(fmt.Sprintf("%x", treeHash)),
 	}
 	LogDebug("Send CompleteMultipartUpload: %+v", request)
-	result, err := a.glacier.CompleteMultipartUpload(request)
+	var result *glacier.ArchiveCreationOutput
+	err := a.retryer.do(ctx, "CompleteMultipartUpload", func() (err error) {
+		result, err = a.glacier.CompleteMultipartUpload(request)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
 
-	return result, err
+	if aws.StringValue(result.Checksum) != *request.Checksum {
+		err := errors.Errorf("The checksum of the archive (%s) does not match the local one (%s)", aws.StringValue(result.Checksum), *request.Checksum)
+		delErr := a.Delete(AWSGlacierDelete{VaultName: vaultName, ArchiveId: aws.StringValue(result.ArchiveId)})
+		if delErr != nil {
+			return result, errors.Wrapf(err, "The archive %s could not be deleted: %v", aws.StringValue(result.ArchiveId), delErr)
+		}
+		return result, errors.Wrap(err, "The archive is deleted")
+	}
+
+	return result, nil
 }
 
 func (a *awsGlacier) Download(download AWSGlacierDownload) error {
-	_, err := a.initDownload(download.VaultName, download.ArchiveId, download.Tier)
+	if download.JobId != "" {
+		return a.downloadCompletedJob(download)
+	}
+
+	_, err := a.initDownload(download.context(), download.VaultName, download.ArchiveId, download.Tier, download.RetrievalByteRange)
 	if err != nil {
 		return errors.Wrap(err, "Could not init download job")
 	}
 
-	jobDesc, err := a.determineJobId(download.VaultName, download.ArchiveId)
+	jobDesc, err := a.determineJobId(download.context(), download.VaultName, download.ArchiveId, download.RetrievalByteRange)
 	if err != nil {
 		return errors.Wrap(err, "Could not found job. Have you init it before?")
 	}
 
-	err = a.WaitForJob(download.VaultName, *jobDesc.JobId, download.PollInterval)
+	jobDesc, err = a.WaitForJob(download.context(), download.VaultName, *jobDesc.JobId, download.PollInterval)
 	if err != nil {
 		return errors.Wrap(err, "Error while waiting for job completion")
 	}
 
-	err = a.downloadJobOutput(download.VaultName, *jobDesc.JobId, download.Target)
+	err = a.downloadJobOutput(download, jobDesc)
+	if err != nil {
+		return errors.Wrap(err, "Error while downloading job output")
+	}
+
+	return nil
+}
+
+// downloadCompletedJob downloads the output of the job which is given in the download
+func (a *awsGlacier) downloadCompletedJob(download AWSGlacierDownload) error {
+	jobDesc, err := a.describeJob(download.context(), download.VaultName, download.JobId)
+	if err != nil {
+		return errors.Wrap(err, "Could not get job status")
+	}
+	if !aws.BoolValue(jobDesc.Completed) {
+		return errors.Errorf("The job %s is not completed yet", download.JobId)
+	}
+
+	err = a.downloadJobOutput(download, jobDesc)
 	if err != nil {
 		return errors.Wrap(err, "Error while downloading job output")
 	}
@@ -221,15 +700,61 @@ func (a *awsGlacier) Download(download AWSGlacierDownload) error {
 	return nil
 }
 
-func (a *awsGlacier) initDownload(vaultName, archiveId, tier string) (string, error) {
+func (a *awsGlacier) RequestRetrieval(retrieval AWSGlacierRetrieval) (string, error) {
+	return a.initDownload(context.Background(), retrieval.VaultName, retrieval.ArchiveId, retrieval.Tier, retrieval.RetrievalByteRange)
+}
+
+func (a *awsGlacier) DescribeJob(vaultName, jobId string) (*AWSGlacierJob, error) {
+	jobDesc, err := a.describeJob(context.Background(), vaultName, jobId)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &AWSGlacierJob{
+		JobId:         jobId,
+		Completed:     aws.BoolValue(jobDesc.Completed),
+		Succeeded:     aws.StringValue(jobDesc.StatusCode) == glacier.StatusCodeSucceeded,
+		StatusMessage: aws.StringValue(jobDesc.StatusMessage),
+	}
+	if jobDesc.CompletionDate != nil {
+		completionDate, err := time.Parse(time.RFC3339, *jobDesc.CompletionDate)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid completion date of job %s", jobId)
+		}
+		job.CompletionDate = &completionDate
+	}
+
+	return job, nil
+}
+
+func (a *awsGlacier) describeJob(ctx context.Context, vaultName, jobId string) (*glacier.JobDescription, error) {
+	request := &glacier.DescribeJobInput{
+		AccountId: a.accountId(),
+		VaultName: aws.String(vaultName),
+		JobId:     aws.String(jobId),
+	}
+	LogDebug("Send DescribeJob: %+v", request)
+	var jobDesc *glacier.JobDescription
+	err := a.retryer.do(ctx, "DescribeJob", func() (err error) {
+		jobDesc, err = a.glacier.DescribeJob(request)
+		return err
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == glacier.ErrCodeResourceNotFoundException {
+		return nil, ErrJobNotFound
+	}
+
+	return jobDesc, err
+}
+
+func (a *awsGlacier) initDownload(ctx context.Context, vaultName, archiveId, tier, byteRange string) (string, error) {
 	//check if we have a running Retrieval-Job
-	glacierJob, _ := a.determineJobId(vaultName, archiveId)
+	glacierJob, _ := a.determineJobId(ctx, vaultName, archiveId, byteRange)
 	if glacierJob != nil {
 		return *glacierJob.JobId, nil
 	}
 
 	request := &glacier.InitiateJobInput{
-		AccountId: aws.String("-"),
+		AccountId: a.accountId(),
 		VaultName: aws.String(vaultName),
 		JobParameters: &glacier.JobParameters{
 			ArchiveId: aws.String(archiveId),
@@ -237,8 +762,15 @@ func (a *awsGlacier) initDownload(vaultName, archiveId, tier string) (string, er
 			Type:      aws.String("archive-retrieval"),
 		},
 	}
+	if byteRange != "" {
+		request.JobParameters.RetrievalByteRange = aws.String(byteRange)
+	}
 	LogDebug("Send InitiateJob: %+v", request)
-	result, err := a.glacier.InitiateJob(request)
+	var result *glacier.InitiateJobOutput
+	err := a.retryer.do(ctx, "InitiateJob", func() (err error) {
+		result, err = a.glacier.InitiateJob(request)
+		return err
+	})
 
 	if err != nil {
 		return "", errors.Wrap(err, "Error while initialise the archive download job")
@@ -248,21 +780,37 @@ func (a *awsGlacier) initDownload(vaultName, archiveId, tier string) (string, er
 	return *result.JobId, nil
 }
 
-func (a *awsGlacier) determineJobId(vaultName, archiveId string) (*glacier.JobDescription, error) {
+// determineJobId returns a retrieval job for the given range of the archive. If the range is empty, the job
+// must retrieve the whole archive.
+func (a *awsGlacier) determineJobId(ctx context.Context, vaultName, archiveId, byteRange string) (*glacier.JobDescription, error) {
 	request := &glacier.ListJobsInput{
-		AccountId: aws.String("-"),
+		AccountId: a.accountId(),
 		VaultName: aws.String(vaultName),
 	}
 	LogDebug("Send ListJobs: %+v", request)
 
-	result, err := a.glacier.ListJobs(request)
+	var result *glacier.ListJobsOutput
+	err := a.retryer.do(ctx, "ListJobs", func() (err error) {
+		result, err = a.glacier.ListJobs(request)
+		return err
+	})
 	if err != nil {
 		return nil, errors.Wrap(err, "Could not get list of jobs")
 	}
 
 	LogInfo("Complete ListJobs: %+v", result)
 	for _, jobDesc := range result.JobList {
-		if *jobDesc.Action == "ArchiveRetrieval" && *jobDesc.ArchiveId == archiveId {
+		if *jobDesc.Action != "ArchiveRetrieval" || *jobDesc.ArchiveId != archiveId {
+			continue
+		}
+
+		jobRange := aws.StringValue(jobDesc.RetrievalByteRange)
+		if byteRange == "" {
+			wholeArchive := fmt.Sprintf("0-%d", aws.Int64Value(jobDesc.ArchiveSizeInBytes)-1)
+			if jobRange == "" || jobRange == wholeArchive {
+				return jobDesc, nil
+			}
+		} else if jobRange == byteRange {
 			return jobDesc, nil
 		}
 	}
@@ -270,21 +818,17 @@ func (a *awsGlacier) determineJobId(vaultName, archiveId string) (*glacier.JobDe
 	return nil, errors.New("No archive retrieval job found")
 }
 
-func (a *awsGlacier) WaitForJob(vaultName, jobId string, pollInterval time.Duration) error {
+// WaitForJob polls the status of the given job until it is completed or the context is cancelled. The description of
+// the completed job will be returned.
+func (a *awsGlacier) WaitForJob(ctx context.Context, vaultName, jobId string, pollInterval time.Duration) (*glacier.JobDescription, error) {
 	for {
-		request := &glacier.DescribeJobInput{
-			AccountId: aws.String("-"),
-			VaultName: aws.String(vaultName),
-			JobId:     aws.String(jobId),
-		}
-		LogDebug("Send DescribeJob: %+v", request)
-		jobDesc, err := a.glacier.DescribeJob(request)
+		jobDesc, err := a.describeJob(ctx, vaultName, jobId)
 		if err != nil {
-			return errors.Wrap(err, "Could not get job status")
+			return nil, errors.Wrap(err, "Could not get job status")
 		}
 
 		if *jobDesc.Completed {
-			return nil
+			return jobDesc, nil
 		} else {
 			d := pollInterval.Round(time.Minute)
 			h := d / time.Hour
@@ -292,39 +836,25 @@ func (a *awsGlacier) WaitForJob(vaultName, jobId string, pollInterval time.Durat
 			m := d / time.Minute
 
 			LogInfo("Job is not completed yet. Wait for %02d:%02d", h, m)
-			time.Sleep(pollInterval)
+			if err := sleepContext(ctx, pollInterval); err != nil {
+				return nil, err
+			}
 		}
 	}
 }
 
-func (a *awsGlacier) downloadJobOutput(vaultName, jobId string, target io.Writer) error {
-	request := &glacier.GetJobOutputInput{
-		AccountId: aws.String("-"),
-		VaultName: aws.String(vaultName),
-		JobId:     aws.String(jobId),
-	}
-	LogDebug("Send GetJobOutput: %+v", request)
-	result, err := a.glacier.GetJobOutput(request)
-
-	if err != nil {
-		return errors.Wrap(err, "Could not get job output")
-	}
-	defer result.Body.Close()
-
-	LogInfo("Complete GetJobOutput: %+v", result)
-	io.Copy(target, result.Body)
-
-	return nil
-}
-
 func (a *awsGlacier) Delete(delete AWSGlacierDelete) error {
 	request := &glacier.DeleteArchiveInput{
-		AccountId: aws.String("-"),
+		AccountId: a.accountId(),
 		VaultName: aws.String(delete.VaultName),
 		ArchiveId: aws.String(delete.ArchiveId),
 	}
 	LogDebug("Send DeleteArchive: %+v", request)
-	result, err := a.glacier.DeleteArchive(request)
+	var result *glacier.DeleteArchiveOutput
+	err := a.retryer.do(context.Background(), "DeleteArchive", func() (err error) {
+		result, err = a.glacier.DeleteArchive(request)
+		return err
+	})
 
 	if err != nil {
 		return errors.Wrap(err, "Could not delete archive")
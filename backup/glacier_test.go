@@ -0,0 +1,350 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/glacier"
+	"github.com/aws/aws-sdk-go/service/glacier/glacieriface"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const mib = 1024 * 1024
+
+type fakeGlacierClient struct {
+	glacieriface.GlacierAPI
+
+	mutex    sync.Mutex
+	parts    map[string][]byte
+	inFlight int
+	maxSeen  int
+	failures int
+	aborted  int
+
+	badChecksum        bool
+	badArchiveChecksum bool
+	deleted            []string
+	jobOutput          []byte
+	requestedRanges    []string
+	dropConnections    map[string]int
+}
+
+func newFakeGlacierClient() *fakeGlacierClient {
+	return &fakeGlacierClient{
+		parts: map[string][]byte{},
+	}
+}
+
+func (f *fakeGlacierClient) UploadMultipartPartWithContext(ctx aws.Context, input *glacier.UploadMultipartPartInput, opts ...request.Option) (*glacier.UploadMultipartPartOutput, error) {
+	f.mutex.Lock()
+	f.inFlight++
+	if f.inFlight > f.maxSeen {
+		f.maxSeen = f.inFlight
+	}
+	f.mutex.Unlock()
+
+	content, err := ioutil.ReadAll(input.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mutex.Lock()
+	if f.failures > 0 {
+		f.failures--
+		f.inFlight--
+		f.mutex.Unlock()
+		return nil, awserr.New("RequestError", "connection reset", nil)
+	}
+	f.mutex.Unlock()
+
+	//simulate a slow and unsteady connection
+	time.Sleep(time.Duration(rand.Intn(10)) * time.Millisecond)
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.inFlight--
+	f.parts[*input.Range] = content
+
+	if f.badChecksum {
+		content = append(content, 0)
+	}
+
+	return &glacier.UploadMultipartPartOutput{
+		Checksum: aws.String(fmt.Sprintf("%x", sha256.Sum256(content))),
+	}, nil
+}
+
+func (f *fakeGlacierClient) GetJobOutputWithContext(ctx aws.Context, input *glacier.GetJobOutputInput, opts ...request.Option) (*glacier.GetJobOutputOutput, error) {
+	return f.GetJobOutput(input)
+}
+
+func (f *fakeGlacierClient) GetJobOutput(input *glacier.GetJobOutputInput) (*glacier.GetJobOutputOutput, error) {
+	content := f.jobOutput
+	if input.Range != nil {
+		var start, end int
+		fmt.Sscanf(*input.Range, "bytes=%d-%d", &start, &end)
+		content = content[start : end+1]
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.requestedRanges = append(f.requestedRanges, aws.StringValue(input.Range))
+
+	var body io.Reader = bytes.NewReader(content)
+	if f.dropConnections[aws.StringValue(input.Range)] > 0 {
+		f.dropConnections[aws.StringValue(input.Range)]--
+		body = io.MultiReader(bytes.NewReader(content[:len(content)/2]), &failingReader{})
+	}
+
+	return &glacier.GetJobOutputOutput{
+		Body:     ioutil.NopCloser(body),
+		Checksum: aws.String(fmt.Sprintf("%x", glacier.ComputeHashes(bytes.NewReader(content)).TreeHash)),
+	}, nil
+}
+
+type failingReader struct{}
+
+func (f *failingReader) Read(p []byte) (int, error) {
+	return 0, errors.New("connection reset by peer")
+}
+
+func (f *fakeGlacierClient) ListParts(input *glacier.ListPartsInput) (*glacier.ListPartsOutput, error) {
+	if *input.UploadId != "upload" {
+		return nil, awserr.New(glacier.ErrCodeResourceNotFoundException, "not found", nil)
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	result := &glacier.ListPartsOutput{
+		ArchiveDescription: aws.String("description"),
+		PartSizeInBytes:    aws.Int64(mib),
+	}
+	for partRange, content := range f.parts {
+		result.Parts = append(result.Parts, &glacier.PartListElement{
+			RangeInBytes:   aws.String(strings.TrimSuffix(strings.TrimPrefix(partRange, "bytes "), "/*")),
+			SHA256TreeHash: aws.String(fmt.Sprintf("%x", glacier.ComputeHashes(bytes.NewReader(content)).TreeHash)),
+		})
+	}
+
+	return result, nil
+}
+
+func (f *fakeGlacierClient) CompleteMultipartUpload(input *glacier.CompleteMultipartUploadInput) (*glacier.ArchiveCreationOutput, error) {
+	checksum := input.Checksum
+	if f.badArchiveChecksum {
+		checksum = aws.String("bad")
+	}
+
+	return &glacier.ArchiveCreationOutput{
+		ArchiveId: aws.String("archive"),
+		Checksum:  checksum,
+	}, nil
+}
+
+func (f *fakeGlacierClient) DeleteArchive(input *glacier.DeleteArchiveInput) (*glacier.DeleteArchiveOutput, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.deleted = append(f.deleted, aws.StringValue(input.ArchiveId))
+	return &glacier.DeleteArchiveOutput{}, nil
+}
+
+func (f *fakeGlacierClient) AbortMultipartUpload(input *glacier.AbortMultipartUploadInput) (*glacier.AbortMultipartUploadOutput, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.aborted++
+	return &glacier.AbortMultipartUploadOutput{}, nil
+}
+
+func TestAwsGlacier_uploadParts_Concurrent(t *testing.T) {
+	//given
+	data := make([]byte, 10*1024+17)
+	rand.Read(data)
+
+	client := newFakeGlacierClient()
+	toTest := &awsGlacier{glacier: client, retryer: newRetryer(RetryPolicy{MaxAttempts: 1})}
+
+	//when
+	total, hashes, err := toTest.uploadParts(AWSGlacierUpload{
+		Source:      bytes.NewReader(data),
+		VaultName:   "vault",
+		PartSize:    1024,
+		Concurrency: 4,
+	}, aws.String("upload"), nil)
+
+	//then
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(data)), total)
+	assert.Len(t, hashes, 11)
+	assert.True(t, client.maxSeen <= 4)
+
+	for i, hash := range hashes {
+		end := (i + 1) * 1024
+		if end > len(data) {
+			end = len(data)
+		}
+		expected := sha256.Sum256(data[i*1024 : end])
+
+		assert.Equal(t, expected[:], hash, "hash of part %d", i)
+		assert.Equal(t, data[i*1024:end], client.parts[fmt.Sprintf("bytes %d-%d/*", i*1024, end-1)])
+	}
+}
+
+func TestAwsGlacier_Resume(t *testing.T) {
+	//given
+	data := make([]byte, 5*mib)
+	rand.Read(data)
+
+	client := newFakeGlacierClient()
+	client.parts[fmt.Sprintf("bytes 0-%d/*", mib-1)] = data[0:mib]
+	client.parts[fmt.Sprintf("bytes %d-%d/*", 2*mib, 3*mib-1)] = data[2*mib : 3*mib]
+	toTest := &awsGlacier{glacier: client, retryer: newRetryer(RetryPolicy{MaxAttempts: 1})}
+
+	//when
+	result, err := toTest.Resume(AWSGlacierResume{
+		Source:    bytes.NewReader(data),
+		VaultName: "vault",
+		UploadId:  "upload",
+	})
+
+	//then
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(data)), result.TotalSize)
+	assert.Equal(t, "description", result.ArchiveDesc)
+	assert.Equal(t, fmt.Sprintf("%x", glacier.ComputeHashes(bytes.NewReader(data)).TreeHash), *result.CreationResult.Checksum)
+	assert.Len(t, client.parts, 5)
+}
+
+func TestAwsGlacier_Resume_ChangedSource(t *testing.T) {
+	//given
+	data := make([]byte, 2*mib)
+	rand.Read(data)
+
+	client := newFakeGlacierClient()
+	client.parts[fmt.Sprintf("bytes 0-%d/*", mib-1)] = make([]byte, mib)
+	toTest := &awsGlacier{glacier: client, retryer: newRetryer(RetryPolicy{MaxAttempts: 1})}
+
+	//when
+	_, err := toTest.Resume(AWSGlacierResume{
+		Source:    bytes.NewReader(data),
+		VaultName: "vault",
+		UploadId:  "upload",
+	})
+
+	//then
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "differs from the already uploaded one")
+}
+
+func TestAwsGlacier_Resume_NotFound(t *testing.T) {
+	toTest := &awsGlacier{glacier: newFakeGlacierClient(), retryer: newRetryer(RetryPolicy{MaxAttempts: 1})}
+
+	_, err := toTest.Resume(AWSGlacierResume{
+		Source:    bytes.NewReader([]byte{}),
+		VaultName: "vault",
+		UploadId:  "unknown",
+	})
+
+	assert.Equal(t, ErrUploadNotFound, err)
+}
+
+func TestAwsGlacier_Resume_Cancelled(t *testing.T) {
+	for _, keep := range []bool{false, true} {
+		client := newFakeGlacierClient()
+		toTest := &awsGlacier{glacier: client, retryer: newRetryer(RetryPolicy{MaxAttempts: 1})}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := toTest.Resume(AWSGlacierResume{
+			Source:       &progressReader{ctx: ctx, source: bytes.NewReader(make([]byte, mib))},
+			VaultName:    "vault",
+			UploadId:     "upload",
+			KeepOnCancel: keep,
+		})
+
+		assert.True(t, isCancelled(err))
+		if keep {
+			assert.Equal(t, 0, client.aborted)
+			assert.Contains(t, err.Error(), "Upload is kept for a later resume")
+		} else {
+			assert.Equal(t, 1, client.aborted)
+			assert.Contains(t, err.Error(), "Upload aborted")
+		}
+	}
+}
+
+func TestAwsGlacier_uploadParts_Retry(t *testing.T) {
+	//given
+	data := make([]byte, 3*1024)
+	rand.Read(data)
+
+	client := newFakeGlacierClient()
+	client.failures = 2
+	toTest := &awsGlacier{glacier: client, retryer: newRetryer(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond})}
+
+	//when
+	total, hashes, err := toTest.uploadParts(AWSGlacierUpload{
+		Source:    bytes.NewReader(data),
+		VaultName: "vault",
+		PartSize:  1024,
+		Spool:     SpoolConfig{Mode: SpoolModeMemory},
+	}, aws.String("upload"), nil)
+
+	//then
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(data)), total)
+	assert.Len(t, hashes, 3)
+	assert.Equal(t, int64(2), toTest.Retries())
+	assert.Equal(t, data[0:1024], client.parts["bytes 0-1023/*"])
+}
+
+func TestAwsGlacier_uploadParts_ChecksumMismatch(t *testing.T) {
+	client := newFakeGlacierClient()
+	client.badChecksum = true
+	toTest := &awsGlacier{glacier: client, retryer: newRetryer(RetryPolicy{MaxAttempts: 1})}
+
+	_, _, err := toTest.uploadParts(AWSGlacierUpload{
+		Source:    bytes.NewReader([]byte("some content")),
+		VaultName: "vault",
+		PartSize:  1024,
+	}, aws.String("upload"), nil)
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "does not match the local one")
+}
+
+func TestAwsGlacier_Upload_ArchiveChecksumMismatch(t *testing.T) {
+	client := newFakeGlacierClient()
+	client.badArchiveChecksum = true
+	toTest := &awsGlacier{glacier: client, retryer: newRetryer(RetryPolicy{MaxAttempts: 1})}
+
+	result, uploadId, err := toTest.continueUpload(AWSGlacierUpload{
+		Source:    bytes.NewReader([]byte("some content")),
+		VaultName: "vault",
+		PartSize:  1024,
+	}, aws.String("upload"), nil)
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "does not match the local one")
+	assert.Nil(t, result)
+	assert.Nil(t, uploadId)
+	assert.Equal(t, []string{"archive"}, client.deleted)
+	assert.Equal(t, 0, client.aborted)
+}
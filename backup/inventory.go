@@ -0,0 +1,125 @@
+package backup
+
+import (
+	. "backup2glacier/log"
+	"context"
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/glacier"
+	"github.com/pkg/errors"
+	"time"
+)
+
+type AWSGlacierInventory struct {
+	VaultName    string
+	PollInterval time.Duration
+}
+
+// VaultInventory is the (json) output of an inventory retrieval job
+type VaultInventory struct {
+	VaultARN      string
+	InventoryDate time.Time
+	ArchiveList   []InventoryArchive
+}
+
+// InventoryArchive is one archive of a VaultInventory
+type InventoryArchive struct {
+	ArchiveId          string
+	ArchiveDescription string
+	CreationDate       time.Time
+	Size               int64
+	SHA256TreeHash     string
+}
+
+// Inventory retrieves the inventory of the vault. If there is already an inventory retrieval job, it will be
+// used. Otherwise a new one will be initiated. This method blocks until the job is completed.
+func (a *awsGlacier) Inventory(inventory AWSGlacierInventory) (*VaultInventory, error) {
+	jobId, err := a.initInventory(inventory.VaultName)
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not init inventory job")
+	}
+
+	_, err = a.WaitForJob(context.Background(), inventory.VaultName, jobId, inventory.PollInterval)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error while waiting for job completion")
+	}
+
+	result, err := a.downloadInventory(inventory.VaultName, jobId)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error while downloading inventory")
+	}
+	LogInfo("Received inventory of %s (%s) with %d archives", inventory.VaultName, result.InventoryDate.Format(time.RFC3339), len(result.ArchiveList))
+
+	return result, nil
+}
+
+func (a *awsGlacier) initInventory(vaultName string) (string, error) {
+	//check if we have a running (or recently completed) inventory job
+	request := &glacier.ListJobsInput{
+		AccountId: a.accountId(),
+		VaultName: aws.String(vaultName),
+	}
+	LogDebug("Send ListJobs: %+v", request)
+
+	var jobs *glacier.ListJobsOutput
+	err := a.retryer.do(context.Background(), "ListJobs", func() (err error) {
+		jobs, err = a.glacier.ListJobs(request)
+		return err
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "Could not get list of jobs")
+	}
+	for _, jobDesc := range jobs.JobList {
+		if aws.StringValue(jobDesc.Action) == glacier.ActionCodeInventoryRetrieval &&
+			aws.StringValue(jobDesc.StatusCode) != glacier.StatusCodeFailed {
+			LogInfo("Use existing inventory job %s", aws.StringValue(jobDesc.JobId))
+			return aws.StringValue(jobDesc.JobId), nil
+		}
+	}
+
+	initRequest := &glacier.InitiateJobInput{
+		AccountId: a.accountId(),
+		VaultName: aws.String(vaultName),
+		JobParameters: &glacier.JobParameters{
+			Format: aws.String("JSON"),
+			Type:   aws.String("inventory-retrieval"),
+		},
+	}
+	LogDebug("Send InitiateJob: %+v", initRequest)
+	var result *glacier.InitiateJobOutput
+	err = a.retryer.do(context.Background(), "InitiateJob", func() (err error) {
+		result, err = a.glacier.InitiateJob(initRequest)
+		return err
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "Error while initialise the inventory job")
+	}
+
+	LogInfo("Complete InitiateJob: %+v", result)
+	return aws.StringValue(result.JobId), nil
+}
+
+func (a *awsGlacier) downloadInventory(vaultName, jobId string) (*VaultInventory, error) {
+	request := &glacier.GetJobOutputInput{
+		AccountId: a.accountId(),
+		VaultName: aws.String(vaultName),
+		JobId:     aws.String(jobId),
+	}
+	LogDebug("Send GetJobOutput: %+v", request)
+
+	inventory := &VaultInventory{}
+	err := a.retryer.do(context.Background(), "GetJobOutput", func() error {
+		result, err := a.glacier.GetJobOutput(request)
+		if err != nil {
+			return err
+		}
+		defer result.Body.Close()
+
+		return json.NewDecoder(a.limiter.Reader(result.Body)).Decode(inventory)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return inventory, nil
+}
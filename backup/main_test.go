@@ -0,0 +1,17 @@
+package backup
+
+import (
+	"os"
+	"testing"
+)
+
+// testAccountId is the account of the credentials in the tests: they must not call the real STS
+const testAccountId = "999999999999"
+
+func TestMain(m *testing.M) {
+	callerAccountId = func(AWSLocation, AssumeRole) (string, error) {
+		return testAccountId, nil
+	}
+
+	os.Exit(m.Run())
+}
@@ -3,9 +3,14 @@ package backup
 import (
 	"backup2glacier/database"
 	"backup2glacier/database/model"
+	. "backup2glacier/log"
+	"context"
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/glacier"
 	"github.com/pkg/errors"
 	"io"
+	"io/ioutil"
 	"os"
 	"regexp"
 	"sync"
@@ -13,13 +18,25 @@ import (
 )
 
 type BackupResult struct {
+	BackupId    uint
 	Vault       string
 	ArchiveDesc string
+	PartSize    int
+	TotalSize   int64
+	Retries     int64
+	Volumes     []*VolumeResult
+	Error       error
+}
+
+type VolumeResult struct {
+	Number      int
 	ArchiveInfo *glacier.ArchiveCreationOutput
 	UploadId    *string
-	PartSize    int
 	TotalSize   int64
+	Retries     int64
 	Error       error
+	// Replicas are the results of the uploads of the replicas of this volume
+	Replicas []*VolumeResult
 }
 
 type BackupCreater interface {
@@ -31,7 +48,16 @@ type BackupCreater interface {
 type BackupGetter interface {
 	io.Closer
 
-	Download(backupId uint, target string, fallbackPassword func() string) error
+	Download(backupId uint, volume int, target string, fallbackPassword func() string) error
+	RequestDownload(backupId uint, volume int, target string) ([]*model.Job, error)
+	FetchDownloads(backupId uint, fallbackPassword func() string) error
+	RefreshJobs(backupId uint) []*model.Job
+}
+
+type BackupResumer interface {
+	io.Closer
+
+	Resume(backupId uint, fallbackPassword func() string) *BackupResult
 }
 
 type BackupDeleter interface {
@@ -42,228 +68,733 @@ type BackupManager interface {
 	io.Closer
 
 	Create(files []string, blacklist, whitelist []*regexp.Regexp, description, vaultName string) *BackupResult
-	Download(backupId uint, target string, fallbackPassword func() string) error
+	Resume(backupId uint, fallbackPassword func() string) *BackupResult
+	Download(backupId uint, volume int, target string, fallbackPassword func() string) error
+	RequestDownload(backupId uint, volume int, target string) ([]*model.Job, error)
+	FetchDownloads(backupId uint, fallbackPassword func() string) error
+	RefreshJobs(backupId uint) []*model.Job
 	Delete(backupId uint) error
+	Copy(backupId uint, target CopyTarget, deleteSource bool) error
+	Cleanup(before time.Time, remove, dryRun bool) ([]*model.Backup, error)
 }
 
 type backupManager struct {
 	dbRepository database.Repository
-	glacier      AWSGlacier
+	// backend is the type of the storage backend for new backups
+	backend string
+	// backends contains the storage backends by their type and location. They will be created on demand.
+	backends     map[storageKey]StorageBackend
+	storageClass string
+	// replicas are the further vaults for new backups
+	replicas []ReplicaTarget
 
 	partSize     int
+	volumeSize   int64
+	concurrency  int
+	spool        SpoolConfig
+	chunkSize    int64
 	savePassword bool
 	password     *string
 	tier         string
 	pollInterval time.Duration
+	// workDir is the directory for the archives which are copied
+	workDir string
+
+	ctx             context.Context
+	keepOnCancel    bool
+	storageSettings *StorageSettings
+	storageFactory  StorageFactory
+	onProgress      func(Progress)
+	onFile          func(FileEvent)
+	// heartbeats contains the time of the last heartbeat of each uploaded backup
+	heartbeats     map[uint]time.Time
+	heartbeatMutex sync.Mutex
 }
 
-func NewBackupCreater(pw string, savePw bool, partSize int, dbUrl string) (BackupCreater, error) {
-	return NewBackupManager(&pw, savePw, partSize, time.Millisecond, "", database.NewRepository(dbUrl))
+// ErrBackupNotFound will be returned if the catalog does not contain the backup
+var ErrBackupNotFound = errors.New("Backup not found")
+
+func NewBackupCreater(pw string, savePw bool, partSize int, volumeSize int64, concurrency int, spool SpoolConfig, backend, storageClass string, replicas []ReplicaTarget, dbUrl string, opts ...ManagerOption) (BackupCreater, error) {
+	return NewBackupManager(&pw, savePw, partSize, time.Millisecond, "", database.NewRepository(dbUrl), append([]ManagerOption{
+		WithBackend(backend, storageClass),
+		WithReplicas(replicas),
+		WithVolumeSize(volumeSize),
+		WithConcurrency(concurrency),
+		WithSpool(spool)}, opts...)...)
 }
 
-func NewBackupGetter(pw *string, tier string, pollInterval time.Duration, dbUrl string) (BackupGetter, error) {
-	return NewBackupManager(pw, false, 0, pollInterval, tier, database.NewRepository(dbUrl))
+func NewBackupResumer(pw *string, concurrency int, spool SpoolConfig, dbUrl string, opts ...ManagerOption) (BackupResumer, error) {
+	return NewBackupManager(pw, false, 0, time.Millisecond, "", database.NewRepository(dbUrl), append([]ManagerOption{
+		WithConcurrency(concurrency),
+		WithSpool(spool)}, opts...)...)
 }
 
-func NewBackupDeleter(dbUrl string) (BackupDeleter, error) {
-	return NewBackupManager(nil, false, 0, 0, "", database.NewRepository(dbUrl))
+func NewBackupGetter(pw *string, tier string, pollInterval time.Duration, chunkSize int64, concurrency int, dbUrl string, opts ...ManagerOption) (BackupGetter, error) {
+	return NewBackupManager(pw, false, 0, pollInterval, tier, database.NewRepository(dbUrl), append([]ManagerOption{
+		WithChunkSize(chunkSize),
+		WithConcurrency(concurrency)}, opts...)...)
 }
 
-func NewBackupDeleterForRepository(dbRepo database.Repository) (BackupDeleter, error) {
-	return NewBackupManager(nil, false, 0, 0, "", dbRepo)
+func NewBackupDeleter(dbUrl string, opts ...ManagerOption) (BackupDeleter, error) {
+	return NewBackupManager(nil, false, 0, 0, "", database.NewRepository(dbUrl), opts...)
 }
 
-func NewBackupManager(pw *string, savePw bool, partSize int, pollInterval time.Duration, tier string, dbRepo database.Repository) (BackupManager, error) {
-	g, err := NewAWSGlacier()
-	if err != nil {
-		return nil, err
+func NewBackupDeleterForRepository(dbRepo database.Repository, opts ...ManagerOption) (BackupDeleter, error) {
+	return NewBackupManager(nil, false, 0, 0, "", dbRepo, opts...)
+}
+
+// NewBackupManager creates a manager for the backups of the given repository. The options overwrite the defaults:
+// new backups are stored in glacier, with one volume and without concurrency. The storage backends are created
+// with the storage settings (Default: NewStorageSettings).
+func NewBackupManager(pw *string, savePw bool, partSize int, pollInterval time.Duration, tier string, dbRepo database.Repository, opts ...ManagerOption) (BackupManager, error) {
+	m := &backupManager{
+		dbRepository:    dbRepo,
+		backend:         BackendGlacier,
+		backends:        map[storageKey]StorageBackend{},
+		partSize:        partSize,
+		pollInterval:    pollInterval,
+		tier:            tier,
+		savePassword:    savePw,
+		password:        pw,
+		ctx:             context.Background(),
+		storageSettings: NewStorageSettings(),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if m.storageFactory == nil {
+		m.storageFactory = NewStorageFactory(m.storageSettings)
 	}
 
-	return &backupManager{
-		dbRepository: dbRepo,
-		glacier:      g,
-		partSize:     partSize,
-		pollInterval: pollInterval,
-		tier:         tier,
-		savePassword: savePw,
-		password:     pw,
-	}, nil
+	return m, nil
 }
 
 func (b *backupManager) Close() error {
 	return b.dbRepository.Close()
 }
 
+// storageKey identifies a storage backend of the manager
+type storageKey struct {
+	backend  string
+	location AWSLocation
+}
+
+// storage returns the storage backend of the given type for the given region and account
+func (b *backupManager) storage(backend, region, accountId string) (StorageBackend, error) {
+	if backend == "" {
+		backend = BackendGlacier
+	}
+	key := storageKey{backend, AWSLocation{region, accountId}.withDefaults(b.storageSettings.Location)}
+	if !isAWSBackend(backend) {
+		key.location = AWSLocation{}
+	}
+	if storage, exists := b.backends[key]; exists {
+		return storage, nil
+	}
+
+	storage, err := b.storageFactory(key.backend, key.location)
+	if err != nil {
+		return nil, err
+	}
+	b.backends[key] = storage
+
+	return storage, nil
+}
+
 func (b *backupManager) Create(files []string, blacklist, whitelist []*regexp.Regexp, description, vaultName string) *BackupResult {
+	//save backup intent
+	dbBackupEntity, err := b.saveBackupIntent(files, blacklist, whitelist, description, vaultName)
+	if err != nil {
+		return &BackupResult{Error: err}
+	}
+
+	return b.upload(dbBackupEntity, files, blacklist, whitelist, nil)
+}
+
+// Resume continues an interrupted backup. Therefore the backup's content will be zipped and encrypted again. Volumes
+// which are already uploaded will be skipped. Interrupted volume uploads will be resumed: only their missing parts
+// will be uploaded. This only works if the backup's sources have not changed in the meantime.
+func (b *backupManager) Resume(backupId uint, fallbackPassword func() string) *BackupResult {
+	dbBackupEntity := b.dbRepository.GetBackupById(backupId)
+	if dbBackupEntity.ID != backupId {
+		return &BackupResult{Error: ErrBackupNotFound}
+	}
+
+	result := &BackupResult{
+		BackupId:    dbBackupEntity.ID,
+		Vault:       dbBackupEntity.Vault,
+		ArchiveDesc: dbBackupEntity.Description,
+		PartSize:    dbBackupEntity.PartSize,
+	}
+	if dbBackupEntity.Sources == "" || dbBackupEntity.PartSize == 0 {
+		result.Error = errors.New("The backup can not be resumed because its sources are unknown")
+		return result
+	}
+
+	if err := resumable(dbBackupEntity); err != nil {
+		result.Error = err
+		return result
+	}
+
+	existingVolumes := map[int]*model.Volume{}
+	volumes := b.dbRepository.GetVolumesByBackupId(backupId)
+	for i := range volumes {
+		existingVolumes[volumes[i].Number] = &volumes[i]
+	}
+
+	var files, blacklistExpr, whitelistExpr []string
+	var blacklist, whitelist []*regexp.Regexp
+	json.Unmarshal([]byte(dbBackupEntity.Sources), &files)
+	json.Unmarshal([]byte(dbBackupEntity.Blacklist), &blacklistExpr)
+	json.Unmarshal([]byte(dbBackupEntity.Whitelist), &whitelistExpr)
+	for _, expr := range blacklistExpr {
+		blacklist = append(blacklist, regexp.MustCompile(expr))
+	}
+	for _, expr := range whitelistExpr {
+		whitelist = append(whitelist, regexp.MustCompile(expr))
+	}
+
+	if b.password == nil {
+		password := dbBackupEntity.Password
+		if password == "" {
+			password = fallbackPassword()
+		}
+		b.password = &password
+	}
+	b.partSize = dbBackupEntity.PartSize
+	b.volumeSize = dbBackupEntity.VolumeSize
+
+	//the contents will be collected again
+	b.dbRepository.DeleteContentsByBackupId(backupId)
+
+	return b.upload(dbBackupEntity, files, blacklist, whitelist, existingVolumes)
+}
+
+// upload zips, encrypts and uploads the given files. Volumes which are contained in existingVolumes are either
+// skipped (if they are already uploaded) or resumed (if they have a upload id).
+func (b *backupManager) upload(dbBackupEntity *model.Backup, files []string, blacklist, whitelist []*regexp.Regexp, existingVolumes map[int]*model.Volume) *BackupResult {
+	description := dbBackupEntity.Description
+	vaultName := dbBackupEntity.Vault
+
+	result := &BackupResult{
+		BackupId:    dbBackupEntity.ID,
+		Vault:       vaultName,
+		ArchiveDesc: description,
+		PartSize:    b.partSize,
+	}
+	if err := saveStatus(b.dbRepository, dbBackupEntity, model.BackupStatusUploading); err != nil {
+		result.Error = err
+		return result
+	}
+
+	storage, err := b.storage(dbBackupEntity.Backend, dbBackupEntity.Region, dbBackupEntity.AccountId)
+	if err != nil {
+		result.Error = err
+		b.updateBackup(result, dbBackupEntity, model.BackupStatusFailed)
+		return result
+	}
+	replicas, err := replicaTargets(dbBackupEntity)
+	if err != nil {
+		result.Error = err
+		b.updateBackup(result, dbBackupEntity, model.BackupStatusFailed)
+		return result
+	}
+
 	// folder/file -> zip -> encrypt -> glacier
-	srcZip, dstZip := io.Pipe()
-	srcCrypt, dstCrypt := io.Pipe()
+	// each volume has its own pipeline (and so its own glacier archive)
+	volumeIds := sync.Map{}
+	var current *volumeUpload
 
-	wg := sync.WaitGroup{}
-	wg.Add(3)
+	finishCurrent := func() error {
+		if current == nil {
+			return nil
+		}
+		volumeResult := current.wait()
+		current = nil
 
-	//save backup intent
-	dbBackupEntity := b.saveBackupIntent(description, vaultName)
+		result.Volumes = append(result.Volumes, volumeResult)
+		result.TotalSize += volumeResult.TotalSize
+		result.Retries += volumeResult.Retries
+
+		return volumeResult.Error
+	}
+
+	supplier := func(volume int) (io.WriteCloser, error) {
+		if err := finishCurrent(); err != nil {
+			return nil, err
+		}
+		if err := b.ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		dbVolume := existingVolumes[volume]
+		if dbVolume == nil {
+			dbVolume = b.saveVolumeIntent(dbBackupEntity, volume)
+		}
+		volumeIds.Store(volume, dbVolume.ID)
+
+		if dbVolume.ArchiveId != nil {
+			LogInfo("Skip volume %d: it is already uploaded", volume)
+
+			result.Volumes = append(result.Volumes, &VolumeResult{
+				Number:   volume,
+				UploadId: dbVolume.UploadId,
+				ArchiveInfo: &glacier.ArchiveCreationOutput{
+					ArchiveId: dbVolume.ArchiveId,
+					Checksum:  dbVolume.Checksum,
+					Location:  dbVolume.Location,
+				},
+				TotalSize: dbVolume.Length,
+			})
+			result.TotalSize += dbVolume.Length
+
+			return &nopWriteCloser{ioutil.Discard}, nil
+		}
+
+		replicaUploads := b.prepareReplicas(dbBackupEntity, dbVolume, replicas)
+		current = b.startVolumeUpload(storage, dbVolume, replicaUploads, archiveDescription(dbBackupEntity, volume), vaultName)
+		return current.dst, nil
+	}
 
 	//zipping
 	contentChan := make(chan *ZipContent, 50)
+	contentDone := make(chan bool)
 
 	go func() {
-		defer wg.Done()
-		defer dstZip.Close()
+		defer close(contentDone)
 
-		Zip(files, blacklist, whitelist, dstZip, contentChan)
-	}()
-	go func() {
-		for {
-			content, open := <-contentChan
-			if !open {
-				return
-			}
+		for content := range contentChan {
+			volumeId, _ := volumeIds.Load(content.Volume)
 
 			//store content direct into db
 			b.dbRepository.AddContent(dbBackupEntity, &model.Content{
-				Path:    content.Realpath,
-				Length:  content.Length,
-				ModTime: content.FileInfo.ModTime(),
+				VolumeID: volumeId.(uint),
+				Path:     content.Realpath,
+				Length:   content.Length,
+				ModTime:  content.FileInfo.ModTime(),
 			})
+
+			if b.onFile != nil {
+				b.onFile(FileEvent{
+					BackupId: dbBackupEntity.ID,
+					Volume:   content.Volume,
+					Path:     content.Realpath,
+					Length:   content.Length,
+				})
+			}
 		}
 	}()
 
+	zipErr := ZipVolumes(b.ctx, files, blacklist, whitelist, b.volumeSize, supplier, contentChan)
+	uploadErr := finishCurrent()
+	<-contentDone
+
+	cancelled := false
+	if err := b.ctx.Err(); err != nil && (uploadErr != nil || zipErr != nil) {
+		//the errors of the pipeline are only consequences of the cancellation
+		result.Error = b.cancelled(err)
+		cancelled = true
+	} else if uploadErr != nil {
+		result.Error = uploadErr
+	} else if zipErr != nil {
+		result.Error = zipErr
+	}
+
+	//save to db
+	b.updateBackup(result, dbBackupEntity, b.uploadStatus(result, cancelled))
+
+	return result
+}
+
+type volumeUpload struct {
+	dst    *volumeWriter
+	wg     sync.WaitGroup
+	result *VolumeResult
+}
+
+// volumeWriter is the destination of the zip of a volume. It receives the contents of the volume for its manifest.
+type volumeWriter struct {
+	*io.PipeWriter
+
+	contents []*ZipContent
+	received bool
+}
+
+func (v *volumeWriter) ReceiveContents(contents []*ZipContent) {
+	v.contents = contents
+	v.received = true
+}
+
+// startVolumeUpload starts the encryption and the upload of the given volume. All data which
+// is written into the returned volumeUpload's dst will be encrypted and uploaded. The encrypted
+// content will be uploaded into the given replicas at the same time.
+func (b *backupManager) startVolumeUpload(storage StorageBackend, dbVolume *model.Volume, replicas []*replicaUpload, description, vaultName string) *volumeUpload {
+	srcZip, dstZip := io.Pipe()
+	srcCrypt, dstCrypt := io.Pipe()
+
+	upload := &volumeUpload{
+		dst: &volumeWriter{PipeWriter: dstZip},
+		result: &VolumeResult{
+			Number: dbVolume.Number,
+		},
+	}
+	upload.wg.Add(2)
+
 	//encryption
 	go func() {
-		defer wg.Done()
+		defer upload.wg.Done()
 		defer dstCrypt.Close()
 
-		crypt := NewCryptModule(*b.password)
-		crypt.Encrypt(srcZip, dstCrypt)
+		crypt := NewVolumeCryptModule(*b.password, dbVolume.Number)
+		err := crypt.Encrypt(srcZip, dstCrypt)
+		if err == nil && upload.dst.received {
+			//the contents are received before the zip is closed: so they are complete after the encryption
+			manifest := NewManifest(dbVolume.BackupID, dbVolume.Number, upload.dst.contents)
+			err = WriteManifest(dstCrypt, *b.password, manifest)
+		}
+		if err != nil {
+			//the upload must not complete and the zipping must not block if the encryption fails
+			dstCrypt.CloseWithError(err)
+			srcZip.CloseWithError(err)
+		}
 	}()
 
-	var err error
-	var uploadResult *AWSGlacierUploadResult
-	var uploadId *string
+	source := srcCrypt
+	if len(replicas) > 0 {
+		source = b.startReplicaUploads(upload, srcCrypt, replicas, description)
+	}
 
 	//uploading
 	go func() {
-		defer wg.Done()
-		defer srcCrypt.Close()
-
-		uploadResult, uploadId, err = b.glacier.Upload(AWSGlacierUpload{
-			Source:      srcCrypt,
-			VaultName:   vaultName,
-			ArchiveDesc: description,
-			PartSize:    b.partSize,
-		})
+		defer upload.wg.Done()
+		defer source.Close()
+
+		retries := storage.Retries()
+		uploadResult, uploadId, err := b.uploadArchive(storage, b.progressOf(source, dbVolume.BackupID, dbVolume.Number, vaultName), dbVolume.UploadId, vaultName, description, dbVolume.Number, b.partSize)
+		if err != nil {
+			err = errors.Wrapf(err, "Could not upload volume %d", dbVolume.Number)
+		}
+
+		upload.result.UploadId = uploadId
+		upload.result.ArchiveInfo = uploadResult.CreationResult
+		upload.result.TotalSize = uploadResult.TotalSize
+		upload.result.Error = err
+		upload.result.Retries = storage.Retries() - retries
+
+		b.updateVolume(upload.result, dbVolume)
 	}()
 
-	//wait for all to finish
-	wg.Wait()
+	return upload
+}
+
+// uploadArchive uploads the source into a new archive. If an upload id is given, this upload will be resumed
+// instead (or a new one will be started if it does not exist anymore). The returned result is never nil.
+func (b *backupManager) uploadArchive(storage StorageBackend, source io.Reader, resumeId *string, vaultName, description string, volume, partSize int) (*AWSGlacierUploadResult, *string, error) {
+	var uploadResult *AWSGlacierUploadResult
+	var uploadId *string
+	var err error
+
+	if resumeId != nil {
+		uploadId = resumeId
+		uploadResult, err = storage.Resume(AWSGlacierResume{
+			Source:       source,
+			VaultName:    vaultName,
+			UploadId:     *resumeId,
+			Concurrency:  b.concurrency,
+			Spool:        b.spool,
+			KeepOnCancel: b.keepOnCancel,
+			Context:      b.ctx,
+		})
+	}
+	if resumeId == nil || err == ErrUploadNotFound {
+		if err == ErrUploadNotFound {
+			LogInfo("The upload of volume %d does not exist anymore. Start a new one.", volume)
+		}
+
+		uploadResult, uploadId, err = storage.Upload(AWSGlacierUpload{
+			Source:       source,
+			VaultName:    vaultName,
+			ArchiveDesc:  description,
+			PartSize:     partSize,
+			Concurrency:  b.concurrency,
+			Spool:        b.spool,
+			StorageClass: b.storageClass,
+			KeepOnCancel: b.keepOnCancel,
+			Context:      b.ctx,
+		})
+	}
+	if isCancelled(err) && !b.keepOnCancel {
+		//the upload is aborted and can not be resumed anymore
+		uploadId = nil
+	}
 
 	if uploadResult == nil {
 		//avoid nil-pointer if upload fails
 		uploadResult = &AWSGlacierUploadResult{}
 	}
 
-	result := &BackupResult{
-		Vault:       vaultName,
-		UploadId:    uploadId,
-		ArchiveInfo: uploadResult.CreationResult,
-		TotalSize:   uploadResult.TotalSize,
-		PartSize:    uploadResult.PartSize,
-		ArchiveDesc: uploadResult.ArchiveDesc,
-		Error:       err,
+	return uploadResult, uploadId, err
+}
+
+// cancelled returns the error of a cancelled backup. It tells whether the backup can be resumed.
+func (b *backupManager) cancelled(err error) error {
+	if b.keepOnCancel {
+		return errors.Wrap(err, "The backup was cancelled. Its uploads are kept for a later resume")
 	}
 
-	//save to db
-	b.updateBackup(result, dbBackupEntity)
+	return errors.Wrap(err, "The backup was cancelled. Its uploads are aborted")
+}
 
-	return result
+// progressOf returns the source of an upload which reports its progress and stops if the context is cancelled.
+// The progress refreshes the heartbeat of the backup.
+func (b *backupManager) progressOf(source io.Reader, backupId uint, volume int, vaultName string) io.Reader {
+	return &progressReader{
+		ctx:    b.ctx,
+		source: source,
+		progress: Progress{
+			BackupId:  backupId,
+			Volume:    volume,
+			Operation: OperationUpload,
+			Vault:     vaultName,
+		},
+		report: func(progress Progress) {
+			b.heartbeat(backupId)
+			if b.onProgress != nil {
+				b.onProgress(progress)
+			}
+		},
+	}
+}
+
+func (v *volumeUpload) wait() *VolumeResult {
+	v.dst.Close()
+	v.wg.Wait()
+
+	return v.result
+}
+
+// archiveDescription returns the description of the archive of the given volume. It contains the metadata of
+// the backup, so that the catalog can be recovered from the vault.
+func archiveDescription(dbBackupEntity *model.Backup, volume int) string {
+	var sources []string
+	json.Unmarshal([]byte(dbBackupEntity.Sources), &sources)
+
+	return NewArchiveMetadata(dbBackupEntity.ID, volume, dbBackupEntity.CreatedAt, dbBackupEntity.Description, sources).ArchiveDescription()
 }
 
-func (b *backupManager) saveBackupIntent(description string, vaultName string) *model.Backup {
+func (b *backupManager) saveBackupIntent(files []string, blacklist, whitelist []*regexp.Regexp, description string, vaultName string) (*model.Backup, error) {
+	var blacklistExpr, whitelistExpr []string
+	for _, expr := range blacklist {
+		blacklistExpr = append(blacklistExpr, expr.String())
+	}
+	for _, expr := range whitelist {
+		whitelistExpr = append(whitelistExpr, expr.String())
+	}
+	sources, _ := json.Marshal(files)
+	blacklistJson, _ := json.Marshal(blacklistExpr)
+	whitelistJson, _ := json.Marshal(whitelistExpr)
+
 	dbBackupEntity := &model.Backup{
+		Backend:     b.backend,
 		Description: description,
 		Vault:       vaultName,
+		Sources:     string(sources),
+		Blacklist:   string(blacklistJson),
+		Whitelist:   string(whitelistJson),
+		PartSize:    b.partSize,
+		VolumeSize:  b.volumeSize,
+	}
+	if isAWSBackend(b.backend) {
+		location, err := b.storageSettings.ResolveLocation()
+		if err != nil {
+			return nil, err
+		}
+		dbBackupEntity.Region = location.Region
+		dbBackupEntity.AccountId = location.AccountId
+		dbBackupEntity.Replicas = encodeReplicaTargets(b.backend, b.replicas, location)
+	} else {
+		dbBackupEntity.Replicas = encodeReplicaTargets(b.backend, b.replicas, AWSLocation{})
 	}
 	if b.savePassword {
 		dbBackupEntity.Password = *b.password
 	}
-	b.dbRepository.SaveBackup(dbBackupEntity)
-	return dbBackupEntity
+	saveNewBackup(b.dbRepository, dbBackupEntity, model.BackupStatusPending)
+	return dbBackupEntity, nil
 }
 
-func (b *backupManager) updateBackup(result *BackupResult, dbBackupEntity *model.Backup) {
+func (b *backupManager) saveVolumeIntent(dbBackupEntity *model.Backup, volume int) *model.Volume {
+	dbVolumeEntity := &model.Volume{
+		Number: volume,
+	}
+	b.dbRepository.SaveVolume(dbBackupEntity, dbVolumeEntity)
+	return dbVolumeEntity
+}
+
+// updateBackup saves the result of the upload and the resulting status of the backup
+func (b *backupManager) updateBackup(result *BackupResult, dbBackupEntity *model.Backup, status string) {
+	dbBackupEntity.Error = ""
 	if result.Error != nil {
 		dbBackupEntity.Error = result.Error.Error()
 	}
-	dbBackupEntity.UploadId = result.UploadId
 	dbBackupEntity.Length = result.TotalSize
 
-	if result.ArchiveInfo != nil {
-		dbBackupEntity.ArchiveId = result.ArchiveInfo.ArchiveId
-		dbBackupEntity.Checksum = result.ArchiveInfo.Checksum
-		dbBackupEntity.Location = result.ArchiveInfo.Location
+	if err := saveStatus(b.dbRepository, dbBackupEntity, status); err != nil {
+		LogError("%v", err)
+		b.dbRepository.UpdateBackup(dbBackupEntity)
 	}
-
-	b.dbRepository.UpdateBackup(dbBackupEntity)
 }
 
-func (b *backupManager) Download(backupId uint, target string, fallbackPassword func() string) error {
-	fTarget, err := os.Create(target)
-	if err != nil {
-		return errors.Wrap(err, "Could not create target file")
+func (b *backupManager) updateVolume(result *VolumeResult, dbVolumeEntity *model.Volume) {
+	dbVolumeEntity.Error = ""
+	if result.Error != nil {
+		dbVolumeEntity.Error = result.Error.Error()
 	}
-	defer fTarget.Close()
+	dbVolumeEntity.UploadId = result.UploadId
+	dbVolumeEntity.Length = result.TotalSize
+
+	if result.ArchiveInfo != nil {
+		dbVolumeEntity.ArchiveId = result.ArchiveInfo.ArchiveId
+		dbVolumeEntity.Checksum = result.ArchiveInfo.Checksum
+		dbVolumeEntity.Location = result.ArchiveInfo.Location
+	}
+
+	b.dbRepository.UpdateVolume(dbVolumeEntity)
+}
 
+// Download downloads all volumes of the given backup. If the backup consists of more than one volume, each
+// volume will be written in its own file (<target>.<volume number>). If volume is not 0, only this volume will
+// be downloaded into the target.
+func (b *backupManager) Download(backupId uint, volume int, target string, fallbackPassword func() string) error {
 	toDownload := b.dbRepository.GetBackupById(backupId)
+	if toDownload.ID != backupId {
+		return ErrBackupNotFound
+	}
 	if b.password != nil {
 		toDownload.Password = *b.password
 	}
+
+	var volumes []model.Volume
+	for _, curVolume := range b.dbRepository.GetVolumesByBackupId(backupId) {
+		if volume == 0 || curVolume.Number == volume {
+			volumes = append(volumes, curVolume)
+		}
+	}
+	if len(volumes) == 0 {
+		return errors.New("No volume found for backup")
+	}
+
 	if toDownload.Password == "" {
 		toDownload.Password = fallbackPassword()
 	}
 
-	// glacier -> decrypt -> save as zip
-	srcCrypt, dstCrypt := io.Pipe()
+	for i := range volumes {
+		volumeTarget := volumeTarget(target, len(volumes), &volumes[i])
 
-	wg := sync.WaitGroup{}
-	wg.Add(2)
+		err := b.downloadVolume(toDownload, &volumes[i], b.volumeCopies(toDownload, &volumes[i]), volumeTarget, "")
+		if err != nil {
+			return errors.Wrapf(err, "Error while downloading volume %d", volumes[i].Number)
+		}
+		LogInfo("Successfully download volume %d to %s", volumes[i].Number, volumeTarget)
+	}
 
-	var downloadErr error
-	go func() {
-		defer wg.Done()
-		defer dstCrypt.Close()
+	return nil
+}
 
-		downloadErr = b.glacier.Download(AWSGlacierDownload{
-			VaultName:    toDownload.Vault,
-			ArchiveId:    *toDownload.ArchiveId,
-			Target:       dstCrypt,
-			Tier:         b.tier,
-			PollInterval: b.pollInterval,
-		})
-	}()
+// downloadVolume downloads the encrypted archive of the volume next to the target and decrypts it into the
+// target afterwards. If the download is interrupted, it will be continued on the next call. If a job id is
+// given, the output of this (completed) job will be downloaded. Otherwise a new job will be initiated. If the
+// download of a copy of the archive fails, the next copy (replica) will be tried.
+func (b *backupManager) downloadVolume(toDownload *model.Backup, volume *model.Volume, copies []archiveCopy, target, jobId string) error {
+	if len(copies) == 0 {
+		return errors.New("The volume has no archive")
+	}
 
-	var decryptErr error
-	go func() {
-		defer wg.Done()
+	// glacier -> save encrypted -> decrypt -> save as zip
+	encrypted := target + ".encrypted"
+	var err error
+	for i, source := range copies {
+		err = b.downloadArchive(source, volume, encrypted, jobId)
+		if err == nil || b.ctx.Err() != nil {
+			break
+		}
+		if i < len(copies)-1 {
+			LogError("Could not download volume %d from %s: %v. Try the replica %s.", volume.Number, source, err, copies[i+1])
+		}
+	}
+	if err != nil {
+		return errors.Wrap(err, "Error while downloading the archive")
+	}
 
-		crypt := NewCryptModule(toDownload.Password)
-		decryptErr = crypt.Decrypt(srcCrypt, fTarget)
-	}()
+	fSource, err := os.Open(encrypted)
+	if err != nil {
+		return errors.Wrap(err, "Could not open downloaded archive")
+	}
+	defer fSource.Close()
+
+	stat, err := fSource.Stat()
+	if err != nil {
+		return errors.Wrap(err, "Could not read downloaded archive")
+	}
+	//the manifest at the end of the archive does not belong to the zip
+	contentLength, err := ArchiveContentLength(fSource, stat.Size())
+	if err != nil {
+		return errors.Wrapf(err, "The encrypted archive remains in %s", encrypted)
+	}
 
-	//wait for all to finish
-	wg.Wait()
+	fTarget, err := os.Create(target)
+	if err != nil {
+		return errors.Wrap(err, "Could not create target file")
+	}
+	defer fTarget.Close()
 
-	if downloadErr != nil {
-		return errors.Wrap(downloadErr, "Error while downloading from glacier")
+	crypt := NewVolumeCryptModule(toDownload.Password, volume.Number)
+	if err := crypt.Decrypt(io.LimitReader(fSource, contentLength), fTarget); err != nil {
+		return errors.Wrapf(err, "Error while decrypt content. The encrypted archive remains in %s", encrypted)
 	}
-	if decryptErr != nil {
-		return errors.Wrap(decryptErr, "Error while decrypt content")
+
+	fSource.Close()
+	if err := os.Remove(encrypted); err != nil {
+		LogError("Could not remove the encrypted archive %s: %v", encrypted, err)
 	}
 
 	return nil
 }
 
+// downloadArchive downloads the given copy of the archive of the volume into the target
+func (b *backupManager) downloadArchive(source archiveCopy, volume *model.Volume, target, jobId string) error {
+	storage, err := b.storage(source.backend, source.region, source.accountId)
+	if err != nil {
+		return err
+	}
+
+	retries := storage.Retries()
+	defer func() {
+		if retries = storage.Retries() - retries; retries > 0 {
+			LogInfo("%d operations had to be retried for volume %d", retries, volume.Number)
+		}
+	}()
+
+	progress := Progress{BackupId: volume.BackupID, Volume: volume.Number, Operation: OperationDownload, Vault: source.vault}
+	return storage.Download(AWSGlacierDownload{
+		Context: b.ctx,
+		Progress: func(downloaded int64) {
+			if b.onProgress != nil {
+				progress.Bytes = downloaded
+				b.onProgress(progress)
+			}
+		},
+		VaultName:    source.vault,
+		ArchiveId:    source.archiveId,
+		Checksum:     aws.StringValue(volume.Checksum),
+		Target:       target,
+		JobId:        jobId,
+		ChunkSize:    b.chunkSize,
+		Concurrency:  b.concurrency,
+		Tier:         b.tier,
+		PollInterval: b.pollInterval,
+	})
+}
+
 func (b *backupManager) ensureTarget(target string) error {
 	handle, err := os.Stat(target)
 
@@ -287,19 +818,44 @@ func (b *backupManager) ensureTarget(target string) error {
 
 func (b *backupManager) Delete(backupId uint) error {
 	toDelete := b.dbRepository.GetBackupById(backupId)
-	if toDelete.ArchiveId == nil {
-		b.dbRepository.DeleteBackupById(backupId)
-		return nil
+	if toDelete.ID != backupId {
+		return ErrBackupNotFound
 	}
 
-	err := b.glacier.Delete(AWSGlacierDelete{
-		VaultName: toDelete.Vault,
-		ArchiveId: *toDelete.ArchiveId,
-	})
+	storage, err := b.storage(toDelete.Backend, toDelete.Region, toDelete.AccountId)
 	if err != nil {
-		return errors.Wrap(err, "Could not delete archive")
+		return err
+	}
+	if err := saveStatus(b.dbRepository, toDelete, model.BackupStatusDeleting); err != nil {
+		return err
+	}
+	if err := b.deleteReplicas(backupId); err != nil {
+		return err
+	}
+
+	for _, volume := range b.dbRepository.GetVolumesByBackupId(backupId) {
+		if volume.ArchiveId == nil {
+			continue
+		}
+
+		err := storage.Delete(AWSGlacierDelete{
+			VaultName: toDelete.Vault,
+			ArchiveId: *volume.ArchiveId,
+		})
+		if err != nil {
+			return errors.Wrapf(err, "Could not delete archive of volume %d", volume.Number)
+		}
+
+		if volume.ID != 0 {
+			//remember that this volume is already deleted (in case of a later volume fails)
+			volume.ArchiveId = nil
+			b.dbRepository.UpdateVolume(&volume)
+		}
 	}
 
+	if err := saveStatus(b.dbRepository, toDelete, model.BackupStatusDeleted); err != nil {
+		return err
+	}
 	b.dbRepository.DeleteBackupById(backupId)
 	return nil
 }
@@ -0,0 +1,154 @@
+package backup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"io"
+	"time"
+)
+
+// ManifestFormatVersion is the version of the manifest format which is written by this version
+const ManifestFormatVersion = 1
+
+// manifestMagic marks the end of an archive which contains a manifest
+var manifestMagic = []byte("B2GMNFST")
+
+// ManifestFooterSize is the size of the (not encrypted) footer at the end of an archive: the magic followed
+// by the length of the encrypted manifest.
+const ManifestFooterSize = 16
+
+// Manifest lists all files of one volume. It is appended (encrypted) at the end of the volume's archive. So
+// that the contents of a backup can be restored without the catalog.
+type Manifest struct {
+	Version  int            `json:"version"`
+	BackupId uint           `json:"backupId"`
+	Volume   int            `json:"volume"`
+	Files    []ManifestFile `json:"files"`
+}
+
+type ManifestFile struct {
+	Path    string    `json:"path"`
+	Length  int64     `json:"length"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// NewManifest creates the manifest of the given volume contents
+func NewManifest(backupId uint, volume int, contents []*ZipContent) *Manifest {
+	manifest := &Manifest{
+		Version:  ManifestFormatVersion,
+		BackupId: backupId,
+		Volume:   volume,
+		Files:    []ManifestFile{},
+	}
+	for _, content := range contents {
+		manifest.Files = append(manifest.Files, ManifestFile{
+			Path:    content.Realpath,
+			Length:  content.Length,
+			ModTime: content.FileInfo.ModTime().UTC(),
+		})
+	}
+
+	return manifest
+}
+
+// WriteManifest writes the encrypted manifest followed by the footer into the destination
+func WriteManifest(dst io.Writer, password string, manifest *Manifest) error {
+	plain := new(bytes.Buffer)
+	gzipWriter := gzip.NewWriter(plain)
+	if err := json.NewEncoder(gzipWriter).Encode(manifest); err != nil {
+		return errors.Wrap(err, "Could not encode manifest")
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return errors.Wrap(err, "Could not compress manifest")
+	}
+
+	encrypted := new(bytes.Buffer)
+	if err := NewManifestCryptModule(password, manifest.Volume).Encrypt(plain, encrypted); err != nil {
+		return errors.Wrap(err, "Could not encrypt manifest")
+	}
+
+	footer := make([]byte, ManifestFooterSize)
+	copy(footer, manifestMagic)
+	binary.BigEndian.PutUint64(footer[len(manifestMagic):], uint64(encrypted.Len()))
+
+	if _, err := dst.Write(encrypted.Bytes()); err != nil {
+		return err
+	}
+	_, err := dst.Write(footer)
+	return err
+}
+
+// ManifestLength reads the footer at the end of the given archive tail. It returns the length of the encrypted
+// manifest and false if the archive has no manifest (it was created by an older version).
+func ManifestLength(tail []byte) (int64, bool) {
+	if len(tail) < ManifestFooterSize {
+		return 0, false
+	}
+
+	footer := tail[len(tail)-ManifestFooterSize:]
+	if !bytes.Equal(footer[:len(manifestMagic)], manifestMagic) {
+		return 0, false
+	}
+
+	return int64(binary.BigEndian.Uint64(footer[len(manifestMagic):])), true
+}
+
+// ArchiveContentLength returns the length of the encrypted zip of the given archive (without the manifest)
+func ArchiveContentLength(archive io.ReaderAt, size int64) (int64, error) {
+	if size < ManifestFooterSize {
+		return size, nil
+	}
+
+	footer := make([]byte, ManifestFooterSize)
+	if _, err := archive.ReadAt(footer, size-ManifestFooterSize); err != nil {
+		return 0, errors.Wrap(err, "Could not read the end of the archive")
+	}
+
+	manifestLength, ok := ManifestLength(footer)
+	if !ok {
+		return size, nil
+	}
+	if manifestLength+ManifestFooterSize > size {
+		return 0, errors.New("The archive has an invalid manifest footer")
+	}
+
+	return size - manifestLength - ManifestFooterSize, nil
+}
+
+// ReadManifest decrypts the manifest at the end of the given archive tail. The tail must contain the whole
+// encrypted manifest and the footer.
+func ReadManifest(tail []byte, password string, volume int) (*Manifest, error) {
+	manifestLength, ok := ManifestLength(tail)
+	if !ok {
+		return nil, errors.New("The archive has no manifest")
+	}
+	if manifestLength+ManifestFooterSize > int64(len(tail)) {
+		return nil, errors.Errorf("The manifest (%d bytes) is not completely contained", manifestLength)
+	}
+
+	start := int64(len(tail)) - ManifestFooterSize - manifestLength
+	encrypted := bytes.NewReader(tail[start : start+manifestLength])
+
+	plain := new(bytes.Buffer)
+	if err := NewManifestCryptModule(password, volume).Decrypt(encrypted, plain); err != nil {
+		return nil, errors.Wrap(err, "Could not decrypt manifest")
+	}
+
+	gzipReader, err := gzip.NewReader(plain)
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not decompress manifest. Is the password correct?")
+	}
+
+	manifest := &Manifest{}
+	if err := json.NewDecoder(gzipReader).Decode(manifest); err != nil {
+		return nil, errors.Wrap(err, "Could not decode manifest")
+	}
+	if manifest.Version > ManifestFormatVersion {
+		return nil, errors.Errorf("The manifest has a newer format (%d) than supported (%d)", manifest.Version, ManifestFormatVersion)
+	}
+
+	return manifest, nil
+}
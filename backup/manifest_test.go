@@ -0,0 +1,66 @@
+package backup
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestManifest_WriteAndRead(t *testing.T) {
+	//given
+	fileInfo, err := os.Stat("manifest.go")
+	assert.NoError(t, err)
+
+	manifest := NewManifest(13, 2, []*ZipContent{
+		{Realpath: "/path/to/manifest.go", Length: 1234, FileInfo: fileInfo},
+	})
+
+	archive := new(bytes.Buffer)
+	archive.WriteString("the encrypted zip")
+
+	//when
+	assert.NoError(t, WriteManifest(archive, "secret", manifest))
+
+	//then
+	contentLength, err := ArchiveContentLength(bytes.NewReader(archive.Bytes()), int64(archive.Len()))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len("the encrypted zip")), contentLength)
+
+	read, err := ReadManifest(archive.Bytes(), "secret", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(13), read.BackupId)
+	assert.Equal(t, 2, read.Volume)
+	assert.Len(t, read.Files, 1)
+	assert.Equal(t, "/path/to/manifest.go", read.Files[0].Path)
+	assert.Equal(t, int64(1234), read.Files[0].Length)
+	assert.True(t, fileInfo.ModTime().Truncate(time.Second).Equal(read.Files[0].ModTime.Truncate(time.Second)))
+
+	_, err = ReadManifest(archive.Bytes(), "wrong", 2)
+	assert.Error(t, err)
+}
+
+func TestManifest_Deterministic(t *testing.T) {
+	fileInfo, err := os.Stat("manifest.go")
+	assert.NoError(t, err)
+	contents := []*ZipContent{{Realpath: "/path/to/manifest.go", Length: 1234, FileInfo: fileInfo}}
+
+	first, second := new(bytes.Buffer), new(bytes.Buffer)
+	assert.NoError(t, WriteManifest(first, "secret", NewManifest(1, 1, contents)))
+	assert.NoError(t, WriteManifest(second, "secret", NewManifest(1, 1, contents)))
+
+	//a resumed upload must produce the same archive
+	assert.Equal(t, first.Bytes(), second.Bytes())
+}
+
+func TestArchiveContentLength_Legacy(t *testing.T) {
+	archive := []byte("an archive of an older version without manifest")
+
+	contentLength, err := ArchiveContentLength(bytes.NewReader(archive), int64(len(archive)))
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(archive)), contentLength)
+	_, hasManifest := ManifestLength(archive)
+	assert.False(t, hasManifest)
+}
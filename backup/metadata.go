@@ -0,0 +1,116 @@
+package backup
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// MetadataFormatVersion is the version of the archive metadata which is written by this version
+const MetadataFormatVersion = 1
+
+// MaxArchiveDescriptionLength is the maximum length of an archive description which glacier accepts
+const MaxArchiveDescriptionLength = 1024
+
+// ArchiveMetadata describes the backup to which an archive belongs. It will be written (as JSON) into the
+// description of each archive, so that the catalog can be recovered from the inventory of the vault.
+type ArchiveMetadata struct {
+	Format      int       `json:"b2g"`
+	BackupId    uint      `json:"id"`
+	Volume      int       `json:"vol"`
+	Created     time.Time `json:"created"`
+	Host        string    `json:"host,omitempty"`
+	Description string    `json:"desc,omitempty"`
+	Sources     []string  `json:"src,omitempty"`
+	// Truncated is true if not all sources (or not the whole description) fit into the archive description
+	Truncated bool `json:"trunc,omitempty"`
+}
+
+// NewArchiveMetadata creates the metadata for the given volume of a backup
+func NewArchiveMetadata(backupId uint, volume int, created time.Time, description string, sources []string) *ArchiveMetadata {
+	host, _ := os.Hostname()
+
+	return &ArchiveMetadata{
+		Format:      MetadataFormatVersion,
+		BackupId:    backupId,
+		Volume:      volume,
+		Created:     created.UTC().Truncate(time.Second),
+		Host:        host,
+		Description: description,
+		Sources:     sources,
+	}
+}
+
+// ArchiveDescription encodes the metadata for the description of an archive. Glacier allows only printable
+// ASCII characters and at most 1024 of them. So all other characters will be escaped and the sources (and
+// at last the description) will be truncated if necessary.
+func (m *ArchiveMetadata) ArchiveDescription() string {
+	metadata := *m
+
+	for {
+		encoded := encodeDescription(metadata)
+		if len(encoded) <= MaxArchiveDescriptionLength {
+			return encoded
+		}
+		metadata.Truncated = true
+
+		switch {
+		case len(metadata.Sources) > 0:
+			metadata.Sources = metadata.Sources[:len(metadata.Sources)-1]
+		case metadata.Description != "":
+			overflow := len(encoded) - MaxArchiveDescriptionLength
+			runes := []rune(metadata.Description)
+			//each rune takes at least one character
+			if overflow >= len(runes) {
+				metadata.Description = ""
+			} else {
+				metadata.Description = string(runes[:len(runes)-overflow])
+			}
+		default:
+			metadata.Host = ""
+		}
+	}
+}
+
+// encodeDescription encodes the given value as JSON which contains only printable ASCII characters
+func encodeDescription(v interface{}) string {
+	raw, _ := json.Marshal(v)
+
+	//json escapes all control characters: so only the non ascii characters remain
+	encoded := strings.Builder{}
+	for _, r := range string(raw) {
+		switch {
+		case r <= 0x7E:
+			encoded.WriteRune(r)
+		case r > 0xFFFF:
+			r1, r2 := utf16.EncodeRune(r)
+			encoded.WriteString(fmt.Sprintf(`\u%04x\u%04x`, r1, r2))
+		default:
+			encoded.WriteString(fmt.Sprintf(`\u%04x`, r))
+		}
+	}
+
+	return encoded.String()
+}
+
+// ParseArchiveDescription reads the metadata of an archive description. If the description contains no
+// (supported) metadata, because the archive was created by an older version or an other tool, false will be
+// returned.
+func ParseArchiveDescription(description string) (*ArchiveMetadata, bool) {
+	if !strings.HasPrefix(description, "{") {
+		return nil, false
+	}
+
+	metadata := &ArchiveMetadata{}
+	if err := json.Unmarshal([]byte(description), metadata); err != nil {
+		return nil, false
+	}
+	if metadata.Format < 1 || metadata.Format > MetadataFormatVersion || metadata.Volume < 1 {
+		return nil, false
+	}
+
+	return metadata, true
+}
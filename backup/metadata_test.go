@@ -0,0 +1,58 @@
+package backup
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestArchiveMetadata_ArchiveDescription(t *testing.T) {
+	created := time.Date(2019, 5, 1, 12, 30, 0, 0, time.UTC)
+	metadata := NewArchiveMetadata(42, 2, created, "Backup of my fotos: München 🏔", []string{"/home/user/fotos"})
+
+	description := metadata.ArchiveDescription()
+
+	for _, c := range description {
+		assert.True(t, c >= 0x20 && c <= 0x7E, "not printable ascii: %q", c)
+	}
+
+	parsed, ok := ParseArchiveDescription(description)
+	assert.True(t, ok)
+	assert.Equal(t, MetadataFormatVersion, parsed.Format)
+	assert.Equal(t, uint(42), parsed.BackupId)
+	assert.Equal(t, 2, parsed.Volume)
+	assert.True(t, created.Equal(parsed.Created))
+	assert.Equal(t, "Backup of my fotos: München 🏔", parsed.Description)
+	assert.Equal(t, []string{"/home/user/fotos"}, parsed.Sources)
+	assert.False(t, parsed.Truncated)
+}
+
+func TestArchiveMetadata_ArchiveDescription_Truncate(t *testing.T) {
+	var sources []string
+	for i := 0; i < 100; i++ {
+		sources = append(sources, "/a/very/long/path/to/the/sources/of/the/backup")
+	}
+	metadata := NewArchiveMetadata(1, 1, time.Now(), strings.Repeat("ä", 2000), sources)
+
+	description := metadata.ArchiveDescription()
+
+	assert.True(t, len(description) <= MaxArchiveDescriptionLength)
+	parsed, ok := ParseArchiveDescription(description)
+	assert.True(t, ok)
+	assert.True(t, parsed.Truncated)
+	assert.Empty(t, parsed.Sources)
+	assert.True(t, strings.HasPrefix(strings.Repeat("ä", 2000), parsed.Description))
+}
+
+func TestParseArchiveDescription_Foreign(t *testing.T) {
+	for _, description := range []string{
+		"",
+		"Backup [/home/user] to vault",
+		`{"some":"json"}`,
+		`{"b2g":99,"id":1,"vol":1}`,
+	} {
+		_, ok := ParseArchiveDescription(description)
+		assert.False(t, ok, description)
+	}
+}
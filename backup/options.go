@@ -0,0 +1,159 @@
+package backup
+
+import (
+	"context"
+	"io"
+)
+
+// StorageFactory creates the storage backend of the given type for the given location. It will be called at most
+// once per type and location by a BackupManager.
+type StorageFactory func(backend string, location AWSLocation) (StorageBackend, error)
+
+// The operations which are reported by a Progress
+const (
+	OperationUpload   = "upload"
+	OperationDownload = "download"
+)
+
+// Progress reports the transferred bytes of a volume
+type Progress struct {
+	BackupId uint
+	Volume   int
+	// Operation is either OperationUpload or OperationDownload
+	Operation string
+	// Vault is the vault (or bucket or directory) from or into which the volume is transferred
+	Vault string
+	// Bytes is the number of (encrypted) bytes of the volume which are transferred so far
+	Bytes int64
+}
+
+// FileEvent reports a file which is added into a volume of a backup
+type FileEvent struct {
+	BackupId uint
+	Volume   int
+	Path     string
+	Length   int64
+}
+
+// ManagerOption configures a BackupManager
+type ManagerOption func(*backupManager)
+
+// WithContext sets the context of all operations of the manager. If the context is cancelled, the running
+// uploads, downloads and retrieval jobs will be stopped and the operation returns the error of the context.
+func WithContext(ctx context.Context) ManagerOption {
+	return func(b *backupManager) {
+		b.ctx = ctx
+	}
+}
+
+// WithStorageSettings sets the settings of the storage backends and the location of new backups.
+// Default: NewStorageSettings
+func WithStorageSettings(settings *StorageSettings) ManagerOption {
+	return func(b *backupManager) {
+		b.storageSettings = settings
+	}
+}
+
+// WithStorageFactory replaces the creation of the storage backends. Default: NewStorageFactory with the storage
+// settings of the manager
+func WithStorageFactory(factory StorageFactory) ManagerOption {
+	return func(b *backupManager) {
+		b.storageFactory = factory
+	}
+}
+
+// WithBackend sets the type of the storage backend and the storage class (only for S3) for new backups
+func WithBackend(backend, storageClass string) ManagerOption {
+	return func(b *backupManager) {
+		b.backend = backend
+		b.storageClass = storageClass
+	}
+}
+
+// WithReplicas sets the further vaults for new backups
+func WithReplicas(replicas []ReplicaTarget) ManagerOption {
+	return func(b *backupManager) {
+		b.replicas = replicas
+	}
+}
+
+// WithVolumeSize sets the maximum size of a volume of new backups. 0 means that a backup has only one volume.
+func WithVolumeSize(volumeSize int64) ManagerOption {
+	return func(b *backupManager) {
+		b.volumeSize = volumeSize
+	}
+}
+
+// WithConcurrency sets the number of parts (or chunks) which will be uploaded (or downloaded) at the same time
+func WithConcurrency(concurrency int) ManagerOption {
+	return func(b *backupManager) {
+		b.concurrency = concurrency
+	}
+}
+
+// WithSpool sets where the parts of the uploads will be buffered
+func WithSpool(spool SpoolConfig) ManagerOption {
+	return func(b *backupManager) {
+		b.spool = spool
+	}
+}
+
+// WithChunkSize sets the size of the ranges in which the archives will be downloaded
+func WithChunkSize(chunkSize int64) ManagerOption {
+	return func(b *backupManager) {
+		b.chunkSize = chunkSize
+	}
+}
+
+// WithWorkDir sets the directory for the archives which are copied. Default: the directory of temporary files
+func WithWorkDir(workDir string) ManagerOption {
+	return func(b *backupManager) {
+		b.workDir = workDir
+	}
+}
+
+// WithKeepOnCancel keeps the multipart uploads for a later resume if the context is cancelled. Otherwise they
+// will be aborted.
+func WithKeepOnCancel(keep bool) ManagerOption {
+	return func(b *backupManager) {
+		b.keepOnCancel = keep
+	}
+}
+
+// WithProgress sets the callback which receives the progress of the uploads and downloads. It will be called
+// concurrently by the uploads of the volume and its replicas.
+func WithProgress(onProgress func(Progress)) ManagerOption {
+	return func(b *backupManager) {
+		b.onProgress = onProgress
+	}
+}
+
+// WithFileEvents sets the callback which receives each file that is added into a backup
+func WithFileEvents(onFile func(FileEvent)) ManagerOption {
+	return func(b *backupManager) {
+		b.onFile = onFile
+	}
+}
+
+// progressReader reports the bytes which are read from the source of an upload. If the context is cancelled,
+// the next read fails with the error of the context.
+type progressReader struct {
+	ctx      context.Context
+	source   io.Reader
+	progress Progress
+	report   func(Progress)
+}
+
+func (p *progressReader) Read(buf []byte) (int, error) {
+	if err := p.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	n, err := p.source.Read(buf)
+	if n > 0 && p.report != nil {
+		p.progress.Bytes += int64(n)
+		p.report(p.progress)
+	}
+
+	return n, err
+}
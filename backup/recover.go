@@ -0,0 +1,300 @@
+package backup
+
+import (
+	"backup2glacier/database"
+	"backup2glacier/database/model"
+	. "backup2glacier/log"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+)
+
+// manifestRetrievalSize is the size of the archive's tail which will be retrieved to read the manifest
+const manifestRetrievalSize = 1024 * 1024
+
+// RecoverReport contains the backups which could be recovered from the inventory of a vault
+type RecoverReport struct {
+	Vault         string
+	InventoryDate time.Time
+	// Recovered are the backups which were restored into the catalog
+	Recovered []*model.Backup
+	// Foreign are the archives without metadata. They can be adopted by a sync.
+	Foreign []model.InventoryArchive
+	// Known is the number of archives which are already in the catalog
+	Known int
+}
+
+type CatalogRecoverer interface {
+	io.Closer
+
+	// Recover creates catalog entries for all archives of the vault which contain metadata in their description
+	// but are not in the catalog yet. If cached is true, the last cached inventory will be used. If dryRun is
+	// true, nothing will be saved.
+	Recover(vault string, cached, dryRun bool) (*RecoverReport, error)
+	// RecoverContents retrieves the manifests of all volumes of the given backup and saves their contents
+	// into the catalog. This needs one (small) retrieval job per volume.
+	RecoverContents(dbBackup *model.Backup, password string) error
+}
+
+func NewCatalogRecoverer(pollInterval time.Duration, tier string, settings *StorageSettings, dbUrl string) (CatalogRecoverer, error) {
+	return NewCatalogRecovererForRepository(pollInterval, tier, settings, database.NewRepository(dbUrl))
+}
+
+func NewCatalogRecovererForRepository(pollInterval time.Duration, tier string, settings *StorageSettings, dbRepo database.Repository) (CatalogRecoverer, error) {
+	g, err := NewAWSGlacier(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	return &vaultSyncer{
+		dbRepository: dbRepo,
+		glacier:      g,
+		settings:     settings,
+		pollInterval: pollInterval,
+		tier:         tier,
+	}, nil
+}
+
+type recoveredArchive struct {
+	archive  model.InventoryArchive
+	metadata *ArchiveMetadata
+}
+
+func (v *vaultSyncer) Recover(vault string, cached, dryRun bool) (*RecoverReport, error) {
+	inventory, err := v.inventory(vault, cached)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &RecoverReport{
+		Vault:         vault,
+		InventoryDate: inventory.InventoryDate,
+	}
+
+	known := map[string]bool{}
+	iter := v.dbRepository.GetByVault(vault)
+	for {
+		backup, next := iter.Next()
+		if !next {
+			break
+		}
+		for _, volume := range v.dbRepository.GetVolumesByBackupId(backup.ID) {
+			if volume.ArchiveId != nil {
+				known[*volume.ArchiveId] = true
+			}
+		}
+	}
+	iter.Close()
+	for _, replica := range v.dbRepository.GetReplicasByVault(vault) {
+		if replica.ArchiveId != nil {
+			known[*replica.ArchiveId] = true
+		}
+	}
+
+	//the volumes of one backup share the same metadata (except the volume number)
+	var keys []string
+	groups := map[string][]recoveredArchive{}
+	for _, archive := range inventory.Archives {
+		if known[archive.ArchiveId] {
+			report.Known++
+			continue
+		}
+
+		if _, isCatalog := ParseCatalogDescription(archive.Description); isCatalog {
+			continue
+		}
+
+		metadata, ok := ParseArchiveDescription(archive.Description)
+		if !ok {
+			report.Foreign = append(report.Foreign, archive)
+			continue
+		}
+
+		key := fmt.Sprintf("%s/%d/%s", metadata.Host, metadata.BackupId, metadata.Created.Format(time.RFC3339))
+		if _, exists := groups[key]; !exists {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], recoveredArchive{archive: archive, metadata: metadata})
+	}
+
+	if len(keys) == 0 {
+		return report, nil
+	}
+	location, err := v.settings.ResolveLocation()
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		report.Recovered = append(report.Recovered, v.recoverBackup(vault, location, groups[key], dryRun))
+	}
+
+	return report, nil
+}
+
+// recoverBackup creates the catalog entry for the given archives of one backup in the vault of the given location.
+// The backup gets its original id if it is not used by an other backup.
+func (v *vaultSyncer) recoverBackup(vault string, location AWSLocation, archives []recoveredArchive, dryRun bool) *model.Backup {
+	sort.Slice(archives, func(i, j int) bool {
+		return archives[i].metadata.Volume < archives[j].metadata.Volume
+	})
+	metadata := archives[0].metadata
+
+	sources, _ := json.Marshal(metadata.Sources)
+	dbBackup := &model.Backup{
+		Vault:       vault,
+		Region:      location.Region,
+		AccountId:   location.AccountId,
+		Description: metadata.Description,
+		Sources:     string(sources),
+	}
+	dbBackup.CreatedAt = metadata.Created
+	if metadata.Truncated {
+		dbBackup.Error = "The sources or the description of the backup are truncated"
+	}
+
+	for _, archive := range archives {
+		dbBackup.Length += archive.archive.Size
+		dbBackup.Volumes = append(dbBackup.Volumes, model.Volume{
+			Number:    archive.metadata.Volume,
+			ArchiveId: aws.String(archive.archive.ArchiveId),
+			Checksum:  aws.String(archive.archive.Checksum),
+			Length:    archive.archive.Size,
+		})
+	}
+	if dryRun {
+		dbBackup.ID = metadata.BackupId
+		return dbBackup
+	}
+
+	if !v.dbRepository.IsBackupIdUsed(metadata.BackupId) {
+		dbBackup.ID = metadata.BackupId
+	}
+	status := model.BackupStatusCompleted
+	if metadata.Truncated {
+		status = model.BackupStatusCompletedWithWarnings
+	}
+
+	volumes := dbBackup.Volumes
+	dbBackup.Volumes = nil
+	saveNewBackup(v.dbRepository, dbBackup, status)
+
+	for i := range volumes {
+		v.dbRepository.SaveVolume(dbBackup, &volumes[i])
+	}
+	dbBackup.Volumes = volumes
+	LogInfo("Recovered backup %d (%d volume(s)) of %s", dbBackup.ID, len(volumes), metadata.Created.Format(time.RFC3339))
+
+	return dbBackup
+}
+
+func (v *vaultSyncer) RecoverContents(dbBackup *model.Backup, password string) error {
+	volumes := v.dbRepository.GetVolumesByBackupId(dbBackup.ID)
+
+	//request all retrievals at first, so that glacier can process them in parallel
+	for _, volume := range volumes {
+		if volume.ArchiveId == nil {
+			continue
+		}
+
+		_, err := v.glacier.RequestRetrieval(AWSGlacierRetrieval{
+			VaultName:          dbBackup.Vault,
+			ArchiveId:          *volume.ArchiveId,
+			Tier:               v.tier,
+			RetrievalByteRange: tailRange(volume.Length, manifestRetrievalSize),
+		})
+		if err != nil {
+			return errors.Wrapf(err, "Could not request the manifest of volume %d", volume.Number)
+		}
+	}
+
+	v.dbRepository.DeleteContentsByBackupId(dbBackup.ID)
+	for _, volume := range volumes {
+		if volume.ArchiveId == nil {
+			continue
+		}
+
+		manifest, err := v.retrieveManifest(dbBackup, &volume, password)
+		if err != nil {
+			return errors.Wrapf(err, "Could not recover the contents of volume %d", volume.Number)
+		}
+
+		for _, file := range manifest.Files {
+			v.dbRepository.AddContent(dbBackup, &model.Content{
+				VolumeID: volume.ID,
+				Path:     file.Path,
+				Length:   file.Length,
+				ModTime:  file.ModTime,
+			})
+		}
+		LogInfo("Recovered %d file(s) of volume %d of backup %d", len(manifest.Files), volume.Number, dbBackup.ID)
+	}
+
+	return nil
+}
+
+// retrieveManifest retrieves the tail of the volume's archive and reads the manifest of it. If the manifest
+// is larger than the retrieved tail, a larger one will be retrieved.
+func (v *vaultSyncer) retrieveManifest(dbBackup *model.Backup, volume *model.Volume, password string) (*Manifest, error) {
+	tail, err := v.retrieveTail(dbBackup.Vault, volume, manifestRetrievalSize)
+	if err != nil {
+		return nil, err
+	}
+
+	manifestLength, ok := ManifestLength(tail)
+	if !ok {
+		return nil, errors.New("The archive has no manifest. It was created by an older version.")
+	}
+	if needed := manifestLength + ManifestFooterSize; needed > int64(len(tail)) {
+		LogInfo("The manifest of volume %d is larger than %d bytes: retrieve %d bytes", volume.Number, len(tail), needed)
+
+		tail, err = v.retrieveTail(dbBackup.Vault, volume, needed)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return ReadManifest(tail, password, volume.Number)
+}
+
+func (v *vaultSyncer) retrieveTail(vault string, volume *model.Volume, length int64) ([]byte, error) {
+	tmpFile, err := ioutil.TempFile("", "manifest")
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not create temporary file")
+	}
+	tmpFile.Close()
+	defer os.Remove(tmpFile.Name())
+	defer os.Remove(ProgressFile(tmpFile.Name()))
+
+	err = v.glacier.Download(AWSGlacierDownload{
+		VaultName:          vault,
+		ArchiveId:          *volume.ArchiveId,
+		Target:             tmpFile.Name(),
+		Tier:               v.tier,
+		PollInterval:       v.pollInterval,
+		RetrievalByteRange: tailRange(volume.Length, length),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Error while downloading from glacier")
+	}
+
+	return ioutil.ReadFile(tmpFile.Name())
+}
+
+// tailRange returns the megabyte aligned range which contains (at least) the last length bytes of an archive
+func tailRange(size, length int64) string {
+	const megabyte = 1024 * 1024
+
+	first := size - length
+	if first < 0 {
+		first = 0
+	}
+	first -= first % megabyte
+
+	return fmt.Sprintf("%d-%d", first, size-1)
+}
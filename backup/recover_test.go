@@ -0,0 +1,177 @@
+package backup
+
+import (
+	"backup2glacier/database/model"
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+	"time"
+)
+
+// saveArchiveWithManifest encrypts the content and appends the manifest like a backup creation does
+func saveArchiveWithManifest(t *testing.T, fake *fakeAWSGlacier, archiveId, password string, backupId uint, volume int, content []byte) InventoryArchive {
+	fileInfo, err := os.Stat("recover.go")
+	assert.NoError(t, err)
+
+	encrypted := new(bytes.Buffer)
+	assert.NoError(t, NewVolumeCryptModule(password, volume).Encrypt(bytes.NewReader(content), encrypted))
+	assert.NoError(t, WriteManifest(encrypted, password, NewManifest(backupId, volume, []*ZipContent{
+		{Realpath: "/path/to/recover.go", Length: 100, FileInfo: fileInfo},
+	})))
+	fake.archives[archiveId] = encrypted.Bytes()
+
+	created := time.Date(2019, 5, 1, 12, 30, 0, 0, time.UTC)
+	return InventoryArchive{
+		ArchiveId:          archiveId,
+		ArchiveDescription: NewArchiveMetadata(backupId, volume, created, "my backup", []string{"/path/to"}).ArchiveDescription(),
+		Size:               int64(encrypted.Len()),
+		SHA256TreeHash:     archiveId + "-hash",
+		CreationDate:       created,
+	}
+}
+
+func TestVaultSyncer_Recover(t *testing.T) {
+	//given
+	syncer, fake, cleanup := newSyncTestSyncer(t)
+	defer cleanup()
+
+	saveSyncTestBackup(syncer, "known", 100, "aaaa")
+	fake.inventory = &VaultInventory{
+		InventoryDate: time.Now(),
+		ArchiveList: []InventoryArchive{
+			{ArchiveId: "known", Size: 100, SHA256TreeHash: "aaaa"},
+			{ArchiveId: "foreign", Size: 300, ArchiveDescription: "from an other tool"},
+			saveArchiveWithManifest(t, fake, "volume-2", "secret", 7, 2, []byte("second volume")),
+			saveArchiveWithManifest(t, fake, "volume-1", "secret", 7, 1, []byte("first volume")),
+		},
+	}
+
+	//when
+	report, err := syncer.Recover("vault", false, false)
+
+	//then
+	assert.NoError(t, err)
+	assert.Equal(t, 1, report.Known)
+	assert.Len(t, report.Foreign, 1)
+	assert.Len(t, report.Recovered, 1)
+
+	recovered := syncer.dbRepository.GetBackupById(7)
+	assert.Equal(t, uint(7), recovered.ID)
+	assert.Equal(t, "my backup", recovered.Description)
+	assert.Equal(t, `["/path/to"]`, recovered.Sources)
+	assert.True(t, time.Date(2019, 5, 1, 12, 30, 0, 0, time.UTC).Equal(recovered.CreatedAt))
+
+	volumes := syncer.dbRepository.GetVolumesByBackupId(7)
+	assert.Len(t, volumes, 2)
+	assert.Equal(t, 1, volumes[0].Number)
+	assert.Equal(t, "volume-1", *volumes[0].ArchiveId)
+	assert.Equal(t, "volume-1-hash", *volumes[0].Checksum)
+	assert.Equal(t, "volume-2", *volumes[1].ArchiveId)
+
+	//when: recover again
+	report, err = syncer.Recover("vault", true, false)
+
+	//then: nothing new
+	assert.NoError(t, err)
+	assert.Equal(t, 3, report.Known)
+	assert.Empty(t, report.Recovered)
+}
+
+func TestVaultSyncer_Recover_IdInUse(t *testing.T) {
+	syncer, fake, cleanup := newSyncTestSyncer(t)
+	defer cleanup()
+
+	existing := saveSyncTestBackup(syncer, "known", 100, "aaaa")
+	fake.inventory = &VaultInventory{
+		ArchiveList: []InventoryArchive{
+			saveArchiveWithManifest(t, fake, "archive", "secret", existing.ID, 1, []byte("content")),
+		},
+	}
+
+	report, err := syncer.Recover("vault", false, false)
+
+	assert.NoError(t, err)
+	assert.Len(t, report.Recovered, 1)
+	assert.NotEqual(t, existing.ID, report.Recovered[0].ID)
+	assert.Len(t, syncer.dbRepository.GetVolumesByBackupId(report.Recovered[0].ID), 1)
+}
+
+func TestVaultSyncer_Recover_IdOfDeletedBackup(t *testing.T) {
+	syncer, fake, cleanup := newSyncTestSyncer(t)
+	defer cleanup()
+
+	deleted := saveSyncTestBackup(syncer, "deleted", 100, "aaaa")
+	syncer.dbRepository.DeleteBackupById(deleted.ID)
+	fake.inventory = &VaultInventory{
+		ArchiveList: []InventoryArchive{
+			saveArchiveWithManifest(t, fake, "archive", "secret", deleted.ID, 1, []byte("content")),
+		},
+	}
+
+	report, err := syncer.Recover("vault", false, false)
+
+	assert.NoError(t, err)
+	assert.NotEqual(t, deleted.ID, report.Recovered[0].ID)
+	assert.Equal(t, "my backup", syncer.dbRepository.GetBackupById(report.Recovered[0].ID).Description)
+}
+
+func TestVaultSyncer_Recover_DryRun(t *testing.T) {
+	syncer, fake, cleanup := newSyncTestSyncer(t)
+	defer cleanup()
+
+	fake.inventory = &VaultInventory{
+		ArchiveList: []InventoryArchive{
+			saveArchiveWithManifest(t, fake, "archive", "secret", 3, 1, []byte("content")),
+		},
+	}
+
+	report, err := syncer.Recover("vault", false, true)
+
+	assert.NoError(t, err)
+	assert.Len(t, report.Recovered, 1)
+	assert.Equal(t, uint(0), syncer.dbRepository.GetBackupById(3).ID)
+}
+
+func TestVaultSyncer_RecoverContents(t *testing.T) {
+	//given
+	syncer, fake, cleanup := newSyncTestSyncer(t)
+	defer cleanup()
+
+	fake.inventory = &VaultInventory{
+		ArchiveList: []InventoryArchive{
+			saveArchiveWithManifest(t, fake, "archive", "secret", 3, 1, []byte("content")),
+		},
+	}
+	report, err := syncer.Recover("vault", false, false)
+	assert.NoError(t, err)
+
+	//when
+	err = syncer.RecoverContents(report.Recovered[0], "secret")
+
+	//then
+	assert.NoError(t, err)
+	_, contents := syncer.dbRepository.GetBackupContentsById(3)
+	defer contents.Close()
+
+	var files []*model.Content
+	for {
+		content, next := contents.Next()
+		if !next {
+			break
+		}
+		files = append(files, content)
+	}
+	assert.Len(t, files, 1)
+	assert.Equal(t, "/path/to/recover.go", files[0].Path)
+	assert.Equal(t, int64(100), files[0].Length)
+}
+
+func TestTailRange(t *testing.T) {
+	const mb = 1024 * 1024
+
+	assert.Equal(t, "0-99", tailRange(100, mb))
+	assert.Equal(t, "0-1048675", tailRange(mb+100, mb))
+	assert.Equal(t, "2097152-3145727", tailRange(3*mb, mb))
+	assert.Equal(t, "1048576-3145827", tailRange(3*mb+100, mb+200))
+}
@@ -0,0 +1,439 @@
+package backup
+
+import (
+	"backup2glacier/database/model"
+	. "backup2glacier/log"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"strings"
+	"sync"
+)
+
+// ReplicaTarget is a further vault (or bucket) which receives a copy of each volume of a backup. The replicas are
+// stored in the same type of storage backend as the backup. Empty values stand for the default region and account.
+type ReplicaTarget struct {
+	Vault     string
+	Region    string `json:",omitempty"`
+	AccountId string `json:",omitempty"`
+}
+
+func (r ReplicaTarget) String() string {
+	if r.Region == "" {
+		return r.Vault
+	}
+
+	return r.Vault + "@" + r.Region
+}
+
+// ParseReplicaTarget parses a replica in the form of <vault>@<region>. The region is optional.
+func ParseReplicaTarget(value string) (ReplicaTarget, error) {
+	target := ReplicaTarget{Vault: value}
+	if i := strings.LastIndex(value, "@"); i >= 0 {
+		target.Vault = value[:i]
+		target.Region = value[i+1:]
+		if target.Region == "" {
+			return target, errors.Errorf("The region of the replica %s is missing", value)
+		}
+	}
+	if target.Vault == "" {
+		return target, errors.Errorf("The vault of the replica %s is missing", value)
+	}
+
+	return target, nil
+}
+
+// encodeReplicaTargets returns the json which is stored in the backup. For AWS backends the empty regions and
+// accounts are replaced by the given (resolved) default location, so that the replicas can be found later even if
+// the defaults are changed.
+func encodeReplicaTargets(backend string, targets []ReplicaTarget, location AWSLocation) string {
+	if len(targets) == 0 {
+		return ""
+	}
+
+	resolved := make([]ReplicaTarget, len(targets))
+	for i, target := range targets {
+		resolved[i] = target
+		if !isAWSBackend(backend) {
+			continue
+		}
+
+		if target.Region == "" {
+			resolved[i].Region = location.Region
+		}
+		if target.AccountId == "" || target.AccountId == DefaultAccountId {
+			resolved[i].AccountId = location.AccountId
+		}
+	}
+
+	encoded, _ := json.Marshal(resolved)
+	return string(encoded)
+}
+
+// replicaTargets returns the replica targets of the given backup
+func replicaTargets(dbBackup *model.Backup) ([]ReplicaTarget, error) {
+	var targets []ReplicaTarget
+	if dbBackup.Replicas == "" {
+		return targets, nil
+	}
+	if err := json.Unmarshal([]byte(dbBackup.Replicas), &targets); err != nil {
+		return nil, errors.Wrap(err, "Could not read the replicas of the backup")
+	}
+
+	return targets, nil
+}
+
+// replicaUpload is the upload of a volume into one replica target
+type replicaUpload struct {
+	dbReplica *model.Replica
+	storage   StorageBackend
+}
+
+// prepareReplicas returns the replica uploads of the given volume. Replicas which are already uploaded (by an
+// earlier run) will be skipped. Missing replicas are saved in the database.
+func (b *backupManager) prepareReplicas(dbBackup *model.Backup, dbVolume *model.Volume, targets []ReplicaTarget) []*replicaUpload {
+	var existing []model.Replica
+	for _, replica := range b.dbRepository.GetReplicasByBackupId(dbBackup.ID) {
+		if replica.VolumeID == dbVolume.ID {
+			existing = append(existing, replica)
+		}
+	}
+
+	var uploads []*replicaUpload
+	for _, target := range targets {
+		dbReplica := replicaOf(existing, dbBackup.Backend, target)
+		if dbReplica == nil {
+			dbReplica = &model.Replica{
+				BackupID:  dbBackup.ID,
+				VolumeID:  dbVolume.ID,
+				Backend:   dbBackup.Backend,
+				Vault:     target.Vault,
+				Region:    target.Region,
+				AccountId: target.AccountId,
+			}
+			b.dbRepository.SaveReplica(dbReplica)
+		}
+		if dbReplica.ArchiveId != nil {
+			LogInfo("Skip replica %s of volume %d: it is already uploaded", target, dbVolume.Number)
+			continue
+		}
+
+		storage, err := b.storage(dbReplica.Backend, dbReplica.Region, dbReplica.AccountId)
+		if err != nil {
+			LogError("Could not upload replica %s of volume %d: %v", target, dbVolume.Number, err)
+			dbReplica.Error = err.Error()
+			b.dbRepository.UpdateReplica(dbReplica)
+			continue
+		}
+
+		uploads = append(uploads, &replicaUpload{dbReplica, storage})
+	}
+
+	return uploads
+}
+
+// replicaOf returns the replica in the given target or nil if there is none. The replicas of other accounts or
+// backends (for example the copies of COPY) are different replicas even if they are in a vault with the same name.
+func replicaOf(replicas []model.Replica, backend string, target ReplicaTarget) *model.Replica {
+	for _, replica := range replicas {
+		if replica.Backend == backend && replica.Vault == target.Vault && replica.Region == target.Region &&
+			replica.AccountId == target.AccountId {
+			replica := replica
+			return &replica
+		}
+	}
+
+	return nil
+}
+
+// startReplicaUploads starts the uploads of the replicas. They receive the same content as the volume itself,
+// which can be read from the returned reader. Each replica has its own queue, so that a short stall of a replica
+// does not stall the upload of the volume. A replica which falls further behind slows the upload down instead of
+// being dropped.
+func (b *backupManager) startReplicaUploads(upload *volumeUpload, source *io.PipeReader, replicas []*replicaUpload, description string) *io.PipeReader {
+	primarySrc, primaryDst := io.Pipe()
+	dsts := []pipeWriter{primaryDst}
+
+	upload.result.Replicas = make([]*VolumeResult, len(replicas))
+	for i, replica := range replicas {
+		src, dst := io.Pipe()
+		dsts = append(dsts, newReplicaQueue(dst, replicaQueueSize))
+
+		upload.wg.Add(1)
+		go func(i int, replica *replicaUpload, src *io.PipeReader) {
+			defer upload.wg.Done()
+			defer src.Close()
+
+			dbReplica := replica.dbReplica
+			retries := replica.storage.Retries()
+			uploadResult, uploadId, err := b.uploadArchive(replica.storage, b.progressOf(src, dbReplica.BackupID, upload.result.Number, dbReplica.Vault), dbReplica.UploadId, dbReplica.Vault, description, upload.result.Number, b.partSize)
+			if err != nil {
+				err = errors.Wrapf(err, "Could not upload replica %s of volume %d", dbReplica.Vault, upload.result.Number)
+				LogError("%v", err)
+			}
+
+			result := &VolumeResult{
+				Number:      upload.result.Number,
+				UploadId:    uploadId,
+				ArchiveInfo: uploadResult.CreationResult,
+				TotalSize:   uploadResult.TotalSize,
+				Retries:     replica.storage.Retries() - retries,
+				Error:       err,
+			}
+			upload.result.Replicas[i] = result
+			b.updateReplica(result, dbReplica)
+		}(i, replica, src)
+	}
+
+	upload.wg.Add(1)
+	go func() {
+		defer upload.wg.Done()
+		defer source.Close()
+
+		_, err := io.Copy(&teeWriter{writers: dsts, errs: make([]error, len(dsts))}, source)
+		for _, dst := range dsts {
+			//a nil error closes the pipe normally
+			dst.CloseWithError(err)
+		}
+	}()
+
+	return primarySrc
+}
+
+func (b *backupManager) updateReplica(result *VolumeResult, dbReplica *model.Replica) {
+	dbReplica.Error = ""
+	if result.Error != nil {
+		dbReplica.Error = result.Error.Error()
+	}
+	dbReplica.UploadId = result.UploadId
+	dbReplica.Length = result.TotalSize
+
+	if result.ArchiveInfo != nil {
+		dbReplica.ArchiveId = result.ArchiveInfo.ArchiveId
+		dbReplica.Checksum = result.ArchiveInfo.Checksum
+		dbReplica.Location = result.ArchiveInfo.Location
+	}
+
+	b.dbRepository.UpdateReplica(dbReplica)
+}
+
+// pipeWriter is the writing half of a pipe
+type pipeWriter interface {
+	io.Writer
+	CloseWithError(err error) error
+}
+
+// teeWriter writes into all of its writers. A writer which fails will be skipped from then on, so that one failed
+// upload does not break the other ones. An error will only be returned if all writers have failed.
+type teeWriter struct {
+	writers []pipeWriter
+	errs    []error
+}
+
+func (t *teeWriter) Write(p []byte) (int, error) {
+	var lastErr error
+	written := false
+
+	for i, w := range t.writers {
+		if t.errs[i] != nil {
+			lastErr = t.errs[i]
+			continue
+		}
+		if _, err := w.Write(p); err != nil {
+			t.errs[i] = err
+			lastErr = err
+			continue
+		}
+		written = true
+	}
+
+	if !written {
+		return 0, lastErr
+	}
+	return len(p), nil
+}
+
+// replicaQueueSize is the number of bytes which a replica can fall behind the upload of the volume before the
+// upload of the volume waits for it. The parts of the uploads are buffered by the spool, so that the queue only
+// smooths the short stalls of the replicas.
+const replicaQueueSize = 8 * 1024 * 1024
+
+// replicaQueue buffers the content of a replica in memory, so that a short stall of the replica does not stall
+// the other uploads. If more than limit bytes are queued, a write waits until the replica has caught up.
+type replicaQueue struct {
+	dst   *io.PipeWriter
+	limit int
+
+	mutex  sync.Mutex
+	cond   *sync.Cond
+	chunks [][]byte
+	queued int
+	closed bool
+	// closeErr will be passed to the pipe after all chunks are written
+	closeErr error
+	// err is the error of the replica: no more chunks will be written into the pipe
+	err error
+}
+
+func newReplicaQueue(dst *io.PipeWriter, limit int) *replicaQueue {
+	q := &replicaQueue{
+		dst:   dst,
+		limit: limit,
+	}
+	q.cond = sync.NewCond(&q.mutex)
+	go q.drain()
+
+	return q
+}
+
+func (q *replicaQueue) Write(p []byte) (int, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	//a chunk which is larger than the limit is queued as soon as the queue is empty
+	for q.err == nil && q.queued > 0 && q.queued+len(p) > q.limit {
+		q.cond.Wait()
+	}
+	if q.err != nil {
+		return 0, q.err
+	}
+
+	q.chunks = append(q.chunks, append([]byte(nil), p...))
+	q.queued += len(p)
+	q.cond.Broadcast()
+
+	return len(p), nil
+}
+
+// CloseWithError closes the queue. The queued chunks are still written before the pipe will be closed with
+// the given error.
+func (q *replicaQueue) CloseWithError(err error) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.closed = true
+	q.closeErr = err
+	q.cond.Broadcast()
+
+	return nil
+}
+
+// fail drops the queued chunks and breaks the pipe. The mutex must be locked.
+func (q *replicaQueue) fail(err error) {
+	q.err = err
+	q.chunks = nil
+	q.queued = 0
+	q.dst.CloseWithError(err)
+	q.cond.Broadcast()
+}
+
+// drain writes the queued chunks into the pipe
+func (q *replicaQueue) drain() {
+	for {
+		q.mutex.Lock()
+		for len(q.chunks) == 0 && !q.closed && q.err == nil {
+			q.cond.Wait()
+		}
+		if q.err != nil {
+			q.mutex.Unlock()
+			return
+		}
+		if len(q.chunks) == 0 {
+			closeErr := q.closeErr
+			q.mutex.Unlock()
+			q.dst.CloseWithError(closeErr)
+			return
+		}
+		chunk := q.chunks[0]
+		q.chunks = q.chunks[1:]
+		q.mutex.Unlock()
+
+		_, err := q.dst.Write(chunk)
+
+		q.mutex.Lock()
+		if q.err == nil {
+			q.queued -= len(chunk)
+			q.cond.Broadcast()
+			if err != nil {
+				q.fail(err)
+			}
+		}
+		q.mutex.Unlock()
+	}
+}
+
+// archiveCopy is the location of one archive of a volume: the archive of the volume itself or of one of its
+// replicas. All copies have the same content (and so the same checksum).
+type archiveCopy struct {
+	backend   string
+	vault     string
+	region    string
+	accountId string
+	archiveId string
+}
+
+func (c archiveCopy) String() string {
+	if c.region == "" {
+		return c.vault
+	}
+
+	return fmt.Sprintf("%s@%s", c.vault, c.region)
+}
+
+// volumeCopies returns all uploaded copies of the given volume. The volume itself comes first.
+func (b *backupManager) volumeCopies(dbBackup *model.Backup, volume *model.Volume) []archiveCopy {
+	var copies []archiveCopy
+	if volume.ArchiveId != nil {
+		copies = append(copies, archiveCopy{dbBackup.Backend, dbBackup.Vault, dbBackup.Region, dbBackup.AccountId, *volume.ArchiveId})
+	}
+	if volume.ID == 0 {
+		//the volume of a backup which is created before the volumes were introduced
+		return copies
+	}
+
+	for _, replica := range b.dbRepository.GetReplicasByBackupId(dbBackup.ID) {
+		if replica.VolumeID == volume.ID && replica.ArchiveId != nil {
+			copies = append(copies, archiveCopy{replica.Backend, replica.Vault, replica.Region, replica.AccountId, *replica.ArchiveId})
+		}
+	}
+
+	return copies
+}
+
+// deleteReplicas deletes the archives of all replicas of the given backup
+func (b *backupManager) deleteReplicas(backupId uint) error {
+	for _, replica := range b.dbRepository.GetReplicasByBackupId(backupId) {
+		replica := replica
+		if err := b.deleteReplica(&replica); err != nil {
+			return errors.Wrapf(err, "Could not delete the replica %s", archiveCopy{vault: replica.Vault, region: replica.Region})
+		}
+	}
+
+	return nil
+}
+
+// deleteReplica deletes the archive of the replica
+func (b *backupManager) deleteReplica(replica *model.Replica) error {
+	if replica.ArchiveId == nil {
+		return nil
+	}
+
+	storage, err := b.storage(replica.Backend, replica.Region, replica.AccountId)
+	if err != nil {
+		return err
+	}
+	err = storage.Delete(AWSGlacierDelete{
+		VaultName: replica.Vault,
+		ArchiveId: *replica.ArchiveId,
+	})
+	if err != nil {
+		return err
+	}
+
+	//remember that this replica is already deleted (in case of a later one fails)
+	replica.ArchiveId = nil
+	b.dbRepository.UpdateReplica(replica)
+
+	return nil
+}
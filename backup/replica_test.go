@@ -0,0 +1,218 @@
+package backup
+
+import (
+	"backup2glacier/database/model"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestParseReplicaTarget(t *testing.T) {
+	target, err := ParseReplicaTarget("vault@eu-west-1")
+	assert.NoError(t, err)
+	assert.Equal(t, ReplicaTarget{Vault: "vault", Region: "eu-west-1"}, target)
+	assert.Equal(t, "vault@eu-west-1", target.String())
+
+	target, err = ParseReplicaTarget("vault")
+	assert.NoError(t, err)
+	assert.Equal(t, ReplicaTarget{Vault: "vault"}, target)
+
+	_, err = ParseReplicaTarget("vault@")
+	assert.Error(t, err)
+	_, err = ParseReplicaTarget("@eu-west-1")
+	assert.Error(t, err)
+}
+
+func TestTeeWriter(t *testing.T) {
+	src1, dst1 := io.Pipe()
+	src2, dst2 := io.Pipe()
+	toTest := &teeWriter{writers: []pipeWriter{dst1, dst2}, errs: make([]error, 2)}
+
+	//the second reader breaks: the first one still receives everything
+	src2.CloseWithError(errors.New("broken"))
+	received := make(chan []byte)
+	go func() {
+		content, _ := ioutil.ReadAll(src1)
+		received <- content
+	}()
+
+	n, err := toTest.Write([]byte("first"))
+	assert.NoError(t, err)
+	assert.Equal(t, 5, n)
+	_, err = toTest.Write([]byte("second"))
+	assert.NoError(t, err)
+	dst1.Close()
+	assert.Equal(t, []byte("firstsecond"), <-received)
+
+	//all readers are broken
+	_, err = toTest.Write([]byte("third"))
+	assert.Error(t, err)
+}
+
+func TestReplicaQueue(t *testing.T) {
+	src, dst := io.Pipe()
+	toTest := newReplicaQueue(dst, 16)
+
+	//the writes do not wait for the reader
+	for _, chunk := range []string{"first", "second"} {
+		_, err := toTest.Write([]byte(chunk))
+		assert.NoError(t, err)
+	}
+	toTest.CloseWithError(nil)
+
+	content, err := ioutil.ReadAll(src)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("firstsecond"), content)
+}
+
+func TestReplicaQueue_Backpressure(t *testing.T) {
+	src, dst := io.Pipe()
+	toTest := newReplicaQueue(dst, 10)
+
+	//nobody reads: the writer waits instead of dropping the replica
+	written := make(chan int)
+	go func() {
+		i := 0
+		for ; i < 4; i++ {
+			if _, err := toTest.Write([]byte("chunk")); err != nil {
+				break
+			}
+		}
+		toTest.CloseWithError(nil)
+		written <- i
+	}()
+
+	select {
+	case <-written:
+		assert.Fail(t, "The writer does not wait for the reader")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	content, err := ioutil.ReadAll(src)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("chunkchunkchunkchunk"), content)
+	assert.Equal(t, 4, <-written)
+}
+
+func TestReplicaQueue_ReaderClosed(t *testing.T) {
+	src, dst := io.Pipe()
+	toTest := newReplicaQueue(dst, 1024)
+	src.CloseWithError(errors.New("broken"))
+
+	//the error of the reader reaches the writer after the first chunk
+	var err error
+	for deadline := time.Now().Add(time.Second); err == nil && time.Now().Before(deadline); {
+		_, err = toTest.Write([]byte("chunk"))
+		time.Sleep(time.Millisecond)
+	}
+	assert.EqualError(t, err, "broken")
+}
+
+// slowReplicaStorage slows down the uploads into the given vault
+type slowReplicaStorage struct {
+	StorageBackend
+	vault string
+}
+
+func (s *slowReplicaStorage) Upload(upload AWSGlacierUpload) (*AWSGlacierUploadResult, *string, error) {
+	if upload.VaultName == s.vault {
+		upload.Source = &slowReader{upload.Source}
+	}
+
+	return s.StorageBackend.Upload(upload)
+}
+
+type slowReader struct {
+	source io.Reader
+}
+
+func (s *slowReader) Read(p []byte) (int, error) {
+	time.Sleep(time.Millisecond)
+	return s.source.Read(p)
+}
+
+func TestBackupManager_SlowReplica(t *testing.T) {
+	dbRepository, _, dir, cleanup := newTestFixture(t, "replica")
+	defer cleanup()
+
+	vault := path.Join(dir, "vault")
+	replicaVault := path.Join(dir, "replica")
+	assert.NoError(t, EnsureDirectoryVault(vault))
+	assert.NoError(t, EnsureDirectoryVault(replicaVault))
+
+	//random content can not be compressed: the replica falls further behind than its queue
+	source := path.Join(dir, "source")
+	content := make([]byte, replicaQueueSize+4*mib)
+	rand.Read(content)
+	assert.NoError(t, ioutil.WriteFile(source, content, 0644))
+
+	password := "secret"
+	manager, err := NewBackupManager(&password, false, mib, time.Millisecond, "", dbRepository,
+		WithBackend(BackendDirectory, ""),
+		WithReplicas([]ReplicaTarget{{Vault: replicaVault}}),
+		WithSpool(SpoolConfig{Mode: SpoolModeMemory}),
+		WithStorageFactory(func(backend string, location AWSLocation) (StorageBackend, error) {
+			storage, err := NewStorageBackend(backend, location, NewStorageSettings())
+			return &slowReplicaStorage{storage, replicaVault}, err
+		}))
+	assert.NoError(t, err)
+
+	result := manager.Create([]string{source}, []*regexp.Regexp{}, []*regexp.Regexp{}, "slow replica", vault)
+	assert.NoError(t, result.Error)
+
+	//the replica is not dropped
+	assert.Len(t, result.Volumes[0].Replicas, 1)
+	assert.NoError(t, result.Volumes[0].Replicas[0].Error)
+	assert.Equal(t, result.Volumes[0].TotalSize, result.Volumes[0].Replicas[0].TotalSize)
+	assert.Equal(t, model.BackupStatusCompleted, dbRepository.GetBackupById(result.BackupId).Status)
+
+	replicas := dbRepository.GetReplicasByBackupId(result.BackupId)
+	assert.Len(t, replicas, 1)
+	assert.NotNil(t, replicas[0].ArchiveId)
+	_, err = os.Stat((&directoryBackend{}).archiveFile(replicaVault, *replicas[0].ArchiveId))
+	assert.NoError(t, err)
+}
+
+func TestBackupManager_prepareReplicas(t *testing.T) {
+	manager, fake, _, cleanup := newRestoreTestManager(t)
+	defer cleanup()
+	manager.storageFactory = func(string, AWSLocation) (StorageBackend, error) {
+		return fake, nil
+	}
+
+	dbBackup := &model.Backup{Backend: BackendGlacier, Vault: "vault"}
+	manager.dbRepository.SaveBackup(dbBackup)
+	dbVolume := &model.Volume{Number: 1}
+	manager.dbRepository.SaveVolume(dbBackup, dbVolume)
+
+	//a replica in another account and a copy into another backend with the same vault name
+	otherAccount := "other-account"
+	manager.dbRepository.SaveReplica(&model.Replica{BackupID: dbBackup.ID, VolumeID: dbVolume.ID, Backend: BackendGlacier,
+		Vault: "replica", Region: "eu-west-1", AccountId: "210987654321", UploadId: &otherAccount})
+	otherBackend := "other-backend"
+	manager.dbRepository.SaveReplica(&model.Replica{BackupID: dbBackup.ID, VolumeID: dbVolume.ID, Backend: BackendS3,
+		Vault: "replica", Region: "eu-west-1", AccountId: "123456789012", UploadId: &otherBackend})
+
+	target := ReplicaTarget{Vault: "replica", Region: "eu-west-1", AccountId: "123456789012"}
+	uploads := manager.prepareReplicas(dbBackup, dbVolume, []ReplicaTarget{target})
+	assert.Len(t, uploads, 1)
+	assert.Nil(t, uploads[0].dbReplica.UploadId)
+	assert.Equal(t, BackendGlacier, uploads[0].dbReplica.Backend)
+	assert.Len(t, manager.dbRepository.GetReplicasByBackupId(dbBackup.ID), 3)
+
+	//the replica of the target is continued by the next run
+	interrupted := "interrupted"
+	uploads[0].dbReplica.UploadId = &interrupted
+	manager.dbRepository.UpdateReplica(uploads[0].dbReplica)
+	uploads = manager.prepareReplicas(dbBackup, dbVolume, []ReplicaTarget{target})
+	assert.Len(t, uploads, 1)
+	assert.Equal(t, &interrupted, uploads[0].dbReplica.UploadId)
+	assert.Len(t, manager.dbRepository.GetReplicasByBackupId(dbBackup.ID), 3)
+}
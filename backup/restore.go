@@ -0,0 +1,270 @@
+package backup
+
+import (
+	"backup2glacier/database/model"
+	. "backup2glacier/log"
+	"fmt"
+	"github.com/pkg/errors"
+	"path/filepath"
+	"time"
+)
+
+// retrievalTimes are the (upper) durations which glacier needs to complete a retrieval job of each tier
+var retrievalTimes = map[string]time.Duration{
+	"Expedited": 5 * time.Minute,
+	"Standard":  5 * time.Hour,
+	"Bulk":      12 * time.Hour,
+}
+
+// ExpectedRetrievalTime returns the duration which glacier (usually) needs to complete a retrieval job of the given tier
+func ExpectedRetrievalTime(tier string) time.Duration {
+	if duration, ok := retrievalTimes[tier]; ok {
+		return duration
+	}
+
+	return retrievalTimes["Standard"]
+}
+
+// IsValidTier checks if the given retrieval tier is known
+func IsValidTier(tier string) bool {
+	_, known := retrievalTimes[tier]
+	return known
+}
+
+// volumeTarget returns the target file of the given volume. If a backup has multiple volumes each volume
+// is saved in its own file.
+func volumeTarget(target string, volumeCount int, volume *model.Volume) string {
+	if volumeCount > 1 {
+		return fmt.Sprintf("%s.%03d", target, volume.Number)
+	}
+
+	return target
+}
+
+// RequestDownload initiates the retrieval jobs for the volumes of the given backup (or only the given volume)
+// without waiting for their completion. The jobs are saved in the database, so that they can be fetched later.
+func (b *backupManager) RequestDownload(backupId uint, volume int, target string) ([]*model.Job, error) {
+	toDownload := b.dbRepository.GetBackupById(backupId)
+	if toDownload.ID != backupId {
+		return nil, ErrBackupNotFound
+	}
+
+	absTarget, err := filepath.Abs(target)
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not determine target")
+	}
+
+	allVolumes := b.dbRepository.GetVolumesByBackupId(backupId)
+	var jobs []*model.Job
+	for i := range allVolumes {
+		if volume != 0 && allVolumes[i].Number != volume {
+			continue
+		}
+		if err := b.ctx.Err(); err != nil {
+			return jobs, err
+		}
+		copies := b.volumeCopies(toDownload, &allVolumes[i])
+		if len(copies) == 0 {
+			return jobs, errors.Errorf("The volume %d has no archive", allVolumes[i].Number)
+		}
+
+		source, jobId, err := b.requestRetrieval(&allVolumes[i], copies)
+		if err != nil {
+			return jobs, errors.Wrapf(err, "Could not request the retrieval of volume %d", allVolumes[i].Number)
+		}
+
+		job := &model.Job{
+			BackupID:           backupId,
+			VolumeNumber:       allVolumes[i].Number,
+			Backend:            source.backend,
+			Vault:              source.vault,
+			Region:             source.region,
+			AccountId:          source.accountId,
+			ArchiveId:          source.archiveId,
+			JobId:              jobId,
+			Tier:               b.tier,
+			Target:             volumeTarget(absTarget, len(allVolumes), &allVolumes[i]),
+			Status:             model.JobStatusPending,
+			ExpectedCompletion: time.Now().Add(ExpectedRetrievalTime(b.tier)),
+		}
+		b.dbRepository.SaveJob(job)
+		jobs = append(jobs, job)
+
+		LogInfo("Requested retrieval of volume %d (job %s). It is expected to be ready at %s",
+			job.VolumeNumber, job.JobId, job.ExpectedCompletion.Format(time.RFC3339))
+	}
+	if len(jobs) == 0 {
+		return nil, errors.New("No volume found for backup")
+	}
+
+	return jobs, nil
+}
+
+// requestRetrieval initiates the retrieval job for the first copy of the volume which is available. It returns
+// the copy and the id of the job.
+func (b *backupManager) requestRetrieval(volume *model.Volume, copies []archiveCopy) (archiveCopy, string, error) {
+	var err error
+	for i, source := range copies {
+		var storage StorageBackend
+		var jobId string
+
+		storage, err = b.storage(source.backend, source.region, source.accountId)
+		if err == nil {
+			jobId, err = storage.RequestRetrieval(AWSGlacierRetrieval{
+				VaultName: source.vault,
+				ArchiveId: source.archiveId,
+				Tier:      b.tier,
+			})
+		}
+		if err == nil {
+			return source, jobId, nil
+		}
+		if i < len(copies)-1 {
+			LogError("Could not request volume %d from %s: %v. Try the replica %s.", volume.Number, source, err, copies[i+1])
+		}
+	}
+
+	return archiveCopy{}, "", err
+}
+
+// RefreshJobs updates the status of all open jobs (of the given backup or of all backups if the id is 0)
+// and returns all jobs
+func (b *backupManager) RefreshJobs(backupId uint) []*model.Job {
+	var dbJobs []model.Job
+	if backupId == 0 {
+		dbJobs = b.dbRepository.GetJobs()
+	} else {
+		dbJobs = b.dbRepository.GetJobsByBackupId(backupId)
+	}
+
+	jobs := make([]*model.Job, 0, len(dbJobs))
+	for i := range dbJobs {
+		job := &dbJobs[i]
+		if job.IsOpen() {
+			b.refreshJob(job)
+		}
+		jobs = append(jobs, job)
+	}
+
+	return jobs
+}
+
+// refreshJob asks the storage backend for the status of the given job and saves it
+func (b *backupManager) refreshJob(job *model.Job) {
+	storage, err := b.storage(job.Backend, job.Region, job.AccountId)
+	if err != nil {
+		LogError("Could not get the status of job %s: %v", job.JobId, err)
+		return
+	}
+	status, err := storage.DescribeJob(job.Vault, job.JobId)
+
+	switch {
+	case err == ErrJobNotFound:
+		job.Status = model.JobStatusExpired
+	case err != nil:
+		//the status is unknown: try it again next time
+		LogError("Could not get the status of job %s: %v", job.JobId, err)
+		return
+	case !status.Completed:
+		job.Status = model.JobStatusPending
+	case !status.Succeeded:
+		job.Status = model.JobStatusFailed
+		job.Error = status.StatusMessage
+	default:
+		job.CompletedAt = status.CompletionDate
+		job.Status = model.JobStatusReady
+	}
+
+	if job.Status == model.JobStatusReady && job.CompletedAt != nil && time.Since(*job.CompletedAt) > JobOutputAvailability {
+		job.Status = model.JobStatusExpired
+	}
+
+	b.dbRepository.UpdateJob(job)
+}
+
+// FetchDownloads downloads the output of all ready jobs (of the given backup or of all backups if the id is 0)
+// into their targets
+func (b *backupManager) FetchDownloads(backupId uint, fallbackPassword func() string) error {
+	fetched := 0
+	var lastErr error
+
+	//ask only once for the password of each backup
+	passwords := map[uint]string{}
+
+	for _, job := range b.RefreshJobs(backupId) {
+		if err := b.ctx.Err(); err != nil {
+			return err
+		}
+
+		switch job.Status {
+		case model.JobStatusPending:
+			LogInfo("The job %s for volume %d of backup %d is not ready yet. It is expected to be ready at %s",
+				job.JobId, job.VolumeNumber, job.BackupID, job.ExpectedCompletion.Format(time.RFC3339))
+			continue
+		case model.JobStatusReady:
+		default:
+			continue
+		}
+
+		backupId := job.BackupID
+		password := func() string {
+			if _, known := passwords[backupId]; !known {
+				passwords[backupId] = fallbackPassword()
+			}
+			return passwords[backupId]
+		}
+
+		if err := b.fetchJob(job, password); err != nil {
+			LogError("Could not fetch volume %d of backup %d: %v", job.VolumeNumber, job.BackupID, err)
+			job.Error = err.Error()
+			b.dbRepository.UpdateJob(job)
+			lastErr = err
+			continue
+		}
+		fetched++
+	}
+
+	if lastErr != nil {
+		return errors.Wrap(lastErr, "Not all ready jobs could be fetched")
+	}
+	LogInfo("Fetched %d volume(s)", fetched)
+
+	return nil
+}
+
+func (b *backupManager) fetchJob(job *model.Job, fallbackPassword func() string) error {
+	toDownload := b.dbRepository.GetBackupById(job.BackupID)
+	if toDownload.ID != job.BackupID {
+		return errors.New("The backup does not exist anymore")
+	}
+	if b.password != nil {
+		toDownload.Password = *b.password
+	}
+	if toDownload.Password == "" {
+		toDownload.Password = fallbackPassword()
+	}
+
+	var volume *model.Volume
+	volumes := b.dbRepository.GetVolumesByBackupId(job.BackupID)
+	for i := range volumes {
+		if volumes[i].Number == job.VolumeNumber {
+			volume = &volumes[i]
+		}
+	}
+	if volume == nil {
+		return errors.New("The volume does not exist anymore")
+	}
+
+	source := archiveCopy{job.Backend, job.Vault, job.Region, job.AccountId, job.ArchiveId}
+	err := b.downloadVolume(toDownload, volume, []archiveCopy{source}, job.Target, job.JobId)
+	if err != nil {
+		return err
+	}
+	LogInfo("Successfully download volume %d of backup %d to %s", job.VolumeNumber, job.BackupID, job.Target)
+
+	job.Status = model.JobStatusFetched
+	job.Error = ""
+	b.dbRepository.UpdateJob(job)
+
+	return nil
+}
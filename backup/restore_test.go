@@ -0,0 +1,189 @@
+package backup
+
+import (
+	"backup2glacier/database/model"
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+// fakeAWSGlacier keeps the archives in memory and completes the retrieval jobs on demand
+type fakeAWSGlacier struct {
+	AWSGlacier
+
+	archives map[string][]byte
+	jobs     map[string]*AWSGlacierJob
+	jobIds   map[string]string
+
+	inventory *VaultInventory
+
+	descriptions []string
+	deleted      []string
+	vaults       map[string]*AWSGlacierVault
+	lock         *AWSGlacierVaultLock
+	lockId       string
+}
+
+func newFakeAWSGlacier() *fakeAWSGlacier {
+	return &fakeAWSGlacier{
+		archives: map[string][]byte{},
+		jobs:     map[string]*AWSGlacierJob{},
+		jobIds:   map[string]string{},
+		vaults:   map[string]*AWSGlacierVault{},
+	}
+}
+
+func (f *fakeAWSGlacier) RequestRetrieval(retrieval AWSGlacierRetrieval) (string, error) {
+	jobId := "job-" + retrieval.ArchiveId
+	f.jobs[jobId] = &AWSGlacierJob{JobId: jobId}
+	f.jobIds[jobId] = retrieval.ArchiveId
+
+	return jobId, nil
+}
+
+func (f *fakeAWSGlacier) DescribeJob(vaultName, jobId string) (*AWSGlacierJob, error) {
+	job, exists := f.jobs[jobId]
+	if !exists {
+		return nil, ErrJobNotFound
+	}
+
+	return job, nil
+}
+
+func (f *fakeAWSGlacier) complete(jobId string, completionDate time.Time) {
+	f.jobs[jobId].Completed = true
+	f.jobs[jobId].Succeeded = true
+	f.jobs[jobId].CompletionDate = &completionDate
+}
+
+func (f *fakeAWSGlacier) Download(download AWSGlacierDownload) error {
+	archive := f.archives[f.jobIds[download.JobId]]
+	if download.JobId == "" {
+		archive = f.archives[download.ArchiveId]
+	}
+
+	var first, last int
+	if _, err := fmt.Sscanf(download.RetrievalByteRange, "%d-%d", &first, &last); err == nil {
+		archive = archive[first : last+1]
+	}
+
+	return ioutil.WriteFile(download.Target, archive, 0644)
+}
+
+func (f *fakeAWSGlacier) Retries() int64 {
+	return 0
+}
+
+func newRestoreTestManager(t *testing.T) (*backupManager, *fakeAWSGlacier, string, func()) {
+	dbRepository, fake, dir, cleanup := newTestFixture(t, "restore")
+	manager := &backupManager{
+		dbRepository:    dbRepository,
+		backend:         BackendGlacier,
+		backends:        map[storageKey]StorageBackend{{backend: BackendGlacier}: fake},
+		tier:            "Bulk",
+		ctx:             context.Background(),
+		storageSettings: NewStorageSettings(),
+	}
+
+	return manager, fake, dir, cleanup
+}
+
+func saveEncryptedBackup(t *testing.T, manager *backupManager, fake *fakeAWSGlacier, password string, content []byte) *model.Backup {
+	encrypted := new(bytes.Buffer)
+	assert.NoError(t, NewVolumeCryptModule(password, 1).Encrypt(bytes.NewReader(content), encrypted))
+	fake.archives["archive"] = encrypted.Bytes()
+
+	dbBackup := &model.Backup{Vault: "vault", Password: password}
+	manager.dbRepository.SaveBackup(dbBackup)
+	manager.dbRepository.SaveVolume(dbBackup, &model.Volume{Number: 1, ArchiveId: aws.String("archive")})
+
+	return dbBackup
+}
+
+func TestBackupManager_RequestAndFetch(t *testing.T) {
+	//given
+	manager, fake, dir, cleanup := newRestoreTestManager(t)
+	defer cleanup()
+
+	dbBackup := saveEncryptedBackup(t, manager, fake, "secret", []byte("the content of the backup"))
+	target := path.Join(dir, "backup.zip")
+
+	//when: request
+	jobs, err := manager.RequestDownload(dbBackup.ID, 0, target)
+
+	//then
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 1)
+	assert.Equal(t, model.JobStatusPending, jobs[0].Status)
+	assert.Equal(t, "Bulk", jobs[0].Tier)
+	assert.True(t, jobs[0].ExpectedCompletion.After(time.Now().Add(11*time.Hour)))
+
+	//when: fetch before the job is ready
+	assert.NoError(t, manager.FetchDownloads(0, nil))
+
+	//then
+	_, err = os.Stat(target)
+	assert.True(t, os.IsNotExist(err))
+	assert.Equal(t, model.JobStatusPending, manager.RefreshJobs(0)[0].Status)
+
+	//when: fetch after the job is ready
+	fake.complete(jobs[0].JobId, time.Now())
+	assert.NoError(t, manager.FetchDownloads(0, nil))
+
+	//then
+	content, err := ioutil.ReadFile(target)
+	assert.NoError(t, err)
+	assert.Equal(t, "the content of the backup", string(content))
+	assert.Equal(t, model.JobStatusFetched, manager.RefreshJobs(dbBackup.ID)[0].Status)
+}
+
+func TestBackupManager_RefreshJobs_Expired(t *testing.T) {
+	manager, fake, dir, cleanup := newRestoreTestManager(t)
+	defer cleanup()
+
+	dbBackup := saveEncryptedBackup(t, manager, fake, "secret", []byte("content"))
+	jobs, err := manager.RequestDownload(dbBackup.ID, 0, path.Join(dir, "backup.zip"))
+	assert.NoError(t, err)
+
+	//the output was available only for 24 hours
+	fake.complete(jobs[0].JobId, time.Now().Add(-25*time.Hour))
+
+	refreshed := manager.RefreshJobs(0)
+	assert.Equal(t, model.JobStatusExpired, refreshed[0].Status)
+
+	//glacier has already forgotten the job
+	delete(fake.jobs, jobs[0].JobId)
+	jobs, err = manager.RequestDownload(dbBackup.ID, 0, path.Join(dir, "backup.zip"))
+	assert.NoError(t, err)
+	delete(fake.jobs, jobs[0].JobId)
+
+	refreshed = manager.RefreshJobs(dbBackup.ID)
+	assert.Len(t, refreshed, 2)
+	assert.Equal(t, model.JobStatusExpired, refreshed[1].Status)
+}
+
+func TestBackupManager_Download_WithManifest(t *testing.T) {
+	manager, fake, dir, cleanup := newRestoreTestManager(t)
+	defer cleanup()
+
+	dbBackup := &model.Backup{Vault: "vault", Password: "secret"}
+	manager.dbRepository.SaveBackup(dbBackup)
+	manager.dbRepository.SaveVolume(dbBackup, &model.Volume{Number: 1, ArchiveId: aws.String("archive")})
+	saveArchiveWithManifest(t, fake, "archive", "secret", dbBackup.ID, 1, []byte("the zip of the volume"))
+	target := path.Join(dir, "backup.zip")
+
+	err := manager.Download(dbBackup.ID, 0, target, nil)
+
+	//the manifest must not be part of the zip
+	assert.NoError(t, err)
+	content, err := ioutil.ReadFile(target)
+	assert.NoError(t, err)
+	assert.Equal(t, "the zip of the volume", string(content))
+}
@@ -0,0 +1,127 @@
+package backup
+
+import (
+	. "backup2glacier/log"
+	"context"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/pkg/errors"
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+// RetryPolicy describes how often and when failed glacier operations will be retried
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts (including the first one) of an operation
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry. It will be doubled for each following retry.
+	BaseDelay time.Duration
+	// MaxDelay is the upper limit of the delay between two attempts
+	MaxDelay time.Duration
+	// Jitter is the fraction (0-1) of the delay which will be randomized
+	Jitter float64
+	// RetryableCodes are aws error codes which should be retried in addition to the network-,
+	// throttling- and server-errors
+	RetryableCodes []string
+}
+
+// DefaultRetryPolicy returns the RetryPolicy of NewStorageSettings
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 5,
+		BaseDelay:   1 * time.Second,
+		MaxDelay:    5 * time.Minute,
+		Jitter:      0.2,
+	}
+}
+
+// IsRetryable returns true if the given error is a temporary one. So that a retry could be successful.
+func (p RetryPolicy) IsRetryable(err error) bool {
+	if isRetryable(err) {
+		return true
+	}
+
+	if aerr, ok := errors.Cause(err).(awserr.Error); ok {
+		for _, code := range p.RetryableCodes {
+			if aerr.Code() == code {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Delay returns the delay before the given retry (starting by 1)
+func (p RetryPolicy) Delay(retry int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < retry && (p.MaxDelay <= 0 || delay < p.MaxDelay); i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	if p.Jitter > 0 {
+		delay -= time.Duration(rand.Float64() * p.Jitter * float64(delay))
+	}
+
+	return delay
+}
+
+// isCancelled returns true if the given error is caused by a cancelled (or expired) context
+func isCancelled(err error) bool {
+	cause := errors.Cause(err)
+	return cause == context.Canceled || cause == context.DeadlineExceeded
+}
+
+// isRetryable returns true if the given error is a temporary one. So that a later retry could be successful.
+func isRetryable(err error) bool {
+	cause := errors.Cause(err)
+	if request.IsErrorRetryable(cause) || request.IsErrorThrottle(cause) {
+		return true
+	}
+	if reqErr, ok := cause.(awserr.RequestFailure); ok {
+		return reqErr.StatusCode() >= 500
+	}
+
+	return false
+}
+
+// retryer executes operations with respect to a RetryPolicy
+type retryer struct {
+	policy  RetryPolicy
+	retries int64
+}
+
+func newRetryer(policy RetryPolicy) *retryer {
+	return &retryer{
+		policy: policy,
+	}
+}
+
+// do executes the given operation until it succeeds, a not retryable error occurs or the maximum number
+// of attempts is reached. The operation must be repeatable. If the context is cancelled while waiting for the next
+// attempt, the error of the context will be returned.
+func (r *retryer) do(ctx context.Context, operation string, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= r.policy.MaxAttempts || !r.policy.IsRetryable(err) {
+			return err
+		}
+
+		delay := r.policy.Delay(attempt)
+		atomic.AddInt64(&r.retries, 1)
+		LogInfo("%s failed (attempt %d of %d). Retry in %s. Error: %v", operation, attempt, r.policy.MaxAttempts, delay.Round(time.Millisecond), err)
+
+		if err := sleepContext(ctx, delay); err != nil {
+			return errors.Wrapf(err, "%s is not retried", operation)
+		}
+	}
+}
+
+// Retries returns the number of retries which are done so far
+func (r *retryer) Retries() int64 {
+	return atomic.LoadInt64(&r.retries)
+}
@@ -0,0 +1,115 @@
+package backup
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/glacier"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestIsRetryable(t *testing.T) {
+	assert.True(t, isRetryable(errors.Wrap(awserr.New("RequestError", "connection reset", nil), "wrapped")))
+	assert.True(t, isRetryable(awserr.New("ThrottlingException", "slow down", nil)))
+	assert.True(t, isRetryable(awserr.NewRequestFailure(awserr.New("ServiceUnavailableException", "unavailable", nil), 503, "id")))
+	assert.False(t, isRetryable(awserr.NewRequestFailure(awserr.New(glacier.ErrCodeInvalidParameterValueException, "invalid", nil), 400, "id")))
+	assert.False(t, isRetryable(errors.New("any other error")))
+}
+
+func TestRetryPolicy_IsRetryable_AdditionalCodes(t *testing.T) {
+	toTest := RetryPolicy{RetryableCodes: []string{glacier.ErrCodeMissingParameterValueException}}
+
+	assert.True(t, toTest.IsRetryable(awserr.New(glacier.ErrCodeMissingParameterValueException, "missing", nil)))
+	assert.False(t, toTest.IsRetryable(awserr.New(glacier.ErrCodeInvalidParameterValueException, "invalid", nil)))
+}
+
+func TestRetryPolicy_Delay(t *testing.T) {
+	toTest := RetryPolicy{
+		BaseDelay: time.Second,
+		MaxDelay:  10 * time.Second,
+	}
+
+	assert.Equal(t, 1*time.Second, toTest.Delay(1))
+	assert.Equal(t, 2*time.Second, toTest.Delay(2))
+	assert.Equal(t, 4*time.Second, toTest.Delay(3))
+	assert.Equal(t, 8*time.Second, toTest.Delay(4))
+	assert.Equal(t, 10*time.Second, toTest.Delay(5))
+	assert.Equal(t, 10*time.Second, toTest.Delay(100))
+}
+
+func TestRetryPolicy_Delay_Jitter(t *testing.T) {
+	toTest := RetryPolicy{
+		BaseDelay: time.Second,
+		Jitter:    0.5,
+	}
+
+	for i := 0; i < 100; i++ {
+		delay := toTest.Delay(2)
+
+		assert.True(t, delay > 1*time.Second && delay <= 2*time.Second, "%s", delay)
+	}
+}
+
+func TestRetryer_do(t *testing.T) {
+	toTest := newRetryer(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond})
+	calls := 0
+
+	err := toTest.do(context.Background(), "test", func() error {
+		calls++
+		if calls < 3 {
+			return awserr.New("RequestError", "connection reset", nil)
+		}
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, int64(2), toTest.Retries())
+}
+
+func TestRetryer_do_MaxAttempts(t *testing.T) {
+	toTest := newRetryer(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond})
+	calls := 0
+
+	err := toTest.do(context.Background(), "test", func() error {
+		calls++
+		return awserr.New("RequestError", "connection reset", nil)
+	})
+
+	assert.Error(t, err)
+	assert.Equal(t, 3, calls)
+}
+
+func TestRetryer_do_NotRetryable(t *testing.T) {
+	toTest := newRetryer(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond})
+	calls := 0
+
+	err := toTest.do(context.Background(), "test", func() error {
+		calls++
+		return errors.New("not retryable")
+	})
+
+	assert.Error(t, err)
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, int64(0), toTest.Retries())
+}
+
+func TestRetryer_do_Cancelled(t *testing.T) {
+	toTest := newRetryer(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Hour})
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+
+	start := time.Now()
+	err := toTest.do(ctx, "test", func() error {
+		calls++
+		cancel()
+		return awserr.New("RequestError", "connection reset", nil)
+	})
+
+	//the backoff must not wait for the delay after the cancellation
+	assert.True(t, isCancelled(err))
+	assert.Equal(t, 1, calls)
+	assert.True(t, time.Since(start) < time.Second, "%s", time.Since(start))
+}
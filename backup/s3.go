@@ -0,0 +1,659 @@
+package backup
+
+import (
+	. "backup2glacier/log"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/glacier"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/pkg/errors"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// S3KeyPrefix is the prefix of the keys of all objects which are uploaded by the S3 backend
+const S3KeyPrefix = "backup2glacier/"
+
+// S3MinPartSize is the smallest valid part size which S3 accepts for multipart uploads (at least 5 MiB)
+const S3MinPartSize = 8 * 1024 * 1024
+
+// S3RestoreDays is the number of days in which a restored object can be downloaded
+const S3RestoreDays = 1
+
+// DefaultS3StorageClass is the storage class of the uploaded objects if no one is given
+const DefaultS3StorageClass = s3.StorageClassDeepArchive
+
+// S3StorageClasses are the storage classes which can be used for the archives. STANDARD is meant for S3
+// compatible servers (like MinIO) which do not support the archive storage classes.
+var S3StorageClasses = []string{s3.StorageClassDeepArchive, s3.StorageClassGlacier, s3.StorageClassStandard}
+
+// s3MinStorageDurations are the durations for which S3 charges the archived objects at least
+var s3MinStorageDurations = map[string]time.Duration{
+	s3.StorageClassGlacier:     90 * 24 * time.Hour,
+	s3.StorageClassDeepArchive: 180 * 24 * time.Hour,
+}
+
+// s3MetadataDescription is the (canonical) key of the user metadata which holds the archive description
+const s3MetadataDescription = "Description"
+
+var restoreExpiryPattern = regexp.MustCompile(`expiry-date="([^"]+)"`)
+
+type s3Backend struct {
+	session *session.Session
+	s3      s3iface.S3API
+	retryer *retryer
+	limiter *BandwidthLimiter
+}
+
+// NewS3Backend creates a S3 backend for the region of the settings
+func NewS3Backend(settings *StorageSettings) (StorageBackend, error) {
+	return NewS3BackendAt(settings.Location, settings)
+}
+
+// NewS3BackendAt creates a S3 backend for the buckets of the given region. The account is not needed because
+// the bucket names are globally unique.
+func NewS3BackendAt(location AWSLocation, settings *StorageSettings) (StorageBackend, error) {
+	s, config, err := newAWSSession(location, settings.AssumeRole)
+	if err != nil {
+		return nil, err
+	}
+	if settings.S3Endpoint != "" {
+		//S3 compatible servers usually do not support virtual hosted buckets
+		config = config.WithEndpoint(settings.S3Endpoint).WithS3ForcePathStyle(true)
+	}
+
+	return &s3Backend{
+		s,
+		s3.New(s, config),
+		newRetryer(settings.RetryPolicy),
+		settings.BandwidthLimiter,
+	}, nil
+}
+
+func (b *s3Backend) Retries() int64 {
+	return b.retryer.Retries()
+}
+
+// s3UploadId returns the upload id of a multipart upload of the S3 backend. Because S3 needs the object key
+// and the part size for resuming a multipart upload, both are part of the id: <key>;<part size>;<S3 upload id>
+func s3UploadId(key string, partSize int, uploadId string) string {
+	return fmt.Sprintf("%s;%d;%s", key, partSize, uploadId)
+}
+
+func parseS3UploadId(id string) (string, int, string, error) {
+	split := strings.SplitN(id, ";", 3)
+	if len(split) != 3 {
+		return "", 0, "", errors.Errorf("Invalid S3 upload id: %s", id)
+	}
+
+	partSize, err := strconv.Atoi(split[1])
+	if err != nil {
+		return "", 0, "", errors.Errorf("Invalid S3 upload id: %s", id)
+	}
+
+	return split[0], partSize, split[2], nil
+}
+
+// newObjectKey returns a new unique key for an archive
+func newObjectKey() (string, error) {
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return "", errors.Wrap(err, "Could not generate object key")
+	}
+
+	return S3KeyPrefix + time.Now().UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(random), nil
+}
+
+func (b *s3Backend) Upload(upload AWSGlacierUpload) (*AWSGlacierUploadResult, *string, error) {
+	if upload.PartSize < S3MinPartSize {
+		return nil, nil, errors.Errorf("The part size must be at least %d MiB for S3", S3MinPartSize/1024/1024)
+	}
+	storageClass := upload.StorageClass
+	if storageClass == "" {
+		storageClass = DefaultS3StorageClass
+	}
+
+	key, err := newObjectKey()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	request := &s3.CreateMultipartUploadInput{
+		Bucket:       aws.String(upload.VaultName),
+		Key:          aws.String(key),
+		StorageClass: aws.String(storageClass),
+		Metadata:     map[string]*string{s3MetadataDescription: aws.String(upload.ArchiveDesc)},
+	}
+	LogDebug("Send CreateMultipartUpload: %+v", request)
+	var result *s3.CreateMultipartUploadOutput
+	err = b.retryer.do(upload.context(), "CreateMultipartUpload", func() (err error) {
+		result, err = b.s3.CreateMultipartUpload(request)
+		return err
+	})
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Could not init multipart upload")
+	}
+	LogInfo("Initialise multipart upload: %+v", result)
+
+	uploadId := s3UploadId(key, upload.PartSize, aws.StringValue(result.UploadId))
+	return b.continueUpload(upload, key, &uploadId, nil)
+}
+
+// Resume continues an interrupted multipart upload. The source must deliver exactly the same content as the
+// source of the interrupted upload. All parts which are already uploaded will be verified against the source.
+func (b *s3Backend) Resume(resume AWSGlacierResume) (*AWSGlacierUploadResult, error) {
+	key, partSize, s3Id, err := parseS3UploadId(resume.UploadId)
+	if err != nil {
+		return nil, err
+	}
+
+	parts, err := b.listParts(resume.context(), resume.VaultName, key, s3Id)
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchUpload {
+		return nil, ErrUploadNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not list the parts of the multipart upload. Maybe the upload is already aborted")
+	}
+	LogInfo("Resume multipart upload %s: %d parts are already uploaded", resume.UploadId, len(parts))
+
+	result, _, err := b.continueUpload(AWSGlacierUpload{
+		Source:       resume.Source,
+		VaultName:    resume.VaultName,
+		PartSize:     partSize,
+		Concurrency:  resume.Concurrency,
+		Spool:        resume.Spool,
+		KeepOnCancel: resume.KeepOnCancel,
+		Context:      resume.Context,
+	}, key, &resume.UploadId, parts)
+
+	return result, err
+}
+
+// continueUpload uploads all parts which are not uploaded yet and completes the multipart upload. If an error
+// occurred which is retryable, the multipart upload will not be aborted. So that the upload can be resumed later.
+func (b *s3Backend) continueUpload(upload AWSGlacierUpload, key string, uploadId *string, uploadedParts []*s3.Part) (*AWSGlacierUploadResult, *string, error) {
+	_, _, s3Id, _ := parseS3UploadId(*uploadId)
+
+	//closure for reusing purposes
+	abortMultipartUpload := func() {
+		request := &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(upload.VaultName),
+			Key:      aws.String(key),
+			UploadId: aws.String(s3Id),
+		}
+		LogDebug("Send AbortMultipartUpload: %+v", request)
+		//the upload is also aborted after the cancellation of its context
+		b.retryer.do(context.Background(), "AbortMultipartUpload", func() error {
+			_, err := b.s3.AbortMultipartUpload(request)
+			return err
+		})
+	}
+	abortOrKeep := func(err error) string {
+		if b.retryer.policy.IsRetryable(err) || (upload.KeepOnCancel && isCancelled(err)) {
+			LogInfo("Keep multipart upload for a later resume: %s", *uploadId)
+			return "Upload is kept for a later resume"
+		}
+
+		abortMultipartUpload()
+		return "Upload aborted"
+	}
+
+	//if any panic occurred: try to abort the upload
+	defer func() {
+		if r := recover(); r != nil {
+			abortMultipartUpload()
+			panic(r)
+		}
+	}()
+
+	//the ETag of a part is the MD5 of its content
+	mutex := sync.Mutex{}
+	etags := map[int64]string{}
+	uploaded := map[string]string{}
+	for _, part := range uploadedParts {
+		number := aws.Int64Value(part.PartNumber)
+		offset := (number - 1) * int64(upload.PartSize)
+		etags[number] = aws.StringValue(part.ETag)
+		uploaded[fmt.Sprintf("%d-%d", offset, offset+aws.Int64Value(part.Size)-1)] = strings.Trim(aws.StringValue(part.ETag), `"`)
+	}
+
+	totalBytes, hashes, err := uploadMultipartParts(upload, b.limiter, uploaded, md5OfPart, func(part *glacierPart) error {
+		etag, err := b.uploadPart(upload.context(), part, upload.VaultName, key, s3Id)
+		if err == nil {
+			mutex.Lock()
+			etags[int64(part.index+1)] = etag
+			mutex.Unlock()
+		}
+		return err
+	})
+	if err == nil && len(hashes) == 0 {
+		err = errors.New("S3 does not accept empty multipart uploads")
+	}
+	if err != nil {
+		return nil, uploadId, errors.Wrap(err, "Failed to upload to S3. "+abortOrKeep(err))
+	}
+
+	completed := make([]*s3.CompletedPart, 0, len(hashes))
+	for i := range hashes {
+		number := int64(i + 1)
+		completed = append(completed, &s3.CompletedPart{PartNumber: aws.Int64(number), ETag: aws.String(etags[number])})
+	}
+
+	request := &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(upload.VaultName),
+		Key:             aws.String(key),
+		UploadId:        aws.String(s3Id),
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: completed},
+	}
+	LogDebug("Send CompleteMultipartUpload: %+v", request)
+	var result *s3.CompleteMultipartUploadOutput
+	err = b.retryer.do(upload.context(), "CompleteMultipartUpload", func() (err error) {
+		result, err = b.s3.CompleteMultipartUpload(request)
+		return err
+	})
+	if err != nil {
+		return nil, uploadId, errors.Wrap(err, "Error while completing multipart upload. "+abortOrKeep(err))
+	}
+	LogInfo("Complete multipart upload: %+v", result)
+
+	return &AWSGlacierUploadResult{
+		ArchiveDesc: upload.ArchiveDesc,
+		PartSize:    upload.PartSize,
+		CreationResult: &glacier.ArchiveCreationOutput{
+			ArchiveId: aws.String(key),
+			//S3 does not know the tree hash, but it is needed for verifying the download
+			Checksum: aws.String(hex.EncodeToString(glacier.ComputeTreeHash(hashes))),
+			Location: result.Location,
+		},
+		TotalSize: totalBytes,
+	}, uploadId, nil
+}
+
+// md5OfPart returns the checksum of the part in the form of S3
+func md5OfPart(part *glacierPart) string {
+	return hex.EncodeToString(part.md5Hash)
+}
+
+// uploadPart uploads the given part and returns its ETag. S3 verifies the part by its MD5.
+func (b *s3Backend) uploadPart(ctx context.Context, part *glacierPart, bucket, key, uploadId string) (string, error) {
+	var result *s3.UploadPartOutput
+	var start time.Time
+
+	err := b.retryer.do(ctx, fmt.Sprintf("UploadPart %d", part.index), func() error {
+		//on each attempt the part must be read again from the beginning
+		if _, err := part.buffer.Seek(0, io.SeekStart); err != nil {
+			return errors.Wrap(err, "Could not read the buffer of the part")
+		}
+
+		request := &s3.UploadPartInput{
+			Bucket:        aws.String(bucket),
+			Key:           aws.String(key),
+			UploadId:      aws.String(uploadId),
+			PartNumber:    aws.Int64(int64(part.index + 1)),
+			ContentLength: aws.Int64(part.length),
+			ContentMD5:    aws.String(base64.StdEncoding.EncodeToString(part.md5Hash)),
+			Body:          b.limiter.ReadSeeker(part.buffer),
+		}
+
+		LogDebug("Send UploadPart: %+v", request)
+		start = time.Now()
+
+		var err error
+		result, err = b.s3.UploadPartWithContext(ctx, request, withContentHash(part.contentHash))
+		return err
+	})
+
+	if err != nil {
+		return "", errors.Wrap(err, "Error while uploading part")
+	}
+	LogInfo("Uploaded multipart part %d (%d bytes) in %s: %s", part.index, part.length, time.Since(start).Round(time.Millisecond), throughput(part.length, time.Since(start)))
+
+	return aws.StringValue(result.ETag), nil
+}
+
+// listParts returns all already uploaded parts of the given multipart upload
+func (b *s3Backend) listParts(ctx context.Context, bucket, key, uploadId string) ([]*s3.Part, error) {
+	var parts []*s3.Part
+
+	request := &s3.ListPartsInput{
+		Bucket:   aws.String(bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadId),
+	}
+	for {
+		LogDebug("Send ListParts: %+v", request)
+		var result *s3.ListPartsOutput
+		err := b.retryer.do(ctx, "ListParts", func() (err error) {
+			result, err = b.s3.ListParts(request)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, result.Parts...)
+
+		if !aws.BoolValue(result.IsTruncated) {
+			return parts, nil
+		}
+		request.PartNumberMarker = result.NextPartNumberMarker
+	}
+}
+
+// Download restores the object (if it is archived) and downloads it in verified chunks into the target. The
+// job id of the S3 backend is the key of the object.
+func (b *s3Backend) Download(download AWSGlacierDownload) error {
+	if download.JobId == "" {
+		_, err := b.RequestRetrieval(AWSGlacierRetrieval{
+			VaultName: download.VaultName,
+			ArchiveId: download.ArchiveId,
+			Tier:      download.Tier,
+		})
+		if err != nil {
+			return errors.Wrap(err, "Could not restore object")
+		}
+
+		if err := b.waitForRestore(download.context(), download.VaultName, download.ArchiveId, download.PollInterval); err != nil {
+			return errors.Wrap(err, "Error while waiting for restore completion")
+		}
+	} else {
+		job, err := b.DescribeJob(download.VaultName, download.JobId)
+		if err != nil {
+			return errors.Wrap(err, "Could not get restore status")
+		}
+		if !job.Completed {
+			return errors.Errorf("The restore of %s is not completed yet", download.JobId)
+		}
+	}
+
+	head, err := b.headObject(download.context(), download.VaultName, download.ArchiveId)
+	if err != nil {
+		return errors.Wrap(err, "Could not get the object")
+	}
+
+	first, size := int64(0), aws.Int64Value(head.ContentLength)
+	if download.RetrievalByteRange != "" {
+		var last int64
+		if n, _ := fmt.Sscanf(download.RetrievalByteRange, "%d-%d", &first, &last); n != 2 {
+			return errors.Errorf("Invalid byte range: %s", download.RetrievalByteRange)
+		}
+		size = last - first + 1
+	}
+
+	err = downloadOutput(download, retrievalOutput{
+		jobId: download.ArchiveId,
+		size:  size,
+		fetch: func(target io.WriterAt, chunk downloadChunk) ([]byte, error) {
+			return b.downloadChunk(download.context(), download.VaultName, download.ArchiveId, first, target, chunk)
+		},
+	})
+	if err != nil {
+		return errors.Wrap(err, "Error while downloading object")
+	}
+
+	return nil
+}
+
+// downloadChunk downloads the given chunk of the object into the target. The offset of the chunk is relative to
+// the given first byte. It returns the tree hash of the chunk.
+func (b *s3Backend) downloadChunk(ctx context.Context, bucket, key string, first int64, target io.WriterAt, chunk downloadChunk) ([]byte, error) {
+	var hash []byte
+	byteRange := fmt.Sprintf("bytes=%d-%d", first+chunk.offset, first+chunk.offset+chunk.length-1)
+
+	err := b.retryer.do(ctx, fmt.Sprintf("GetObject %s", byteRange), func() error {
+		request := &s3.GetObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+			Range:  aws.String(byteRange),
+		}
+		LogDebug("Send GetObject: %+v", request)
+
+		result, err := b.s3.GetObjectWithContext(ctx, request)
+		if err != nil {
+			return err
+		}
+		defer result.Body.Close()
+
+		treeHash := NewTreeHashWriter()
+		written, err := io.Copy(io.MultiWriter(&offsetWriter{target, chunk.offset}, treeHash), b.limiter.Reader(result.Body))
+		if err != nil {
+			//a dropped connection is worth a retry
+			return awserr.New("RequestError", "Error while reading object", err)
+		}
+		if written != chunk.length {
+			return awserr.New("RequestError", fmt.Sprintf("Received %d bytes instead of %d", written, chunk.length), nil)
+		}
+
+		hash = treeHash.TreeHash()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	LogInfo("Downloaded chunk %d (%d bytes)", chunk.index, chunk.length)
+
+	return hash, nil
+}
+
+// waitForRestore polls the restore status of the given object until it can be downloaded
+func (b *s3Backend) waitForRestore(ctx context.Context, bucket, key string, pollInterval time.Duration) error {
+	for {
+		job, err := b.DescribeJob(bucket, key)
+		if err != nil {
+			return errors.Wrap(err, "Could not get restore status")
+		}
+		if job.Completed {
+			return nil
+		}
+
+		LogInfo("Object is not restored yet. Wait for %s", pollInterval.Round(time.Minute))
+		if err := sleepContext(ctx, pollInterval); err != nil {
+			return err
+		}
+	}
+}
+
+// RequestRetrieval restores the object if it is archived. The whole object will be restored, even if only a range
+// is requested. The key of the object will be returned as job id.
+func (b *s3Backend) RequestRetrieval(retrieval AWSGlacierRetrieval) (string, error) {
+	head, err := b.headObject(context.Background(), retrieval.VaultName, retrieval.ArchiveId)
+	if err != nil {
+		return "", errors.Wrap(err, "Could not get the object")
+	}
+	if !isArchived(head) || head.Restore != nil {
+		//the object can be downloaded directly or its restore is already requested
+		return retrieval.ArchiveId, nil
+	}
+
+	tier := retrieval.Tier
+	if tier == "" {
+		tier = s3.TierStandard
+	}
+	request := &s3.RestoreObjectInput{
+		Bucket: aws.String(retrieval.VaultName),
+		Key:    aws.String(retrieval.ArchiveId),
+		RestoreRequest: &s3.RestoreRequest{
+			Days:                 aws.Int64(S3RestoreDays),
+			GlacierJobParameters: &s3.GlacierJobParameters{Tier: aws.String(tier)},
+		},
+	}
+	LogDebug("Send RestoreObject: %+v", request)
+	err = b.retryer.do(context.Background(), "RestoreObject", func() error {
+		_, err := b.s3.RestoreObject(request)
+		return err
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "RestoreAlreadyInProgress" {
+		err = nil
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "Error while restoring the object")
+	}
+	LogInfo("Requested restore of object %s (%s)", retrieval.ArchiveId, tier)
+
+	return retrieval.ArchiveId, nil
+}
+
+// DescribeJob returns the restore status of the object with the given key. If the object is archived and not
+// restored (anymore), ErrJobNotFound will be returned.
+func (b *s3Backend) DescribeJob(bucket, jobId string) (*AWSGlacierJob, error) {
+	head, err := b.headObject(context.Background(), bucket, jobId)
+	if isS3NotFound(err) {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	job := &AWSGlacierJob{JobId: jobId}
+	if !isArchived(head) {
+		job.Completed = true
+		job.Succeeded = true
+		return job, nil
+	}
+
+	restore := aws.StringValue(head.Restore)
+	if restore == "" {
+		return nil, ErrJobNotFound
+	}
+	if strings.Contains(restore, `ongoing-request="true"`) {
+		return job, nil
+	}
+
+	job.Completed = true
+	job.Succeeded = true
+	if match := restoreExpiryPattern.FindStringSubmatch(restore); match != nil {
+		expiry, err := time.Parse(time.RFC1123, match[1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid expiry date of restored object %s", jobId)
+		}
+		//the restored object is available for S3RestoreDays
+		completionDate := expiry.Add(-S3RestoreDays * 24 * time.Hour)
+		job.CompletionDate = &completionDate
+	}
+
+	return job, nil
+}
+
+// Delete deletes the object. S3 charges archived objects for a minimum storage duration even if they are deleted
+// earlier, so an early deletion will be logged. An object which does not exist anymore (for example because it is
+// expired by a lifecycle rule of the bucket) is no error.
+func (b *s3Backend) Delete(delete AWSGlacierDelete) error {
+	head, err := b.headObject(context.Background(), delete.VaultName, delete.ArchiveId)
+	if isS3NotFound(err) {
+		LogInfo("The object %s does not exist anymore. Maybe it is expired by a lifecycle rule.", delete.ArchiveId)
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "Could not get the object")
+	}
+
+	storageClass := aws.StringValue(head.StorageClass)
+	if minDuration, archived := s3MinStorageDurations[storageClass]; archived && head.LastModified != nil {
+		if age := time.Since(*head.LastModified); age < minDuration {
+			LogInfo("The object %s is deleted before the minimum storage duration of %s. The remaining %d day(s) will be charged anyway.",
+				delete.ArchiveId, storageClass, int((minDuration-age).Hours()/24)+1)
+		}
+	}
+
+	request := &s3.DeleteObjectInput{
+		Bucket: aws.String(delete.VaultName),
+		Key:    aws.String(delete.ArchiveId),
+	}
+	LogDebug("Send DeleteObject: %+v", request)
+	var result *s3.DeleteObjectOutput
+	err = b.retryer.do(context.Background(), "DeleteObject", func() (err error) {
+		result, err = b.s3.DeleteObject(request)
+		return err
+	})
+	if err != nil {
+		return errors.Wrap(err, "Could not delete object")
+	}
+	LogInfo("Complete DeleteObject: %+v", result)
+
+	return nil
+}
+
+// Inventory lists all objects of the bucket which are uploaded by the S3 backend. In contrast to glacier the
+// list is always up to date. The tree hashes of the objects are unknown.
+func (b *s3Backend) Inventory(inventory AWSGlacierInventory) (*VaultInventory, error) {
+	result := &VaultInventory{
+		VaultARN:      "arn:aws:s3:::" + inventory.VaultName,
+		InventoryDate: time.Now().UTC(),
+	}
+
+	request := &s3.ListObjectsV2Input{
+		Bucket: aws.String(inventory.VaultName),
+		Prefix: aws.String(S3KeyPrefix),
+	}
+	for {
+		LogDebug("Send ListObjectsV2: %+v", request)
+		var page *s3.ListObjectsV2Output
+		err := b.retryer.do(context.Background(), "ListObjectsV2", func() (err error) {
+			page, err = b.s3.ListObjectsV2(request)
+			return err
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "Could not list objects")
+		}
+
+		for _, object := range page.Contents {
+			//the description is only available in the metadata of the object
+			head, err := b.headObject(context.Background(), inventory.VaultName, aws.StringValue(object.Key))
+			if err != nil {
+				return nil, errors.Wrapf(err, "Could not get the object %s", aws.StringValue(object.Key))
+			}
+
+			result.ArchiveList = append(result.ArchiveList, InventoryArchive{
+				ArchiveId:          aws.StringValue(object.Key),
+				ArchiveDescription: aws.StringValue(head.Metadata[s3MetadataDescription]),
+				CreationDate:       aws.TimeValue(object.LastModified),
+				Size:               aws.Int64Value(object.Size),
+			})
+		}
+
+		if !aws.BoolValue(page.IsTruncated) {
+			break
+		}
+		request.ContinuationToken = page.NextContinuationToken
+	}
+	LogInfo("Listed %d objects of bucket %s", len(result.ArchiveList), inventory.VaultName)
+
+	return result, nil
+}
+
+func (b *s3Backend) headObject(ctx context.Context, bucket, key string) (*s3.HeadObjectOutput, error) {
+	request := &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}
+	LogDebug("Send HeadObject: %+v", request)
+
+	var result *s3.HeadObjectOutput
+	err := b.retryer.do(ctx, "HeadObject", func() (err error) {
+		result, err = b.s3.HeadObject(request)
+		return err
+	})
+
+	return result, err
+}
+
+// isArchived returns true if the object must be restored before it can be downloaded
+func isArchived(head *s3.HeadObjectOutput) bool {
+	_, archived := s3MinStorageDurations[aws.StringValue(head.StorageClass)]
+	return archived
+}
+
+func isS3NotFound(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && (aerr.Code() == "NotFound" || aerr.Code() == s3.ErrCodeNoSuchKey)
+}
@@ -0,0 +1,434 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/glacier"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeS3Object struct {
+	content      []byte
+	storageClass string
+	metadata     map[string]*string
+	lastModified time.Time
+	restore      *string
+}
+
+// fakeS3Client keeps the objects and the multipart uploads of one bucket in memory
+type fakeS3Client struct {
+	s3iface.S3API
+
+	mutex    sync.Mutex
+	objects  map[string]*fakeS3Object
+	uploads  map[string]*fakeS3Object
+	parts    map[string]map[int64][]byte
+	failPart int64
+	uploaded int
+	restored []string
+}
+
+func newFakeS3Client() *fakeS3Client {
+	return &fakeS3Client{
+		objects: map[string]*fakeS3Object{},
+		uploads: map[string]*fakeS3Object{},
+		parts:   map[string]map[int64][]byte{},
+	}
+}
+
+func (f *fakeS3Client) CreateMultipartUpload(input *s3.CreateMultipartUploadInput) (*s3.CreateMultipartUploadOutput, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	uploadId := fmt.Sprintf("upload-%d", len(f.uploads))
+	f.uploads[uploadId] = &fakeS3Object{storageClass: *input.StorageClass, metadata: input.Metadata}
+	f.parts[uploadId] = map[int64][]byte{}
+
+	return &s3.CreateMultipartUploadOutput{UploadId: aws.String(uploadId), Key: input.Key}, nil
+}
+
+func (f *fakeS3Client) UploadPartWithContext(ctx aws.Context, input *s3.UploadPartInput, opts ...request.Option) (*s3.UploadPartOutput, error) {
+	content, err := ioutil.ReadAll(input.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if *input.PartNumber == f.failPart {
+		return nil, awserr.New("RequestError", "connection reset", nil)
+	}
+	hash := md5.Sum(content)
+	if base64.StdEncoding.EncodeToString(hash[:]) != *input.ContentMD5 {
+		return nil, awserr.New("BadDigest", "content md5 mismatch", nil)
+	}
+	f.parts[*input.UploadId][*input.PartNumber] = content
+	f.uploaded++
+
+	return &s3.UploadPartOutput{ETag: aws.String(fmt.Sprintf(`"%x"`, hash))}, nil
+}
+
+func (f *fakeS3Client) ListParts(input *s3.ListPartsInput) (*s3.ListPartsOutput, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	parts, exists := f.parts[*input.UploadId]
+	if !exists {
+		return nil, awserr.New(s3.ErrCodeNoSuchUpload, "no such upload", nil)
+	}
+
+	result := &s3.ListPartsOutput{}
+	for number, content := range parts {
+		result.Parts = append(result.Parts, &s3.Part{
+			PartNumber: aws.Int64(number),
+			Size:       aws.Int64(int64(len(content))),
+			ETag:       aws.String(fmt.Sprintf(`"%x"`, md5.Sum(content))),
+		})
+	}
+
+	return result, nil
+}
+
+func (f *fakeS3Client) CompleteMultipartUpload(input *s3.CompleteMultipartUploadInput) (*s3.CompleteMultipartUploadOutput, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	object := f.uploads[*input.UploadId]
+	parts := f.parts[*input.UploadId]
+
+	numbers := make([]int, 0, len(input.MultipartUpload.Parts))
+	for _, part := range input.MultipartUpload.Parts {
+		content := parts[*part.PartNumber]
+		if fmt.Sprintf(`"%x"`, md5.Sum(content)) != *part.ETag {
+			return nil, awserr.New("InvalidPart", "etag mismatch", nil)
+		}
+		numbers = append(numbers, int(*part.PartNumber))
+	}
+	sort.Ints(numbers)
+	for _, number := range numbers {
+		object.content = append(object.content, parts[int64(number)]...)
+	}
+	object.lastModified = time.Now()
+
+	f.objects[*input.Key] = object
+	delete(f.uploads, *input.UploadId)
+	delete(f.parts, *input.UploadId)
+
+	return &s3.CompleteMultipartUploadOutput{Key: input.Key, Location: aws.String("/" + *input.Bucket + "/" + *input.Key)}, nil
+}
+
+func (f *fakeS3Client) AbortMultipartUpload(input *s3.AbortMultipartUploadInput) (*s3.AbortMultipartUploadOutput, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	delete(f.uploads, *input.UploadId)
+	delete(f.parts, *input.UploadId)
+
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+func (f *fakeS3Client) HeadObject(input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	object, exists := f.objects[*input.Key]
+	if !exists {
+		return nil, awserr.New("NotFound", "not found", nil)
+	}
+
+	result := &s3.HeadObjectOutput{
+		ContentLength: aws.Int64(int64(len(object.content))),
+		LastModified:  aws.Time(object.lastModified),
+		Metadata:      object.metadata,
+		Restore:       object.restore,
+	}
+	if object.storageClass != s3.StorageClassStandard {
+		result.StorageClass = aws.String(object.storageClass)
+	}
+
+	return result, nil
+}
+
+func (f *fakeS3Client) RestoreObject(input *s3.RestoreObjectInput) (*s3.RestoreObjectOutput, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.objects[*input.Key].restore = aws.String(`ongoing-request="true"`)
+	f.restored = append(f.restored, *input.Key)
+
+	return &s3.RestoreObjectOutput{}, nil
+}
+
+func (f *fakeS3Client) completeRestore(key string, expiry time.Time) {
+	f.objects[key].restore = aws.String(fmt.Sprintf(`ongoing-request="false", expiry-date="%s"`, expiry.Format(time.RFC1123)))
+}
+
+func (f *fakeS3Client) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	object := f.objects[*input.Key]
+	if _, archived := s3MinStorageDurations[object.storageClass]; archived && !strings.Contains(aws.StringValue(object.restore), `ongoing-request="false"`) {
+		return nil, awserr.New("InvalidObjectState", "object is archived", nil)
+	}
+
+	var start, end int
+	fmt.Sscanf(*input.Range, "bytes=%d-%d", &start, &end)
+
+	return &s3.GetObjectOutput{Body: ioutil.NopCloser(bytes.NewReader(object.content[start : end+1]))}, nil
+}
+
+func (f *fakeS3Client) DeleteObject(input *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	delete(f.objects, *input.Key)
+
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func (f *fakeS3Client) ListObjectsV2(input *s3.ListObjectsV2Input) (*s3.ListObjectsV2Output, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	result := &s3.ListObjectsV2Output{}
+	for key, object := range f.objects {
+		if strings.HasPrefix(key, *input.Prefix) {
+			result.Contents = append(result.Contents, &s3.Object{
+				Key:          aws.String(key),
+				Size:         aws.Int64(int64(len(object.content))),
+				LastModified: aws.Time(object.lastModified),
+			})
+		}
+	}
+
+	return result, nil
+}
+
+func newS3TestBackend() (*s3Backend, *fakeS3Client) {
+	client := newFakeS3Client()
+	return &s3Backend{s3: client, retryer: newRetryer(RetryPolicy{MaxAttempts: 1})}, client
+}
+
+func TestS3Backend_UploadDownload(t *testing.T) {
+	toTest, client := newS3TestBackend()
+
+	data := make([]byte, 2*S3MinPartSize+17)
+	rand.Read(data)
+
+	result, uploadId, err := toTest.Upload(AWSGlacierUpload{
+		Source:       bytes.NewReader(data),
+		VaultName:    "bucket",
+		ArchiveDesc:  "description",
+		PartSize:     S3MinPartSize,
+		Concurrency:  2,
+		StorageClass: s3.StorageClassStandard,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(data)), result.TotalSize)
+	assert.Equal(t, fmt.Sprintf("%x", glacier.ComputeHashes(bytes.NewReader(data)).TreeHash), *result.CreationResult.Checksum)
+
+	key := *result.CreationResult.ArchiveId
+	assert.True(t, strings.HasPrefix(key, S3KeyPrefix))
+	assert.True(t, strings.HasPrefix(*uploadId, key+";"))
+	assert.Equal(t, data, client.objects[key].content)
+
+	dir, err := ioutil.TempDir("", "s3")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	target := path.Join(dir, "download")
+
+	//a STANDARD object must not be restored
+	err = toTest.Download(AWSGlacierDownload{
+		Target:    target,
+		ChunkSize: mib,
+		VaultName: "bucket",
+		ArchiveId: key,
+		Checksum:  *result.CreationResult.Checksum,
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, client.restored)
+
+	downloaded, err := ioutil.ReadFile(target)
+	assert.NoError(t, err)
+	assert.Equal(t, data, downloaded)
+
+	inventory, err := toTest.Inventory(AWSGlacierInventory{VaultName: "bucket"})
+	assert.NoError(t, err)
+	assert.Len(t, inventory.ArchiveList, 1)
+	assert.Equal(t, key, inventory.ArchiveList[0].ArchiveId)
+	assert.Equal(t, "description", inventory.ArchiveList[0].ArchiveDescription)
+}
+
+func TestS3Backend_Resume(t *testing.T) {
+	toTest, client := newS3TestBackend()
+
+	data := make([]byte, 3*S3MinPartSize)
+	rand.Read(data)
+
+	//the second part fails: the upload is kept
+	client.failPart = 2
+	_, uploadId, err := toTest.Upload(AWSGlacierUpload{
+		Source:    bytes.NewReader(data),
+		VaultName: "bucket",
+		PartSize:  S3MinPartSize,
+	})
+	assert.Error(t, err)
+	assert.NotNil(t, uploadId)
+	assert.Len(t, client.uploads, 1)
+
+	client.failPart = 0
+	client.uploaded = 0
+	result, err := toTest.Resume(AWSGlacierResume{
+		Source:    bytes.NewReader(data),
+		VaultName: "bucket",
+		UploadId:  *uploadId,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, client.uploaded)
+	assert.Equal(t, data, client.objects[*result.CreationResult.ArchiveId].content)
+	assert.Equal(t, DefaultS3StorageClass, client.objects[*result.CreationResult.ArchiveId].storageClass)
+
+	//the upload does not exist anymore
+	_, err = toTest.Resume(AWSGlacierResume{
+		Source:    bytes.NewReader(data),
+		VaultName: "bucket",
+		UploadId:  *uploadId,
+	})
+	assert.Equal(t, ErrUploadNotFound, err)
+}
+
+func TestS3Backend_Restore(t *testing.T) {
+	toTest, client := newS3TestBackend()
+
+	data := make([]byte, 3*mib)
+	rand.Read(data)
+	client.objects["key"] = &fakeS3Object{content: data, storageClass: s3.StorageClassDeepArchive}
+
+	//not restored yet
+	_, err := toTest.DescribeJob("bucket", "key")
+	assert.Equal(t, ErrJobNotFound, err)
+
+	jobId, err := toTest.RequestRetrieval(AWSGlacierRetrieval{VaultName: "bucket", ArchiveId: "key", Tier: "Bulk"})
+	assert.NoError(t, err)
+	assert.Equal(t, "key", jobId)
+
+	//a second request does not restore again
+	_, err = toTest.RequestRetrieval(AWSGlacierRetrieval{VaultName: "bucket", ArchiveId: "key", Tier: "Bulk"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"key"}, client.restored)
+
+	job, err := toTest.DescribeJob("bucket", jobId)
+	assert.NoError(t, err)
+	assert.False(t, job.Completed)
+
+	expiry := time.Date(2019, 8, 2, 0, 0, 0, 0, time.UTC)
+	client.completeRestore("key", expiry)
+
+	job, err = toTest.DescribeJob("bucket", jobId)
+	assert.NoError(t, err)
+	assert.True(t, job.Completed)
+	assert.True(t, job.Succeeded)
+	assert.True(t, expiry.Add(-24*time.Hour).Equal(*job.CompletionDate))
+
+	dir, err := ioutil.TempDir("", "s3")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	target := path.Join(dir, "download")
+
+	//only the last MiB
+	err = toTest.Download(AWSGlacierDownload{
+		Target:             target,
+		VaultName:          "bucket",
+		ArchiveId:          "key",
+		JobId:              jobId,
+		RetrievalByteRange: tailRange(int64(len(data)), mib),
+	})
+	assert.NoError(t, err)
+
+	downloaded, err := ioutil.ReadFile(target)
+	assert.NoError(t, err)
+	assert.Equal(t, data[2*mib:], downloaded)
+}
+
+func TestS3Backend_Delete(t *testing.T) {
+	toTest, client := newS3TestBackend()
+
+	client.objects["key"] = &fakeS3Object{storageClass: s3.StorageClassGlacier, lastModified: time.Now()}
+
+	assert.NoError(t, toTest.Delete(AWSGlacierDelete{VaultName: "bucket", ArchiveId: "key"}))
+	assert.NotContains(t, client.objects, "key")
+
+	//an object which is already expired by a lifecycle rule
+	assert.NoError(t, toTest.Delete(AWSGlacierDelete{VaultName: "bucket", ArchiveId: "key"}))
+}
+
+// TestS3Backend_MinIO runs against a local MinIO server. It is skipped if MINIO_ENDPOINT is not set. The bucket
+// (MINIO_BUCKET) must exist and the credentials must be given by AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY.
+func TestS3Backend_MinIO(t *testing.T) {
+	endpoint := os.Getenv("MINIO_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("MINIO_ENDPOINT is not set")
+	}
+	if os.Getenv("AWS_REGION") == "" {
+		os.Setenv("AWS_REGION", "us-east-1")
+	}
+
+	settings := NewStorageSettings()
+	settings.S3Endpoint = endpoint
+
+	toTest, err := NewS3Backend(settings)
+	assert.NoError(t, err)
+
+	data := make([]byte, S3MinPartSize+17)
+	rand.Read(data)
+
+	bucket := os.Getenv("MINIO_BUCKET")
+	result, _, err := toTest.Upload(AWSGlacierUpload{
+		Source:       bytes.NewReader(data),
+		VaultName:    bucket,
+		ArchiveDesc:  "minio test",
+		PartSize:     S3MinPartSize,
+		StorageClass: s3.StorageClassStandard,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	key := *result.CreationResult.ArchiveId
+
+	dir, err := ioutil.TempDir("", "s3")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	target := path.Join(dir, "download")
+
+	err = toTest.Download(AWSGlacierDownload{
+		Target:    target,
+		VaultName: bucket,
+		ArchiveId: key,
+		Checksum:  *result.CreationResult.Checksum,
+	})
+	assert.NoError(t, err)
+
+	downloaded, err := ioutil.ReadFile(target)
+	assert.NoError(t, err)
+	assert.Equal(t, data, downloaded)
+
+	assert.NoError(t, toTest.Delete(AWSGlacierDelete{VaultName: bucket, ArchiveId: key}))
+}
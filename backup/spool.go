@@ -0,0 +1,210 @@
+package backup
+
+import (
+	"bytes"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+const (
+	// SpoolModeDisk buffers each part in a temporary file
+	SpoolModeDisk = "disk"
+	// SpoolModeMemory buffers each part in memory
+	SpoolModeMemory = "memory"
+)
+
+// SpoolConfig describes where the parts of a multipart upload are buffered before they are uploaded
+type SpoolConfig struct {
+	Mode string
+	// Dir is the directory for the temporary files (only for SpoolModeDisk). If it is empty, the
+	// default directory for temporary files will be used.
+	Dir string
+}
+
+// partBuffer holds the content of one part
+type partBuffer interface {
+	io.Writer
+	io.ReadSeeker
+
+	// Reset empties the buffer so that it can be reused for the next part
+	Reset() error
+}
+
+// spool is a bounded pool of part buffers. The buffers will be reused for all parts of an upload.
+type spool struct {
+	config   SpoolConfig
+	partSize int
+
+	mutex   sync.Mutex
+	free    []partBuffer
+	created []partBuffer
+	limit   int
+}
+
+func newSpool(config SpoolConfig, partSize, limit int) *spool {
+	if config.Mode == "" {
+		config.Mode = SpoolModeDisk
+	}
+
+	return &spool{
+		config:   config,
+		partSize: partSize,
+		limit:    limit,
+	}
+}
+
+// Get returns an empty buffer for the next part. There are never more than limit buffers at once.
+func (s *spool) Get() (partBuffer, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var buffer partBuffer
+	if len(s.free) > 0 {
+		buffer = s.free[len(s.free)-1]
+		s.free = s.free[:len(s.free)-1]
+
+		if err := buffer.Reset(); err != nil {
+			return nil, errors.Wrap(err, "Could not reset part buffer")
+		}
+	} else {
+		if len(s.created) >= s.limit {
+			return nil, errors.Errorf("All %d part buffers are in use", s.limit)
+		}
+
+		var err error
+		buffer, err = s.newBuffer()
+		if err != nil {
+			return nil, err
+		}
+		s.created = append(s.created, buffer)
+	}
+
+	if err := s.checkSpace(); err != nil {
+		s.free = append(s.free, buffer)
+		return nil, err
+	}
+
+	return buffer, nil
+}
+
+// Put gives back the given buffer, so that it can be reused for one of the next parts
+func (s *spool) Put(buffer partBuffer) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.free = append(s.free, buffer)
+}
+
+// Close releases all buffers (and removes their temporary files)
+func (s *spool) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, buffer := range s.created {
+		if closer, ok := buffer.(io.Closer); ok {
+			closer.Close()
+		}
+	}
+	s.created = nil
+	s.free = nil
+
+	return nil
+}
+
+func (s *spool) newBuffer() (partBuffer, error) {
+	switch s.config.Mode {
+	case SpoolModeMemory:
+		return &memoryBuffer{
+			content: make([]byte, 0, s.partSize),
+		}, nil
+	case SpoolModeDisk:
+		tmpFile, err := ioutil.TempFile(s.config.Dir, "aws-glacier-part")
+		if err != nil {
+			return nil, errors.Wrap(err, "Could not create temporary file for part upload")
+		}
+		return &fileBuffer{tmpFile}, nil
+	default:
+		return nil, errors.Errorf("Unknown spool mode: %s", s.config.Mode)
+	}
+}
+
+// checkSpace checks if there is enough space in the spool directory for the next part. The buffers of the
+// previous parts are already reset at this point. So there must be space for only one part.
+func (s *spool) checkSpace() error {
+	if s.config.Mode != SpoolModeDisk {
+		return nil
+	}
+
+	return CheckSpoolSpace(s.config.Dir, int64(s.partSize))
+}
+
+// CheckSpoolSpace checks if there are at least the given number of bytes available in the spool directory
+func CheckSpoolSpace(dir string, needed int64) error {
+	if dir == "" {
+		dir = os.TempDir()
+	}
+
+	available, err := freeSpace(dir)
+	if err != nil {
+		return errors.Wrapf(err, "Could not determine the free space of the spool directory %s", dir)
+	}
+	if available >= 0 && available < needed {
+		return errors.Errorf("There is not enough space in the spool directory %s: %d bytes available but %d bytes are needed", dir, available, needed)
+	}
+
+	return nil
+}
+
+type memoryBuffer struct {
+	content []byte
+	reader  *bytes.Reader
+}
+
+func (m *memoryBuffer) Write(p []byte) (int, error) {
+	m.content = append(m.content, p...)
+	m.reader = nil
+
+	return len(p), nil
+}
+
+func (m *memoryBuffer) Read(p []byte) (int, error) {
+	return m.getReader().Read(p)
+}
+
+func (m *memoryBuffer) Seek(offset int64, whence int) (int64, error) {
+	return m.getReader().Seek(offset, whence)
+}
+
+func (m *memoryBuffer) getReader() *bytes.Reader {
+	if m.reader == nil {
+		m.reader = bytes.NewReader(m.content)
+	}
+	return m.reader
+}
+
+func (m *memoryBuffer) Reset() error {
+	m.content = m.content[:0]
+	m.reader = nil
+
+	return nil
+}
+
+type fileBuffer struct {
+	*os.File
+}
+
+func (f *fileBuffer) Reset() error {
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	_, err := f.Seek(0, io.SeekStart)
+	return err
+}
+
+func (f *fileBuffer) Close() error {
+	f.File.Close()
+	return os.Remove(f.Name())
+}
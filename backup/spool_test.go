@@ -0,0 +1,60 @@
+package backup
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestSpool_ReuseBuffers(t *testing.T) {
+	for _, mode := range []string{SpoolModeMemory, SpoolModeDisk} {
+		t.Run(mode, func(t *testing.T) {
+			tmpDir, err := ioutil.TempDir("", "spool")
+			assert.NoError(t, err)
+			defer os.RemoveAll(tmpDir)
+
+			toTest := newSpool(SpoolConfig{Mode: mode, Dir: tmpDir}, 1024, 2)
+
+			first, err := toTest.Get()
+			assert.NoError(t, err)
+			second, err := toTest.Get()
+			assert.NoError(t, err)
+
+			//the pool is bounded
+			_, err = toTest.Get()
+			assert.Error(t, err)
+
+			first.Write([]byte("first content"))
+			toTest.Put(first)
+
+			//the buffer will be reused and is empty
+			third, err := toTest.Get()
+			assert.NoError(t, err)
+			assert.True(t, first == third)
+
+			third.Write([]byte("third"))
+			third.Seek(0, 0)
+			content, _ := ioutil.ReadAll(third)
+			assert.Equal(t, "third", string(content))
+
+			toTest.Put(second)
+			toTest.Put(third)
+			assert.NoError(t, toTest.Close())
+
+			files, _ := ioutil.ReadDir(tmpDir)
+			assert.Len(t, files, 0)
+		})
+	}
+}
+
+func TestCheckSpoolSpace(t *testing.T) {
+	assert.NoError(t, CheckSpoolSpace("", 1))
+	assert.Error(t, CheckSpoolSpace("", 1<<62))
+}
+
+func TestSpool_UnknownMode(t *testing.T) {
+	_, err := newSpool(SpoolConfig{Mode: "unknown"}, 1024, 1).Get()
+
+	assert.Error(t, err)
+}
@@ -0,0 +1,16 @@
+//go:build !windows
+// +build !windows
+
+package backup
+
+import "syscall"
+
+// freeSpace returns the number of bytes which are available in the given directory
+func freeSpace(dir string) (int64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return 0, err
+	}
+
+	return int64(stat.Bavail) * int64(stat.Bsize), nil
+}
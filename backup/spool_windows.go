@@ -0,0 +1,9 @@
+//go:build windows
+// +build windows
+
+package backup
+
+// freeSpace returns -1 because the free space can not be determined on windows
+func freeSpace(dir string) (int64, error) {
+	return -1, nil
+}
@@ -0,0 +1,216 @@
+package backup
+
+import (
+	"backup2glacier/database"
+	"backup2glacier/database/model"
+	. "backup2glacier/log"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// ErrInterrupted is the error of the backups whose runs are interrupted (see Cleanup)
+var ErrInterrupted = errors.New("The backup was interrupted")
+
+// statusTransitions contains the allowed transitions between the states of a backup. Backups without status
+// were created by an older version, so they can change into any state.
+var statusTransitions = map[string][]string{
+	"": {
+		model.BackupStatusPending,
+		model.BackupStatusUploading,
+		model.BackupStatusCompleted,
+		model.BackupStatusCompletedWithWarnings,
+		model.BackupStatusFailed,
+		model.BackupStatusCancelled,
+		model.BackupStatusDeleting,
+	},
+	model.BackupStatusPending: {
+		model.BackupStatusUploading,
+		model.BackupStatusFailed,
+		model.BackupStatusCancelled,
+		model.BackupStatusDeleting,
+	},
+	model.BackupStatusUploading: {
+		model.BackupStatusCompleted,
+		model.BackupStatusCompletedWithWarnings,
+		model.BackupStatusFailed,
+		model.BackupStatusCancelled,
+	},
+	model.BackupStatusFailed:    {model.BackupStatusUploading, model.BackupStatusDeleting},
+	model.BackupStatusCancelled: {model.BackupStatusUploading, model.BackupStatusDeleting},
+	// completed backups fail if some of their archives are missing in the vault
+	model.BackupStatusCompleted:             {model.BackupStatusDeleting, model.BackupStatusFailed},
+	model.BackupStatusCompletedWithWarnings: {model.BackupStatusDeleting, model.BackupStatusFailed},
+	// an interrupted deletion can be repeated
+	model.BackupStatusDeleting: {model.BackupStatusDeleting, model.BackupStatusDeleted},
+}
+
+// IsValidStatus checks if the given status is one of model.BackupStatuses
+func IsValidStatus(status string) bool {
+	for _, valid := range model.BackupStatuses {
+		if valid == status {
+			return true
+		}
+	}
+
+	return false
+}
+
+func canChangeStatus(from, to string) bool {
+	for _, allowed := range statusTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// changeStatus checks and sets the new status of the backup. The returned transition has to be saved after
+// the backup.
+func changeStatus(dbBackup *model.Backup, status string) (*model.BackupTransition, error) {
+	if !canChangeStatus(dbBackup.Status, status) {
+		return nil, errors.Errorf("The status of backup %d can not change from %s to %s", dbBackup.ID, statusName(dbBackup.Status), status)
+	}
+
+	transition := &model.BackupTransition{
+		BackupID:   dbBackup.ID,
+		FromStatus: dbBackup.Status,
+		ToStatus:   status,
+		Error:      dbBackup.Error,
+	}
+	dbBackup.Status = status
+	dbBackup.StatusChangedAt = time.Now()
+	dbBackup.HeartbeatAt = dbBackup.StatusChangedAt
+
+	return transition, nil
+}
+
+// saveStatus changes the status of the saved backup and records the transition
+func saveStatus(dbRepository database.Repository, dbBackup *model.Backup, status string) error {
+	transition, err := changeStatus(dbBackup, status)
+	if err != nil {
+		return err
+	}
+
+	dbRepository.UpdateBackup(dbBackup)
+	dbRepository.SaveBackupTransition(transition)
+	return nil
+}
+
+// saveNewBackup saves the new backup with the given status and records its first transition
+func saveNewBackup(dbRepository database.Repository, dbBackup *model.Backup, status string) {
+	transition, err := changeStatus(dbBackup, status)
+	if err != nil {
+		panic(err)
+	}
+
+	dbRepository.SaveBackup(dbBackup)
+	transition.BackupID = dbBackup.ID
+	dbRepository.SaveBackupTransition(transition)
+}
+
+func statusName(status string) string {
+	if status == "" {
+		return "unknown"
+	}
+
+	return status
+}
+
+// resumable checks if the upload of the backup can be continued
+func resumable(dbBackup *model.Backup) error {
+	switch dbBackup.Status {
+	case "", model.BackupStatusPending, model.BackupStatusFailed, model.BackupStatusCancelled:
+		return nil
+	case model.BackupStatusUploading:
+		return errors.New("The backup is still uploading. If its run was interrupted, mark it as failed with CLEANUP.")
+	case model.BackupStatusCompleted, model.BackupStatusCompletedWithWarnings:
+		return errors.New("The backup is already completed")
+	default:
+		return errors.Errorf("The backup can not be resumed because it is %s", dbBackup.Status)
+	}
+}
+
+// uploadStatus returns the status of a backup after its upload
+func (b *backupManager) uploadStatus(result *BackupResult, isCancelled bool) string {
+	if isCancelled {
+		return model.BackupStatusCancelled
+	}
+	if result.Error != nil {
+		return model.BackupStatusFailed
+	}
+
+	for _, replica := range b.dbRepository.GetReplicasByBackupId(result.BackupId) {
+		if replica.ArchiveId == nil {
+			return model.BackupStatusCompletedWithWarnings
+		}
+	}
+
+	return model.BackupStatusCompleted
+}
+
+// heartbeatInterval is the minimal time between two heartbeats of a backup
+const heartbeatInterval = time.Minute
+
+// heartbeat refreshes the heartbeat of the backup while it is uploaded, so that Cleanup does not regard a long
+// running upload as interrupted. The heartbeat is saved at most once per heartbeatInterval.
+func (b *backupManager) heartbeat(backupId uint) {
+	now := time.Now()
+
+	b.heartbeatMutex.Lock()
+	if b.heartbeats == nil {
+		b.heartbeats = map[uint]time.Time{}
+	}
+	if now.Sub(b.heartbeats[backupId]) < heartbeatInterval {
+		b.heartbeatMutex.Unlock()
+		return
+	}
+	b.heartbeats[backupId] = now
+	b.heartbeatMutex.Unlock()
+
+	b.dbRepository.UpdateHeartbeat(backupId, now)
+}
+
+// Cleanup marks the backups as failed which are pending or uploading and whose last heartbeat is before the given
+// time: their runs are assumed to be interrupted, so that they can be resumed. If remove is true, their archives will be deleted and
+// they will be removed from the catalog. Open multipart uploads of the backups are not aborted. The returned
+// backups are the stale ones, which are only listed if dryRun is true.
+func (b *backupManager) Cleanup(before time.Time, remove, dryRun bool) ([]*model.Backup, error) {
+	var stale []*model.Backup
+
+	iter := b.dbRepository.GetStale(before)
+	for {
+		dbBackup, next := iter.Next()
+		if !next {
+			break
+		}
+		stale = append(stale, dbBackup)
+	}
+	iter.Close()
+
+	if dryRun {
+		return stale, nil
+	}
+
+	for _, dbBackup := range stale {
+		if err := b.ctx.Err(); err != nil {
+			return stale, err
+		}
+
+		status, lastSeen := dbBackup.Status, dbBackup.HeartbeatAt
+		dbBackup.Error = ErrInterrupted.Error()
+		if err := saveStatus(b.dbRepository, dbBackup, model.BackupStatusFailed); err != nil {
+			return stale, err
+		}
+		LogInfo("Marked backup %d as failed: it was %s and last seen at %s", dbBackup.ID, status, lastSeen.Format(time.RFC3339))
+
+		if remove {
+			if err := b.Delete(dbBackup.ID); err != nil {
+				return stale, errors.Wrapf(err, "Could not delete backup %d", dbBackup.ID)
+			}
+			LogInfo("Deleted backup %d", dbBackup.ID)
+		}
+	}
+
+	return stale, nil
+}
@@ -0,0 +1,73 @@
+package backup
+
+import (
+	"backup2glacier/database"
+	"backup2glacier/database/model"
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func Test_changeStatus(t *testing.T) {
+	dbBackup := &model.Backup{}
+	dbBackup.ID = 1
+
+	for _, status := range []string{
+		model.BackupStatusPending,
+		model.BackupStatusUploading,
+		model.BackupStatusCancelled,
+		model.BackupStatusUploading,
+		model.BackupStatusCompleted,
+		model.BackupStatusDeleting,
+		model.BackupStatusDeleting,
+		model.BackupStatusDeleted,
+	} {
+		from := dbBackup.Status
+		transition, err := changeStatus(dbBackup, status)
+		assert.NoError(t, err)
+		assert.Equal(t, from, transition.FromStatus)
+		assert.Equal(t, status, transition.ToStatus)
+		assert.Equal(t, status, dbBackup.Status)
+		assert.False(t, dbBackup.StatusChangedAt.IsZero())
+		assert.Equal(t, dbBackup.StatusChangedAt, dbBackup.HeartbeatAt)
+	}
+
+	dbBackup.Status = model.BackupStatusCompleted
+	_, err := changeStatus(dbBackup, model.BackupStatusUploading)
+	assert.EqualError(t, err, "The status of backup 1 can not change from completed to uploading")
+	assert.Equal(t, model.BackupStatusCompleted, dbBackup.Status)
+
+	dbBackup.Status = model.BackupStatusUploading
+	_, err = changeStatus(dbBackup, model.BackupStatusDeleting)
+	assert.Error(t, err)
+	assert.Error(t, resumable(dbBackup))
+}
+
+func TestBackupManager_heartbeat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "status")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	toTest := &backupManager{
+		dbRepository: database.NewRepository(path.Join(dir, "database.db")),
+		ctx:          context.Background(),
+	}
+	defer toTest.Close()
+
+	longAgo := time.Now().Add(-72 * time.Hour)
+	dbBackup := &model.Backup{Status: model.BackupStatusUploading, StatusChangedAt: longAgo, HeartbeatAt: longAgo}
+	toTest.dbRepository.SaveBackup(dbBackup)
+
+	_, err = ioutil.ReadAll(toTest.progressOf(bytes.NewReader([]byte("content")), dbBackup.ID, 1, "vault"))
+	assert.NoError(t, err)
+
+	stale, err := toTest.Cleanup(time.Now().Add(-24*time.Hour), false, false)
+	assert.NoError(t, err)
+	assert.Empty(t, stale)
+	assert.Equal(t, model.BackupStatusUploading, toTest.dbRepository.GetBackupById(dbBackup.ID).Status)
+}
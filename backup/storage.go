@@ -0,0 +1,120 @@
+package backup
+
+import (
+	"backup2glacier/database/model"
+	"github.com/pkg/errors"
+	"sync"
+	"time"
+)
+
+// The types of the storage backends
+const (
+	BackendGlacier   = "glacier"
+	BackendS3        = "s3"
+	BackendDirectory = "directory"
+)
+
+// StorageBackend stores the (encrypted) archives of the backups. For glacier the vault is a glacier vault and the
+// archive id is the id of a glacier archive. For S3 the vault is a bucket and the archive id is the key of an object.
+// For the directory backend the vault is the path of a (local or mounted) directory.
+type StorageBackend interface {
+	Upload(AWSGlacierUpload) (*AWSGlacierUploadResult, *string, error)
+	Resume(AWSGlacierResume) (*AWSGlacierUploadResult, error)
+	Download(AWSGlacierDownload) error
+	// RequestRetrieval initiates an archive retrieval job (or returns a running one) without waiting for it
+	RequestRetrieval(AWSGlacierRetrieval) (string, error)
+	// DescribeJob returns the status of the given job. If the job does not exist, ErrJobNotFound will be returned.
+	DescribeJob(vaultName, jobId string) (*AWSGlacierJob, error)
+	Delete(AWSGlacierDelete) error
+	// Inventory retrieves the list of all archives of a vault. This can take several hours.
+	Inventory(AWSGlacierInventory) (*VaultInventory, error)
+
+	// Retries returns the number of retried operations so far
+	Retries() int64
+}
+
+// IsValidBackend checks if there is a storage backend of the given type
+func IsValidBackend(backend string) bool {
+	return backend == BackendGlacier || backend == BackendS3 || backend == BackendDirectory
+}
+
+// StorageSettings are passed into every storage backend. They must not be changed after the first backend is
+// created, so that all backends of a client use the same settings.
+type StorageSettings struct {
+	// Location is the region and the account for new backups and for all operations which are not related to an
+	// existing backup
+	Location AWSLocation
+	// AssumeRole is the role which is assumed by the AWS clients
+	AssumeRole  AssumeRole
+	RetryPolicy RetryPolicy
+	// GlacierEndpoint replaces the endpoint of glacier (for example by a fake glacier server)
+	GlacierEndpoint string
+	// S3Endpoint replaces the endpoint of S3 (for example by a MinIO server)
+	S3Endpoint string
+	// BandwidthLimiter limits the uploads and downloads of all backends. nil means no limit.
+	BandwidthLimiter *BandwidthLimiter
+	// RetrievalDelays are the simulated durations of the retrieval jobs of the directory backend by their tier.
+	// The empty tier stands for all tiers without an own delay. Default: no delay
+	RetrievalDelays map[string]time.Duration
+
+	// accountId caches the account of the credentials, because it does not change
+	accountId    string
+	accountMutex sync.Mutex
+}
+
+// NewStorageSettings creates the settings for the default location without a role, endpoints and limits
+func NewStorageSettings() *StorageSettings {
+	return &StorageSettings{
+		RetryPolicy:     DefaultRetryPolicy(),
+		RetrievalDelays: map[string]time.Duration{},
+	}
+}
+
+// NewStorageBackend creates a storage backend of the given type for the given region and account. An empty type
+// stands for glacier, because all backups which are created before the introduction of the storage backends are
+// stored in glacier. The location will be ignored by the directory backend.
+func NewStorageBackend(backend string, location AWSLocation, settings *StorageSettings) (StorageBackend, error) {
+	switch backend {
+	case "", BackendGlacier:
+		return NewAWSGlacierAt(location, settings)
+	case BackendS3:
+		return NewS3BackendAt(location, settings)
+	case BackendDirectory:
+		return NewDirectoryBackend(settings)
+	}
+
+	return nil, errors.Errorf("Unknown storage backend: %s", backend)
+}
+
+// NewStorageFactory returns the StorageFactory which creates the storage backends with the given settings
+func NewStorageFactory(settings *StorageSettings) StorageFactory {
+	return func(backend string, location AWSLocation) (StorageBackend, error) {
+		return NewStorageBackend(backend, location, settings)
+	}
+}
+
+// isAWSBackend returns true if the backend is located in a region of AWS
+func isAWSBackend(backend string) bool {
+	return backend == "" || backend == BackendGlacier || backend == BackendS3
+}
+
+// isGlacierBackup returns true if the backup is stored in a glacier vault of the given location (and not in a
+// bucket or in a vault with the same name in another region or account). The location has to be resolved by
+// StorageSettings.ResolveLocation.
+func isGlacierBackup(dbBackup *model.Backup, location AWSLocation) bool {
+	if dbBackup.Backend != "" && dbBackup.Backend != BackendGlacier {
+		return false
+	}
+
+	return locationOf(dbBackup, location) == location
+}
+
+// isGlacierReplica returns true if the replica is stored in a glacier vault of the given location. The location
+// has to be resolved by StorageSettings.ResolveLocation.
+func isGlacierReplica(dbReplica *model.Replica, location AWSLocation) bool {
+	if dbReplica.Backend != "" && dbReplica.Backend != BackendGlacier {
+		return false
+	}
+
+	return locationOf(&model.Backup{Region: dbReplica.Region, AccountId: dbReplica.AccountId}, location) == location
+}
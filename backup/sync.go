@@ -0,0 +1,269 @@
+package backup
+
+import (
+	"backup2glacier/database"
+	"backup2glacier/database/model"
+	. "backup2glacier/log"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/pkg/errors"
+	"io"
+	"time"
+)
+
+// SyncReport contains all differences between the catalog and the inventory of a vault
+type SyncReport struct {
+	Vault         string
+	InventoryDate time.Time
+	// Unknown are the archives of the vault which have no catalog entry
+	Unknown []model.InventoryArchive
+	// Missing are the catalog entries whose archive is not in the vault
+	Missing []SyncMissing
+	// Mismatches are the catalog entries whose archive differs in size or checksum
+	Mismatches []SyncMismatch
+}
+
+type SyncMissing struct {
+	Backup *model.Backup
+	Volume model.Volume
+}
+
+type SyncMismatch struct {
+	Backup  *model.Backup
+	Volume  model.Volume
+	Archive model.InventoryArchive
+	Reason  string
+}
+
+type VaultSyncer interface {
+	io.Closer
+
+	// Sync compares the catalog with the inventory of the vault. If cached is true, the last cached inventory
+	// will be used. Otherwise a new inventory will be retrieved (which can take several hours) and cached.
+	Sync(vault string, cached bool) (*SyncReport, error)
+	// Adopt creates a catalog entry for the given archive
+	Adopt(vault string, archive model.InventoryArchive) *model.Backup
+	// Prune removes the catalog entry of the given missing archive
+	Prune(missing SyncMissing)
+}
+
+type vaultSyncer struct {
+	dbRepository database.Repository
+	glacier      AWSGlacier
+	settings     *StorageSettings
+	pollInterval time.Duration
+	tier         string
+}
+
+func NewVaultSyncer(pollInterval time.Duration, settings *StorageSettings, dbUrl string) (VaultSyncer, error) {
+	return NewVaultSyncerForRepository(pollInterval, settings, database.NewRepository(dbUrl))
+}
+
+func NewVaultSyncerForRepository(pollInterval time.Duration, settings *StorageSettings, dbRepo database.Repository) (VaultSyncer, error) {
+	g, err := NewAWSGlacier(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	return &vaultSyncer{
+		dbRepository: dbRepo,
+		glacier:      g,
+		settings:     settings,
+		pollInterval: pollInterval,
+	}, nil
+}
+
+func (v *vaultSyncer) Close() error {
+	return v.dbRepository.Close()
+}
+
+func (v *vaultSyncer) Sync(vault string, cached bool) (*SyncReport, error) {
+	inventory, err := v.inventory(vault, cached)
+	if err != nil {
+		return nil, err
+	}
+
+	return v.reconcile(inventory)
+}
+
+// inventory returns the last cached inventory of the vault or retrieves (and caches) a new one
+func (v *vaultSyncer) inventory(vault string, cached bool) (*model.Inventory, error) {
+	var inventory *model.Inventory
+
+	if cached {
+		inventory = v.dbRepository.GetLastInventory(vault)
+		if inventory == nil {
+			return nil, errors.Errorf("There is no cached inventory of the vault %s", vault)
+		}
+		LogInfo("Use cached inventory of %s", inventory.InventoryDate.Format(time.RFC3339))
+	} else {
+		vaultInventory, err := v.glacier.Inventory(AWSGlacierInventory{
+			VaultName:    vault,
+			PollInterval: v.pollInterval,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "Could not retrieve the inventory")
+		}
+
+		inventory = toInventoryModel(vault, vaultInventory)
+		v.dbRepository.SaveInventory(inventory)
+	}
+
+	return inventory, nil
+}
+
+func toInventoryModel(vault string, vaultInventory *VaultInventory) *model.Inventory {
+	inventory := &model.Inventory{
+		Vault:         vault,
+		InventoryDate: vaultInventory.InventoryDate,
+	}
+	for _, archive := range vaultInventory.ArchiveList {
+		inventory.Archives = append(inventory.Archives, model.InventoryArchive{
+			ArchiveId:    archive.ArchiveId,
+			Description:  archive.ArchiveDescription,
+			CreationDate: archive.CreationDate,
+			Size:         archive.Size,
+			Checksum:     archive.SHA256TreeHash,
+		})
+	}
+
+	return inventory
+}
+
+// reconcile compares the catalog entries of the vault with the given inventory
+func (v *vaultSyncer) reconcile(inventory *model.Inventory) (*SyncReport, error) {
+	report := &SyncReport{
+		Vault:         inventory.Vault,
+		InventoryDate: inventory.InventoryDate,
+	}
+
+	archives := map[string]model.InventoryArchive{}
+	for _, archive := range inventory.Archives {
+		archives[archive.ArchiveId] = archive
+	}
+
+	var backups []*model.Backup
+	location, err := v.settings.ResolveLocation()
+	if err != nil {
+		return nil, err
+	}
+	iter := v.dbRepository.GetByVault(inventory.Vault)
+	for {
+		backup, next := iter.Next()
+		if !next {
+			break
+		}
+		if isGlacierBackup(backup, location) {
+			backups = append(backups, backup)
+		}
+	}
+	iter.Close()
+
+	seen := map[string]bool{}
+	for _, backup := range backups {
+		for _, volume := range v.dbRepository.GetVolumesByBackupId(backup.ID) {
+			if volume.ArchiveId == nil {
+				continue
+			}
+
+			archive, exists := archives[*volume.ArchiveId]
+			if !exists {
+				//glacier updates the inventory only once a day: so newer archives can not be in it
+				if backup.CreatedAt.Before(inventory.InventoryDate) {
+					report.Missing = append(report.Missing, SyncMissing{Backup: backup, Volume: volume})
+				}
+				continue
+			}
+			seen[archive.ArchiveId] = true
+
+			if archive.Size != volume.Length {
+				report.Mismatches = append(report.Mismatches, SyncMismatch{
+					Backup: backup, Volume: volume, Archive: archive, Reason: "size differs",
+				})
+			} else if volume.Checksum != nil && *volume.Checksum != archive.Checksum {
+				report.Mismatches = append(report.Mismatches, SyncMismatch{
+					Backup: backup, Volume: volume, Archive: archive, Reason: "checksum differs",
+				})
+			}
+		}
+	}
+
+	//the replicas of other backups are not unknown
+	for _, replica := range v.dbRepository.GetReplicasByVault(inventory.Vault) {
+		if replica.ArchiveId != nil {
+			seen[*replica.ArchiveId] = true
+		}
+	}
+
+	for _, archive := range inventory.Archives {
+		//the catalog snapshots are managed by the catalog backup
+		if _, isCatalog := ParseCatalogDescription(archive.Description); isCatalog {
+			continue
+		}
+		if !seen[archive.ArchiveId] {
+			report.Unknown = append(report.Unknown, archive)
+		}
+	}
+
+	return report, nil
+}
+
+func (v *vaultSyncer) Adopt(vault string, archive model.InventoryArchive) *model.Backup {
+	description := archive.Description
+	if metadata, ok := ParseArchiveDescription(archive.Description); ok {
+		description = metadata.Description
+	}
+
+	dbBackup := &model.Backup{
+		Vault:       vault,
+		Description: description,
+		ArchiveId:   aws.String(archive.ArchiveId),
+		Checksum:    aws.String(archive.Checksum),
+		Length:      archive.Size,
+	}
+	dbBackup.CreatedAt = archive.CreationDate
+	saveNewBackup(v.dbRepository, dbBackup, model.BackupStatusCompleted)
+
+	v.dbRepository.SaveVolume(dbBackup, &model.Volume{
+		Number:    1,
+		ArchiveId: aws.String(archive.ArchiveId),
+		Checksum:  aws.String(archive.Checksum),
+		Length:    archive.Size,
+	})
+	LogInfo("Adopted archive %s as backup %d", archive.ArchiveId, dbBackup.ID)
+
+	return dbBackup
+}
+
+func (v *vaultSyncer) Prune(missing SyncMissing) {
+	volumes := v.dbRepository.GetVolumesByBackupId(missing.Backup.ID)
+
+	if len(volumes) <= 1 {
+		//the archive is already gone: the backup is deleted
+		dbBackup := v.dbRepository.GetBackupById(missing.Backup.ID)
+		dbBackup.Error = "The archive is missing in the vault"
+		for _, status := range []string{model.BackupStatusDeleting, model.BackupStatusDeleted} {
+			if err := saveStatus(v.dbRepository, dbBackup, status); err != nil {
+				LogError("%v", err)
+			}
+		}
+		v.dbRepository.DeleteBackupById(missing.Backup.ID)
+		LogInfo("Removed backup %d from the catalog", missing.Backup.ID)
+		return
+	}
+
+	//the other volumes of the backup are still there
+	volume := missing.Volume
+	volume.ArchiveId = nil
+	volume.Error = "The archive is missing in the vault"
+	v.dbRepository.UpdateVolume(&volume)
+	LogInfo("Removed volume %d of backup %d from the catalog", volume.Number, missing.Backup.ID)
+
+	dbBackup := v.dbRepository.GetBackupById(missing.Backup.ID)
+	if dbBackup.IsUploaded() {
+		//the backup can be resumed to upload the volume again
+		dbBackup.Error = volume.Error
+		if err := saveStatus(v.dbRepository, dbBackup, model.BackupStatusFailed); err != nil {
+			LogError("%v", err)
+		}
+	}
+}
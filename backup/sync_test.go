@@ -0,0 +1,126 @@
+package backup
+
+import (
+	"backup2glacier/database/model"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func (f *fakeAWSGlacier) Inventory(inventory AWSGlacierInventory) (*VaultInventory, error) {
+	return f.inventory, nil
+}
+
+func newSyncTestSyncer(t *testing.T) (*vaultSyncer, *fakeAWSGlacier, func()) {
+	dbRepository, fake, _, cleanup := newTestFixture(t, "sync")
+
+	return &vaultSyncer{dbRepository: dbRepository, glacier: fake, settings: NewStorageSettings()}, fake, cleanup
+}
+
+func saveSyncTestBackup(syncer *vaultSyncer, archiveId string, length int64, checksum string) *model.Backup {
+	dbBackup := &model.Backup{Vault: "vault", Length: length}
+	syncer.dbRepository.SaveBackup(dbBackup)
+	syncer.dbRepository.SaveVolume(dbBackup, &model.Volume{
+		Number:    1,
+		ArchiveId: aws.String(archiveId),
+		Checksum:  aws.String(checksum),
+		Length:    length,
+	})
+
+	return dbBackup
+}
+
+func TestVaultSyncer_Sync(t *testing.T) {
+	//given
+	syncer, fake, cleanup := newSyncTestSyncer(t)
+	defer cleanup()
+
+	saveSyncTestBackup(syncer, "in-sync", 100, "aaaa")
+	saveSyncTestBackup(syncer, "other-size", 100, "bbbb")
+	saveSyncTestBackup(syncer, "other-checksum", 100, "cccc")
+	missing := saveSyncTestBackup(syncer, "missing", 100, "dddd")
+
+	fake.inventory = &VaultInventory{
+		InventoryDate: time.Now().Add(time.Minute),
+		ArchiveList: []InventoryArchive{
+			{ArchiveId: "in-sync", Size: 100, SHA256TreeHash: "aaaa"},
+			{ArchiveId: "other-size", Size: 200, SHA256TreeHash: "bbbb"},
+			{ArchiveId: "other-checksum", Size: 100, SHA256TreeHash: "ffff"},
+			{ArchiveId: "unknown", Size: 300, SHA256TreeHash: "eeee", ArchiveDescription: "from an other machine"},
+			{ArchiveId: "catalog", Size: 400, ArchiveDescription: (&CatalogMetadata{Format: CatalogFormatVersion}).ArchiveDescription()},
+		},
+	}
+
+	//when
+	report, err := syncer.Sync("vault", false)
+
+	//then
+	assert.NoError(t, err)
+	assert.Len(t, report.Unknown, 1)
+	assert.Equal(t, "unknown", report.Unknown[0].ArchiveId)
+	assert.Len(t, report.Missing, 1)
+	assert.Equal(t, missing.ID, report.Missing[0].Backup.ID)
+	assert.Len(t, report.Mismatches, 2)
+	assert.Equal(t, "size differs", report.Mismatches[0].Reason)
+	assert.Equal(t, "checksum differs", report.Mismatches[1].Reason)
+
+	//the inventory is cached
+	cachedReport, err := syncer.Sync("vault", true)
+	assert.NoError(t, err)
+	assert.Equal(t, report.Unknown, cachedReport.Unknown)
+	assert.Len(t, cachedReport.Missing, 1)
+}
+
+func TestVaultSyncer_Sync_NewerThanInventory(t *testing.T) {
+	syncer, fake, cleanup := newSyncTestSyncer(t)
+	defer cleanup()
+
+	saveSyncTestBackup(syncer, "new", 100, "aaaa")
+	fake.inventory = &VaultInventory{InventoryDate: time.Now().Add(-time.Hour)}
+
+	report, err := syncer.Sync("vault", false)
+
+	assert.NoError(t, err)
+	assert.Empty(t, report.Missing)
+}
+
+func TestVaultSyncer_Sync_NoCachedInventory(t *testing.T) {
+	syncer, _, cleanup := newSyncTestSyncer(t)
+	defer cleanup()
+
+	_, err := syncer.Sync("vault", true)
+
+	assert.Error(t, err)
+}
+
+func TestVaultSyncer_AdoptAndPrune(t *testing.T) {
+	syncer, fake, cleanup := newSyncTestSyncer(t)
+	defer cleanup()
+
+	saveSyncTestBackup(syncer, "missing", 100, "dddd")
+	fake.inventory = &VaultInventory{
+		InventoryDate: time.Now().Add(time.Minute),
+		ArchiveList: []InventoryArchive{
+			{ArchiveId: "unknown", Size: 300, SHA256TreeHash: "eeee", CreationDate: time.Now().Add(-time.Hour)},
+		},
+	}
+	report, err := syncer.Sync("vault", false)
+	assert.NoError(t, err)
+
+	//when
+	adopted := syncer.Adopt("vault", report.Unknown[0])
+	syncer.Prune(report.Missing[0])
+
+	//then
+	report, err = syncer.Sync("vault", true)
+	assert.NoError(t, err)
+	assert.Empty(t, report.Unknown)
+	assert.Empty(t, report.Missing)
+	assert.Empty(t, report.Mismatches)
+
+	volumes := syncer.dbRepository.GetVolumesByBackupId(adopted.ID)
+	assert.Len(t, volumes, 1)
+	assert.Equal(t, "unknown", *volumes[0].ArchiveId)
+	assert.Equal(t, int64(300), volumes[0].Length)
+}
@@ -0,0 +1,61 @@
+package backup
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"github.com/aws/aws-sdk-go/service/glacier"
+	"hash"
+)
+
+const treeHashChunkSize = 1024 * 1024
+
+// TreeHashWriter calculates the SHA256 tree hash (as glacier does) of all written data
+type TreeHashWriter struct {
+	hashes  [][]byte
+	current hash.Hash
+	written int
+}
+
+func NewTreeHashWriter() *TreeHashWriter {
+	return &TreeHashWriter{
+		current: sha256.New(),
+	}
+}
+
+func (t *TreeHashWriter) Write(p []byte) (int, error) {
+	total := len(p)
+
+	for len(p) > 0 {
+		n := treeHashChunkSize - t.written
+		if n > len(p) {
+			n = len(p)
+		}
+
+		t.current.Write(p[:n])
+		t.written += n
+		p = p[n:]
+
+		if t.written == treeHashChunkSize {
+			t.hashes = append(t.hashes, t.current.Sum(nil))
+			t.current.Reset()
+			t.written = 0
+		}
+	}
+
+	return total, nil
+}
+
+// TreeHash returns the tree hash of all data written so far
+func (t *TreeHashWriter) TreeHash() []byte {
+	hashes := t.hashes
+	if t.written > 0 || len(hashes) == 0 {
+		hashes = append(hashes[:len(hashes):len(hashes)], t.current.Sum(nil))
+	}
+
+	return glacier.ComputeTreeHash(hashes)
+}
+
+// HexTreeHash returns the tree hash of all data written so far as hex string
+func (t *TreeHashWriter) HexTreeHash() string {
+	return fmt.Sprintf("%x", t.TreeHash())
+}
@@ -0,0 +1,40 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"github.com/aws/aws-sdk-go/service/glacier"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"testing"
+)
+
+func TestTreeHashWriter(t *testing.T) {
+	for _, size := range []int{1, 1024, treeHashChunkSize - 1, treeHashChunkSize, treeHashChunkSize + 1, 3*treeHashChunkSize + 17} {
+		t.Run(fmt.Sprintf("%d", size), func(t *testing.T) {
+			data := make([]byte, size)
+			rand.Read(data)
+
+			toTest := NewTreeHashWriter()
+
+			//write in odd chunks
+			for rest := data; len(rest) > 0; {
+				n := 4711
+				if n > len(rest) {
+					n = len(rest)
+				}
+				toTest.Write(rest[:n])
+				rest = rest[n:]
+			}
+
+			assert.Equal(t, glacier.ComputeHashes(bytes.NewReader(data)).TreeHash, toTest.TreeHash())
+		})
+	}
+}
+
+func TestTreeHashWriter_Empty(t *testing.T) {
+	expected := sha256.Sum256(nil)
+
+	assert.Equal(t, fmt.Sprintf("%x", expected), NewTreeHashWriter().HexTreeHash())
+}
@@ -0,0 +1,330 @@
+package backup
+
+import (
+	"backup2glacier/database"
+	"backup2glacier/database/model"
+	. "backup2glacier/log"
+	"context"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/glacier"
+	"github.com/pkg/errors"
+	"io"
+	"time"
+)
+
+// ErrVaultNotFound will be returned if a vault does not exist
+var ErrVaultNotFound = errors.New("The vault does not exist")
+
+type AWSGlacierVault struct {
+	VaultName    string
+	VaultARN     string
+	CreationDate *time.Time
+	// LastInventoryDate is the date of the last inventory which glacier has taken (about once a day)
+	LastInventoryDate *time.Time
+	NumberOfArchives  int64
+	SizeInBytes       int64
+}
+
+// VaultInfo contains the information of glacier about a vault and the information of the catalog
+type VaultInfo struct {
+	AWSGlacierVault
+
+	// LiveBackups is the number of backups in the catalog which are stored in the vault
+	LiveBackups int
+	// CachedInventoryDate is the date of the last inventory which is cached in the catalog
+	CachedInventoryDate *time.Time
+}
+
+type VaultManager interface {
+	io.Closer
+
+	Create(vaultName string) error
+	List() ([]*VaultInfo, error)
+	Describe(vaultName string) (*VaultInfo, error)
+	// Delete deletes the vault. It refuses if the catalog has live backups in the vault.
+	Delete(vaultName string) error
+	// EnsureVault creates the vault if it does not exist yet
+	EnsureVault(vaultName string) error
+
+	Tags(vaultName string) (map[string]string, error)
+	Tag(vaultName string, tags map[string]string) error
+	Untag(vaultName string, keys []string) error
+	// Policy returns the access policy of the vault or an empty string if there is none
+	Policy(vaultName string) (string, error)
+	SetPolicy(vaultName, policy string) error
+	DeletePolicy(vaultName string) error
+	// Notifications returns the notification configuration of the vault or nil if there is none
+	Notifications(vaultName string) (*AWSGlacierNotifications, error)
+	SetNotifications(vaultName string, notifications AWSGlacierNotifications) error
+	DeleteNotifications(vaultName string) error
+
+	// InitiateLock installs the lock policy in the vault. The lock must be completed within 24 hours.
+	InitiateLock(vaultName, policy string) (*model.VaultLock, error)
+	// LockStatus returns the lock of the vault after it was reconciled with glacier or nil if there is none
+	LockStatus(vaultName string) (*model.VaultLock, error)
+	// CompleteLock completes the initiated lock. After that the lock policy can not be changed anymore!
+	CompleteLock(vaultName string) (*model.VaultLock, error)
+	// AbortLock aborts the initiated lock and removes the lock policy from the vault
+	AbortLock(vaultName string) error
+}
+
+type vaultManager struct {
+	dbRepository database.Repository
+	glacier      AWSGlacier
+	settings     *StorageSettings
+}
+
+func NewVaultManager(settings *StorageSettings, dbUrl string) (VaultManager, error) {
+	return NewVaultManagerForRepository(settings, database.NewRepository(dbUrl))
+}
+
+func NewVaultManagerForRepository(settings *StorageSettings, dbRepo database.Repository) (VaultManager, error) {
+	g, err := NewAWSGlacier(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	return &vaultManager{
+		dbRepository: dbRepo,
+		glacier:      g,
+		settings:     settings,
+	}, nil
+}
+
+func (v *vaultManager) Close() error {
+	return v.dbRepository.Close()
+}
+
+func (v *vaultManager) Create(vaultName string) error {
+	if err := v.glacier.CreateVault(vaultName); err != nil {
+		return err
+	}
+	LogInfo("Created vault %s", vaultName)
+
+	return nil
+}
+
+func (v *vaultManager) List() ([]*VaultInfo, error) {
+	vaults, err := v.glacier.ListVaults()
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]*VaultInfo, 0, len(vaults))
+	for _, vault := range vaults {
+		info, err := v.vaultInfo(vault)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+
+	return infos, nil
+}
+
+func (v *vaultManager) Describe(vaultName string) (*VaultInfo, error) {
+	vault, err := v.glacier.DescribeVault(vaultName)
+	if err != nil {
+		return nil, err
+	}
+
+	return v.vaultInfo(vault)
+}
+
+func (v *vaultManager) vaultInfo(vault *AWSGlacierVault) (*VaultInfo, error) {
+	count, err := v.countBackups(vault.VaultName)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &VaultInfo{
+		AWSGlacierVault: *vault,
+		LiveBackups:     count,
+	}
+	if inventory := v.dbRepository.GetLastInventory(vault.VaultName); inventory != nil {
+		info.CachedInventoryDate = &inventory.InventoryDate
+	}
+
+	return info, nil
+}
+
+// countBackups returns the number of backups which have a volume or a replica in the given vault
+func (v *vaultManager) countBackups(vaultName string) (int, error) {
+	backupIds := map[uint]bool{}
+
+	location, err := v.settings.ResolveLocation()
+	if err != nil {
+		return 0, err
+	}
+	iter := v.dbRepository.GetByVault(vaultName)
+	defer iter.Close()
+	for {
+		backup, next := iter.Next()
+		if !next {
+			break
+		}
+		if isGlacierBackup(backup, location) {
+			backupIds[backup.ID] = true
+		}
+	}
+	for _, replica := range v.dbRepository.GetReplicasByVault(vaultName) {
+		if replica.ArchiveId != nil && isGlacierReplica(&replica, location) {
+			backupIds[replica.BackupID] = true
+		}
+	}
+
+	return len(backupIds), nil
+}
+
+func (v *vaultManager) Delete(vaultName string) error {
+	count, err := v.countBackups(vaultName)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.Errorf("The catalog has still %d backup(s) in the vault %s. Delete them at first.", count, vaultName)
+	}
+
+	if err := v.glacier.DeleteVault(vaultName); err != nil {
+		return err
+	}
+	LogInfo("Deleted vault %s", vaultName)
+
+	return nil
+}
+
+func (v *vaultManager) EnsureVault(vaultName string) error {
+	_, err := v.glacier.DescribeVault(vaultName)
+	if err == ErrVaultNotFound {
+		return v.Create(vaultName)
+	}
+
+	return err
+}
+
+func (a *awsGlacier) CreateVault(vaultName string) error {
+	request := &glacier.CreateVaultInput{
+		AccountId: a.accountId(),
+		VaultName: aws.String(vaultName),
+	}
+	LogDebug("Send CreateVault: %+v", request)
+
+	err := a.retryer.do(context.Background(), "CreateVault", func() error {
+		_, err := a.glacier.CreateVault(request)
+		return err
+	})
+	if err != nil {
+		return errors.Wrap(err, "Could not create vault")
+	}
+
+	return nil
+}
+
+func (a *awsGlacier) ListVaults() ([]*AWSGlacierVault, error) {
+	var vaults []*AWSGlacierVault
+
+	request := &glacier.ListVaultsInput{
+		AccountId: a.accountId(),
+	}
+	for {
+		LogDebug("Send ListVaults: %+v", request)
+
+		var result *glacier.ListVaultsOutput
+		err := a.retryer.do(context.Background(), "ListVaults", func() (err error) {
+			result, err = a.glacier.ListVaults(request)
+			return err
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "Could not list vaults")
+		}
+
+		for _, vault := range result.VaultList {
+			converted, err := toVault(vault)
+			if err != nil {
+				return nil, err
+			}
+			vaults = append(vaults, converted)
+		}
+
+		if result.Marker == nil {
+			return vaults, nil
+		}
+		request.Marker = result.Marker
+	}
+}
+
+func (a *awsGlacier) DescribeVault(vaultName string) (*AWSGlacierVault, error) {
+	request := &glacier.DescribeVaultInput{
+		AccountId: a.accountId(),
+		VaultName: aws.String(vaultName),
+	}
+	LogDebug("Send DescribeVault: %+v", request)
+
+	var result *glacier.DescribeVaultOutput
+	err := a.retryer.do(context.Background(), "DescribeVault", func() (err error) {
+		result, err = a.glacier.DescribeVault(request)
+		return err
+	})
+	if isNotFound(err) {
+		return nil, ErrVaultNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not describe vault")
+	}
+
+	return toVault(result)
+}
+
+func (a *awsGlacier) DeleteVault(vaultName string) error {
+	request := &glacier.DeleteVaultInput{
+		AccountId: a.accountId(),
+		VaultName: aws.String(vaultName),
+	}
+	LogDebug("Send DeleteVault: %+v", request)
+
+	err := a.retryer.do(context.Background(), "DeleteVault", func() error {
+		_, err := a.glacier.DeleteVault(request)
+		return err
+	})
+	if isNotFound(err) {
+		return ErrVaultNotFound
+	}
+	if err != nil {
+		//glacier refuses to delete a vault which contained archives at the last inventory
+		return errors.Wrap(err, "Could not delete vault")
+	}
+
+	return nil
+}
+
+func toVault(vault *glacier.DescribeVaultOutput) (*AWSGlacierVault, error) {
+	converted := &AWSGlacierVault{
+		VaultName:        aws.StringValue(vault.VaultName),
+		VaultARN:         aws.StringValue(vault.VaultARN),
+		NumberOfArchives: aws.Int64Value(vault.NumberOfArchives),
+		SizeInBytes:      aws.Int64Value(vault.SizeInBytes),
+	}
+
+	var err error
+	if converted.CreationDate, err = parseDate(vault.CreationDate); err != nil {
+		return nil, errors.Wrapf(err, "Invalid creation date of vault %s", converted.VaultName)
+	}
+	if converted.LastInventoryDate, err = parseDate(vault.LastInventoryDate); err != nil {
+		return nil, errors.Wrapf(err, "Invalid inventory date of vault %s", converted.VaultName)
+	}
+
+	return converted, nil
+}
+
+func parseDate(date *string) (*time.Time, error) {
+	if date == nil {
+		return nil, nil
+	}
+
+	parsed, err := time.Parse(time.RFC3339, *date)
+	if err != nil {
+		return nil, err
+	}
+
+	return &parsed, nil
+}
@@ -0,0 +1,461 @@
+package backup
+
+import (
+	"backup2glacier/database/model"
+	. "backup2glacier/log"
+	"context"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/glacier"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// VaultLockDuration is the time in which an initiated vault lock must be completed. Otherwise glacier aborts it.
+const VaultLockDuration = 24 * time.Hour
+
+// The events of a vault for which glacier can send notifications
+const (
+	EventArchiveRetrievalCompleted   = "ArchiveRetrievalCompleted"
+	EventInventoryRetrievalCompleted = "InventoryRetrievalCompleted"
+)
+
+type AWSGlacierNotifications struct {
+	SNSTopic string
+	Events   []string
+}
+
+type AWSGlacierVaultLock struct {
+	Policy string
+	// State is either InProgress or Locked
+	State          string
+	CreationDate   *time.Time
+	ExpirationDate *time.Time
+}
+
+func (v *vaultManager) Tags(vaultName string) (map[string]string, error) {
+	return v.glacier.GetVaultTags(vaultName)
+}
+
+func (v *vaultManager) Tag(vaultName string, tags map[string]string) error {
+	if err := v.glacier.AddVaultTags(vaultName, tags); err != nil {
+		return err
+	}
+	LogInfo("Added %d tag(s) to vault %s", len(tags), vaultName)
+
+	return nil
+}
+
+func (v *vaultManager) Untag(vaultName string, keys []string) error {
+	if err := v.glacier.RemoveVaultTags(vaultName, keys); err != nil {
+		return err
+	}
+	LogInfo("Removed %d tag(s) from vault %s", len(keys), vaultName)
+
+	return nil
+}
+
+func (v *vaultManager) Policy(vaultName string) (string, error) {
+	return v.glacier.GetVaultAccessPolicy(vaultName)
+}
+
+func (v *vaultManager) SetPolicy(vaultName, policy string) error {
+	if err := v.glacier.SetVaultAccessPolicy(vaultName, policy); err != nil {
+		return err
+	}
+	LogInfo("Set access policy of vault %s", vaultName)
+
+	return nil
+}
+
+func (v *vaultManager) DeletePolicy(vaultName string) error {
+	if err := v.glacier.DeleteVaultAccessPolicy(vaultName); err != nil {
+		return err
+	}
+	LogInfo("Deleted access policy of vault %s", vaultName)
+
+	return nil
+}
+
+func (v *vaultManager) Notifications(vaultName string) (*AWSGlacierNotifications, error) {
+	return v.glacier.GetVaultNotifications(vaultName)
+}
+
+func (v *vaultManager) SetNotifications(vaultName string, notifications AWSGlacierNotifications) error {
+	if err := v.glacier.SetVaultNotifications(vaultName, notifications); err != nil {
+		return err
+	}
+	LogInfo("Set notifications of vault %s to %s", vaultName, notifications.SNSTopic)
+
+	return nil
+}
+
+func (v *vaultManager) DeleteNotifications(vaultName string) error {
+	if err := v.glacier.DeleteVaultNotifications(vaultName); err != nil {
+		return err
+	}
+	LogInfo("Deleted notifications of vault %s", vaultName)
+
+	return nil
+}
+
+func (v *vaultManager) InitiateLock(vaultName, policy string) (*model.VaultLock, error) {
+	lock, err := v.LockStatus(vaultName)
+	if err != nil {
+		return nil, err
+	}
+	if lock != nil {
+		switch lock.State {
+		case model.VaultLockStateLocked:
+			return nil, errors.Errorf("The vault %s is already locked", vaultName)
+		case model.VaultLockStateInProgress:
+			return nil, errors.Errorf("There is already a lock in progress for vault %s. Complete or abort it at first.", vaultName)
+		}
+	}
+
+	lockId, err := v.glacier.InitiateVaultLock(vaultName, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	lock = &model.VaultLock{
+		Vault:          vaultName,
+		LockId:         lockId,
+		State:          model.VaultLockStateInProgress,
+		Policy:         policy,
+		ExpirationDate: time.Now().Add(VaultLockDuration),
+	}
+	v.dbRepository.SaveVaultLock(lock)
+	LogInfo("Initiated lock of vault %s. It must be completed until %s", vaultName, lock.ExpirationDate.Format(time.RFC3339))
+
+	//take the expiration date of glacier
+	return v.LockStatus(vaultName)
+}
+
+func (v *vaultManager) LockStatus(vaultName string) (*model.VaultLock, error) {
+	remote, err := v.glacier.GetVaultLock(vaultName)
+	if err != nil {
+		return nil, err
+	}
+	lock := v.dbRepository.GetVaultLock(vaultName)
+
+	if remote == nil {
+		if lock != nil && lock.State == model.VaultLockStateInProgress {
+			//glacier forgets locks which are aborted or not completed in time
+			if time.Now().After(lock.ExpirationDate) {
+				lock.State = model.VaultLockStateExpired
+			} else {
+				lock.State = model.VaultLockStateAborted
+			}
+			v.dbRepository.UpdateVaultLock(lock)
+		}
+		return lock, nil
+	}
+
+	if lock == nil || lock.State == model.VaultLockStateAborted || lock.State == model.VaultLockStateExpired {
+		//the lock was initiated outside of backup2glacier so we don't know its lock id
+		lock = &model.VaultLock{Vault: vaultName}
+	}
+	lock.State = remote.State
+	lock.Policy = remote.Policy
+	if remote.ExpirationDate != nil {
+		lock.ExpirationDate = *remote.ExpirationDate
+	}
+
+	if lock.ID == 0 {
+		v.dbRepository.SaveVaultLock(lock)
+	} else {
+		v.dbRepository.UpdateVaultLock(lock)
+	}
+
+	return lock, nil
+}
+
+func (v *vaultManager) CompleteLock(vaultName string) (*model.VaultLock, error) {
+	lock, err := v.LockStatus(vaultName)
+	if err != nil {
+		return nil, err
+	}
+	if lock == nil || lock.State != model.VaultLockStateInProgress {
+		return nil, errors.Errorf("There is no lock in progress for vault %s", vaultName)
+	}
+	if lock.LockId == "" {
+		return nil, errors.Errorf("The lock of vault %s was not initiated by backup2glacier. Its lock id is unknown.", vaultName)
+	}
+
+	if err := v.glacier.CompleteVaultLock(vaultName, lock.LockId); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	lock.State = model.VaultLockStateLocked
+	lock.CompletedAt = &now
+	v.dbRepository.UpdateVaultLock(lock)
+	LogInfo("Completed lock of vault %s", vaultName)
+
+	return lock, nil
+}
+
+func (v *vaultManager) AbortLock(vaultName string) error {
+	if err := v.glacier.AbortVaultLock(vaultName); err != nil {
+		return err
+	}
+
+	if lock := v.dbRepository.GetVaultLock(vaultName); lock != nil && lock.State == model.VaultLockStateInProgress {
+		lock.State = model.VaultLockStateAborted
+		v.dbRepository.UpdateVaultLock(lock)
+	}
+	LogInfo("Aborted lock of vault %s", vaultName)
+
+	return nil
+}
+
+func (a *awsGlacier) GetVaultTags(vaultName string) (map[string]string, error) {
+	request := &glacier.ListTagsForVaultInput{
+		AccountId: a.accountId(),
+		VaultName: aws.String(vaultName),
+	}
+	LogDebug("Send ListTagsForVault: %+v", request)
+
+	var result *glacier.ListTagsForVaultOutput
+	err := a.retryer.do(context.Background(), "ListTagsForVault", func() (err error) {
+		result, err = a.glacier.ListTagsForVault(request)
+		return err
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not get tags of vault")
+	}
+
+	return aws.StringValueMap(result.Tags), nil
+}
+
+func (a *awsGlacier) AddVaultTags(vaultName string, tags map[string]string) error {
+	request := &glacier.AddTagsToVaultInput{
+		AccountId: a.accountId(),
+		VaultName: aws.String(vaultName),
+		Tags:      aws.StringMap(tags),
+	}
+	LogDebug("Send AddTagsToVault: %+v", request)
+
+	err := a.retryer.do(context.Background(), "AddTagsToVault", func() error {
+		_, err := a.glacier.AddTagsToVault(request)
+		return err
+	})
+	return errors.Wrap(err, "Could not add tags to vault")
+}
+
+func (a *awsGlacier) RemoveVaultTags(vaultName string, keys []string) error {
+	request := &glacier.RemoveTagsFromVaultInput{
+		AccountId: a.accountId(),
+		VaultName: aws.String(vaultName),
+		TagKeys:   aws.StringSlice(keys),
+	}
+	LogDebug("Send RemoveTagsFromVault: %+v", request)
+
+	err := a.retryer.do(context.Background(), "RemoveTagsFromVault", func() error {
+		_, err := a.glacier.RemoveTagsFromVault(request)
+		return err
+	})
+	return errors.Wrap(err, "Could not remove tags from vault")
+}
+
+func (a *awsGlacier) GetVaultAccessPolicy(vaultName string) (string, error) {
+	request := &glacier.GetVaultAccessPolicyInput{
+		AccountId: a.accountId(),
+		VaultName: aws.String(vaultName),
+	}
+	LogDebug("Send GetVaultAccessPolicy: %+v", request)
+
+	var result *glacier.GetVaultAccessPolicyOutput
+	err := a.retryer.do(context.Background(), "GetVaultAccessPolicy", func() (err error) {
+		result, err = a.glacier.GetVaultAccessPolicy(request)
+		return err
+	})
+	if isNotFound(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "Could not get access policy of vault")
+	}
+	if result.Policy == nil {
+		return "", nil
+	}
+
+	return aws.StringValue(result.Policy.Policy), nil
+}
+
+func (a *awsGlacier) SetVaultAccessPolicy(vaultName, policy string) error {
+	request := &glacier.SetVaultAccessPolicyInput{
+		AccountId: a.accountId(),
+		VaultName: aws.String(vaultName),
+		Policy:    &glacier.VaultAccessPolicy{Policy: aws.String(policy)},
+	}
+	LogDebug("Send SetVaultAccessPolicy: %+v", request)
+
+	err := a.retryer.do(context.Background(), "SetVaultAccessPolicy", func() error {
+		_, err := a.glacier.SetVaultAccessPolicy(request)
+		return err
+	})
+	return errors.Wrap(err, "Could not set access policy of vault")
+}
+
+func (a *awsGlacier) DeleteVaultAccessPolicy(vaultName string) error {
+	request := &glacier.DeleteVaultAccessPolicyInput{
+		AccountId: a.accountId(),
+		VaultName: aws.String(vaultName),
+	}
+	LogDebug("Send DeleteVaultAccessPolicy: %+v", request)
+
+	err := a.retryer.do(context.Background(), "DeleteVaultAccessPolicy", func() error {
+		_, err := a.glacier.DeleteVaultAccessPolicy(request)
+		return err
+	})
+	return errors.Wrap(err, "Could not delete access policy of vault")
+}
+
+func (a *awsGlacier) GetVaultNotifications(vaultName string) (*AWSGlacierNotifications, error) {
+	request := &glacier.GetVaultNotificationsInput{
+		AccountId: a.accountId(),
+		VaultName: aws.String(vaultName),
+	}
+	LogDebug("Send GetVaultNotifications: %+v", request)
+
+	var result *glacier.GetVaultNotificationsOutput
+	err := a.retryer.do(context.Background(), "GetVaultNotifications", func() (err error) {
+		result, err = a.glacier.GetVaultNotifications(request)
+		return err
+	})
+	if isNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not get notifications of vault")
+	}
+	if result.VaultNotificationConfig == nil {
+		return nil, nil
+	}
+
+	return &AWSGlacierNotifications{
+		SNSTopic: aws.StringValue(result.VaultNotificationConfig.SNSTopic),
+		Events:   aws.StringValueSlice(result.VaultNotificationConfig.Events),
+	}, nil
+}
+
+func (a *awsGlacier) SetVaultNotifications(vaultName string, notifications AWSGlacierNotifications) error {
+	request := &glacier.SetVaultNotificationsInput{
+		AccountId: a.accountId(),
+		VaultName: aws.String(vaultName),
+		VaultNotificationConfig: &glacier.VaultNotificationConfig{
+			SNSTopic: aws.String(notifications.SNSTopic),
+			Events:   aws.StringSlice(notifications.Events),
+		},
+	}
+	LogDebug("Send SetVaultNotifications: %+v", request)
+
+	err := a.retryer.do(context.Background(), "SetVaultNotifications", func() error {
+		_, err := a.glacier.SetVaultNotifications(request)
+		return err
+	})
+	return errors.Wrap(err, "Could not set notifications of vault")
+}
+
+func (a *awsGlacier) DeleteVaultNotifications(vaultName string) error {
+	request := &glacier.DeleteVaultNotificationsInput{
+		AccountId: a.accountId(),
+		VaultName: aws.String(vaultName),
+	}
+	LogDebug("Send DeleteVaultNotifications: %+v", request)
+
+	err := a.retryer.do(context.Background(), "DeleteVaultNotifications", func() error {
+		_, err := a.glacier.DeleteVaultNotifications(request)
+		return err
+	})
+	return errors.Wrap(err, "Could not delete notifications of vault")
+}
+
+func (a *awsGlacier) InitiateVaultLock(vaultName, policy string) (string, error) {
+	request := &glacier.InitiateVaultLockInput{
+		AccountId: a.accountId(),
+		VaultName: aws.String(vaultName),
+		Policy:    &glacier.VaultLockPolicy{Policy: aws.String(policy)},
+	}
+	LogDebug("Send InitiateVaultLock: %+v", request)
+
+	var result *glacier.InitiateVaultLockOutput
+	err := a.retryer.do(context.Background(), "InitiateVaultLock", func() (err error) {
+		result, err = a.glacier.InitiateVaultLock(request)
+		return err
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "Could not initiate vault lock")
+	}
+
+	return aws.StringValue(result.LockId), nil
+}
+
+func (a *awsGlacier) GetVaultLock(vaultName string) (*AWSGlacierVaultLock, error) {
+	request := &glacier.GetVaultLockInput{
+		AccountId: a.accountId(),
+		VaultName: aws.String(vaultName),
+	}
+	LogDebug("Send GetVaultLock: %+v", request)
+
+	var result *glacier.GetVaultLockOutput
+	err := a.retryer.do(context.Background(), "GetVaultLock", func() (err error) {
+		result, err = a.glacier.GetVaultLock(request)
+		return err
+	})
+	if isNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not get vault lock")
+	}
+
+	lock := &AWSGlacierVaultLock{
+		Policy: aws.StringValue(result.Policy),
+		State:  aws.StringValue(result.State),
+	}
+	if lock.CreationDate, err = parseDate(result.CreationDate); err != nil {
+		return nil, errors.Wrap(err, "Invalid creation date of vault lock")
+	}
+	if lock.ExpirationDate, err = parseDate(result.ExpirationDate); err != nil {
+		return nil, errors.Wrap(err, "Invalid expiration date of vault lock")
+	}
+
+	return lock, nil
+}
+
+func (a *awsGlacier) CompleteVaultLock(vaultName, lockId string) error {
+	request := &glacier.CompleteVaultLockInput{
+		AccountId: a.accountId(),
+		VaultName: aws.String(vaultName),
+		LockId:    aws.String(lockId),
+	}
+	LogDebug("Send CompleteVaultLock: %+v", request)
+
+	err := a.retryer.do(context.Background(), "CompleteVaultLock", func() error {
+		_, err := a.glacier.CompleteVaultLock(request)
+		return err
+	})
+	return errors.Wrap(err, "Could not complete vault lock")
+}
+
+func (a *awsGlacier) AbortVaultLock(vaultName string) error {
+	request := &glacier.AbortVaultLockInput{
+		AccountId: a.accountId(),
+		VaultName: aws.String(vaultName),
+	}
+	LogDebug("Send AbortVaultLock: %+v", request)
+
+	err := a.retryer.do(context.Background(), "AbortVaultLock", func() error {
+		_, err := a.glacier.AbortVaultLock(request)
+		return err
+	})
+	return errors.Wrap(err, "Could not abort vault lock")
+}
+
+func isNotFound(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == glacier.ErrCodeResourceNotFoundException
+}
@@ -0,0 +1,158 @@
+package backup
+
+import (
+	"backup2glacier/database/model"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/glacier"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func (f *fakeGlacierClient) GetVaultAccessPolicy(input *glacier.GetVaultAccessPolicyInput) (*glacier.GetVaultAccessPolicyOutput, error) {
+	return nil, awserr.New(glacier.ErrCodeResourceNotFoundException, "no policy", nil)
+}
+
+func (f *fakeGlacierClient) GetVaultLock(input *glacier.GetVaultLockInput) (*glacier.GetVaultLockOutput, error) {
+	return &glacier.GetVaultLockOutput{
+		Policy:         aws.String(`{"Version":"2012-10-17"}`),
+		State:          aws.String(model.VaultLockStateInProgress),
+		CreationDate:   aws.String("2019-05-01T12:30:00.000Z"),
+		ExpirationDate: aws.String("2019-05-02T12:30:00.000Z"),
+	}, nil
+}
+
+func (f *fakeAWSGlacier) InitiateVaultLock(vaultName, policy string) (string, error) {
+	if f.lock != nil {
+		return "", errors.New("lock already exists")
+	}
+	expiration := time.Now().Add(VaultLockDuration)
+	f.lock = &AWSGlacierVaultLock{Policy: policy, State: model.VaultLockStateInProgress, ExpirationDate: &expiration}
+	f.lockId = "lock-id"
+	return f.lockId, nil
+}
+
+func (f *fakeAWSGlacier) GetVaultLock(vaultName string) (*AWSGlacierVaultLock, error) {
+	return f.lock, nil
+}
+
+func (f *fakeAWSGlacier) CompleteVaultLock(vaultName, lockId string) error {
+	if f.lock == nil || lockId != f.lockId {
+		return errors.New("invalid lock id")
+	}
+	f.lock.State = model.VaultLockStateLocked
+	return nil
+}
+
+func (f *fakeAWSGlacier) AbortVaultLock(vaultName string) error {
+	if f.lock != nil && f.lock.State == model.VaultLockStateLocked {
+		return errors.New("vault is locked")
+	}
+	f.lock = nil
+	return nil
+}
+
+func TestAwsGlacier_GetVaultAccessPolicy_NotFound(t *testing.T) {
+	toTest := &awsGlacier{glacier: newFakeGlacierClient(), retryer: newRetryer(RetryPolicy{MaxAttempts: 1})}
+
+	policy, err := toTest.GetVaultAccessPolicy("vault")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "", policy)
+}
+
+func TestAwsGlacier_GetVaultLock(t *testing.T) {
+	toTest := &awsGlacier{glacier: newFakeGlacierClient(), retryer: newRetryer(RetryPolicy{MaxAttempts: 1})}
+
+	lock, err := toTest.GetVaultLock("vault")
+
+	assert.NoError(t, err)
+	assert.Equal(t, model.VaultLockStateInProgress, lock.State)
+	assert.Equal(t, `{"Version":"2012-10-17"}`, lock.Policy)
+	assert.True(t, time.Date(2019, 5, 2, 12, 30, 0, 0, time.UTC).Equal(*lock.ExpirationDate))
+}
+
+func TestVaultManager_Lock_Complete(t *testing.T) {
+	manager, fake, cleanup := newVaultTestManager(t)
+	defer cleanup()
+
+	lock, err := manager.InitiateLock("vault", "policy")
+	assert.NoError(t, err)
+	assert.Equal(t, model.VaultLockStateInProgress, lock.State)
+	assert.Equal(t, "lock-id", lock.LockId)
+	assert.True(t, fake.lock.ExpirationDate.Equal(lock.ExpirationDate))
+
+	//a second lock is refused
+	_, err = manager.InitiateLock("vault", "policy")
+	assert.Error(t, err)
+
+	lock, err = manager.CompleteLock("vault")
+	assert.NoError(t, err)
+	assert.Equal(t, model.VaultLockStateLocked, fake.lock.State)
+
+	stored := manager.dbRepository.GetVaultLock("vault")
+	assert.Equal(t, model.VaultLockStateLocked, stored.State)
+	assert.Equal(t, "policy", stored.Policy)
+	assert.NotNil(t, stored.CompletedAt)
+
+	//a completed lock can not be aborted
+	assert.Error(t, manager.AbortLock("vault"))
+}
+
+func TestVaultManager_Lock_Abort(t *testing.T) {
+	manager, fake, cleanup := newVaultTestManager(t)
+	defer cleanup()
+
+	_, err := manager.InitiateLock("vault", "policy")
+	assert.NoError(t, err)
+
+	assert.NoError(t, manager.AbortLock("vault"))
+	assert.Nil(t, fake.lock)
+	assert.Equal(t, model.VaultLockStateAborted, manager.dbRepository.GetVaultLock("vault").State)
+
+	//nothing to complete
+	_, err = manager.CompleteLock("vault")
+	assert.Error(t, err)
+
+	//a new lock can be initiated
+	_, err = manager.InitiateLock("vault", "other-policy")
+	assert.NoError(t, err)
+	assert.Equal(t, "other-policy", manager.dbRepository.GetVaultLock("vault").Policy)
+}
+
+func TestVaultManager_LockStatus_Expired(t *testing.T) {
+	manager, _, cleanup := newVaultTestManager(t)
+	defer cleanup()
+
+	//glacier has forgotten the lock which was not completed in time
+	manager.dbRepository.SaveVaultLock(&model.VaultLock{
+		Vault:          "vault",
+		LockId:         "lock-id",
+		State:          model.VaultLockStateInProgress,
+		ExpirationDate: time.Now().Add(-time.Hour),
+	})
+
+	lock, err := manager.LockStatus("vault")
+
+	assert.NoError(t, err)
+	assert.Equal(t, model.VaultLockStateExpired, lock.State)
+	assert.Equal(t, model.VaultLockStateExpired, manager.dbRepository.GetVaultLock("vault").State)
+}
+
+func TestVaultManager_LockStatus_Foreign(t *testing.T) {
+	manager, fake, cleanup := newVaultTestManager(t)
+	defer cleanup()
+
+	//the lock was initiated by someone else
+	fake.lock = &AWSGlacierVaultLock{Policy: "policy", State: model.VaultLockStateInProgress}
+
+	lock, err := manager.LockStatus("vault")
+	assert.NoError(t, err)
+	assert.Equal(t, model.VaultLockStateInProgress, lock.State)
+	assert.Equal(t, "", lock.LockId)
+
+	_, err = manager.CompleteLock("vault")
+	assert.Error(t, err)
+}
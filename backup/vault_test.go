@@ -0,0 +1,166 @@
+package backup
+
+import (
+	"backup2glacier/database/model"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/glacier"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func (f *fakeGlacierClient) ListVaults(input *glacier.ListVaultsInput) (*glacier.ListVaultsOutput, error) {
+	//two pages
+	if input.Marker == nil {
+		return &glacier.ListVaultsOutput{
+			VaultList: []*glacier.DescribeVaultOutput{{VaultName: aws.String("first"), NumberOfArchives: aws.Int64(3)}},
+			Marker:    aws.String("next"),
+		}, nil
+	}
+
+	return &glacier.ListVaultsOutput{
+		VaultList: []*glacier.DescribeVaultOutput{{
+			VaultName:         aws.String("second"),
+			CreationDate:      aws.String("2019-05-01T12:30:00.000Z"),
+			LastInventoryDate: aws.String("2019-05-02T12:30:00.000Z"),
+		}},
+	}, nil
+}
+
+func (f *fakeGlacierClient) DescribeVault(input *glacier.DescribeVaultInput) (*glacier.DescribeVaultOutput, error) {
+	return nil, awserr.New(glacier.ErrCodeResourceNotFoundException, "vault not found", nil)
+}
+
+func (f *fakeAWSGlacier) CreateVault(vaultName string) error {
+	f.vaults[vaultName] = &AWSGlacierVault{VaultName: vaultName}
+	return nil
+}
+
+func (f *fakeAWSGlacier) ListVaults() ([]*AWSGlacierVault, error) {
+	var vaults []*AWSGlacierVault
+	for _, vault := range f.vaults {
+		vaults = append(vaults, vault)
+	}
+	return vaults, nil
+}
+
+func (f *fakeAWSGlacier) DescribeVault(vaultName string) (*AWSGlacierVault, error) {
+	vault, exists := f.vaults[vaultName]
+	if !exists {
+		return nil, ErrVaultNotFound
+	}
+	return vault, nil
+}
+
+func (f *fakeAWSGlacier) DeleteVault(vaultName string) error {
+	delete(f.vaults, vaultName)
+	return nil
+}
+
+func TestAwsGlacier_ListVaults(t *testing.T) {
+	toTest := &awsGlacier{glacier: newFakeGlacierClient(), retryer: newRetryer(RetryPolicy{MaxAttempts: 1})}
+
+	vaults, err := toTest.ListVaults()
+
+	assert.NoError(t, err)
+	assert.Len(t, vaults, 2)
+	assert.Equal(t, "first", vaults[0].VaultName)
+	assert.Equal(t, int64(3), vaults[0].NumberOfArchives)
+	assert.Nil(t, vaults[0].LastInventoryDate)
+	assert.Equal(t, "second", vaults[1].VaultName)
+	assert.True(t, time.Date(2019, 5, 2, 12, 30, 0, 0, time.UTC).Equal(*vaults[1].LastInventoryDate))
+}
+
+func TestAwsGlacier_DescribeVault_NotFound(t *testing.T) {
+	toTest := &awsGlacier{glacier: newFakeGlacierClient(), retryer: newRetryer(RetryPolicy{MaxAttempts: 1})}
+
+	_, err := toTest.DescribeVault("vault")
+
+	assert.Equal(t, ErrVaultNotFound, err)
+}
+
+func newVaultTestManager(t *testing.T) (*vaultManager, *fakeAWSGlacier, func()) {
+	dbRepository, fake, _, cleanup := newTestFixture(t, "vault")
+
+	return &vaultManager{dbRepository: dbRepository, glacier: fake, settings: NewStorageSettings()}, fake, cleanup
+}
+
+func TestVaultManager_Describe(t *testing.T) {
+	manager, fake, cleanup := newVaultTestManager(t)
+	defer cleanup()
+
+	fake.vaults["vault"] = &AWSGlacierVault{VaultName: "vault", NumberOfArchives: 2, SizeInBytes: 300}
+	manager.dbRepository.SaveBackup(&model.Backup{Vault: "vault"})
+	manager.dbRepository.SaveBackup(&model.Backup{Vault: "other"})
+	inventoryDate := time.Now().Add(-time.Hour).UTC()
+	manager.dbRepository.SaveInventory(&model.Inventory{Vault: "vault", InventoryDate: inventoryDate})
+
+	info, err := manager.Describe("vault")
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), info.NumberOfArchives)
+	assert.Equal(t, int64(300), info.SizeInBytes)
+	assert.Equal(t, 1, info.LiveBackups)
+	assert.True(t, inventoryDate.Equal(*info.CachedInventoryDate))
+}
+
+func TestVaultManager_Delete_LiveBackups(t *testing.T) {
+	manager, fake, cleanup := newVaultTestManager(t)
+	defer cleanup()
+
+	fake.vaults["vault"] = &AWSGlacierVault{VaultName: "vault"}
+	dbBackup := &model.Backup{Vault: "vault"}
+	manager.dbRepository.SaveBackup(dbBackup)
+
+	//refused
+	assert.Error(t, manager.Delete("vault"))
+	assert.Contains(t, fake.vaults, "vault")
+
+	//the backup is deleted
+	manager.dbRepository.DeleteBackupById(dbBackup.ID)
+	assert.NoError(t, manager.Delete("vault"))
+	assert.NotContains(t, fake.vaults, "vault")
+}
+
+func TestVaultManager_Delete_LiveReplicas(t *testing.T) {
+	manager, fake, cleanup := newVaultTestManager(t)
+	defer cleanup()
+
+	fake.vaults["replica"] = &AWSGlacierVault{VaultName: "replica"}
+	dbBackup := &model.Backup{Vault: "vault"}
+	manager.dbRepository.SaveBackup(dbBackup)
+	location, err := manager.settings.ResolveLocation()
+	assert.NoError(t, err)
+
+	//the replica of an other region and a failed replica do not count
+	for _, dbReplica := range []*model.Replica{
+		{BackupID: dbBackup.ID, Vault: "replica", Region: "other-region", AccountId: location.AccountId, ArchiveId: aws.String("other")},
+		{BackupID: dbBackup.ID, Vault: "replica", Region: location.Region, AccountId: location.AccountId},
+	} {
+		manager.dbRepository.SaveReplica(dbReplica)
+	}
+	count, err := manager.countBackups("replica")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	manager.dbRepository.SaveReplica(&model.Replica{BackupID: dbBackup.ID, Vault: "replica", Region: location.Region, AccountId: location.AccountId, ArchiveId: aws.String("archive")})
+
+	//refused
+	assert.Error(t, manager.Delete("replica"))
+	assert.Contains(t, fake.vaults, "replica")
+}
+
+func TestVaultManager_EnsureVault(t *testing.T) {
+	manager, fake, cleanup := newVaultTestManager(t)
+	defer cleanup()
+
+	existing := &AWSGlacierVault{VaultName: "existing"}
+	fake.vaults["existing"] = existing
+
+	assert.NoError(t, manager.EnsureVault("existing"))
+	assert.NoError(t, manager.EnsureVault("missing"))
+
+	assert.True(t, existing == fake.vaults["existing"])
+	assert.Contains(t, fake.vaults, "missing")
+}
@@ -4,6 +4,8 @@ import (
 	"archive/zip"
 	. "backup2glacier/log"
 	"compress/flate"
+	"context"
+	"github.com/pkg/errors"
 	"io"
 	"io/ioutil"
 	"os"
@@ -17,116 +19,209 @@ type ZipContent struct {
 	Realpath string
 	Length   int64
 	FileInfo os.FileInfo
+	Volume   int
+}
+
+// ZipContentReceiver can be implemented by the destination of a volume. Then it will receive all contents of the
+// volume before it is closed.
+type ZipContentReceiver interface {
+	ReceiveContents(contents []*ZipContent)
+}
+
+// ZipVolumeSupplier returns the destination for the given volume (starting by 1)
+type ZipVolumeSupplier func(volume int) (io.WriteCloser, error)
+
+type zipVolumes struct {
+	volumeSize int64
+	supplier   ZipVolumeSupplier
+
+	volume    int
+	dst       io.WriteCloser
+	counter   *countingWriter
+	zipWriter *zip.Writer
+	contents  []*ZipContent
+}
+
+type countingWriter struct {
+	w       io.Writer
+	written int64
+	// err is the first error of the destination. After that the volume is broken.
+	err error
+}
+
+type nopWriteCloser struct {
+	io.Writer
 }
 
 // ZIP the given file/folder and write file information out in given channel
 func Zip(filePaths []string, blacklist, whitelist []*regexp.Regexp, dst io.Writer, contentChan chan<- *ZipContent) {
-	// Create a new zip archive.
-	zipWriter := zip.NewWriter(dst)
-	zipWriter.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
-		return flate.NewWriter(out, flate.BestCompression)
+	ZipVolumes(context.Background(), filePaths, blacklist, whitelist, 0, func(int) (io.WriteCloser, error) {
+		return &nopWriteCloser{dst}, nil
+	}, contentChan)
+}
+
+// ZipVolumes zips the given file/folder like Zip. But if the current volume has reached the volumeSize (in bytes)
+// a new zip archive will be started with the next file. The destination of each volume is given by the supplier.
+// Each volume will be closed after it is completed. A volumeSize of 0 means that there is only one volume.
+// The zipping stops with an error if the context is cancelled or the destination of a volume fails: the files
+// which can not be read are only logged.
+func ZipVolumes(ctx context.Context, filePaths []string, blacklist, whitelist []*regexp.Regexp, volumeSize int64, supplier ZipVolumeSupplier, contentChan chan<- *ZipContent) error {
+	volumes := &zipVolumes{
+		volumeSize: volumeSize,
+		supplier:   supplier,
+	}
+	defer func() {
+		if contentChan != nil {
+			close(contentChan)
+		}
+	}()
+
+	err := walkFiles(filePaths, blacklist, whitelist, true, func(filePath, zipPath string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		_, err := addFile(volumes, filePath, zipPath, contentChan)
+		return err
 	})
-	defer zipWriter.Close()
+	if err != nil {
+		volumes.Close()
+		return err
+	}
+
+	return volumes.Close()
+}
 
+// fileVisitor will be called for each file which should be added to the zip
+type fileVisitor func(filePath, zipPath string) error
+
+// walkFiles walks through all given files/folders and calls the visitor for each file which is not
+// excluded by the blacklist (or included by whitelist again). If verbose is true, the excluded/included
+// files will be logged.
+func walkFiles(filePaths []string, blacklist, whitelist []*regexp.Regexp, verbose bool, visitor fileVisitor) error {
 	for _, filePath := range filePaths {
 		absFilePath, _ := filepath.Abs(filePath)
 		fInfo, err := os.Stat(filePath)
 		if err != nil {
-			LogError("Could not read file information for '%s'. Error: %v", filePath, err)
+			if verbose {
+				LogError("Could not read file information for '%s'. Error: %v", filePath, err)
+			}
 			continue
 		}
 
 		if fInfo.IsDir() {
-			addFiles(zipWriter, absFilePath+"/", filepath.Dir(absFilePath+"/")+"/", blacklist, whitelist, contentChan)
+			err = walkDir(absFilePath+"/", filepath.Dir(absFilePath+"/")+"/", blacklist, whitelist, verbose, visitor)
 		} else {
 			dir, name := filepath.Split(absFilePath)
-			addFile(zipWriter, dir, dir+"/", name, blacklist, whitelist, contentChan)
+			err = visitFile(dir, dir+"/", name, blacklist, whitelist, verbose, visitor)
+		}
+		if err != nil {
+			return err
 		}
 	}
 
-	if contentChan != nil {
-		close(contentChan)
-	}
+	return nil
 }
 
-func addFiles(w *zip.Writer, basePath, baseInZip string, blacklist, whitelist []*regexp.Regexp, contentChan chan<- *ZipContent) {
+func walkDir(basePath, baseInZip string, blacklist, whitelist []*regexp.Regexp, verbose bool, visitor fileVisitor) error {
 	// Open the Directory
 	files, err := ioutil.ReadDir(basePath)
 	if err != nil {
-		LogError("Could not list directory '%s'. Error: %v", basePath, err)
-		return
+		if verbose {
+			LogError("Could not list directory '%s'. Error: %v", basePath, err)
+		}
+		return nil
 	}
 
 	for _, fileDesc := range files {
 		if fileDesc.IsDir() {
 			// recursion ahead!
 			newBase := basePath + fileDesc.Name() + "/"
-			addFiles(w, newBase, baseInZip+"/"+fileDesc.Name()+"/", blacklist, whitelist, contentChan)
+			err = walkDir(newBase, baseInZip+"/"+fileDesc.Name()+"/", blacklist, whitelist, verbose, visitor)
 		} else {
-			addFile(w, basePath, baseInZip, fileDesc.Name(), blacklist, whitelist, contentChan)
+			err = visitFile(basePath, baseInZip, fileDesc.Name(), blacklist, whitelist, verbose, visitor)
+		}
+		if err != nil {
+			return err
 		}
 	}
+
+	return nil
 }
 
-func addFile(w *zip.Writer, basePath, baseInZip, fileName string, blacklist, whitelist []*regexp.Regexp, contentChan chan<- *ZipContent) int64 {
-	//open for reading
+func visitFile(basePath, baseInZip, fileName string, blacklist, whitelist []*regexp.Regexp, verbose bool, visitor fileVisitor) error {
 	filePath := normalizeFilePath(basePath + fileName)
 	zipPath := normalizeZipPath(baseInZip + fileName)
 
-	osFile, err := os.Open(filePath)
-	if err != nil {
-		LogError("Could not open file '%s'. Error: %v", filePath, err)
-		return 0
-	}
-	defer osFile.Close()
-
 	if blacklisted, blExpr := isListed(filePath, blacklist); blacklisted {
 		if whitelisted, wlExpr := isListed(filePath, whitelist); whitelisted {
-			LogInfo(`Include file because it is whitelisted: %s -> "%s"`, filePath, wlExpr)
+			if verbose {
+				LogInfo(`Include file because it is whitelisted: %s -> "%s"`, filePath, wlExpr)
+			}
 		} else {
-			LogInfo(`Ignore file because it is blacklisted: %s -> "%s"`, filePath, blExpr)
-			return 0
+			if verbose {
+				LogInfo(`Ignore file because it is blacklisted: %s -> "%s"`, filePath, blExpr)
+			}
+			return nil
 		}
 	}
 
-	LogInfo("Add to zip: %s -> %s", osFile.Name(), zipPath)
+	return visitor(filePath, zipPath)
+}
+
+func addFile(w *zipVolumes, filePath, zipPath string, contentChan chan<- *ZipContent) (int64, error) {
+	//open for reading
+	osFile, err := os.Open(filePath)
+	if err != nil {
+		LogError("Could not open file '%s'. Error: %v", filePath, err)
+		return 0, nil
+	}
+	defer osFile.Close()
 
+	LogInfo("Add to zip: %s -> %s", osFile.Name(), zipPath)
 	// Add some files to the archive.
 	fileInfo, err := osFile.Stat()
 	if err != nil {
 		LogError("Could not read file metadata for %s. Error: %v", filePath, err)
-		return 0
+		return 0, nil
 	}
 
 	zipFileInfo, err := zip.FileInfoHeader(fileInfo)
 	if err != nil {
 		LogError("Could not create fileinfo header for %s. Error: %v", zipPath, err)
-		return 0
+		return 0, nil
 	}
 	zipFileInfo.Name = zipPath
 
-	zipFileHandle, err := w.CreateHeader(zipFileInfo)
+	zipWriter, err := w.writer()
+	if err != nil {
+		return 0, err
+	}
+
+	zipFileHandle, err := zipWriter.CreateHeader(zipFileInfo)
 	if err != nil {
-		LogError("Could not add file '%s' to zip. Error %v", zipPath, err)
-		return 0
+		return 0, w.skipFile(zipPath, err)
 	}
 
 	written, err := io.Copy(zipFileHandle, osFile)
 	if err != nil {
-		LogError("Could not add file '%s' to zip. Error %v", zipPath, err)
-		return 0
+		return 0, w.skipFile(zipPath, err)
 	}
 
+	content := &ZipContent{
+		Zippath:  zipPath,
+		Realpath: filePath,
+		Length:   written,
+		FileInfo: fileInfo,
+		Volume:   w.volume,
+	}
+	if _, ok := w.dst.(ZipContentReceiver); ok {
+		w.contents = append(w.contents, content)
+	}
 	if contentChan != nil {
-		contentChan <- &ZipContent{
-			Zippath:  zipPath,
-			Realpath: filePath,
-			Length:   written,
-			FileInfo: fileInfo,
-		}
+		contentChan <- content
 	}
 
-	return written
+	return written, nil
 }
 
 func isListed(path string, list []*regexp.Regexp) (bool, *regexp.Regexp) {
@@ -147,3 +242,104 @@ func normalizeZipPath(path string) string {
 	result := strings.Replace("/"+path, "//", "/", -1)
 	return result[1:]
 }
+
+// skipFile logs the error of a file which could not be added. If the destination of the volume has failed (for
+// example the upload is aborted), the error will be returned instead, because no further file can be added.
+func (z *zipVolumes) skipFile(zipPath string, err error) error {
+	if z.counter.err != nil {
+		return errors.Wrapf(z.counter.err, "Could not write volume %d", z.volume)
+	}
+
+	LogError("Could not add file '%s' to zip. Error %v", zipPath, err)
+	return nil
+}
+
+// writer returns the zip writer for the next file. If the current volume is full, a new one will be started.
+func (z *zipVolumes) writer() (*zip.Writer, error) {
+	if z.zipWriter != nil && z.volumeSize > 0 {
+		//the zip writer is buffered: so flush it for a more accurate volume size
+		if err := z.zipWriter.Flush(); err != nil {
+			return nil, errors.Wrapf(err, "Could not write volume %d", z.volume)
+		}
+	}
+
+	if z.zipWriter == nil || (z.volumeSize > 0 && z.counter.written >= z.volumeSize) {
+		if err := z.next(); err != nil {
+			return nil, err
+		}
+	}
+
+	return z.zipWriter, nil
+}
+
+func (z *zipVolumes) next() error {
+	if err := z.closeCurrent(); err != nil {
+		return err
+	}
+
+	z.volume++
+	if z.volume > 1 {
+		LogInfo("Start new volume: %d", z.volume)
+	}
+
+	dst, err := z.supplier(z.volume)
+	if err != nil {
+		return errors.Wrapf(err, "Could not create volume %d", z.volume)
+	}
+
+	z.dst = dst
+	z.counter = &countingWriter{w: dst}
+	z.zipWriter = zip.NewWriter(z.counter)
+	z.zipWriter.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+		return flate.NewWriter(out, flate.BestCompression)
+	})
+
+	return nil
+}
+
+func (z *zipVolumes) closeCurrent() error {
+	if z.zipWriter == nil {
+		return nil
+	}
+
+	zipErr := z.zipWriter.Close()
+	if receiver, ok := z.dst.(ZipContentReceiver); ok && zipErr == nil {
+		receiver.ReceiveContents(z.contents)
+	}
+	dstErr := z.dst.Close()
+	z.zipWriter = nil
+	z.contents = nil
+
+	if zipErr != nil {
+		return errors.Wrapf(zipErr, "Could not close volume %d", z.volume)
+	}
+	if dstErr != nil {
+		return errors.Wrapf(dstErr, "Could not close volume %d", z.volume)
+	}
+	return nil
+}
+
+// Close closes the current volume. If no volume was started yet, an empty one will be created.
+func (z *zipVolumes) Close() error {
+	if z.volume == 0 {
+		if err := z.next(); err != nil {
+			return err
+		}
+	}
+
+	return z.closeCurrent()
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.written += int64(n)
+	if err != nil && c.err == nil {
+		c.err = err
+	}
+
+	return n, err
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
@@ -2,8 +2,14 @@ package backup
 
 import (
 	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"io"
 	"io/ioutil"
+	"log"
 	"os"
 	"regexp"
 	"strings"
@@ -79,3 +85,122 @@ func TestList(t *testing.T) {
 		})
 	}
 }
+
+func Test_ZipVolumes(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "volumes")
+	assert.NoError(t, err)
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(tmpDir)
+
+	var volumeFiles []string
+	supplier := func(volume int) (io.WriteCloser, error) {
+		f, err := os.Create(fmt.Sprintf("%s/%03d.zip", tmpDir, volume))
+		if err == nil {
+			volumeFiles = append(volumeFiles, f.Name())
+		}
+		return f, err
+	}
+
+	contentVolumes := map[string]int{}
+	contentChan := make(chan *ZipContent)
+
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		for content := range contentChan {
+			contentVolumes[content.Zippath] = content.Volume
+		}
+	}()
+
+	//each file should be placed in its own volume
+	err = ZipVolumes(context.Background(), []string{"./"}, []*regexp.Regexp{}, []*regexp.Regexp{}, 1, supplier, contentChan)
+	wg.Wait()
+
+	assert.NoError(t, err)
+	assert.True(t, len(volumeFiles) > 1)
+	assert.Equal(t, len(contentVolumes), len(volumeFiles))
+
+	for i, volumeFile := range volumeFiles {
+		unzipReader, err := zip.OpenReader(volumeFile)
+		assert.NoError(t, err)
+		if err != nil {
+			continue
+		}
+
+		assert.Len(t, unzipReader.File, 1)
+		assert.Equal(t, i+1, contentVolumes[unzipReader.File[0].Name])
+		unzipReader.Close()
+	}
+}
+
+type receivingWriteCloser struct {
+	nopWriteCloser
+	contents []*ZipContent
+	closed   bool
+}
+
+func (r *receivingWriteCloser) ReceiveContents(contents []*ZipContent) {
+	r.contents = contents
+}
+
+func (r *receivingWriteCloser) Close() error {
+	r.closed = true
+	return nil
+}
+
+func Test_ZipVolumes_ReceiveContents(t *testing.T) {
+	var volumes []*receivingWriteCloser
+	supplier := func(volume int) (io.WriteCloser, error) {
+		dst := &receivingWriteCloser{nopWriteCloser: nopWriteCloser{ioutil.Discard}}
+		volumes = append(volumes, dst)
+		return dst, nil
+	}
+
+	err := ZipVolumes(context.Background(), []string{"./zip.go", "./zip_test.go"}, nil, nil, 1, supplier, nil)
+
+	assert.NoError(t, err)
+	assert.Len(t, volumes, 2)
+	for i, volume := range volumes {
+		assert.True(t, volume.closed)
+		assert.Len(t, volume.contents, 1)
+		assert.Equal(t, i+1, volume.contents[0].Volume)
+	}
+	assert.True(t, strings.HasSuffix(volumes[0].contents[0].Realpath, "zip.go"))
+	assert.True(t, strings.HasSuffix(volumes[1].contents[0].Realpath, "zip_test.go"))
+}
+
+func Test_ZipVolumes_BrokenDestination(t *testing.T) {
+	//the upload of the volume is aborted: the reader of the pipe is closed
+	src, dst := io.Pipe()
+	src.CloseWithError(errors.New("aborted"))
+	supplier := func(volume int) (io.WriteCloser, error) {
+		return dst, nil
+	}
+	output := new(bytes.Buffer)
+	log.SetOutput(output)
+	defer log.SetOutput(os.Stderr)
+
+	err := ZipVolumes(context.Background(), []string{"./"}, nil, nil, 0, supplier, nil)
+	assert.Error(t, err)
+	assert.Equal(t, "aborted", errors.Cause(err).Error())
+
+	//the walk stops at the first file which can not be written
+	assert.Equal(t, 1, strings.Count(output.String(), "Add to zip"))
+}
+
+func Test_ZipVolumes_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	contentChan := make(chan *ZipContent, 1000)
+
+	err := ZipVolumes(ctx, []string{"./"}, nil, nil, 0, func(int) (io.WriteCloser, error) {
+		return &nopWriteCloser{ioutil.Discard}, nil
+	}, contentChan)
+	assert.Equal(t, context.Canceled, err)
+	_, received := <-contentChan
+	assert.False(t, received)
+}
@@ -0,0 +1,46 @@
+package cli
+
+import (
+	api "backup2glacier/api/v1"
+	"backup2glacier/config"
+	. "backup2glacier/log"
+	"context"
+	"os"
+)
+
+type actionBootstrap struct {
+}
+
+func NewBootstrapAction() CliAction {
+	return &actionBootstrap{}
+}
+
+func (a *actionBootstrap) Do(cfg *config.Config) {
+	err := api.Bootstrap(context.Background(), api.BootstrapRequest{
+		Vault:     cfg.Bootstrap.AWSVaultName,
+		Password:  cfg.Bootstrap.CatalogPassword,
+		Target:    cfg.Bootstrap.Database,
+		Overwrite: cfg.Bootstrap.Force,
+	}, append(awsOptions(&cfg.Bootstrap.AwsGeneralConfig),
+		api.WithRetrieval(cfg.Bootstrap.AWSTier, cfg.Bootstrap.AWSPollInterval))...)
+	if err != nil {
+		LogFatal("Could not restore the catalog. Error: %v", err)
+	}
+	LogInfo("Successfully restored the catalog into %s", cfg.Bootstrap.Database)
+}
+
+func (a *actionBootstrap) Validate(cfg *config.Config) {
+	if !isValidTier(cfg.Bootstrap.AWSTier) {
+		cfg.Bootstrap.Fail("The tier is not valid. Valid tiers are: %+v", validTiers)
+	}
+	if cfg.Bootstrap.CatalogPassword == "" {
+		cfg.Bootstrap.Fail("No catalog password given!")
+	}
+
+	ValidateDatabase(&cfg.Bootstrap.DatabaseConfig)
+	ValidateAWS(&cfg.Bootstrap.AwsGeneralConfig)
+
+	if _, err := os.Stat(cfg.Bootstrap.Database); err == nil && !cfg.Bootstrap.Force {
+		cfg.Bootstrap.Fail("The database %s already exists. Use --force to overwrite it.", cfg.Bootstrap.Database)
+	}
+}
@@ -0,0 +1,97 @@
+package cli
+
+import (
+	api "backup2glacier/api/v1"
+	"backup2glacier/config"
+	"backup2glacier/database/model"
+	. "backup2glacier/log"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"time"
+)
+
+type actionCleanup struct {
+}
+
+func NewCleanupAction() CliAction {
+	return &actionCleanup{}
+}
+
+func (a *actionCleanup) Do(cfg *config.Config) {
+	client := newClient(cfg.Cleanup.Database, awsOptions(&cfg.Cleanup.AwsGeneralConfig)...)
+	defer client.Close()
+
+	ctx, stop := signalContext()
+	defer stop()
+
+	request := api.CleanupRequest{
+		OlderThan: cfg.Cleanup.OlderThan,
+		Delete:    cfg.Cleanup.Delete,
+		DryRun:    true,
+	}
+	stale, err := client.Cleanup(ctx, request)
+	if err != nil {
+		LogFatal("Error while searching interrupted backups. Error: %v", err)
+	}
+	if len(stale) == 0 {
+		LogInfo("Nothing to do.")
+		return
+	}
+	printStaleBackups(stale)
+
+	if cfg.Cleanup.DryRun {
+		return
+	}
+	if cfg.Cleanup.Delete && !cfg.Cleanup.DontAsk {
+		if !askYesNo("Are you sure to delete the interrupted backups?") {
+			LogFatal("Cleanup cancelled!")
+			return
+		}
+	}
+
+	request.DryRun = false
+	_, err = client.Cleanup(ctx, request)
+
+	BackupCatalog(client, &cfg.Cleanup.CatalogBackupConfig)
+	exitIfCancelled(err)
+	if err != nil {
+		LogFatal("Error while cleaning up the interrupted backups. Error: %v", err)
+	}
+}
+
+func printStaleBackups(backups []*model.Backup) {
+	w := csv.NewWriter(os.Stdout)
+	w.UseCRLF = true
+	w.Comma = ';'
+
+	err := w.Write([]string{"ID", "CREATED", "VAULT", "DESCRIPTION", "STATUS", "LAST SEEN"})
+	if err != nil {
+		panic(err)
+	}
+
+	for _, backup := range backups {
+		err = w.Write([]string{
+			fmt.Sprintf("%d", backup.ID),
+			backup.CreatedAt.Format(time.RFC3339),
+			backup.Vault,
+			backup.Description,
+			backup.Status,
+			backup.HeartbeatAt.Format(time.RFC3339),
+		})
+		if err != nil {
+			panic(err)
+		}
+	}
+	w.Flush()
+}
+
+func (a *actionCleanup) Validate(cfg *config.Config) {
+	if cfg.Cleanup.OlderThan <= 0 {
+		cfg.Cleanup.Fail("The age of interrupted backups must be positive!")
+	}
+
+	ValidateDatabase(&cfg.Cleanup.DatabaseConfig)
+	ValidateAWS(&cfg.Cleanup.AwsGeneralConfig)
+	ValidateCatalogBackup(&cfg.Cleanup.CatalogBackupConfig)
+}
@@ -0,0 +1,128 @@
+package cli
+
+import (
+	api "backup2glacier/api/v1"
+	"backup2glacier/backup"
+	"backup2glacier/config"
+	. "backup2glacier/log"
+	"context"
+	"path/filepath"
+	"strings"
+)
+
+type actionCopy struct {
+}
+
+func NewCopyAction() CliAction {
+	return &actionCopy{}
+}
+
+func (a *actionCopy) Do(cfg *config.Config) {
+	client := newClient(cfg.Copy.Database, append(awsOptions(&cfg.Copy.AwsGeneralConfig),
+		bandwidthOption(&cfg.Copy.BandwidthConfig),
+		api.WithRetrieval(cfg.Copy.AWSTier, cfg.Copy.AWSPollInterval),
+		api.WithWorkDir(cfg.Copy.WorkDir))...)
+	defer client.Close()
+
+	backupIds := []uint{cfg.Copy.BackupId}
+	if cfg.Copy.FromVault != "" {
+		backups, err := client.List(context.Background(), api.ListRequest{Vault: cfg.Copy.FromVault})
+		if err != nil {
+			LogFatal("Could not list the backups. Error: %v", err)
+		}
+		backupIds = printBackups(backups, 1)
+
+		if len(backupIds) == 0 {
+			LogInfo("Nothing to do.")
+			return
+		}
+	}
+
+	if cfg.Copy.DeleteSource && !cfg.Copy.DontAsk {
+		if !askYesNo("Are you sure to delete the original archives after the copy?") {
+			LogFatal("Copy cancelled!")
+			return
+		}
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+
+	target := copyTarget(cfg.Copy)
+	failed := 0
+	var cancelErr error
+	for _, backupId := range backupIds {
+		err := client.Copy(ctx, api.CopyRequest{
+			BackupId:     backupId,
+			Target:       target,
+			StorageClass: cfg.Copy.S3StorageClass,
+			DeleteSource: cfg.Copy.DeleteSource,
+		})
+		if api.IsCancelled(err) {
+			//the catalog has to be saved anyway: the finished copies are recorded in it
+			cancelErr = err
+			break
+		}
+		if err != nil {
+			LogError("Could not copy backup %d. Error: %v", backupId, err)
+			failed++
+			continue
+		}
+		LogInfo("Successfully copied backup %d into %s", backupId, target)
+	}
+
+	BackupCatalog(client, &cfg.Copy.CatalogBackupConfig)
+	exitIfCancelled(cancelErr)
+	if failed > 0 {
+		LogFatal("%d of %d backup(s) could not be copied.", failed, len(backupIds))
+	}
+}
+
+// copyTarget returns the target of the copy. For the directory backend the target is the path of the directory vault.
+func copyTarget(cfg *config.CopyConfig) backup.CopyTarget {
+	if cfg.ToBackend == backup.BackendDirectory {
+		vaultDir, _ := filepath.Abs(cfg.To)
+		return backup.CopyTarget{Backend: cfg.ToBackend, Vault: vaultDir}
+	}
+
+	replica, _ := backup.ParseReplicaTarget(cfg.To)
+	return backup.CopyTarget{Backend: cfg.ToBackend, Vault: replica.Vault, Region: replica.Region}
+}
+
+func (a *actionCopy) Validate(cfg *config.Config) {
+	if cfg.Copy.BackupId == 0 && cfg.Copy.FromVault == "" {
+		cfg.Copy.Fail("No backup id given!")
+	}
+	if cfg.Copy.BackupId != 0 && cfg.Copy.FromVault != "" {
+		cfg.Copy.Fail("The backup id and --from-vault can not be used together!")
+	}
+
+	if cfg.Copy.To == "" {
+		cfg.Copy.Fail("No target given!")
+	}
+	if cfg.Copy.ToBackend != "" && !backup.IsValidBackend(cfg.Copy.ToBackend) {
+		cfg.Copy.Fail("Invalid backend: %s. Possible: %s;%s;%s", cfg.Copy.ToBackend, backup.BackendGlacier, backup.BackendS3, backup.BackendDirectory)
+	}
+	if cfg.Copy.ToBackend != backup.BackendDirectory {
+		if _, err := backup.ParseReplicaTarget(cfg.Copy.To); err != nil {
+			cfg.Copy.Fail("Invalid target: %v", err)
+		}
+	} else if _, err := filepath.Abs(cfg.Copy.To); err != nil {
+		cfg.Copy.Fail("Invalid directory vault: %s", cfg.Copy.To)
+	}
+
+	if cfg.Copy.S3StorageClass == "" {
+		cfg.Copy.S3StorageClass = backup.DefaultS3StorageClass
+	}
+	if !isValidStorageClass(cfg.Copy.S3StorageClass) {
+		cfg.Copy.Fail("Invalid storage class: %s. Possible: %s", cfg.Copy.S3StorageClass, strings.Join(backup.S3StorageClasses, ";"))
+	}
+	if !isValidTier(cfg.Copy.AWSTier) {
+		cfg.Copy.Fail("The tier is not valid. Valid tiers are: %+v", validTiers)
+	}
+
+	ValidateDatabase(&cfg.Copy.DatabaseConfig)
+	ValidateAWS(&cfg.Copy.AwsGeneralConfig)
+	ValidateBandwidth(&cfg.Copy.BandwidthConfig)
+	ValidateCatalogBackup(&cfg.Copy.CatalogBackupConfig)
+}
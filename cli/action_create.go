@@ -1,17 +1,21 @@
 package cli
 
 import (
+	api "backup2glacier/api/v1"
 	"backup2glacier/backup"
 	"backup2glacier/config"
 	. "backup2glacier/log"
+	"context"
 	"fmt"
+	"github.com/pkg/errors"
 	"golang.org/x/crypto/ssh/terminal"
+	"path/filepath"
 	"regexp"
+	"strconv"
+	"strings"
 	"syscall"
 )
 
-var validPartSizes = []int{1, 2, 4, 8, 16, 32, 64, 128, 256, 512, 1024, 4096}
-
 type actionCreate struct {
 }
 
@@ -20,26 +24,90 @@ func NewCreateAction() CliAction {
 }
 
 func (a *actionCreate) Do(cfg *config.Config) {
-	b, err := backup.NewBackupCreater(
-		cfg.Create.Password,
-		cfg.Create.SavePassword,
-		cfg.Create.AWSPartSize,
-		cfg.Create.Database)
+	if cfg.Create.CreateVault && cfg.Create.Backend == backup.BackendDirectory {
+		if err := backup.EnsureDirectoryVault(cfg.Create.AWSVaultName); err != nil {
+			LogFatal("Could not create vault. Error: %v", err)
+		}
+	}
 
-	if err != nil {
-		LogFatal("Could not init backup. Error: %v", err)
+	replicas, _ := replicaTargets(cfg.Create)
+
+	client := newClient(cfg.Create.Database, append(awsOptions(&cfg.Create.AwsGeneralConfig),
+		bandwidthOption(&cfg.Create.BandwidthConfig),
+		api.WithConcurrency(cfg.Create.UploadConcurrency),
+		api.WithSpool(spoolConfig(&cfg.Create.SpoolConfig)))...)
+	defer client.Close()
+
+	if cfg.Create.CreateVault && cfg.Create.Backend != backup.BackendDirectory {
+		if err := client.EnsureVault(context.Background(), cfg.Create.AWSVaultName); err != nil {
+			LogFatal("Could not create vault. Error: %v", err)
+		}
 	}
-	defer b.Close()
 
-	result := b.Create(cfg.Create.Files, cfg.Create.GetBlacklist(), cfg.Create.GetWhitelist(), cfg.Create.AWSArchiveDescription, cfg.Create.AWSVaultName)
+	ctx, stop := signalContext()
+	defer stop()
 
-	if result.Error != nil {
-		LogError("Could not upload backup. Error: %v", result.Error)
+	result, err := client.Create(ctx, api.CreateRequest{
+		Files:        cfg.Create.Files,
+		Blacklist:    cfg.Create.GetBlacklist(),
+		Whitelist:    cfg.Create.GetWhitelist(),
+		Description:  cfg.Create.AWSArchiveDescription,
+		Vault:        cfg.Create.AWSVaultName,
+		Backend:      cfg.Create.Backend,
+		StorageClass: cfg.Create.S3StorageClass,
+		Replicas:     replicas,
+		Password:     cfg.Create.Password,
+		SavePassword: cfg.Create.SavePassword,
+		PartSize:     cfg.Create.PartSize,
+		VolumeSize:   cfg.Create.GetVolumeSize(),
+		KeepOnCancel: cfg.Create.KeepOnCancel,
+	})
+	if result == nil {
+		LogFatal("Could not upload backup. Error: %v", err)
+	}
+	if api.IsCancelled(err) && cfg.Create.KeepOnCancel {
+		LogInfo("Use the sub-command %s %d for continue the backup.", config.ActionResume, result.BackupId)
+	}
+	exitIfCancelled(err)
+
+	if err != nil {
+		LogError("Could not upload backup. Error: %v", err)
 	} else {
 		LogInfo("Successfully upload backup. Result: %+v", result)
+		BackupCatalog(client, &cfg.Create.CatalogBackupConfig)
+	}
+	if result.Retries > 0 {
+		LogInfo("%d glacier operations had to be retried.", result.Retries)
 	}
 }
 
+// replicaTargets parses the replicas. For the directory backend a replica is the path of a further directory vault.
+func replicaTargets(cfg *config.CreateConfig) ([]backup.ReplicaTarget, error) {
+	var targets []backup.ReplicaTarget
+	for _, replica := range cfg.Replicas {
+		target := backup.ReplicaTarget{Vault: replica}
+		if cfg.Backend == backup.BackendDirectory {
+			vaultDir, err := filepath.Abs(replica)
+			if err != nil {
+				return nil, err
+			}
+			target.Vault = vaultDir
+		} else {
+			var err error
+			if target, err = backup.ParseReplicaTarget(replica); err != nil {
+				return nil, err
+			}
+		}
+
+		if target.Vault == cfg.AWSVaultName && (target.Region == "" || target.Region == cfg.AWSRegion) {
+			return nil, errors.Errorf("The replica %s is the vault of the backup itself", replica)
+		}
+		targets = append(targets, target)
+	}
+
+	return targets, nil
+}
+
 func (a *actionCreate) Validate(cfg *config.Config) {
 	if len(cfg.Create.Files) == 0 {
 		cfg.Create.Fail("No file given!")
@@ -57,11 +125,79 @@ func (a *actionCreate) Validate(cfg *config.Config) {
 		}
 	}
 
-	if !isValidPartSize(cfg.Create.AWSPartSize) {
-		cfg.Create.Fail("The part size is not valid. Valid sizes are: %+v", validPartSizes)
+	if cfg.Create.Backend == "" {
+		cfg.Create.Backend = backup.BackendGlacier
+	}
+	if !backup.IsValidBackend(cfg.Create.Backend) {
+		cfg.Create.Fail("Invalid backend: %s. Possible: %s;%s;%s", cfg.Create.Backend, backup.BackendGlacier, backup.BackendS3, backup.BackendDirectory)
+	}
+	if cfg.Create.Backend == backup.BackendDirectory {
+		//the backups must be found independent of the working directory
+		vaultDir, err := filepath.Abs(cfg.Create.AWSVaultName)
+		if err != nil {
+			cfg.Create.Fail("Invalid directory vault: %s", cfg.Create.AWSVaultName)
+		}
+		cfg.Create.AWSVaultName = vaultDir
+	}
+	if cfg.Create.Backend == backup.BackendS3 {
+		if cfg.Create.S3StorageClass == "" {
+			cfg.Create.S3StorageClass = backup.DefaultS3StorageClass
+		}
+		if !isValidStorageClass(cfg.Create.S3StorageClass) {
+			cfg.Create.Fail("Invalid storage class: %s. Possible: %s", cfg.Create.S3StorageClass, strings.Join(backup.S3StorageClasses, ";"))
+		}
+		if cfg.Create.CreateVault {
+			cfg.Create.Fail("The bucket can not be created by backup2glacier. Create it at first.")
+		}
+	}
+
+	if _, err := replicaTargets(cfg.Create); err != nil {
+		cfg.Create.Fail("Invalid replica: %v", err)
+	}
+
+	if cfg.Create.UploadConcurrency < 1 {
+		cfg.Create.Fail("The upload concurrency must be at least 1.")
+	}
+
+	var volumeSize int64
+	if cfg.Create.VolumeSize != "" {
+		var err error
+		volumeSize, err = config.ParseSize(cfg.Create.VolumeSize)
+		if err != nil || volumeSize <= 0 {
+			cfg.Create.Fail(`The volume size is not valid: "%s"`, cfg.Create.VolumeSize)
+		}
+	}
+
+	var partSize int
+	if strings.ToLower(cfg.Create.AWSPartSize) == config.PartSizeAuto {
+		estimation := backup.EstimateZip(cfg.Create.Files, cfg.Create.GetBlacklist(), cfg.Create.GetWhitelist())
+		archiveSize := estimation.ArchiveSize(volumeSize)
+
+		var err error
+		partSize, err = backup.ChoosePartSize(archiveSize, backup.PartSizeSafetyMargin)
+		if err != nil {
+			cfg.Create.Fail("Could not choose a part size automatically: %v", err)
+		}
+		LogInfo("The largest archive will have ~%d MiB (%d files in total). Use a part size of %d MiB.", archiveSize/1024/1024, estimation.Files, partSize)
+	} else {
+		var err error
+		partSize, err = strconv.Atoi(cfg.Create.AWSPartSize)
+		if err != nil || !isValidPartSize(partSize) {
+			cfg.Create.Fail("The part size is not valid. Valid sizes are: %+v or %s", backup.ValidPartSizes, config.PartSizeAuto)
+		}
+	}
+
+	cfg.Create.PartSize = 1024 * 1024 * partSize
+	if cfg.Create.Backend == backup.BackendS3 && cfg.Create.PartSize < backup.S3MinPartSize {
+		LogInfo("S3 needs parts of at least 5 MiB. Use a part size of %d MiB.", backup.S3MinPartSize/1024/1024)
+		cfg.Create.PartSize = backup.S3MinPartSize
+		partSize = backup.S3MinPartSize / 1024 / 1024
 	}
 
-	cfg.Create.AWSPartSize = 1024 * 1024 * cfg.Create.AWSPartSize
+	if maxVolumeSize := int64(cfg.Create.PartSize) * backup.MaxPartsPerUpload; volumeSize > maxVolumeSize {
+		cfg.Create.Fail("The volume size is too large for the part size. With a part size of %d MiB a volume can not be larger than %d MiB.",
+			partSize, maxVolumeSize/1024/1024)
+	}
 
 	if cfg.Create.Password == "" {
 		cfg.Create.Password = askForPassword()
@@ -71,8 +207,11 @@ func (a *actionCreate) Validate(cfg *config.Config) {
 		cfg.Create.AWSArchiveDescription = fmt.Sprintf("Backup %v to %s", cfg.Create.Files, cfg.Create.AWSVaultName)
 	}
 
+	ValidateSpool(&cfg.Create.SpoolConfig, cfg.Create.PartSize, cfg.Create.UploadConcurrency)
 	ValidateDatabase(&cfg.Create.DatabaseConfig)
 	ValidateAWS(&cfg.Create.AwsGeneralConfig)
+	ValidateBandwidth(&cfg.Create.BandwidthConfig)
+	ValidateCatalogBackup(&cfg.Create.CatalogBackupConfig)
 }
 
 func askForPassword() string {
@@ -102,8 +241,18 @@ func askForPassword() string {
 	return pw1
 }
 
+func isValidStorageClass(storageClass string) bool {
+	for _, valid := range backup.S3StorageClasses {
+		if valid == storageClass {
+			return true
+		}
+	}
+
+	return false
+}
+
 func isValidPartSize(size int) bool {
-	for _, valid := range validPartSizes {
+	for _, valid := range backup.ValidPartSizes {
 		if valid == size {
 			return true
 		}
@@ -1,10 +1,10 @@
 package cli
 
 import (
-	"backup2glacier/backup"
+	api "backup2glacier/api/v1"
 	"backup2glacier/config"
-	"backup2glacier/database"
 	. "backup2glacier/log"
+	"context"
 	"time"
 )
 
@@ -16,21 +16,23 @@ func NewCuratorAction() CliAction {
 }
 
 func (a *actionCurator) Do(cfg *config.Config) {
-	dbRepository := database.NewRepository(cfg.Curator.Database)
-
-	var backupIter database.BackupIterator
+	client := newClient(cfg.Curator.Database, awsOptions(&cfg.Curator.AwsGeneralConfig)...)
+	defer client.Close()
 
+	request := api.ListRequest{Vault: cfg.Curator.AWSVaultName}
 	if cfg.Curator.OlderThanTime != nil {
-		t := *cfg.Curator.OlderThanTime
-		backupIter = dbRepository.GetOlderThan(cfg.Curator.AWSVaultName, t)
+		request.OlderThan = *cfg.Curator.OlderThanTime
 	} else if cfg.Curator.MaxAgeDays != 0 {
-		t := time.Now().Add(time.Hour * 24 * time.Duration(cfg.Curator.MaxAgeDays) * -1)
-		backupIter = dbRepository.GetOlderThan(cfg.Curator.AWSVaultName, t)
+		request.OlderThan = time.Now().Add(time.Hour * 24 * time.Duration(cfg.Curator.MaxAgeDays) * -1)
 	} else {
-		backupIter = dbRepository.GetLast(cfg.Curator.AWSVaultName, cfg.Curator.KeepN)
+		request.SkipNewest = cfg.Curator.KeepN
 	}
 
-	backupIds := printBackups(backupIter, 1)
+	backups, err := client.List(context.Background(), request)
+	if err != nil {
+		LogFatal("Could not list the backups. Error: %v", err)
+	}
+	backupIds := printBackups(backups, 1)
 
 	if len(backupIds) == 0 {
 		LogInfo("Nothing to do.")
@@ -44,23 +46,30 @@ func (a *actionCurator) Do(cfg *config.Config) {
 		}
 	}
 
-	//delete all
-	b, err := backup.NewBackupDeleterForRepository(dbRepository)
-	if err != nil {
-		LogFatal("Could not delete backup. Error: %v", err)
-	}
+	ctx, stop := signalContext()
+	defer stop()
 
+	//delete all
+	var cancelErr error
 	for _, backupId := range backupIds {
-		err = b.Delete(backupId)
+		err := client.Delete(ctx, backupId)
+		if api.IsCancelled(err) {
+			cancelErr = err
+			break
+		}
 		if err != nil {
 			LogFatal("Error while delete backup. Error: %v", err)
 		}
 	}
+
+	BackupCatalog(client, &cfg.Curator.CatalogBackupConfig)
+	exitIfCancelled(cancelErr)
 }
 
 func (a *actionCurator) Validate(cfg *config.Config) {
 	ValidateDatabase(&cfg.Curator.DatabaseConfig)
 	ValidateAWS(&cfg.Curator.AwsGeneralConfig)
+	ValidateCatalogBackup(&cfg.Curator.CatalogBackupConfig)
 
 	if cfg.Curator.OlderThanTime == nil && cfg.Curator.MaxAgeDays == 0 && cfg.Curator.KeepN == 0 {
 		cfg.Curator.Fail("Even OlderThan, MaxAge or Keep must be given!")
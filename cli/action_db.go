@@ -0,0 +1,77 @@
+package cli
+
+import (
+	"backup2glacier/config"
+	"backup2glacier/database"
+	. "backup2glacier/log"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strings"
+)
+
+type actionDB struct {
+}
+
+func NewDBAction() CliAction {
+	return &actionDB{}
+}
+
+func (a *actionDB) Do(cfg *config.Config) {
+	version, pending, err := database.PendingMigrations(cfg.DB.Database)
+	if err != nil {
+		LogFatal("Could not read the schema version of the database. Error: %v", err)
+	}
+
+	LogInfo("The database has the schema version %d. The current version is %d.", version, database.SchemaVersion())
+	if len(pending) == 0 {
+		LogInfo("Nothing to do.")
+		return
+	}
+	printMigrations(pending)
+
+	if cfg.DB.DryRun {
+		return
+	}
+
+	//the migrations are applied on opening
+	dbRepository, err := database.OpenRepository(cfg.DB.Database)
+	if err != nil {
+		LogFatal("Error while migrating the database. Error: %v", err)
+	}
+	dbRepository.Close()
+
+	LogInfo("Successfully migrated the database to schema version %d", database.SchemaVersion())
+}
+
+func printMigrations(migrations []database.Migration) {
+	w := csv.NewWriter(os.Stdout)
+	w.UseCRLF = true
+	w.Comma = ';'
+
+	err := w.Write([]string{"VERSION", "DESCRIPTION"})
+	if err != nil {
+		panic(err)
+	}
+
+	for _, migration := range migrations {
+		err = w.Write([]string{
+			fmt.Sprintf("%d", migration.Version),
+			migration.Description,
+		})
+		if err != nil {
+			panic(err)
+		}
+	}
+	w.Flush()
+}
+
+func (a *actionDB) Validate(cfg *config.Config) {
+	cfg.DB.Command = strings.ToUpper(cfg.DB.Command)
+
+	if cfg.DB.Command != config.DBCommandMigrate {
+		cfg.DB.Fail("Invalid database command: %s. Possible: %s", cfg.DB.Command, config.DBCommandMigrate)
+	}
+
+	ValidateDatabase(&cfg.DB.DatabaseConfig)
+}
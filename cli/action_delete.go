@@ -1,10 +1,10 @@
 package cli
 
 import (
-	"backup2glacier/backup"
 	"backup2glacier/config"
 	. "backup2glacier/log"
 	"bufio"
+	"context"
 	"fmt"
 	"os"
 	"strings"
@@ -25,25 +25,29 @@ func (a *actionDelete) Do(cfg *config.Config) {
 		}
 	}
 
-	b, err := backup.NewBackupDeleter(cfg.Delete.Database)
-	if err != nil {
-		LogFatal("Could not delete backup. Error: %v", err)
-	}
-
-	err = b.Delete(cfg.Delete.BackupId)
+	client := newClient(cfg.Delete.Database, awsOptions(&cfg.Delete.AwsGeneralConfig)...)
+	err := client.Delete(context.Background(), cfg.Delete.BackupId)
+	client.Close()
 	if err != nil {
 		LogFatal("Error while delete backup. Error: %v", err)
 	}
+
+	BackupCatalog(client, &cfg.Delete.CatalogBackupConfig)
 }
 
 func (a *actionDelete) Validate(cfg *config.Config) {
 	ValidateDatabase(&cfg.Delete.DatabaseConfig)
 	ValidateAWS(&cfg.Delete.AwsGeneralConfig)
+	ValidateCatalogBackup(&cfg.Delete.CatalogBackupConfig)
 }
 
 func askToBeSure() bool {
+	return askYesNo("Are you sure to delete the backup?")
+}
+
+func askYesNo(question string) bool {
 	reader := bufio.NewReader(os.Stdin)
-	fmt.Print("Are you sure to delete the backup? (y/n): ")
+	fmt.Printf("%s (y/n): ", question)
 	answer, _ := reader.ReadString('\n')
 
 	switch strings.ToLower(strings.Trim(answer, "\n")) {
@@ -1,9 +1,9 @@
 package cli
 
 import (
+	api "backup2glacier/api/v1"
 	"backup2glacier/backup"
 	"backup2glacier/config"
-	"backup2glacier/database"
 	. "backup2glacier/log"
 )
 
@@ -17,43 +17,86 @@ func NewGetAction() CliAction {
 }
 
 func (a *actionGet) Do(cfg *config.Config) {
-	b, err := backup.NewBackupGetter(
-		cfg.Get.Password,
-		cfg.Get.AWSTier,
-		cfg.Get.AWSPollInterval,
-		cfg.Get.Database)
-
-	if err != nil {
-		LogFatal("Could not init backup. Error: %v", err)
-	}
-	defer b.Close()
+	client := newClient(cfg.Get.Database, append(awsOptions(&cfg.Get.AwsGeneralConfig),
+		bandwidthOption(&cfg.Get.BandwidthConfig),
+		api.WithRetrieval(cfg.Get.AWSTier, cfg.Get.AWSPollInterval),
+		api.WithChunkSize(cfg.Get.GetChunkSize()),
+		api.WithConcurrency(cfg.Get.DownloadConcurrency))...)
+	defer client.Close()
 
-	repo := database.NewRepository(cfg.Get.Database)
-	defer repo.Close()
+	ctx, stop := signalContext()
+	defer stop()
 
-	if e := repo.GetBackupById(cfg.Get.BackupId); e.ID == cfg.Get.BackupId {
-		err := b.Download(cfg.Get.BackupId, cfg.Get.File, askForPassword)
+	if cfg.Get.Fetch {
+		err := client.FetchRestores(ctx, cfg.Get.BackupId, askForPassword)
+		exitIfCancelled(err)
 		if err != nil {
-			LogError("Could not download backup. Error: %v", err)
-		} else {
-			LogInfo("Successfully download backup.")
+			LogError("Could not fetch backups. Error: %v", err)
 		}
+		return
+	}
+
+	request := api.RestoreRequest{
+		BackupId:       cfg.Get.BackupId,
+		Volume:         cfg.Get.Volume,
+		Target:         cfg.Get.File,
+		PasswordPrompt: askForPassword,
+	}
+	if cfg.Get.Password != nil {
+		request.Password = *cfg.Get.Password
+	}
+
+	var err error
+	if cfg.Get.Request {
+		_, err = client.RequestRestore(ctx, request)
 	} else {
+		err = client.Restore(ctx, request)
+	}
+	exitIfCancelled(err)
+
+	switch {
+	case api.IsNotFound(err):
 		LogError("Backup not found. Please make sure you took the right one. Use the sub-command %s for do that.", config.ActionList)
+	case err != nil && cfg.Get.Request:
+		LogError("Could not request backup. Error: %v", err)
+	case err != nil:
+		LogError("Could not download backup. Error: %v", err)
+	case cfg.Get.Request:
+		LogInfo("Successfully requested backup. Use the sub-command %s --fetch for download it when it is ready.", config.ActionGet)
+	default:
+		LogInfo("Successfully download backup.")
 	}
 }
 
 func (a *actionGet) Validate(cfg *config.Config) {
-	if cfg.Get.File == "" {
-		cfg.Get.Fail("No file given!")
+	if cfg.Get.Request && cfg.Get.Fetch {
+		cfg.Get.Fail("The options --request and --fetch can not be used together!")
+	}
+	if !cfg.Get.Fetch {
+		if cfg.Get.BackupId == 0 {
+			cfg.Get.Fail("No backup id given!")
+		}
+		if cfg.Get.File == "" {
+			cfg.Get.Fail("No file given!")
+		}
 	}
 
 	if !isValidTier(cfg.Get.AWSTier) {
-		cfg.Get.Fail("The part size is not valid. Valid sizes are: %+v", validPartSizes)
+		cfg.Get.Fail("The tier is not valid. Valid tiers are: %+v", validTiers)
+	}
+
+	if cfg.Get.DownloadConcurrency < 1 {
+		cfg.Get.Fail("The download concurrency must be at least 1.")
+	}
+	if chunkSize, err := config.ParseSize(cfg.Get.ChunkSize); err != nil {
+		cfg.Get.Fail("Invalid chunk size: %v", err)
+	} else if !backup.IsValidChunkSize(chunkSize) {
+		cfg.Get.Fail("The chunk size must be a power of two multiple of 1M (1M, 2M, 4M, 8M, ...).")
 	}
 
 	ValidateDatabase(&cfg.Get.DatabaseConfig)
 	ValidateAWS(&cfg.Get.AwsGeneralConfig)
+	ValidateBandwidth(&cfg.Get.BandwidthConfig)
 }
 
 func isValidTier(tier string) bool {
@@ -0,0 +1,73 @@
+package cli
+
+import (
+	"backup2glacier/backup"
+	"backup2glacier/config"
+	. "backup2glacier/log"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"time"
+)
+
+type actionJobs struct {
+}
+
+func NewJobsAction() CliAction {
+	return &actionJobs{}
+}
+
+func (a *actionJobs) Do(cfg *config.Config) {
+	client := newClient(cfg.Jobs.Database, awsOptions(&cfg.Jobs.AwsGeneralConfig)...)
+	defer client.Close()
+
+	jobs, err := client.Jobs(context.Background(), cfg.Jobs.BackupId)
+	if err != nil {
+		LogFatal("Error while refreshing the retrieval jobs. Error: %v", err)
+	}
+
+	w := csv.NewWriter(os.Stdout)
+	w.UseCRLF = true
+	w.Comma = ';'
+
+	err = w.Write([]string{"BACKUP_ID", "VOLUME", "STATUS", "TIER", "REQUESTED", "EXPECTED", "COMPLETED", "AVAILABLE_UNTIL", "TARGET", "JOB_ID", "ERROR"})
+	if err != nil {
+		panic(err)
+	}
+
+	for _, job := range jobs {
+		if !cfg.Jobs.All && !job.IsOpen() {
+			continue
+		}
+
+		completed, availableUntil := "", ""
+		if job.CompletedAt != nil {
+			completed = job.CompletedAt.Format(time.RFC3339)
+			availableUntil = job.CompletedAt.Add(backup.JobOutputAvailability).Format(time.RFC3339)
+		}
+
+		err = w.Write([]string{
+			fmt.Sprintf("%d", job.BackupID),
+			fmt.Sprintf("%d", job.VolumeNumber),
+			job.Status,
+			job.Tier,
+			job.CreatedAt.Format(time.RFC3339),
+			job.ExpectedCompletion.Format(time.RFC3339),
+			completed,
+			availableUntil,
+			job.Target,
+			job.JobId,
+			job.Error,
+		})
+		if err != nil {
+			panic(err)
+		}
+	}
+	w.Flush()
+}
+
+func (a *actionJobs) Validate(cfg *config.Config) {
+	ValidateDatabase(&cfg.Jobs.DatabaseConfig)
+	ValidateAWS(&cfg.Jobs.AwsGeneralConfig)
+}
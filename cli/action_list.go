@@ -1,11 +1,16 @@
 package cli
 
 import (
+	api "backup2glacier/api/v1"
+	"backup2glacier/backup"
 	"backup2glacier/config"
-	"backup2glacier/database"
+	"backup2glacier/database/model"
+	. "backup2glacier/log"
+	"context"
 	"encoding/csv"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 )
 
@@ -17,31 +22,29 @@ func NewListAction() CliAction {
 }
 
 func (a *actionList) Do(cfg *config.Config) {
-	dbRepository := database.NewRepository(cfg.List.Database)
+	client := newClient(cfg.List.Database)
+	defer client.Close()
 
-	backupIter := dbRepository.List()
-	printBackups(backupIter, cfg.List.Factor)
+	backups, err := client.List(context.Background(), api.ListRequest{Status: cfg.List.Status})
+	if err != nil {
+		LogFatal("Could not list the backups. Error: %v", err)
+	}
+	printBackups(backups, cfg.List.Factor)
 }
 
-func printBackups(iter database.BackupIterator, factor int) []uint {
-	defer iter.Close()
-	backupIds := make([]uint, 0, 10)
+func printBackups(backups []*model.Backup, factor int) []uint {
+	backupIds := make([]uint, 0, len(backups))
 
 	w := csv.NewWriter(os.Stdout)
 	w.UseCRLF = true
 	w.Comma = ';'
 
-	err := w.Write([]string{"ID", "CREATED", "VAULT", "DESCRIPTION", "LENGTH", "ARCHIVE_ID"})
+	err := w.Write([]string{"ID", "CREATED", "VAULT", "DESCRIPTION", "LENGTH", "VOLUMES", "ARCHIVE_ID", "STATUS"})
 	if err != nil {
 		panic(err)
 	}
 
-	for {
-		backup, next := iter.Next()
-		if !next {
-			break
-		}
-
+	for _, backup := range backups {
 		backupIds = append(backupIds, backup.ID)
 
 		var sLength string
@@ -52,13 +55,20 @@ func printBackups(iter database.BackupIterator, factor int) []uint {
 			sLength = fmt.Sprintf("%.2f", float64(2684354560)/float64(factor))
 		}
 
+		var archiveIds []string
+		for _, volume := range backup.Volumes {
+			archiveIds = append(archiveIds, sValue(volume.ArchiveId))
+		}
+
 		err = w.Write([]string{
 			fmt.Sprintf("%d", backup.ID),
 			backup.CreatedAt.Format(time.RFC3339),
 			backup.Vault,
 			backup.Description,
 			sLength,
-			sValue(backup.ArchiveId),
+			fmt.Sprintf("%d", len(backup.Volumes)),
+			strings.Join(archiveIds, ","),
+			backup.Status,
 		})
 		if err != nil {
 			panic(err)
@@ -72,6 +82,12 @@ func printBackups(iter database.BackupIterator, factor int) []uint {
 func (a *actionList) Validate(cfg *config.Config) {
 	ValidateDatabase(&cfg.List.DatabaseConfig)
 
+	for _, status := range cfg.List.Status {
+		if !backup.IsValidStatus(status) || status == model.BackupStatusDeleted {
+			cfg.List.Fail("Invalid status: %s. Possible: pending;uploading;completed;completed-with-warnings;failed;cancelled;deleting", status)
+		}
+	}
+
 	if cfg.List.Factor < 1 {
 		cfg.List.Factor = 1
 	}
@@ -0,0 +1,101 @@
+package cli
+
+import (
+	api "backup2glacier/api/v1"
+	"backup2glacier/config"
+	. "backup2glacier/log"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"time"
+)
+
+type actionRecoverCatalog struct {
+}
+
+func NewRecoverCatalogAction() CliAction {
+	return &actionRecoverCatalog{}
+}
+
+func (a *actionRecoverCatalog) Do(cfg *config.Config) {
+	client := newClient(cfg.RecoverCatalog.Database, append(awsOptions(&cfg.RecoverCatalog.AwsGeneralConfig),
+		api.WithRetrieval(cfg.RecoverCatalog.AWSTier, cfg.RecoverCatalog.AWSPollInterval))...)
+	defer client.Close()
+
+	ctx := context.Background()
+	report, err := client.RecoverCatalog(ctx, api.RecoverRequest{
+		Vault:  cfg.RecoverCatalog.AWSVaultName,
+		Cached: cfg.RecoverCatalog.Cached,
+		DryRun: cfg.RecoverCatalog.DryRun,
+	})
+	if err != nil {
+		LogFatal("Could not recover the catalog. Error: %v", err)
+	}
+
+	printRecoverReport(report)
+
+	if cfg.RecoverCatalog.DryRun || !cfg.RecoverCatalog.Contents || len(report.Recovered) == 0 {
+		return
+	}
+
+	password := ""
+	if cfg.RecoverCatalog.Password != nil {
+		password = *cfg.RecoverCatalog.Password
+	} else {
+		password = askForPassword()
+	}
+
+	failed := false
+	for _, recovered := range report.Recovered {
+		if err := client.RecoverContents(ctx, recovered, password); err != nil {
+			LogError("Could not recover the contents of backup %d: %v", recovered.ID, err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func printRecoverReport(report *api.RecoverReport) {
+	fmt.Printf("Inventory of %s from %s\n\n", report.Vault, report.InventoryDate.Format(time.RFC3339))
+
+	w := csv.NewWriter(os.Stdout)
+	w.UseCRLF = true
+	w.Comma = ';'
+
+	err := w.Write([]string{"BACKUP_ID", "CREATED", "VOLUMES", "LENGTH", "DESCRIPTION", "SOURCES"})
+	if err != nil {
+		panic(err)
+	}
+
+	for _, recovered := range report.Recovered {
+		err = w.Write([]string{
+			fmt.Sprintf("%d", recovered.ID),
+			recovered.CreatedAt.Format(time.RFC3339),
+			fmt.Sprintf("%d", len(recovered.Volumes)),
+			fmt.Sprintf("%d", recovered.Length),
+			recovered.Description,
+			recovered.Sources,
+		})
+		if err != nil {
+			panic(err)
+		}
+	}
+	w.Flush()
+
+	fmt.Printf("\nRecovered %d backup(s). %d archive(s) are already in the catalog.\n", len(report.Recovered), report.Known)
+	if len(report.Foreign) > 0 {
+		fmt.Printf("%d archive(s) have no metadata. They can be adopted with %s.\n", len(report.Foreign), config.ActionSync)
+	}
+}
+
+func (a *actionRecoverCatalog) Validate(cfg *config.Config) {
+	if !isValidTier(cfg.RecoverCatalog.AWSTier) {
+		cfg.RecoverCatalog.Fail("The tier is not valid. Valid tiers are: %+v", validTiers)
+	}
+
+	ValidateDatabase(&cfg.RecoverCatalog.DatabaseConfig)
+	ValidateAWS(&cfg.RecoverCatalog.AwsGeneralConfig)
+}
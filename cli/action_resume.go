@@ -0,0 +1,58 @@
+package cli
+
+import (
+	api "backup2glacier/api/v1"
+	"backup2glacier/config"
+	. "backup2glacier/log"
+)
+
+type actionResume struct {
+}
+
+func NewResumeAction() CliAction {
+	return &actionResume{}
+}
+
+func (a *actionResume) Do(cfg *config.Config) {
+	client := newClient(cfg.Resume.Database, append(awsOptions(&cfg.Resume.AwsGeneralConfig),
+		bandwidthOption(&cfg.Resume.BandwidthConfig),
+		api.WithConcurrency(cfg.Resume.UploadConcurrency),
+		api.WithSpool(spoolConfig(&cfg.Resume.SpoolConfig)))...)
+	defer client.Close()
+
+	request := api.ResumeRequest{
+		BackupId:       cfg.Resume.BackupId,
+		PasswordPrompt: askForPassword,
+		KeepOnCancel:   cfg.Resume.KeepOnCancel,
+	}
+	if cfg.Resume.Password != nil {
+		request.Password = *cfg.Resume.Password
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+
+	result, err := client.Resume(ctx, request)
+	exitIfCancelled(err)
+
+	if err != nil {
+		LogError("Could not resume backup. Error: %v", err)
+	} else {
+		LogInfo("Successfully resume backup. Result: %+v", result)
+	}
+	if result.Retries > 0 {
+		LogInfo("%d glacier operations had to be retried.", result.Retries)
+	}
+}
+
+func (a *actionResume) Validate(cfg *config.Config) {
+	if cfg.Resume.UploadConcurrency < 1 {
+		cfg.Resume.Fail("The upload concurrency must be at least 1.")
+	}
+
+	//the part size is not known until the backup is loaded
+	ValidateSpool(&cfg.Resume.SpoolConfig, 0, cfg.Resume.UploadConcurrency)
+	ValidateDatabase(&cfg.Resume.DatabaseConfig)
+	ValidateAWS(&cfg.Resume.AwsGeneralConfig)
+	ValidateBandwidth(&cfg.Resume.BandwidthConfig)
+}
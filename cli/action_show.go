@@ -1,8 +1,12 @@
 package cli
 
 import (
+	api "backup2glacier/api/v1"
+	"backup2glacier/backup"
 	"backup2glacier/config"
-	"backup2glacier/database"
+	"backup2glacier/database/model"
+	. "backup2glacier/log"
+	"context"
 	"encoding/csv"
 	"fmt"
 	"os"
@@ -17,65 +21,144 @@ func NewShowAction() CliAction {
 }
 
 func (a *actionShow) Do(cfg *config.Config) {
-	dbRepository := database.NewRepository(cfg.Show.Database)
+	client := newClient(cfg.Show.Database)
+	defer client.Close()
 
-	backup, contentIter := dbRepository.GetBackupContentsById(cfg.Show.BackupId)
-	defer contentIter.Close()
-
-	if backup.ID == 0 {
-		//Not found!
+	details, err := client.Show(context.Background(), cfg.Show.BackupId)
+	if api.IsNotFound(err) {
 		return
 	}
+	if err != nil {
+		LogFatal("Could not show the backup. Error: %v", err)
+	}
+	dbBackup := details.Backup
+
+	backend := dbBackup.Backend
+	if backend == "" {
+		backend = backup.BackendGlacier
+	}
 
 	fmt.Printf(`Id: %d
+Backend: %s
 Vault: %s
+Region: %s
+Account: %s
 Description: %s
 Length: %d
 Created at: %s
-Archive Id: %s
-Upload Id: %s
-Location: %s
 Password: %s
+Status: %s (since %s)
 Error: %s
-Content:
-
-`, backup.ID,
-		backup.Vault,
-		backup.Description,
-		backup.Length,
-		backup.CreatedAt.Format(time.RFC3339),
-		sValue(backup.ArchiveId),
-		sValue(backup.UploadId),
-		sValue(backup.Location),
-		backup.Password,
-		backup.Error)
+Volumes:
+
+`, dbBackup.ID,
+		backend,
+		dbBackup.Vault,
+		dbBackup.Region,
+		dbBackup.AccountId,
+		dbBackup.Description,
+		dbBackup.Length,
+		dbBackup.CreatedAt.Format(time.RFC3339),
+		dbBackup.Password,
+		dbBackup.Status,
+		dbBackup.StatusChangedAt.Format(time.RFC3339),
+		dbBackup.Error)
 
 	w := csv.NewWriter(os.Stdout)
 	w.UseCRLF = true
 	w.Comma = ';'
 
-	err := w.Write([]string{"PATH", "LENGTH", "MODIFY"})
+	err = w.Write([]string{"VOLUME", "LENGTH", "ARCHIVE_ID", "UPLOAD_ID", "LOCATION", "CHECKSUM", "ERROR"})
 	if err != nil {
 		panic(err)
 	}
 
-	for {
-		content, next := contentIter.Next()
-		if !next {
-			break
+	volumeNumbers := map[uint]int{}
+	for _, volume := range details.Volumes {
+		volumeNumbers[volume.ID] = volume.Number
+
+		err = w.Write([]string{
+			fmt.Sprintf("%d", volume.Number),
+			fmt.Sprintf("%d", volume.Length),
+			sValue(volume.ArchiveId),
+			sValue(volume.UploadId),
+			sValue(volume.Location),
+			sValue(volume.Checksum),
+			volume.Error,
+		})
+		if err != nil {
+			panic(err)
 		}
+	}
+	w.Flush()
 
-		w.Write([]string{
+	if replicas := details.Replicas; len(replicas) > 0 {
+		fmt.Printf("\nReplicas:\n\n")
+
+		err = w.Write([]string{"VOLUME", "VAULT", "REGION", "LENGTH", "ARCHIVE_ID", "UPLOAD_ID", "ERROR"})
+		if err != nil {
+			panic(err)
+		}
+		for _, replica := range replicas {
+			err = w.Write([]string{
+				fmt.Sprintf("%d", volumeNumbers[replica.VolumeID]),
+				replica.Vault,
+				replica.Region,
+				fmt.Sprintf("%d", replica.Length),
+				sValue(replica.ArchiveId),
+				sValue(replica.UploadId),
+				replica.Error,
+			})
+			if err != nil {
+				panic(err)
+			}
+		}
+		w.Flush()
+	}
+
+	if transitions := details.Transitions; len(transitions) > 0 {
+		fmt.Printf("\nHistory:\n\n")
+
+		err = w.Write([]string{"AT", "FROM", "TO", "ERROR"})
+		if err != nil {
+			panic(err)
+		}
+		for _, transition := range transitions {
+			err = w.Write([]string{
+				transition.CreatedAt.Format(time.RFC3339),
+				transition.FromStatus,
+				transition.ToStatus,
+				transition.Error,
+			})
+			if err != nil {
+				panic(err)
+			}
+		}
+		w.Flush()
+	}
+
+	fmt.Printf("\nContent:\n\n")
+
+	err = w.Write([]string{"PATH", "LENGTH", "MODIFY", "VOLUME"})
+	if err != nil {
+		panic(err)
+	}
+
+	err = client.Contents(context.Background(), dbBackup.ID, func(content *model.Content) {
+		err := w.Write([]string{
 			content.Path,
 			fmt.Sprintf("%d", content.Length),
 			content.ModTime.Format(time.RFC3339),
+			fmt.Sprintf("%d", volumeNumbers[content.VolumeID]),
 		})
-
 		if err != nil {
 			panic(err)
 		}
-	}
+	})
 	w.Flush()
+	if err != nil {
+		LogFatal("Could not read the content of the backup. Error: %v", err)
+	}
 }
 
 func (a *actionShow) Validate(cfg *config.Config) {
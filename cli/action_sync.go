@@ -0,0 +1,113 @@
+package cli
+
+import (
+	api "backup2glacier/api/v1"
+	"backup2glacier/config"
+	. "backup2glacier/log"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"time"
+)
+
+type actionSync struct {
+}
+
+func NewSyncAction() CliAction {
+	return &actionSync{}
+}
+
+func (a *actionSync) Do(cfg *config.Config) {
+	client := newClient(cfg.Sync.Database, append(awsOptions(&cfg.Sync.AwsGeneralConfig),
+		api.WithPollInterval(cfg.Sync.AWSPollInterval))...)
+	defer client.Close()
+
+	ctx := context.Background()
+	report, err := client.Sync(ctx, api.SyncRequest{
+		Vault:  cfg.Sync.AWSVaultName,
+		Cached: cfg.Sync.Cached,
+	})
+	if err != nil {
+		LogFatal("Could not sync vault. Error: %v", err)
+	}
+
+	printSyncReport(report)
+
+	if cfg.Sync.DryRun {
+		return
+	}
+
+	for _, archive := range report.Unknown {
+		if cfg.Sync.DontAsk || askYesNo(fmt.Sprintf("Adopt archive %s (%s) into the catalog?", archive.ArchiveId, archive.Description)) {
+			if _, err := client.Adopt(ctx, report.Vault, archive); err != nil {
+				LogFatal("Could not adopt archive %s. Error: %v", archive.ArchiveId, err)
+			}
+		}
+	}
+	for _, missing := range report.Missing {
+		if cfg.Sync.DontAsk || askYesNo(fmt.Sprintf("Remove volume %d of backup %d from the catalog?", missing.Volume.Number, missing.Backup.ID)) {
+			if err := client.Prune(ctx, missing); err != nil {
+				LogFatal("Could not prune volume %d of backup %d. Error: %v", missing.Volume.Number, missing.Backup.ID, err)
+			}
+		}
+	}
+}
+
+func printSyncReport(report *api.SyncReport) {
+	fmt.Printf("Inventory of %s from %s\n\n", report.Vault, report.InventoryDate.Format(time.RFC3339))
+
+	w := csv.NewWriter(os.Stdout)
+	w.UseCRLF = true
+	w.Comma = ';'
+
+	err := w.Write([]string{"STATE", "BACKUP_ID", "VOLUME", "ARCHIVE_ID", "CATALOG_LENGTH", "VAULT_LENGTH", "DESCRIPTION"})
+	if err != nil {
+		panic(err)
+	}
+
+	for _, archive := range report.Unknown {
+		err = w.Write([]string{"UNKNOWN", "", "", archive.ArchiveId, "", fmt.Sprintf("%d", archive.Size), archive.Description})
+		if err != nil {
+			panic(err)
+		}
+	}
+	for _, missing := range report.Missing {
+		err = w.Write([]string{
+			"MISSING",
+			fmt.Sprintf("%d", missing.Backup.ID),
+			fmt.Sprintf("%d", missing.Volume.Number),
+			sValue(missing.Volume.ArchiveId),
+			fmt.Sprintf("%d", missing.Volume.Length),
+			"",
+			missing.Backup.Description,
+		})
+		if err != nil {
+			panic(err)
+		}
+	}
+	for _, mismatch := range report.Mismatches {
+		err = w.Write([]string{
+			"MISMATCH (" + mismatch.Reason + ")",
+			fmt.Sprintf("%d", mismatch.Backup.ID),
+			fmt.Sprintf("%d", mismatch.Volume.Number),
+			mismatch.Archive.ArchiveId,
+			fmt.Sprintf("%d", mismatch.Volume.Length),
+			fmt.Sprintf("%d", mismatch.Archive.Size),
+			mismatch.Backup.Description,
+		})
+		if err != nil {
+			panic(err)
+		}
+	}
+	w.Flush()
+
+	if len(report.Unknown)+len(report.Missing)+len(report.Mismatches) == 0 {
+		fmt.Println("The catalog is in sync with the vault.")
+	}
+}
+
+func (a *actionSync) Validate(cfg *config.Config) {
+	ValidateDatabase(&cfg.Sync.DatabaseConfig)
+	ValidateAWS(&cfg.Sync.AwsGeneralConfig)
+}
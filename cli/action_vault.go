@@ -0,0 +1,279 @@
+package cli
+
+import (
+	api "backup2glacier/api/v1"
+	"backup2glacier/backup"
+	"backup2glacier/config"
+	"backup2glacier/database/model"
+	. "backup2glacier/log"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+type actionVault struct {
+}
+
+func NewVaultAction() CliAction {
+	return &actionVault{}
+}
+
+func (a *actionVault) Do(cfg *config.Config) {
+	client := newClient(cfg.Vault.Database, awsOptions(&cfg.Vault.AwsGeneralConfig)...)
+	defer client.Close()
+
+	ctx := context.Background()
+	vaultName := cfg.Vault.AWSVaultName
+
+	var err error
+	switch cfg.Vault.Command {
+	case config.VaultCommandCreate:
+		err = client.CreateVault(ctx, vaultName)
+	case config.VaultCommandList:
+		var vaults []*api.VaultInfo
+		if vaults, err = client.ListVaults(ctx); err == nil {
+			printVaults(vaults)
+		}
+	case config.VaultCommandDescribe:
+		var vault *api.VaultInfo
+		if vault, err = client.DescribeVault(ctx, vaultName); err == nil {
+			printVault(vault)
+		}
+	case config.VaultCommandDelete:
+		if !cfg.Vault.DontAsk && !askYesNo(fmt.Sprintf("Are you sure to delete the vault %s?", cfg.Vault.AWSVaultName)) {
+			LogFatal("Vault deletion cancelled!")
+		}
+		err = client.DeleteVault(ctx, vaultName)
+	case config.VaultCommandTags:
+		var tags map[string]string
+		if tags, err = client.VaultTags(ctx, vaultName); err == nil {
+			printTags(tags)
+		}
+	case config.VaultCommandTag:
+		err = client.TagVault(ctx, vaultName, parseTags(cfg.Vault.Tags))
+	case config.VaultCommandUntag:
+		err = client.UntagVault(ctx, vaultName, cfg.Vault.Tags)
+	case config.VaultCommandPolicy:
+		var policy string
+		if policy, err = client.VaultPolicy(ctx, vaultName); err == nil {
+			fmt.Println(policy)
+		}
+	case config.VaultCommandSetPolicy:
+		err = client.SetVaultPolicy(ctx, vaultName, cfg.Vault.Policy)
+	case config.VaultCommandDeletePolicy:
+		err = client.DeleteVaultPolicy(ctx, vaultName)
+	case config.VaultCommandNotifications:
+		var notifications *api.VaultNotifications
+		if notifications, err = client.VaultNotifications(ctx, vaultName); err == nil && notifications != nil {
+			fmt.Printf("SNS topic: %s\nEvents: %s\n", notifications.SNSTopic, strings.Join(notifications.Events, ";"))
+		}
+	case config.VaultCommandSetNotifications:
+		err = client.SetVaultNotifications(ctx, vaultName, api.VaultNotifications{
+			SNSTopic: cfg.Vault.SNSTopic,
+			Events:   cfg.Vault.Events,
+		})
+	case config.VaultCommandDeleteNotifications:
+		err = client.DeleteVaultNotifications(ctx, vaultName)
+	case config.VaultCommandLockInitiate:
+		var lock *model.VaultLock
+		if lock, err = client.InitiateVaultLock(ctx, vaultName, cfg.Vault.Policy); err == nil {
+			printVaultLock(lock)
+		}
+	case config.VaultCommandLockStatus:
+		var lock *model.VaultLock
+		if lock, err = client.VaultLockStatus(ctx, vaultName); err == nil && lock != nil {
+			printVaultLock(lock)
+		}
+	case config.VaultCommandLockComplete:
+		if !cfg.Vault.DontAsk && !askYesNo(fmt.Sprintf("The lock policy of vault %s can never be changed or removed after completion. Are you sure?", cfg.Vault.AWSVaultName)) {
+			LogFatal("Vault lock completion cancelled!")
+		}
+		var lock *model.VaultLock
+		if lock, err = client.CompleteVaultLock(ctx, vaultName); err == nil {
+			printVaultLock(lock)
+		}
+	case config.VaultCommandLockAbort:
+		err = client.AbortVaultLock(ctx, vaultName)
+	}
+
+	if err != nil {
+		LogFatal("Error while %s vault. Error: %v", strings.ToLower(cfg.Vault.Command), err)
+	}
+}
+
+func printVaults(vaults []*api.VaultInfo) {
+	w := csv.NewWriter(os.Stdout)
+	w.UseCRLF = true
+	w.Comma = ';'
+
+	err := w.Write([]string{"VAULT", "CREATED", "ARCHIVES", "SIZE", "LAST_INVENTORY", "CATALOG_BACKUPS"})
+	if err != nil {
+		panic(err)
+	}
+
+	for _, vault := range vaults {
+		err = w.Write([]string{
+			vault.VaultName,
+			formatDate(vault.CreationDate),
+			fmt.Sprintf("%d", vault.NumberOfArchives),
+			fmt.Sprintf("%d", vault.SizeInBytes),
+			formatDate(vault.LastInventoryDate),
+			fmt.Sprintf("%d", vault.LiveBackups),
+		})
+		if err != nil {
+			panic(err)
+		}
+	}
+	w.Flush()
+}
+
+func printVault(vault *api.VaultInfo) {
+	fmt.Printf(`Vault: %s
+ARN: %s
+Created at: %s
+Archives: %d
+Size: %d
+Last inventory: %s
+Last cached inventory: %s
+Backups in catalog: %d
+`, vault.VaultName,
+		vault.VaultARN,
+		formatDate(vault.CreationDate),
+		vault.NumberOfArchives,
+		vault.SizeInBytes,
+		formatDate(vault.LastInventoryDate),
+		formatDate(vault.CachedInventoryDate),
+		vault.LiveBackups)
+}
+
+func printTags(tags map[string]string) {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	w := csv.NewWriter(os.Stdout)
+	w.UseCRLF = true
+	w.Comma = ';'
+
+	err := w.Write([]string{"KEY", "VALUE"})
+	if err != nil {
+		panic(err)
+	}
+
+	for _, key := range keys {
+		err = w.Write([]string{key, tags[key]})
+		if err != nil {
+			panic(err)
+		}
+	}
+	w.Flush()
+}
+
+func printVaultLock(lock *model.VaultLock) {
+	fmt.Printf(`Vault: %s
+State: %s
+Lock id: %s
+Initiated at: %s
+Expires at: %s
+Completed at: %s
+Policy: %s
+`, lock.Vault,
+		lock.State,
+		lock.LockId,
+		lock.CreatedAt.Format(time.RFC3339),
+		lock.ExpirationDate.Format(time.RFC3339),
+		formatDate(lock.CompletedAt),
+		lock.Policy)
+}
+
+func parseTags(tags []string) map[string]string {
+	parsed := map[string]string{}
+	for _, tag := range tags {
+		split := strings.SplitN(tag, "=", 2)
+		parsed[split[0]] = split[1]
+	}
+
+	return parsed
+}
+
+func formatDate(date *time.Time) string {
+	if date == nil {
+		return ""
+	}
+
+	return date.Format(time.RFC3339)
+}
+
+func (a *actionVault) Validate(cfg *config.Config) {
+	cfg.Vault.Command = strings.ToUpper(cfg.Vault.Command)
+
+	switch cfg.Vault.Command {
+	case config.VaultCommandList:
+	case config.VaultCommandCreate, config.VaultCommandDescribe, config.VaultCommandDelete,
+		config.VaultCommandTags, config.VaultCommandTag, config.VaultCommandUntag,
+		config.VaultCommandPolicy, config.VaultCommandSetPolicy, config.VaultCommandDeletePolicy,
+		config.VaultCommandNotifications, config.VaultCommandSetNotifications, config.VaultCommandDeleteNotifications,
+		config.VaultCommandLockInitiate, config.VaultCommandLockStatus, config.VaultCommandLockComplete, config.VaultCommandLockAbort:
+		if cfg.Vault.AWSVaultName == "" {
+			cfg.Vault.Fail("No vault name given!")
+		}
+	default:
+		cfg.Vault.Fail("Invalid vault command: %s. Possible: %s", cfg.Vault.Command, strings.Join([]string{
+			config.VaultCommandCreate, config.VaultCommandList, config.VaultCommandDescribe, config.VaultCommandDelete,
+			config.VaultCommandTags, config.VaultCommandTag, config.VaultCommandUntag,
+			config.VaultCommandPolicy, config.VaultCommandSetPolicy, config.VaultCommandDeletePolicy,
+			config.VaultCommandNotifications, config.VaultCommandSetNotifications, config.VaultCommandDeleteNotifications,
+			config.VaultCommandLockInitiate, config.VaultCommandLockStatus, config.VaultCommandLockComplete, config.VaultCommandLockAbort,
+		}, ";"))
+	}
+
+	switch cfg.Vault.Command {
+	case config.VaultCommandTag, config.VaultCommandUntag:
+		if len(cfg.Vault.Tags) == 0 {
+			cfg.Vault.Fail("No tag given!")
+		}
+		if cfg.Vault.Command == config.VaultCommandTag {
+			for _, tag := range cfg.Vault.Tags {
+				if !strings.Contains(tag, "=") {
+					cfg.Vault.Fail("Invalid tag: %s. Expected: key=value", tag)
+				}
+			}
+		}
+	case config.VaultCommandSetPolicy, config.VaultCommandLockInitiate:
+		if cfg.Vault.PolicyFile == "" {
+			cfg.Vault.Fail("No policy file given!")
+		}
+		policy, err := ioutil.ReadFile(cfg.Vault.PolicyFile)
+		if err != nil {
+			cfg.Vault.Fail("Could not read policy file: %v", err)
+		}
+		if !json.Valid(policy) {
+			cfg.Vault.Fail("The policy file contains no valid JSON!")
+		}
+		cfg.Vault.Policy = string(policy)
+	case config.VaultCommandSetNotifications:
+		if cfg.Vault.SNSTopic == "" {
+			cfg.Vault.Fail("No SNS topic given!")
+		}
+		if len(cfg.Vault.Events) == 0 {
+			cfg.Vault.Events = []string{backup.EventArchiveRetrievalCompleted, backup.EventInventoryRetrievalCompleted}
+		}
+		for _, event := range cfg.Vault.Events {
+			if event != backup.EventArchiveRetrievalCompleted && event != backup.EventInventoryRetrievalCompleted {
+				cfg.Vault.Fail("Invalid event: %s. Possible: %s;%s", event,
+					backup.EventArchiveRetrievalCompleted, backup.EventInventoryRetrievalCompleted)
+			}
+		}
+	}
+
+	ValidateDatabase(&cfg.Vault.DatabaseConfig)
+	ValidateAWS(&cfg.Vault.AwsGeneralConfig)
+}
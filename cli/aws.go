@@ -1,12 +1,78 @@
 package cli
 
 import (
+	api "backup2glacier/api/v1"
+	"backup2glacier/backup"
 	"backup2glacier/config"
+	. "backup2glacier/log"
 	"os"
+	"regexp"
+	"strings"
 )
 
+var accountIdPattern = regexp.MustCompile(`^[0-9]{12}$`)
+
 func ValidateAWS(cfg *config.AwsGeneralConfig) {
 	if cfg.AWSProfile != "" {
 		os.Setenv("AWS_PROFILE", cfg.AWSProfile)
 	}
+
+	retryPolicy := retryPolicy(cfg)
+	if retryPolicy.MaxAttempts < 1 {
+		LogFatal("The maximum number of attempts must be at least 1.")
+	}
+	if retryPolicy.Jitter < 0 || retryPolicy.Jitter > 1 {
+		LogFatal("The retry jitter must be between 0 and 1.")
+	}
+
+	if cfg.AWSAccountId != "" && cfg.AWSAccountId != backup.DefaultAccountId && !accountIdPattern.MatchString(cfg.AWSAccountId) {
+		LogFatal("The AWS account id must consist of 12 digits.")
+	}
+	if cfg.AWSRoleARN != "" && !strings.HasPrefix(cfg.AWSRoleARN, "arn:") {
+		LogFatal("Invalid role ARN: %s", cfg.AWSRoleARN)
+	}
+	if cfg.AWSRoleARN == "" && (cfg.AWSExternalId != "" || cfg.AWSRoleSessionName != "") {
+		LogFatal("The external id and the session name can only be used together with a role ARN.")
+	}
+
+	if _, err := config.ParseRetrievalDelays(cfg.DirectoryRetrievalDelay); err != nil {
+		LogFatal("Invalid retrieval delay. Error: %v", err)
+	}
+}
+
+// awsOptions returns the options of the client for the (validated) AWS configuration
+func awsOptions(cfg *config.AwsGeneralConfig) []api.Option {
+	delays, _ := config.ParseRetrievalDelays(cfg.DirectoryRetrievalDelay)
+
+	return []api.Option{
+		api.WithRetryPolicy(retryPolicy(cfg)),
+		api.WithEndpoints(cfg.AWSEndpoint, cfg.S3Endpoint),
+		api.WithLocation(cfg.AWSRegion, cfg.AWSAccountId),
+		api.WithAssumeRole(backup.AssumeRole{
+			RoleARN:     cfg.AWSRoleARN,
+			ExternalId:  cfg.AWSExternalId,
+			SessionName: cfg.AWSRoleSessionName,
+		}),
+		api.WithRetrievalDelays(delays),
+	}
+}
+
+// retryPolicy returns the default retry policy with the values of the configuration
+func retryPolicy(cfg *config.AwsGeneralConfig) backup.RetryPolicy {
+	retryPolicy := backup.DefaultRetryPolicy()
+	if cfg.AWSMaxAttempts != 0 {
+		retryPolicy.MaxAttempts = cfg.AWSMaxAttempts
+	}
+	if cfg.AWSRetryDelay != 0 {
+		retryPolicy.BaseDelay = cfg.AWSRetryDelay
+	}
+	if cfg.AWSRetryMaxDelay != 0 {
+		retryPolicy.MaxDelay = cfg.AWSRetryMaxDelay
+	}
+	if cfg.AWSRetryJitter != nil {
+		retryPolicy.Jitter = *cfg.AWSRetryJitter
+	}
+	retryPolicy.RetryableCodes = cfg.AWSRetryCodes
+
+	return retryPolicy
 }
@@ -0,0 +1,49 @@
+package cli
+
+import (
+	api "backup2glacier/api/v1"
+	"backup2glacier/backup"
+	"backup2glacier/config"
+	. "backup2glacier/log"
+)
+
+// ValidateBandwidth checks the bandwidth limits and the schedule
+func ValidateBandwidth(cfg *config.BandwidthConfig) {
+	if cfg.BWLimit != "" {
+		if _, err := config.ParseSize(cfg.BWLimit); err != nil {
+			LogFatal("Invalid bandwidth limit. Error: %v", err)
+		}
+	}
+
+	schedule, err := config.ParseBandwidthSchedule(cfg.BWLimitSchedule)
+	if err != nil {
+		LogFatal("Invalid bandwidth schedule. Error: %v", err)
+	}
+	if cfg.PauseOutsideWindow && len(schedule) == 0 {
+		LogFatal("The upload can only be paused outside of the time windows if there is a bandwidth schedule.")
+	}
+}
+
+// bandwidthOption returns the option of the client which limits all transfers by the (validated) bandwidth limits
+func bandwidthOption(cfg *config.BandwidthConfig) api.Option {
+	var rate int64
+	if cfg.BWLimit != "" {
+		rate, _ = config.ParseSize(cfg.BWLimit)
+	}
+	schedule, _ := config.ParseBandwidthSchedule(cfg.BWLimitSchedule)
+
+	if rate == 0 && len(schedule) == 0 {
+		return api.WithBandwidthLimiter(nil)
+	}
+
+	windows := make([]backup.BandwidthWindow, 0, len(schedule))
+	for _, window := range schedule {
+		windows = append(windows, backup.BandwidthWindow{
+			From: window.From,
+			To:   window.To,
+			Rate: window.Rate,
+		})
+	}
+
+	return api.WithBandwidthLimiter(backup.NewBandwidthLimiter(rate, cfg.PauseOutsideWindow, windows...))
+}
@@ -0,0 +1,40 @@
+package cli
+
+import (
+	api "backup2glacier/api/v1"
+	"backup2glacier/config"
+	. "backup2glacier/log"
+	"context"
+)
+
+// ValidateCatalogBackup validates the configuration of the catalog snapshots
+func ValidateCatalogBackup(cfg *config.CatalogBackupConfig) {
+	if cfg.CatalogVault == "" {
+		return
+	}
+
+	if cfg.CatalogPassword == "" {
+		LogFatal("The catalog snapshots need their own password (--catalog-password).")
+	}
+	if cfg.CatalogKeep < 1 {
+		LogFatal("At least one catalog snapshot must be kept.")
+	}
+}
+
+// BackupCatalog uploads a snapshot of the catalog of the client if the catalog backup is enabled. A failed
+// catalog backup does not fail the whole run. It is not cancelled by a signal, because it saves the catalog after
+// an interrupted run.
+func BackupCatalog(client *api.Client, cfg *config.CatalogBackupConfig) {
+	if cfg.CatalogVault == "" {
+		return
+	}
+
+	err := client.BackupCatalog(context.Background(), api.CatalogBackupRequest{
+		Vault:    cfg.CatalogVault,
+		Password: cfg.CatalogPassword,
+		Keep:     cfg.CatalogKeep,
+	})
+	if err != nil {
+		LogError("Could not backup the catalog. Error: %v", err)
+	}
+}
@@ -0,0 +1,16 @@
+package cli
+
+import (
+	api "backup2glacier/api/v1"
+	. "backup2glacier/log"
+)
+
+// newClient creates the client of the library API for the catalog in the given database
+func newClient(database string, opts ...api.Option) *api.Client {
+	client, err := api.New(append([]api.Option{api.WithDatabase(database)}, opts...)...)
+	if err != nil {
+		LogFatal("Could not init backup. Error: %v", err)
+	}
+
+	return client
+}
@@ -2,6 +2,9 @@ package cli
 
 import (
 	"backup2glacier/config"
+	"backup2glacier/database"
+	. "backup2glacier/log"
+	"github.com/pkg/errors"
 	"os"
 	"os/user"
 	"strings"
@@ -18,4 +21,9 @@ func ValidateDatabase(cfg *config.DatabaseConfig) {
 
 		cfg.Database = usr.HomeDir + "/" + cfg.Database[2:]
 	}
+
+	//the catalog must not be changed by an older version
+	if _, _, err := database.PendingMigrations(cfg.Database); errors.Cause(err) == database.ErrSchemaTooNew {
+		LogFatal("Can not use the database %s: %v", cfg.Database, err)
+	}
 }
@@ -0,0 +1,49 @@
+package cli
+
+import (
+	api "backup2glacier/api/v1"
+	. "backup2glacier/log"
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// exitInterrupted is the exit code if the process is terminated by a second signal
+const exitInterrupted = 130
+
+// signalContext returns a context which will be cancelled by the first SIGINT or SIGTERM, so that the running
+// operation can stop gracefully. A second signal terminates the process immediately. The returned function
+// stops the handling of the signals.
+func signalContext() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case sig := <-signals:
+			LogError("Received %s: stop the running operation. Send it again to exit immediately.", sig)
+			cancel()
+		case <-ctx.Done():
+			return
+		}
+
+		sig := <-signals
+		LogError("Received %s again: exit immediately.", sig)
+		os.Exit(exitInterrupted)
+	}()
+
+	return ctx, func() {
+		signal.Stop(signals)
+		cancel()
+	}
+}
+
+// exitIfCancelled terminates the process if the operation is stopped by a signal
+func exitIfCancelled(err error) {
+	if api.IsCancelled(err) {
+		LogError("Cancelled: %v", err)
+		os.Exit(exitInterrupted)
+	}
+}
@@ -0,0 +1,54 @@
+package cli
+
+import (
+	"backup2glacier/backup"
+	"backup2glacier/config"
+	. "backup2glacier/log"
+	"os"
+	"os/user"
+	"strings"
+)
+
+// ValidateSpool validates the spool configuration. If the part size is known (> 0), it will be checked that
+// the spool directory is large enough for the given number of concurrent parts.
+func ValidateSpool(cfg *config.SpoolConfig, partSize, concurrency int) {
+	cfg.SpoolMode = strings.ToLower(cfg.SpoolMode)
+
+	switch cfg.SpoolMode {
+	case config.SpoolModeMemory:
+		if partSize > 0 {
+			LogInfo("Up to %d MiB memory will be used for buffering the parts.", partSize*concurrency/1024/1024)
+		}
+		return
+	case config.SpoolModeDisk:
+	default:
+		LogFatal("Invalid spool mode: %s. Possible: %s;%s", cfg.SpoolMode, config.SpoolModeDisk, config.SpoolModeMemory)
+	}
+
+	if strings.HasPrefix(cfg.SpoolDir, "~/") {
+		usr, _ := user.Current()
+
+		cfg.SpoolDir = usr.HomeDir + "/" + cfg.SpoolDir[2:]
+	}
+
+	if cfg.SpoolDir != "" {
+		handle, err := os.Stat(cfg.SpoolDir)
+		if err != nil || !handle.IsDir() {
+			LogFatal("The spool directory does not exist: %s", cfg.SpoolDir)
+		}
+	}
+
+	if partSize > 0 {
+		if err := backup.CheckSpoolSpace(cfg.SpoolDir, int64(partSize)*int64(concurrency)); err != nil {
+			LogFatal("The spool directory is too small for %d concurrent parts of %d MiB. Choose an other spool directory, "+
+				"a smaller part size or a lower upload concurrency. Error: %v", concurrency, partSize/1024/1024, err)
+		}
+	}
+}
+
+func spoolConfig(cfg *config.SpoolConfig) backup.SpoolConfig {
+	return backup.SpoolConfig{
+		Mode: cfg.SpoolMode,
+		Dir:  cfg.SpoolDir,
+	}
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// BandwidthWindow is a daily time window with its own transfer rate
+type BandwidthWindow struct {
+	// From is the start of the window (offset since midnight)
+	From time.Duration
+	// To is the end of the window (offset since midnight)
+	To time.Duration
+	// Rate is the transfer rate in bytes per second. 0 means unlimited.
+	Rate int64
+}
+
+// ParseBandwidthSchedule parses a comma separated list of time windows with their transfer rate (such like
+// 08:00-18:00=2M,18:00-08:00=0). The rates are parsed with ParseSize.
+func ParseBandwidthSchedule(schedule string) ([]BandwidthWindow, error) {
+	var windows []BandwidthWindow
+
+	for _, entry := range strings.Split(schedule, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.Split(entry, "=")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf(`invalid time window: "%s"`, entry)
+		}
+		times := strings.Split(parts[0], "-")
+		if len(times) != 2 {
+			return nil, fmt.Errorf(`invalid time window: "%s"`, entry)
+		}
+
+		from, err := parseTimeOfDay(times[0])
+		if err != nil {
+			return nil, err
+		}
+		to, err := parseTimeOfDay(times[1])
+		if err != nil {
+			return nil, err
+		}
+		rate, err := ParseSize(parts[1])
+		if err != nil {
+			return nil, err
+		}
+
+		windows = append(windows, BandwidthWindow{
+			From: from,
+			To:   to,
+			Rate: rate,
+		})
+	}
+
+	return windows, nil
+}
+
+// parseTimeOfDay parses a time of day (such like 08:00) into the offset since midnight
+func parseTimeOfDay(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "24:00" {
+		return 0, nil
+	}
+
+	parsed, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf(`invalid time of day: "%s"`, value)
+	}
+
+	return time.Duration(parsed.Hour())*time.Hour + time.Duration(parsed.Minute())*time.Minute, nil
+}
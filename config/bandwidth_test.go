@@ -0,0 +1,36 @@
+package config
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestParseBandwidthSchedule(t *testing.T) {
+	windows, err := ParseBandwidthSchedule("08:00-18:00=2M, 18:00-08:00=0")
+
+	assert.NoError(t, err)
+	assert.Equal(t, []BandwidthWindow{
+		{From: 8 * time.Hour, To: 18 * time.Hour, Rate: 2 * 1024 * 1024},
+		{From: 18 * time.Hour, To: 8 * time.Hour, Rate: 0},
+	}, windows)
+}
+
+func TestParseBandwidthSchedule_Midnight(t *testing.T) {
+	windows, err := ParseBandwidthSchedule("22:30-24:00=512K")
+
+	assert.NoError(t, err)
+	assert.Equal(t, []BandwidthWindow{
+		{From: 22*time.Hour + 30*time.Minute, To: 0, Rate: 512 * 1024},
+	}, windows)
+}
+
+func TestParseBandwidthSchedule_Invalid(t *testing.T) {
+	for _, schedule := range []string{"08:00=2M", "08:00-18:00", "8-18=2M", "08:00-25:00=2M", "08:00-18:00=fast"} {
+		t.Run(schedule, func(t *testing.T) {
+			_, err := ParseBandwidthSchedule(schedule)
+
+			assert.Error(t, err)
+		})
+	}
+}
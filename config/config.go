@@ -15,10 +15,56 @@ const (
 	ActionGet     = "GET"
 	ActionDelete  = "DELETE"
 	ActionCurator = "CURATOR"
+	ActionResume  = "RESUME"
+	ActionJobs    = "JOBS"
+	ActionSync    = "SYNC"
+	ActionCopy    = "COPY"
+	ActionCleanup = "CLEANUP"
+
+	ActionRecoverCatalog = "RECOVER-CATALOG"
+	ActionBootstrap      = "BOOTSTRAP"
+	ActionVault          = "VAULT"
+	ActionDB             = "DB"
+)
+
+const (
+	DBCommandMigrate = "MIGRATE"
+)
+
+const (
+	VaultCommandCreate   = "CREATE"
+	VaultCommandList     = "LIST"
+	VaultCommandDescribe = "DESCRIBE"
+	VaultCommandDelete   = "DELETE"
+
+	VaultCommandTags                = "TAGS"
+	VaultCommandTag                 = "TAG"
+	VaultCommandUntag               = "UNTAG"
+	VaultCommandPolicy              = "POLICY"
+	VaultCommandSetPolicy           = "SET-POLICY"
+	VaultCommandDeletePolicy        = "DELETE-POLICY"
+	VaultCommandNotifications       = "NOTIFICATIONS"
+	VaultCommandSetNotifications    = "SET-NOTIFICATIONS"
+	VaultCommandDeleteNotifications = "DELETE-NOTIFICATIONS"
+	VaultCommandLockInitiate        = "LOCK-INITIATE"
+	VaultCommandLockStatus          = "LOCK-STATUS"
+	VaultCommandLockComplete        = "LOCK-COMPLETE"
+	VaultCommandLockAbort           = "LOCK-ABORT"
 )
 
 const DefaultDatabase = "~/.aws/backup2glacier/database.db"
 
+// DefaultCatalogKeep is the default number of catalog snapshots which are kept in the vault
+const DefaultCatalogKeep = 3
+
+const (
+	SpoolModeDisk   = "disk"
+	SpoolModeMemory = "memory"
+)
+
+// PartSizeAuto is the part size value for choosing the part size automatically
+const PartSizeAuto = "auto"
+
 type Config struct {
 	Action string
 
@@ -28,24 +74,62 @@ type Config struct {
 	Show    *ShowConfig
 	List    *ListConfig
 	Curator *CuratorConfig
+	Resume  *ResumeConfig
+	Jobs    *JobsConfig
+	Sync    *SyncConfig
+	Copy    *CopyConfig
+	Cleanup *CleanupConfig
+
+	RecoverCatalog *RecoverCatalogConfig
+	Bootstrap      *BootstrapConfig
+	Vault          *VaultConfig
+	DB             *DBConfig
 }
 
 type CreateConfig struct {
 	GeneralConfig
 	DatabaseConfig
 	AwsGeneralConfig
+	SpoolConfig
+	BandwidthConfig
+	CatalogBackupConfig
 
-	AWSVaultName string   `arg:"positional,env:AWS_VAULT_NAME,help:The name of the glacier vault."`
+	AWSVaultName string   `arg:"positional,env:AWS_VAULT_NAME,help:The name of the glacier vault (or of the S3 bucket or the path of the directory vault)."`
 	Files        []string `arg:"positional,env:FILE,help:The file or folder to backup."`
 	Blacklist    []string `arg:"-b,separate,env:BLACKLIST,help:Regular expressions of files that should be excluded."`
 	Whitelist    []string `arg:"-w,separate,env:WHITELIST,help:Regular expressions of files that should be included even if their would be excluded by blacklist."`
 
-	AWSPartSize           int    `arg:"--aws-part-size,env:AWS_PART_SIZE,help:The size of each part (except the last) in MiB."`
-	AWSArchiveDescription string `arg:"-d,env:AWS_ARCHIVE_DESC,help:The description of the archive."`
+	AWSPartSize           string   `arg:"--aws-part-size,env:AWS_PART_SIZE,help:The size of each part (except the last) in MiB. Use 'auto' for choosing the smallest possible size for the backup. Default: 1"`
+	UploadConcurrency     int      `arg:"--upload-concurrency,env:UPLOAD_CONCURRENCY,help:The number of parts which are uploaded at the same time. Each of them is buffered in the spool (see --spool-mode). Default: 1"`
+	VolumeSize            string   `arg:"--volume-size,env:VOLUME_SIZE,help:Split the backup into multiple archives (volumes) of this size (e.g. 100G). The split is done at file boundaries. Default: no split"`
+	AWSArchiveDescription string   `arg:"-d,env:AWS_ARCHIVE_DESC,help:The description of the archive."`
+	CreateVault           bool     `arg:"--create-vault,env:CREATE_VAULT,help:Create the vault (or the directory vault) if it does not exist."`
+	Backend               string   `arg:"--backend,env:BACKEND,help:The storage backend for the backup. Default: glacier. Possible: glacier;s3;directory"`
+	S3StorageClass        string   `arg:"--s3-storage-class,env:S3_STORAGE_CLASS,help:The storage class of the S3 objects. Default: DEEP_ARCHIVE. Possible: DEEP_ARCHIVE;GLACIER;STANDARD"`
+	Replicas              []string `arg:"--replica,separate,env:REPLICAS,help:A further vault (vault@region) which receives a copy of each archive. The copies are uploaded at the same time. The vault must exist."`
+	KeepOnCancel          bool     `arg:"--keep-on-cancel,env:KEEP_ON_CANCEL,help:Keep the multipart uploads if the backup is interrupted (SIGINT/SIGTERM), so that it can be continued by RESUME. Default: the uploads are aborted"`
 
 	Password     string `arg:"-p,env:PASSWORD,help:The password for encryption."`
 	SavePassword bool   `arg:"--save-password,env:SAVE_PASSWORD,help:Should the password save into the database (plain)? Default: false"`
 
+	// PartSize is the resolved part size in bytes
+	PartSize int `arg:"-"`
+
+	argParser *arg.Parser `arg:"-"`
+}
+
+type ResumeConfig struct {
+	GeneralConfig
+	DatabaseConfig
+	AwsGeneralConfig
+	SpoolConfig
+	BandwidthConfig
+
+	BackupId          uint    `arg:"positional,required,env:BACKUP_ID,help:The id of the backup to resume."`
+	UploadConcurrency int     `arg:"--upload-concurrency,env:UPLOAD_CONCURRENCY,help:The number of parts which are uploaded at the same time. Each of them is buffered in the spool (see --spool-mode). Default: 1"`
+	Password          *string `arg:"-p,env:PASSWORD,help:The password for encryption. If no password is given it will use the one in the database"`
+	KeepOnCancel      bool    `arg:"--keep-on-cancel,env:KEEP_ON_CANCEL,help:Keep the multipart uploads if the backup is interrupted (SIGINT/SIGTERM), so that it can be resumed again. Default: the uploads are aborted"`
+
 	argParser *arg.Parser `arg:"-"`
 }
 
@@ -61,6 +145,8 @@ type ListConfig struct {
 	Gb     bool `arg:"--gb,env:FACTOR_MB,help:Use GB as conversion factor."`
 	Gib    bool `arg:"--gib,env:FACTOR_MIB,help:Use GiB as conversion factor."`
 
+	Status []string `arg:"--status,separate,env:STATUS,help:List only the backups with this status. Possible: pending;uploading;completed;completed-with-warnings;failed;cancelled;deleting"`
+
 	argParser *arg.Parser `arg:"-"`
 }
 
@@ -77,9 +163,16 @@ type GetConfig struct {
 	GeneralConfig
 	DatabaseConfig
 	AwsGeneralConfig
+	BandwidthConfig
 
-	BackupId uint   `arg:"positional,required,env:BACKUP_ID,help:The id of the backup to get."`
+	BackupId uint   `arg:"positional,env:BACKUP_ID,help:The id of the backup to get. Optional for --fetch."`
 	File     string `arg:"positional,env:FILE,help:The target zip path."`
+	Volume   int    `arg:"--volume,env:VOLUME,help:Download only this volume of the backup. Default: all volumes (each in its own file <target>.<volume>)"`
+	Request  bool   `arg:"--request,env:REQUEST,help:Only request the retrieval of the backup. The retrieval jobs will be saved in the database and can be downloaded later with --fetch."`
+	Fetch    bool   `arg:"--fetch,env:FETCH,help:Download all requested backups (or only the given one) which are ready. The targets of the --request are used."`
+
+	ChunkSize           string `arg:"--chunk-size,env:CHUNK_SIZE,help:The size of the ranges in which the archive is downloaded (power of two multiple of 1M). Default: 64M"`
+	DownloadConcurrency int    `arg:"--download-concurrency,env:DOWNLOAD_CONCURRENCY,help:The number of ranges which are downloaded at the same time. Default: 1"`
 
 	AWSTier         string        `arg:"--aws-tier,env:AWS_TIER,help:The tier to use for the archive retrieval job. Default: Standard. Possible: Expedited;Standard;Bulk"`
 	AWSPollInterval time.Duration `arg:"--aws-poll-interval,env:AWS_POLL_INTERVAL,help:The interval to poll job status. Default: 30min."`
@@ -88,10 +181,107 @@ type GetConfig struct {
 	argParser *arg.Parser `arg:"-"`
 }
 
+type JobsConfig struct {
+	GeneralConfig
+	DatabaseConfig
+	AwsGeneralConfig
+
+	BackupId uint `arg:"positional,env:BACKUP_ID,help:Show only the retrieval jobs of this backup."`
+	All      bool `arg:"--all,env:ALL,help:Show also the jobs which are already fetched, expired or failed."`
+
+	argParser *arg.Parser `arg:"-"`
+}
+
+type SyncConfig struct {
+	GeneralConfig
+	DatabaseConfig
+	AwsGeneralConfig
+
+	AWSVaultName    string        `arg:"positional,required,env:AWS_VAULT_NAME,help:The name of the glacier vault."`
+	AWSPollInterval time.Duration `arg:"--aws-poll-interval,env:AWS_POLL_INTERVAL,help:The interval to poll job status. Default: 30min."`
+	Cached          bool          `arg:"--cached,env:CACHED,help:Use the last cached inventory instead of retrieving a new one (which takes several hours)."`
+	DryRun          bool          `arg:"--dry-run,env:DRY_RUN,help:Only report the differences. Do not adopt or prune anything."`
+	DontAsk         bool          `arg:"-y,env:DONT_ASK,help:Dont ask: adopt all unknown archives and prune all missing ones."`
+
+	argParser *arg.Parser `arg:"-"`
+}
+
+type CopyConfig struct {
+	GeneralConfig
+	DatabaseConfig
+	AwsGeneralConfig
+	BandwidthConfig
+	CatalogBackupConfig
+
+	BackupId     uint   `arg:"positional,env:BACKUP_ID,help:The id of the backup to copy. Not needed for --from-vault."`
+	To           string `arg:"--to,env:COPY_TO,help:The target vault (vault@region), bucket or path of the directory vault."`
+	ToBackend    string `arg:"--to-backend,env:COPY_TO_BACKEND,help:The storage backend of the target. Default: the backend of the backup. Possible: glacier;s3;directory"`
+	FromVault    string `arg:"--from-vault,env:COPY_FROM_VAULT,help:Copy all backups of this vault (batch mode)."`
+	DeleteSource bool   `arg:"--delete-source,env:DELETE_SOURCE,help:Delete the original archives after the copy. The copy becomes the location of the backup."`
+	DontAsk      bool   `arg:"-y,env:DONT_ASK,help:Dont ask if you be sure to delete the original archives."`
+
+	S3StorageClass  string        `arg:"--s3-storage-class,env:S3_STORAGE_CLASS,help:The storage class of the S3 objects. Default: DEEP_ARCHIVE. Possible: DEEP_ARCHIVE;GLACIER;STANDARD"`
+	WorkDir         string        `arg:"--work-dir,env:WORK_DIR,help:The directory for the retrieved archives until they are uploaded. Default is the directory for temporary files."`
+	AWSTier         string        `arg:"--aws-tier,env:AWS_TIER,help:The tier to use for the archive retrieval job. Default: Standard. Possible: Expedited;Standard;Bulk"`
+	AWSPollInterval time.Duration `arg:"--aws-poll-interval,env:AWS_POLL_INTERVAL,help:The interval to poll job status. Default: 30min."`
+
+	argParser *arg.Parser `arg:"-"`
+}
+
+type VaultConfig struct {
+	GeneralConfig
+	DatabaseConfig
+	AwsGeneralConfig
+
+	Command      string   `arg:"positional,required,env:VAULT_COMMAND,help:The vault command. Possible: CREATE;LIST;DESCRIBE;DELETE;TAGS;TAG;UNTAG;POLICY;SET-POLICY;DELETE-POLICY;NOTIFICATIONS;SET-NOTIFICATIONS;DELETE-NOTIFICATIONS;LOCK-INITIATE;LOCK-STATUS;LOCK-COMPLETE;LOCK-ABORT"`
+	AWSVaultName string   `arg:"positional,env:AWS_VAULT_NAME,help:The name of the glacier vault. Not needed for LIST."`
+	DontAsk      bool     `arg:"-y,env:DONT_ASK,help:Dont ask if you be sure to delete the vault or to complete the vault lock."`
+	Tags         []string `arg:"--tag,separate,env:VAULT_TAG,help:The tag (key=value) to add for TAG or the key of the tag to remove for UNTAG."`
+	PolicyFile   string   `arg:"--policy,env:VAULT_POLICY,help:The file which contains the (JSON) policy for SET-POLICY and LOCK-INITIATE."`
+	SNSTopic     string   `arg:"--sns-topic,env:VAULT_SNS_TOPIC,help:The ARN of the SNS topic for SET-NOTIFICATIONS."`
+	Events       []string `arg:"--event,separate,env:VAULT_EVENT,help:The event to notify for SET-NOTIFICATIONS. Possible: ArchiveRetrievalCompleted;InventoryRetrievalCompleted. Default: both"`
+
+	// Policy is the content of the PolicyFile
+	Policy string `arg:"-"`
+
+	argParser *arg.Parser `arg:"-"`
+}
+
+type BootstrapConfig struct {
+	GeneralConfig
+	DatabaseConfig
+	AwsGeneralConfig
+
+	AWSVaultName    string        `arg:"positional,required,env:AWS_VAULT_NAME,help:The name of the glacier vault which contains the catalog snapshots."`
+	AWSPollInterval time.Duration `arg:"--aws-poll-interval,env:AWS_POLL_INTERVAL,help:The interval to poll job status. Default: 30min."`
+	AWSTier         string        `arg:"--aws-tier,env:AWS_TIER,help:The tier to use for the retrieval of the snapshot. Default: Standard. Possible: Expedited;Standard;Bulk"`
+	CatalogPassword string        `arg:"--catalog-password,env:CATALOG_PASSWORD,help:The password of the catalog snapshots."`
+	Force           bool          `arg:"--force,env:FORCE,help:Overwrite the existing database."`
+
+	argParser *arg.Parser `arg:"-"`
+}
+
+type RecoverCatalogConfig struct {
+	GeneralConfig
+	DatabaseConfig
+	AwsGeneralConfig
+
+	AWSVaultName    string        `arg:"positional,required,env:AWS_VAULT_NAME,help:The name of the glacier vault."`
+	AWSPollInterval time.Duration `arg:"--aws-poll-interval,env:AWS_POLL_INTERVAL,help:The interval to poll job status. Default: 30min."`
+	AWSTier         string        `arg:"--aws-tier,env:AWS_TIER,help:The tier to use for the retrieval of the manifests. Default: Standard. Possible: Expedited;Standard;Bulk"`
+	Cached          bool          `arg:"--cached,env:CACHED,help:Use the last cached inventory instead of retrieving a new one (which takes several hours)."`
+	Contents        bool          `arg:"--contents,env:CONTENTS,help:Retrieve the manifest of each recovered volume to restore the file lists, too. This needs one retrieval job per volume."`
+	DryRun          bool          `arg:"--dry-run,env:DRY_RUN,help:Only report the backups which can be recovered. Do not save anything."`
+	Password        *string       `arg:"-p,env:PASSWORD,help:The password for the decryption of the manifests."`
+
+	argParser *arg.Parser `arg:"-"`
+}
+
 type DeleteConfig struct {
 	GeneralConfig
 	DatabaseConfig
 	AwsGeneralConfig
+	CatalogBackupConfig
 
 	BackupId uint `arg:"positional,required,env:BACKUP_ID,help:The id of the backup to get."`
 	DontAsk  bool `arg:"-y,env:DONT_ASK,help:Dont ask if you be sure to delete backup."`
@@ -103,6 +293,7 @@ type CuratorConfig struct {
 	GeneralConfig
 	DatabaseConfig
 	AwsGeneralConfig
+	CatalogBackupConfig
 
 	AWSVaultName string `arg:"positional,env:AWS_VAULT_NAME,help:The name of the glacier vault."`
 	DontAsk      bool   `arg:"-y,env:DONT_ASK,help:Dont ask if you be sure to delete backup."`
@@ -119,7 +310,65 @@ type GeneralConfig struct {
 }
 
 type AwsGeneralConfig struct {
-	AWSProfile string `arg:"--aws-profile,env:AWS_PROFILE,help:If you want to use a other AWS profile"`
+	AWSProfile   string `arg:"--aws-profile,env:AWS_PROFILE,help:If you want to use a other AWS profile"`
+	AWSRegion    string `arg:"--aws-region,env:AWS_REGION,help:The AWS region of the vaults (or buckets) for new backups. Existing backups always use the region in which they are created. Default: the region of the AWS profile"`
+	AWSEndpoint  string `arg:"--aws-endpoint,env:AWS_ENDPOINT,help:The endpoint of a glacier compatible server (e.g. a proxy or a VPC endpoint). Default: AWS"`
+	AWSAccountId string `arg:"--aws-account-id,env:AWS_ACCOUNT_ID,help:The id of the AWS account which owns the vaults. Existing backups always use the account in which they are created. Default: the account of the credentials"`
+
+	AWSRoleARN         string `arg:"--aws-role-arn,env:AWS_ASSUME_ROLE_ARN,help:The ARN of a role which should be assumed for all AWS requests"`
+	AWSExternalId      string `arg:"--aws-external-id,env:AWS_ASSUME_ROLE_EXTERNAL_ID,help:The external id for assuming the role"`
+	AWSRoleSessionName string `arg:"--aws-role-session-name,env:AWS_ASSUME_ROLE_SESSION_NAME,help:The session name for assuming the role. Default: backup2glacier"`
+
+	AWSMaxAttempts   int           `arg:"--aws-max-attempts,env:AWS_MAX_ATTEMPTS,help:The maximum number of attempts for each glacier operation. Default: 5"`
+	AWSRetryDelay    time.Duration `arg:"--aws-retry-delay,env:AWS_RETRY_DELAY,help:The delay before the first retry. It will be doubled for each further retry. Default: 1s"`
+	AWSRetryMaxDelay time.Duration `arg:"--aws-retry-max-delay,env:AWS_RETRY_MAX_DELAY,help:The maximum delay between two retries. Default: 5m"`
+	AWSRetryJitter   *float64      `arg:"--aws-retry-jitter,env:AWS_RETRY_JITTER,help:The fraction (0-1) of the retry delay which will be randomized. Default: 0.2"`
+	AWSRetryCodes    []string      `arg:"--aws-retry-code,separate,env:AWS_RETRY_CODES,help:Additional AWS error codes which should be retried. Network-, throttling- and server-errors are always retried."`
+
+	S3Endpoint string `arg:"--s3-endpoint,env:S3_ENDPOINT,help:The endpoint of an S3 compatible server (e.g. MinIO) for the s3 backend. Default: AWS"`
+
+	DirectoryRetrievalDelay string `arg:"--directory-retrieval-delay,env:DIRECTORY_RETRIEVAL_DELAY,help:The simulated duration of the retrieval jobs of the directory backend. One duration for all tiers (such like 5m) or one per tier (such like Expedited=1m,Standard=5m,Bulk=1h). Default: 0"`
+}
+
+type SpoolConfig struct {
+	SpoolMode string `arg:"--spool-mode,env:SPOOL_MODE,help:Where the parts are buffered before they are uploaded. Default: disk. Possible: disk;memory"`
+	SpoolDir  string `arg:"--spool-dir,env:SPOOL_DIR,help:The directory for the buffered parts (only for spool mode disk). Default is the directory for temporary files."`
+}
+
+type BandwidthConfig struct {
+	BWLimit            string `arg:"--bwlimit,env:BWLIMIT,help:The maximum transfer rate per second (such like 512K or 5M) for uploads and downloads. Default: 0 (unlimited)"`
+	BWLimitSchedule    string `arg:"--bwlimit-schedule,env:BWLIMIT_SCHEDULE,help:Daily time windows with their own transfer rate (such like 08:00-18:00=2M,18:00-08:00=0). Outside of the windows the --bwlimit is used."`
+	PauseOutsideWindow bool   `arg:"--pause-outside-window,env:PAUSE_OUTSIDE_WINDOW,help:Suspend the upload outside of the time windows of the --bwlimit-schedule."`
+}
+
+type CleanupConfig struct {
+	GeneralConfig
+	DatabaseConfig
+	AwsGeneralConfig
+	CatalogBackupConfig
+
+	OlderThan time.Duration `arg:"--older-than,env:OLDER_THAN,help:Backups which are pending or uploading without a heartbeat for longer than this are regarded as interrupted. Default: 24h"`
+	Delete    bool          `arg:"--delete,env:DELETE,help:Delete the interrupted backups instead of marking them as failed (so that they can be resumed)."`
+	DryRun    bool          `arg:"--dry-run,env:DRY_RUN,help:Only list the interrupted backups. Do not change anything."`
+	DontAsk   bool          `arg:"-y,env:DONT_ASK,help:Dont ask if you be sure to delete the interrupted backups."`
+
+	argParser *arg.Parser `arg:"-"`
+}
+
+type DBConfig struct {
+	GeneralConfig
+	DatabaseConfig
+
+	Command string `arg:"positional,required,env:DB_COMMAND,help:The database command. Possible: MIGRATE"`
+	DryRun  bool   `arg:"--dry-run,env:DRY_RUN,help:Only show the pending migrations. Do not change the database."`
+
+	argParser *arg.Parser `arg:"-"`
+}
+
+type CatalogBackupConfig struct {
+	CatalogVault    string `arg:"--catalog-vault,env:CATALOG_VAULT,help:Upload an encrypted snapshot of the catalog into this vault after each successful run. Default: no snapshots"`
+	CatalogPassword string `arg:"--catalog-password,env:CATALOG_PASSWORD,help:The password for the encryption of the catalog snapshots. It should differ from the passwords of the backups."`
+	CatalogKeep     int    `arg:"--catalog-keep,env:CATALOG_KEEP,help:The number of catalog snapshots which are kept in the vault. Older ones will be deleted. Default: 3"`
 }
 
 type DatabaseConfig struct {
@@ -131,13 +380,13 @@ func NewConfig() *Config {
 	cfg := &Config{}
 
 	if len(os.Args) <= 1 {
-		fmt.Printf("You have to specify a subcommand: %v\n", []string{ActionCreate, ActionGet, ActionDelete, ActionList, ActionShow, ActionCurator})
+		fmt.Printf("You have to specify a subcommand: %v\n", []string{ActionCreate, ActionResume, ActionGet, ActionDelete, ActionList, ActionShow, ActionCurator, ActionJobs, ActionSync, ActionCopy, ActionCleanup, ActionRecoverCatalog, ActionBootstrap, ActionVault, ActionDB})
 		os.Exit(2)
 	}
 	cfg.Action = os.Args[1]
 
 	if !isValidAction(cfg.Action) {
-		fmt.Printf("You have to specify a valid subcommand: %v\n", []string{ActionCreate, ActionGet, ActionDelete, ActionList, ActionShow, ActionCurator})
+		fmt.Printf("You have to specify a valid subcommand: %v\n", []string{ActionCreate, ActionResume, ActionGet, ActionDelete, ActionList, ActionShow, ActionCurator, ActionJobs, ActionSync, ActionCopy, ActionCleanup, ActionRecoverCatalog, ActionBootstrap, ActionVault, ActionDB})
 		os.Exit(2)
 	}
 
@@ -153,13 +402,37 @@ func NewConfig() *Config {
 			DatabaseConfig: DatabaseConfig{
 				Database: DefaultDatabase,
 			},
-			AWSPartSize:  1, //1MB chunk
-			SavePassword: false,
+			SpoolConfig: SpoolConfig{
+				SpoolMode: SpoolModeDisk,
+			},
+			CatalogBackupConfig: CatalogBackupConfig{
+				CatalogKeep: DefaultCatalogKeep,
+			},
+			AWSPartSize:       "1", //1MB chunk
+			UploadConcurrency: 1,
+			SavePassword:      false,
 		}
 
 		cfg.Create.argParser, _ = arg.NewParser(arg.Config{}, cfg.Create)
 		argParser = cfg.Create.argParser
 		err = cfg.Create.argParser.Parse(os.Args[2:])
+	case ActionResume:
+		cfg.Resume = &ResumeConfig{
+			GeneralConfig: GeneralConfig{
+				LogLevel: "INFO",
+			},
+			DatabaseConfig: DatabaseConfig{
+				Database: DefaultDatabase,
+			},
+			SpoolConfig: SpoolConfig{
+				SpoolMode: SpoolModeDisk,
+			},
+			UploadConcurrency: 1,
+		}
+
+		cfg.Resume.argParser, _ = arg.NewParser(arg.Config{}, cfg.Resume)
+		argParser = cfg.Resume.argParser
+		err = cfg.Resume.argParser.Parse(os.Args[2:])
 	case ActionGet:
 		cfg.Get = &GetConfig{
 			GeneralConfig: GeneralConfig{
@@ -168,8 +441,10 @@ func NewConfig() *Config {
 			DatabaseConfig: DatabaseConfig{
 				Database: DefaultDatabase,
 			},
-			AWSPollInterval: 30 * time.Minute,
-			AWSTier:         "Standard",
+			AWSPollInterval:     30 * time.Minute,
+			AWSTier:             "Standard",
+			ChunkSize:           "64M",
+			DownloadConcurrency: 1,
 		}
 
 		cfg.Get.argParser, _ = arg.NewParser(arg.Config{}, cfg.Get)
@@ -224,6 +499,9 @@ func NewConfig() *Config {
 			DatabaseConfig: DatabaseConfig{
 				Database: DefaultDatabase,
 			},
+			CatalogBackupConfig: CatalogBackupConfig{
+				CatalogKeep: DefaultCatalogKeep,
+			},
 
 			DontAsk: false,
 		}
@@ -239,6 +517,9 @@ func NewConfig() *Config {
 			DatabaseConfig: DatabaseConfig{
 				Database: DefaultDatabase,
 			},
+			CatalogBackupConfig: CatalogBackupConfig{
+				CatalogKeep: DefaultCatalogKeep,
+			},
 
 			DontAsk: false,
 		}
@@ -246,6 +527,124 @@ func NewConfig() *Config {
 		cfg.Curator.argParser, _ = arg.NewParser(arg.Config{}, cfg.Curator)
 		argParser = cfg.Curator.argParser
 		err = cfg.Curator.argParser.Parse(os.Args[2:])
+	case ActionJobs:
+		cfg.Jobs = &JobsConfig{
+			GeneralConfig: GeneralConfig{
+				LogLevel: "INFO",
+			},
+			DatabaseConfig: DatabaseConfig{
+				Database: DefaultDatabase,
+			},
+		}
+
+		cfg.Jobs.argParser, _ = arg.NewParser(arg.Config{}, cfg.Jobs)
+		argParser = cfg.Jobs.argParser
+		err = cfg.Jobs.argParser.Parse(os.Args[2:])
+	case ActionSync:
+		cfg.Sync = &SyncConfig{
+			GeneralConfig: GeneralConfig{
+				LogLevel: "INFO",
+			},
+			DatabaseConfig: DatabaseConfig{
+				Database: DefaultDatabase,
+			},
+			AWSPollInterval: 30 * time.Minute,
+		}
+
+		cfg.Sync.argParser, _ = arg.NewParser(arg.Config{}, cfg.Sync)
+		argParser = cfg.Sync.argParser
+		err = cfg.Sync.argParser.Parse(os.Args[2:])
+	case ActionCopy:
+		cfg.Copy = &CopyConfig{
+			GeneralConfig: GeneralConfig{
+				LogLevel: "INFO",
+			},
+			DatabaseConfig: DatabaseConfig{
+				Database: DefaultDatabase,
+			},
+			CatalogBackupConfig: CatalogBackupConfig{
+				CatalogKeep: DefaultCatalogKeep,
+			},
+			AWSPollInterval: 30 * time.Minute,
+			AWSTier:         "Standard",
+		}
+
+		cfg.Copy.argParser, _ = arg.NewParser(arg.Config{}, cfg.Copy)
+		argParser = cfg.Copy.argParser
+		err = cfg.Copy.argParser.Parse(os.Args[2:])
+	case ActionCleanup:
+		cfg.Cleanup = &CleanupConfig{
+			GeneralConfig: GeneralConfig{
+				LogLevel: "INFO",
+			},
+			DatabaseConfig: DatabaseConfig{
+				Database: DefaultDatabase,
+			},
+			CatalogBackupConfig: CatalogBackupConfig{
+				CatalogKeep: DefaultCatalogKeep,
+			},
+			OlderThan: 24 * time.Hour,
+		}
+
+		cfg.Cleanup.argParser, _ = arg.NewParser(arg.Config{}, cfg.Cleanup)
+		argParser = cfg.Cleanup.argParser
+		err = cfg.Cleanup.argParser.Parse(os.Args[2:])
+	case ActionRecoverCatalog:
+		cfg.RecoverCatalog = &RecoverCatalogConfig{
+			GeneralConfig: GeneralConfig{
+				LogLevel: "INFO",
+			},
+			DatabaseConfig: DatabaseConfig{
+				Database: DefaultDatabase,
+			},
+			AWSPollInterval: 30 * time.Minute,
+			AWSTier:         "Standard",
+		}
+
+		cfg.RecoverCatalog.argParser, _ = arg.NewParser(arg.Config{}, cfg.RecoverCatalog)
+		argParser = cfg.RecoverCatalog.argParser
+		err = cfg.RecoverCatalog.argParser.Parse(os.Args[2:])
+	case ActionBootstrap:
+		cfg.Bootstrap = &BootstrapConfig{
+			GeneralConfig: GeneralConfig{
+				LogLevel: "INFO",
+			},
+			DatabaseConfig: DatabaseConfig{
+				Database: DefaultDatabase,
+			},
+			AWSPollInterval: 30 * time.Minute,
+			AWSTier:         "Standard",
+		}
+
+		cfg.Bootstrap.argParser, _ = arg.NewParser(arg.Config{}, cfg.Bootstrap)
+		argParser = cfg.Bootstrap.argParser
+		err = cfg.Bootstrap.argParser.Parse(os.Args[2:])
+	case ActionVault:
+		cfg.Vault = &VaultConfig{
+			GeneralConfig: GeneralConfig{
+				LogLevel: "INFO",
+			},
+			DatabaseConfig: DatabaseConfig{
+				Database: DefaultDatabase,
+			},
+		}
+
+		cfg.Vault.argParser, _ = arg.NewParser(arg.Config{}, cfg.Vault)
+		argParser = cfg.Vault.argParser
+		err = cfg.Vault.argParser.Parse(os.Args[2:])
+	case ActionDB:
+		cfg.DB = &DBConfig{
+			GeneralConfig: GeneralConfig{
+				LogLevel: "INFO",
+			},
+			DatabaseConfig: DatabaseConfig{
+				Database: DefaultDatabase,
+			},
+		}
+
+		cfg.DB.argParser, _ = arg.NewParser(arg.Config{}, cfg.DB)
+		argParser = cfg.DB.argParser
+		err = cfg.DB.argParser.Parse(os.Args[2:])
 	}
 
 	if err != nil {
@@ -281,9 +680,34 @@ func (c *CreateConfig) GetWhitelist() []*regexp.Regexp {
 	return result
 }
 
+func (c *GetConfig) GetChunkSize() int64 {
+	size, err := ParseSize(c.ChunkSize)
+	if err != nil {
+		panic(err)
+	}
+
+	return size
+}
+
+func (c *CreateConfig) GetVolumeSize() int64 {
+	if c.VolumeSize == "" {
+		return 0
+	}
+
+	size, err := ParseSize(c.VolumeSize)
+	if err != nil {
+		panic(err)
+	}
+
+	return size
+}
+
 func (c *CreateConfig) Fail(format string, args ...interface{}) {
 	failInternal(c.argParser, format, args...)
 }
+func (c *ResumeConfig) Fail(format string, args ...interface{}) {
+	failInternal(c.argParser, format, args...)
+}
 func (c *GetConfig) Fail(format string, args ...interface{}) {
 	failInternal(c.argParser, format, args...)
 }
@@ -299,6 +723,30 @@ func (c *ShowConfig) Fail(format string, args ...interface{}) {
 func (c *CuratorConfig) Fail(format string, args ...interface{}) {
 	failInternal(c.argParser, format, args...)
 }
+func (c *JobsConfig) Fail(format string, args ...interface{}) {
+	failInternal(c.argParser, format, args...)
+}
+func (c *SyncConfig) Fail(format string, args ...interface{}) {
+	failInternal(c.argParser, format, args...)
+}
+func (c *CopyConfig) Fail(format string, args ...interface{}) {
+	failInternal(c.argParser, format, args...)
+}
+func (c *CleanupConfig) Fail(format string, args ...interface{}) {
+	failInternal(c.argParser, format, args...)
+}
+func (c *VaultConfig) Fail(format string, args ...interface{}) {
+	failInternal(c.argParser, format, args...)
+}
+func (c *DBConfig) Fail(format string, args ...interface{}) {
+	failInternal(c.argParser, format, args...)
+}
+func (c *BootstrapConfig) Fail(format string, args ...interface{}) {
+	failInternal(c.argParser, format, args...)
+}
+func (c *RecoverCatalogConfig) Fail(format string, args ...interface{}) {
+	failInternal(c.argParser, format, args...)
+}
 func failInternal(argParser *arg.Parser, format string, args ...interface{}) {
 	fmt.Printf(format+"\n\n", args...)
 	argParser.WriteHelp(os.Stdout)
@@ -309,6 +757,8 @@ func isValidAction(action string) bool {
 	switch action {
 	case ActionCreate:
 		fallthrough
+	case ActionResume:
+		fallthrough
 	case ActionGet:
 		fallthrough
 	case ActionDelete:
@@ -318,6 +768,22 @@ func isValidAction(action string) bool {
 	case ActionList:
 		fallthrough
 	case ActionCurator:
+		fallthrough
+	case ActionJobs:
+		fallthrough
+	case ActionSync:
+		fallthrough
+	case ActionCopy:
+		fallthrough
+	case ActionCleanup:
+		fallthrough
+	case ActionRecoverCatalog:
+		fallthrough
+	case ActionBootstrap:
+		fallthrough
+	case ActionVault:
+		fallthrough
+	case ActionDB:
 		return true
 	default:
 		return false
@@ -0,0 +1,42 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ParseRetrievalDelays parses the delays of the retrieval jobs. This is either one duration for all tiers (such
+// like 5m) or a comma separated list of tiers with their own duration (such like Expedited=1m,Standard=5m). The
+// duration of the empty tier (key "") is used for all tiers which are not contained.
+func ParseRetrievalDelays(value string) (map[string]time.Duration, error) {
+	delays := map[string]time.Duration{}
+
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		tier, duration := "", entry
+		if parts := strings.Split(entry, "="); len(parts) == 2 {
+			tier, duration = strings.TrimSpace(parts[0]), parts[1]
+			if tier == "" {
+				return nil, fmt.Errorf(`invalid retrieval delay: "%s"`, entry)
+			}
+		} else if len(parts) > 2 {
+			return nil, fmt.Errorf(`invalid retrieval delay: "%s"`, entry)
+		}
+
+		delay, err := time.ParseDuration(strings.TrimSpace(duration))
+		if err != nil || delay < 0 {
+			return nil, fmt.Errorf(`invalid retrieval delay: "%s"`, entry)
+		}
+		if _, exists := delays[tier]; exists {
+			return nil, fmt.Errorf(`duplicate retrieval delay: "%s"`, entry)
+		}
+		delays[tier] = delay
+	}
+
+	return delays, nil
+}
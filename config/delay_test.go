@@ -0,0 +1,34 @@
+package config
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestParseRetrievalDelays(t *testing.T) {
+	delays, err := ParseRetrievalDelays("")
+	assert.NoError(t, err)
+	assert.Empty(t, delays)
+
+	delays, err = ParseRetrievalDelays("5m")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]time.Duration{"": 5 * time.Minute}, delays)
+
+	delays, err = ParseRetrievalDelays("Expedited=1m, Standard=5m,1h")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]time.Duration{
+		"Expedited": time.Minute,
+		"Standard":  5 * time.Minute,
+		"":          time.Hour,
+	}, delays)
+}
+
+func TestParseRetrievalDelays_Invalid(t *testing.T) {
+	for _, value := range []string{"5", "Standard=", "=5m", "Standard=-1m", "Standard=1m,Standard=2m", "a=b=c"} {
+		t.Run(value, func(t *testing.T) {
+			_, err := ParseRetrievalDelays(value)
+			assert.Error(t, err)
+		})
+	}
+}
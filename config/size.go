@@ -0,0 +1,44 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var sizeUnits = []struct {
+	suffix string
+	factor int64
+}{
+	{"T", 1024 * 1024 * 1024 * 1024},
+	{"G", 1024 * 1024 * 1024},
+	{"M", 1024 * 1024},
+	{"K", 1024},
+	{"B", 1},
+}
+
+// ParseSize parses a human readable size (such like 512K, 100M or 2G) into bytes. The units are
+// binary units (1K = 1024 bytes). A value without unit is interpreted as bytes.
+func ParseSize(size string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(size))
+	value = strings.TrimSuffix(value, "IB")
+	if len(value) > 1 {
+		value = strings.TrimSuffix(value, "B")
+	}
+
+	factor := int64(1)
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(value, unit.suffix) {
+			factor = unit.factor
+			value = strings.TrimSuffix(value, unit.suffix)
+			break
+		}
+	}
+
+	parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || parsed < 0 {
+		return 0, fmt.Errorf(`invalid size: "%s"`, size)
+	}
+
+	return int64(parsed * float64(factor)), nil
+}
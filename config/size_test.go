@@ -0,0 +1,43 @@
+package config
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected int64
+	}{
+		{"0", 0},
+		{"1024", 1024},
+		{"1B", 1},
+		{"1K", 1024},
+		{"1KB", 1024},
+		{"1KiB", 1024},
+		{"5M", 5 * 1024 * 1024},
+		{"5m", 5 * 1024 * 1024},
+		{"1.5G", 1536 * 1024 * 1024},
+		{"100G", 100 * 1024 * 1024 * 1024},
+		{"2T", 2 * 1024 * 1024 * 1024 * 1024},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			result, err := ParseSize(test.value)
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, result)
+		})
+	}
+}
+
+func TestParseSize_Invalid(t *testing.T) {
+	for _, value := range []string{"", "G", "abc", "-1M", "1X"} {
+		t.Run(value, func(t *testing.T) {
+			_, err := ParseSize(value)
+
+			assert.Error(t, err)
+		})
+	}
+}
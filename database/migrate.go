@@ -0,0 +1,227 @@
+package database
+
+import (
+	. "backup2glacier/log"
+	"database/sql"
+	"fmt"
+	"github.com/pkg/errors"
+	"os"
+	"time"
+)
+
+const schemaVersionTable = "schema_version"
+
+// ErrSchemaTooNew will be returned if the catalog was written by a newer version of backup2glacier
+var ErrSchemaTooNew = errors.New("The catalog was written by a newer version of backup2glacier. Please update backup2glacier.")
+
+// PendingMigrations returns the schema version of the given catalog and the migrations which are not applied yet.
+// The catalog is not changed.
+func PendingMigrations(dbFile string) (int, []Migration, error) {
+	if _, err := os.Stat(dbFile); os.IsNotExist(err) {
+		return 0, migrations, nil
+	}
+
+	db, err := sql.Open("sqlite3", dbFile)
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "failed to connect database")
+	}
+	defer db.Close()
+
+	version, err := schemaVersion(db)
+	if err != nil {
+		return 0, nil, err
+	}
+	pending, err := pendingMigrations(version)
+
+	return version, pending, err
+}
+
+// schemaVersion returns the version of the newest applied migration. Catalogs which were created before the
+// migrations were introduced have the version 0.
+func schemaVersion(db *sql.DB) (int, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", schemaVersionTable).Scan(&count)
+	if err != nil {
+		return 0, errors.Wrap(err, "Could not read the schema version")
+	}
+	if count == 0 {
+		return 0, nil
+	}
+
+	var version sql.NullInt64
+	if err := db.QueryRow("SELECT MAX(version) FROM " + schemaVersionTable).Scan(&version); err != nil {
+		return 0, errors.Wrap(err, "Could not read the schema version")
+	}
+
+	return int(version.Int64), nil
+}
+
+func pendingMigrations(version int) ([]Migration, error) {
+	if version > SchemaVersion() {
+		return nil, errors.Wrapf(ErrSchemaTooNew, "The catalog has the schema version %d, but this binary supports only the versions up to %d", version, SchemaVersion())
+	}
+
+	var pending []Migration
+	for _, migration := range migrations {
+		if migration.Version > version {
+			pending = append(pending, migration)
+		}
+	}
+
+	return pending, nil
+}
+
+// migrate applies the pending migrations to the catalog. A catalog which is not empty will be copied into a
+// backup file (<file>.v<version>-<time>.bak) before.
+func migrate(db *sql.DB, dbFile string) error {
+	version, err := schemaVersion(db)
+	if err != nil {
+		return err
+	}
+	pending, err := pendingMigrations(version)
+	if err != nil || len(pending) == 0 {
+		return err
+	}
+
+	var tables int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table'").Scan(&tables); err != nil {
+		return errors.Wrap(err, "Could not read the tables")
+	}
+	if tables > 0 {
+		backupFile := fmt.Sprintf("%s.v%d-%s.bak", dbFile, version, time.Now().Format("20060102150405"))
+		if err := Snapshot(dbFile, backupFile); err != nil {
+			return errors.Wrap(err, "Could not backup the catalog before the migration")
+		}
+		LogInfo("Saved the catalog with schema version %d into %s", version, backupFile)
+	}
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS ` + schemaVersionTable + ` ("version" integer primary key,"description" varchar(255),"applied_at" datetime)`)
+	if err != nil {
+		return errors.Wrap(err, "Could not create the schema version table")
+	}
+
+	for _, migration := range pending {
+		if err := applyMigration(db, migration); err != nil {
+			return errors.Wrapf(err, "Could not apply migration %d (%s)", migration.Version, migration.Description)
+		}
+		if tables > 0 {
+			LogInfo("Migrated the catalog to schema version %d: %s", migration.Version, migration.Description)
+		}
+	}
+
+	return nil
+}
+
+// applyMigration applies the migration and records it in one transaction
+func applyMigration(db *sql.DB, migration Migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(migration.SQL); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if migration.Version == 1 {
+		if err := addMissingColumns(tx); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	_, err = tx.Exec("INSERT INTO "+schemaVersionTable+" (version, description, applied_at) VALUES (?, ?, ?)",
+		migration.Version, migration.Description, time.Now())
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// addMissingColumns adds the columns of the initial schema which are missing in the tables of an older catalog.
+// The tables of older versions were created by gorm, which only added the columns of their models.
+func addMissingColumns(tx *sql.Tx) error {
+	initial, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		return err
+	}
+	defer initial.Close()
+
+	//each connection would have its own in-memory database
+	initial.SetMaxOpenConns(1)
+	if _, err := initial.Exec(migrationInitialSchema); err != nil {
+		return err
+	}
+
+	rows, err := initial.Query("SELECT name FROM sqlite_master WHERE type = 'table' AND name <> 'sqlite_sequence'")
+	if err != nil {
+		return err
+	}
+	var tables []string
+	for rows.Next() {
+		var table string
+		rows.Scan(&table)
+		tables = append(tables, table)
+	}
+	rows.Close()
+
+	for _, table := range tables {
+		columns, err := tableColumns(initial, table)
+		if err != nil {
+			return err
+		}
+		existingColumns, err := tableColumns(tx, table)
+		if err != nil {
+			return err
+		}
+		existing := map[string]bool{}
+		for _, column := range existingColumns {
+			existing[column.name] = true
+		}
+
+		for _, column := range columns {
+			if existing[column.name] {
+				continue
+			}
+			if _, err := tx.Exec(fmt.Sprintf(`ALTER TABLE "%s" ADD COLUMN "%s" %s`, table, column.name, column.columnType)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+type tableColumn struct {
+	name       string
+	columnType string
+}
+
+// tableColumns returns the columns of the given table in their order. A missing table has no columns.
+func tableColumns(db queryer, table string) ([]tableColumn, error) {
+	rows, err := db.Query(fmt.Sprintf(`PRAGMA table_info("%s")`, table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []tableColumn
+	for rows.Next() {
+		var cid, notNull, pk int
+		var defaultValue interface{}
+		var column tableColumn
+
+		if err := rows.Scan(&cid, &column.name, &column.columnType, &notNull, &defaultValue, &pk); err != nil {
+			return nil, err
+		}
+		columns = append(columns, column)
+	}
+
+	return columns, rows.Err()
+}
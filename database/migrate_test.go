@@ -0,0 +1,100 @@
+package database
+
+import (
+	"backup2glacier/database/model"
+	"database/sql"
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrate_MatchesModels(t *testing.T) {
+	r, cleanup := newTestRepository(t)
+	defer cleanup()
+
+	//the schema of the migrations must contain all columns of the models
+	db, err := gorm.Open("sqlite3", ":memory:")
+	assert.NoError(t, err)
+	defer db.Close()
+	db.DB().SetMaxOpenConns(1)
+
+	models := []interface{}{&model.Content{}, &model.Backup{}, &model.BackupTransition{}, &model.Volume{},
+		&model.Replica{}, &model.Job{}, &model.Inventory{}, &model.InventoryArchive{}, &model.CatalogSnapshot{},
+		&model.VaultLock{}}
+	for _, m := range models {
+		assert.NoError(t, db.AutoMigrate(m).Error)
+
+		table := db.NewScope(m).TableName()
+		expected, err := tableColumns(db.DB(), table)
+		assert.NoError(t, err)
+		actual, err := tableColumns(r.(*repository).db.DB(), table)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, actual, table)
+	}
+}
+
+func TestMigrate_OlderCatalog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "migrate")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	dbFile := path.Join(dir, "database.db")
+
+	//a catalog of an older version without status, region and volumes
+	db, err := sql.Open("sqlite3", dbFile)
+	assert.NoError(t, err)
+	_, err = db.Exec(`CREATE TABLE "backups" ("id" integer primary key autoincrement,"created_at" datetime,"updated_at" datetime,"deleted_at" datetime,"vault" varchar(255),"archive_id" varchar(255),"error" varchar(255));
+		INSERT INTO backups (vault, archive_id, error) VALUES ('vault', 'archive', '');
+		INSERT INTO backups (vault, error) VALUES ('vault', 'Could not upload');`)
+	assert.NoError(t, err)
+	db.Close()
+
+	version, pending, err := PendingMigrations(dbFile)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, version)
+	assert.Len(t, pending, len(migrations))
+
+	r, err := OpenRepository(dbFile)
+	assert.NoError(t, err)
+	assert.Equal(t, model.BackupStatusCompleted, r.GetBackupById(1).Status)
+	assert.Equal(t, model.BackupStatusFailed, r.GetBackupById(2).Status)
+	assert.Len(t, r.GetVolumesByBackupId(1), 1)
+	r.Close()
+
+	backups, _ := filepath.Glob(dbFile + ".v0-*.bak")
+	assert.Len(t, backups, 1)
+
+	version, pending, err = PendingMigrations(dbFile)
+	assert.NoError(t, err)
+	assert.Equal(t, SchemaVersion(), version)
+	assert.Empty(t, pending)
+
+	//an up to date catalog is not saved again
+	r, err = OpenRepository(dbFile)
+	assert.NoError(t, err)
+	r.Close()
+	backups, _ = filepath.Glob(dbFile + ".*.bak")
+	assert.Len(t, backups, 1)
+}
+
+func TestMigrate_NewerCatalog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "migrate")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	dbFile := path.Join(dir, "database.db")
+
+	r, err := OpenRepository(dbFile)
+	assert.NoError(t, err)
+	assert.NoError(t, r.(*repository).db.Exec("INSERT INTO schema_version (version, description) VALUES (?, ?)", SchemaVersion()+1, "Future").Error)
+	r.Close()
+
+	_, _, err = PendingMigrations(dbFile)
+	assert.Equal(t, ErrSchemaTooNew, errors.Cause(err))
+
+	_, err = OpenRepository(dbFile)
+	assert.Equal(t, ErrSchemaTooNew, errors.Cause(err))
+}
@@ -0,0 +1,69 @@
+package database
+
+// Migration is a numbered change of the schema (or the data) of the catalog. The applied migrations are recorded
+// in the schema_version table.
+type Migration struct {
+	Version     int
+	Description string
+	SQL         string
+}
+
+// migrations are all migrations of the catalog ordered by their version. New migrations have to be appended
+// with the next version: an applied migration must never be changed.
+var migrations = []Migration{
+	{1, "Initial schema", migrationInitialSchema},
+	{2, "Derive the status of the existing backups", migrationBackupStatus},
+	{3, "Add the heartbeat of the backups", migrationBackupHeartbeat},
+}
+
+// SchemaVersion returns the schema version of the catalogs which are written by this binary
+func SchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// migrationInitialSchema is the schema which was created by gorm's AutoMigrate before the migrations were
+// introduced. Catalogs of older versions are adopted by adding their missing tables and columns.
+const migrationInitialSchema = `
+CREATE TABLE IF NOT EXISTS "contents" ("id" integer primary key autoincrement,"backup_id" integer,"volume_id" integer,"path" TEXT,"length" bigint,"mod_time" datetime);
+CREATE TABLE IF NOT EXISTS "backups" ("id" integer primary key autoincrement,"created_at" datetime,"updated_at" datetime,"deleted_at" datetime,"backend" varchar(255),"vault" varchar(255),"region" varchar(255),"account_id" varchar(255),"description" TEXT,"upload_id" varchar(255),"archive_id" varchar(255),"location" varchar(255),"checksum" varchar(255),"length" bigint,"password" varchar(255),"error" varchar(255),"sources" TEXT,"blacklist" TEXT,"whitelist" TEXT,"part_size" integer,"volume_size" bigint,"replicas" TEXT,"status" varchar(255),"status_changed_at" datetime);
+CREATE INDEX IF NOT EXISTS idx_backups_deleted_at ON "backups"(deleted_at);
+CREATE TABLE IF NOT EXISTS "backup_transitions" ("id" integer primary key autoincrement,"created_at" datetime,"updated_at" datetime,"deleted_at" datetime,"backup_id" integer,"from_status" varchar(255),"to_status" varchar(255),"error" varchar(255));
+CREATE INDEX IF NOT EXISTS idx_backup_transitions_deleted_at ON "backup_transitions"(deleted_at);
+CREATE TABLE IF NOT EXISTS "volumes" ("id" integer primary key autoincrement,"created_at" datetime,"updated_at" datetime,"deleted_at" datetime,"backup_id" integer,"number" integer,"upload_id" varchar(255),"archive_id" varchar(255),"location" varchar(255),"checksum" varchar(255),"length" bigint,"error" varchar(255));
+CREATE INDEX IF NOT EXISTS idx_volumes_deleted_at ON "volumes"(deleted_at);
+CREATE TABLE IF NOT EXISTS "replicas" ("id" integer primary key autoincrement,"created_at" datetime,"updated_at" datetime,"deleted_at" datetime,"backup_id" integer,"volume_id" integer,"backend" varchar(255),"vault" varchar(255),"region" varchar(255),"account_id" varchar(255),"upload_id" varchar(255),"archive_id" varchar(255),"location" varchar(255),"checksum" varchar(255),"length" bigint,"error" varchar(255));
+CREATE INDEX IF NOT EXISTS idx_replicas_deleted_at ON "replicas"(deleted_at);
+CREATE TABLE IF NOT EXISTS "jobs" ("id" integer primary key autoincrement,"created_at" datetime,"updated_at" datetime,"deleted_at" datetime,"backup_id" integer,"volume_number" integer,"backend" varchar(255),"vault" varchar(255),"region" varchar(255),"account_id" varchar(255),"archive_id" varchar(255),"job_id" varchar(255),"tier" varchar(255),"target" TEXT,"status" varchar(255),"expected_completion" datetime,"completed_at" datetime,"error" varchar(255));
+CREATE INDEX IF NOT EXISTS idx_jobs_deleted_at ON "jobs"(deleted_at);
+CREATE TABLE IF NOT EXISTS "inventories" ("id" integer primary key autoincrement,"created_at" datetime,"updated_at" datetime,"deleted_at" datetime,"vault" varchar(255),"inventory_date" datetime);
+CREATE INDEX IF NOT EXISTS idx_inventories_deleted_at ON "inventories"(deleted_at);
+CREATE TABLE IF NOT EXISTS "inventory_archives" ("id" integer primary key autoincrement,"inventory_id" integer,"archive_id" varchar(255),"description" TEXT,"creation_date" datetime,"size" bigint,"checksum" varchar(255));
+CREATE TABLE IF NOT EXISTS "catalog_snapshots" ("id" integer primary key autoincrement,"created_at" datetime,"updated_at" datetime,"deleted_at" datetime,"vault" varchar(255),"archive_id" varchar(255),"checksum" varchar(255),"length" bigint);
+CREATE INDEX IF NOT EXISTS idx_catalog_snapshots_deleted_at ON "catalog_snapshots"(deleted_at);
+CREATE TABLE IF NOT EXISTS "vault_locks" ("id" integer primary key autoincrement,"created_at" datetime,"updated_at" datetime,"deleted_at" datetime,"vault" varchar(255),"lock_id" varchar(255),"state" varchar(255),"policy" TEXT,"expiration_date" datetime,"completed_at" datetime);
+CREATE INDEX IF NOT EXISTS idx_vault_locks_deleted_at ON "vault_locks"(deleted_at);
+`
+
+// migrationBackupStatus derives the status of the backups which were created before the status was introduced
+const migrationBackupStatus = `
+UPDATE backups SET
+	status = CASE
+		WHEN deleted_at IS NOT NULL THEN 'deleted'
+		WHEN error LIKE 'The backup was cancelled%' THEN 'cancelled'
+		WHEN (archive_id IS NOT NULL AND NOT EXISTS (SELECT 1 FROM volumes WHERE volumes.backup_id = backups.id AND volumes.deleted_at IS NULL))
+			OR (EXISTS (SELECT 1 FROM volumes WHERE volumes.backup_id = backups.id AND volumes.deleted_at IS NULL)
+			AND NOT EXISTS (SELECT 1 FROM volumes WHERE volumes.backup_id = backups.id AND volumes.deleted_at IS NULL AND volumes.archive_id IS NULL)) THEN
+			CASE WHEN IFNULL(error, '') = '' AND NOT EXISTS (SELECT 1 FROM replicas WHERE replicas.backup_id = backups.id AND replicas.deleted_at IS NULL AND replicas.archive_id IS NULL)
+				THEN 'completed' ELSE 'completed-with-warnings' END
+		WHEN IFNULL(error, '') <> '' THEN 'failed'
+		ELSE 'pending'
+	END,
+	status_changed_at = updated_at
+	WHERE IFNULL(status, '') = '';
+`
+
+// migrationBackupHeartbeat adds the heartbeat which is refreshed during the upload of a backup
+const migrationBackupHeartbeat = `
+ALTER TABLE "backups" ADD COLUMN "heartbeat_at" datetime;
+UPDATE backups SET heartbeat_at = status_changed_at;
+`
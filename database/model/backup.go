@@ -10,7 +10,10 @@ const (
 	ColumnCreatedAt  = "created_at"
 	ColumnUpdateddAt = "updated_at"
 
+	ColumnBackupBackend     = "backend"
 	ColumnBackupVault       = "vault"
+	ColumnBackupRegion      = "region"
+	ColumnBackupAccountId   = "account_id"
 	ColumnBackupDescription = "description"
 	ColumnBackupUploadId    = "upload_id"
 	ColumnBackupArchiveId   = "archive_id"
@@ -19,30 +22,132 @@ const (
 	ColumnBackupLength      = "length"
 	ColumnBackupPassword    = "password"
 	ColumnBackupError       = "error"
+	ColumnBackupSources     = "sources"
+	ColumnBackupBlacklist   = "blacklist"
+	ColumnBackupWhitelist   = "whitelist"
+	ColumnBackupPartSize    = "part_size"
+	ColumnBackupVolumeSize  = "volume_size"
+	ColumnBackupReplicas    = "replicas"
+	ColumnBackupStatus      = "status"
+	ColumnBackupStatusAt    = "status_changed_at"
+	ColumnBackupHeartbeatAt = "heartbeat_at"
 
+	ColumnTransitionBackupId = "backup_id"
+
+	ColumnVolumeBackupId = "backup_id"
+	ColumnVolumeNumber   = "number"
+
+	ColumnContentBackupId = "backup_id"
 	ColumnContentZipPath  = "zip_path"
 	ColumnContentRealPath = "real_path"
 	ColumnContentLength   = "length"
 )
 
+// The states of a backup. A backup starts as pending and becomes uploading as soon as its volumes are uploaded. The
+// transitions between the states are checked by the backup manager.
+const (
+	// BackupStatusPending means that the backup is saved but its upload has not started yet
+	BackupStatusPending = "pending"
+	// BackupStatusUploading means that the volumes of the backup are uploaded (or the run was interrupted)
+	BackupStatusUploading = "uploading"
+	// BackupStatusCompleted means that all volumes and replicas of the backup are uploaded
+	BackupStatusCompleted = "completed"
+	// BackupStatusCompletedWithWarnings means that all volumes are uploaded but some replicas are missing
+	BackupStatusCompletedWithWarnings = "completed-with-warnings"
+	// BackupStatusFailed means that the upload failed. The backup can be resumed.
+	BackupStatusFailed = "failed"
+	// BackupStatusCancelled means that the upload was cancelled. The backup can be resumed.
+	BackupStatusCancelled = "cancelled"
+	// BackupStatusDeleting means that the archives of the backup are deleted (or the deletion was interrupted)
+	BackupStatusDeleting = "deleting"
+	// BackupStatusDeleted means that the archives of the backup are deleted. The backup is removed from the catalog.
+	BackupStatusDeleted = "deleted"
+)
+
+// BackupStatuses are all states of a backup
+var BackupStatuses = []string{
+	BackupStatusPending,
+	BackupStatusUploading,
+	BackupStatusCompleted,
+	BackupStatusCompletedWithWarnings,
+	BackupStatusFailed,
+	BackupStatusCancelled,
+	BackupStatusDeleting,
+	BackupStatusDeleted,
+}
+
 type Backup struct {
 	gorm.Model
 
-	Vault       string    `db:"vault"`
-	Description string    `db:"description" gorm:"type:TEXT"`
-	UploadId    *string   `db:"upload_id"`
-	ArchiveId   *string   `db:"archive_id"`
-	Location    *string   `db:"location"`
-	Checksum    *string   `db:"checksum"`
-	Length      int64     `db:"length"`
-	Password    string    `db:"password"`
-	Error       string    `db:"error"`
+	// Backend is the type of the storage backend. An empty backend means glacier.
+	Backend string `db:"backend"`
+	// Vault is the glacier vault or the S3 bucket
+	Vault string `db:"vault"`
+	// Region and AccountId are the location of the vault. Empty values stand for the defaults (backups which
+	// are created before the location is stored).
+	Region      string  `db:"region"`
+	AccountId   string  `db:"account_id"`
+	Description string  `db:"description" gorm:"type:TEXT"`
+	UploadId    *string `db:"upload_id"`
+	ArchiveId   *string `db:"archive_id"`
+	Location    *string `db:"location"`
+	Checksum    *string `db:"checksum"`
+	Length      int64   `db:"length"`
+	Password    string  `db:"password"`
+	Error       string  `db:"error"`
+	Sources     string  `db:"sources" gorm:"type:TEXT"`
+	Blacklist   string  `db:"blacklist" gorm:"type:TEXT"`
+	Whitelist   string  `db:"whitelist" gorm:"type:TEXT"`
+	PartSize    int     `db:"part_size"`
+	VolumeSize  int64   `db:"volume_size"`
+	// Replicas are the (json encoded) further vaults which receive a copy of each volume
+	Replicas string `db:"replicas" gorm:"type:TEXT"`
+	// Status is one of BackupStatuses. StatusChangedAt is the time of the last transition.
+	Status          string    `db:"status"`
+	StatusChangedAt time.Time `db:"status_changed_at"`
+	// HeartbeatAt is refreshed while the backup is uploaded. A pending or uploading backup whose heartbeat is
+	// expired is regarded as interrupted.
+	HeartbeatAt time.Time `db:"heartbeat_at"`
 	FileList    []Content `gorm:"foreignkey:BackupID"`
+	Volumes     []Volume  `gorm:"foreignkey:BackupID"`
+}
+
+// IsUploaded returns true if all volumes of the backup are uploaded
+func (b *Backup) IsUploaded() bool {
+	return b.Status == BackupStatusCompleted || b.Status == BackupStatusCompletedWithWarnings
+}
+
+// BackupTransition is a change of the status of a backup. The transitions are kept even if the backup is deleted.
+type BackupTransition struct {
+	gorm.Model
+
+	BackupID   uint   `db:"backup_id"`
+	FromStatus string `db:"from_status"`
+	ToStatus   string `db:"to_status"`
+	// Error is the error of the backup which caused the transition
+	Error string `db:"error"`
+}
+
+// Volume is one glacier archive of a backup. Each volume is a self-contained zip archive
+// and holds the contents which are referenced by Content.VolumeID.
+type Volume struct {
+	gorm.Model
+
+	BackupID uint    `db:"backup_id"`
+	Number   int     `db:"number"`
+	UploadId *string `db:"upload_id"`
+	// ArchiveId is the id of the glacier archive or the key of the S3 object
+	ArchiveId *string `db:"archive_id"`
+	Location  *string `db:"location"`
+	Checksum  *string `db:"checksum"`
+	Length    int64   `db:"length"`
+	Error     string  `db:"error"`
 }
 
 type Content struct {
 	ID       uint `gorm:"primary_key"`
 	BackupID uint
+	VolumeID uint
 	Path     string    `db:"path" gorm:"type:TEXT"`
 	Length   int64     `db:"length"`
 	ModTime  time.Time `db:"mod"`
@@ -0,0 +1,19 @@
+package model
+
+import (
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	ColumnCatalogSnapshotVault = "vault"
+)
+
+// CatalogSnapshot is an encrypted copy of the catalog database which is uploaded into a vault
+type CatalogSnapshot struct {
+	gorm.Model
+
+	Vault     string `db:"vault"`
+	ArchiveId string `db:"archive_id"`
+	Checksum  string `db:"checksum"`
+	Length    int64  `db:"length"`
+}
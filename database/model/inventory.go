@@ -0,0 +1,31 @@
+package model
+
+import (
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+const (
+	ColumnInventoryVault         = "vault"
+	ColumnInventoryInventoryDate = "inventory_date"
+)
+
+// Inventory is the cached inventory of a vault
+type Inventory struct {
+	gorm.Model
+
+	Vault         string             `db:"vault"`
+	InventoryDate time.Time          `db:"inventory_date"`
+	Archives      []InventoryArchive `gorm:"foreignkey:InventoryID"`
+}
+
+// InventoryArchive is one archive of an Inventory
+type InventoryArchive struct {
+	ID           uint      `gorm:"primary_key"`
+	InventoryID  uint      `db:"inventory_id"`
+	ArchiveId    string    `db:"archive_id"`
+	Description  string    `db:"description" gorm:"type:TEXT"`
+	CreationDate time.Time `db:"creation_date"`
+	Size         int64     `db:"size"`
+	Checksum     string    `db:"checksum"`
+}
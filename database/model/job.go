@@ -0,0 +1,48 @@
+package model
+
+import (
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+const (
+	ColumnJobBackupId = "backup_id"
+	ColumnJobStatus   = "status"
+
+	// JobStatusPending means that glacier has not completed the retrieval job yet
+	JobStatusPending = "pending"
+	// JobStatusReady means that the output of the job can be fetched
+	JobStatusReady = "ready"
+	// JobStatusFetched means that the output of the job is already downloaded
+	JobStatusFetched = "fetched"
+	// JobStatusExpired means that the output of the job is not available anymore
+	JobStatusExpired = "expired"
+	// JobStatusFailed means that glacier could not complete the job
+	JobStatusFailed = "failed"
+)
+
+// Job is an archive retrieval job of a volume. The output of the job will be downloaded into the target
+// as soon as it is ready.
+type Job struct {
+	gorm.Model
+
+	BackupID           uint       `db:"backup_id"`
+	VolumeNumber       int        `db:"volume_number"`
+	Backend            string     `db:"backend"`
+	Vault              string     `db:"vault"`
+	Region             string     `db:"region"`
+	AccountId          string     `db:"account_id"`
+	ArchiveId          string     `db:"archive_id"`
+	JobId              string     `db:"job_id"`
+	Tier               string     `db:"tier"`
+	Target             string     `db:"target" gorm:"type:TEXT"`
+	Status             string     `db:"status"`
+	ExpectedCompletion time.Time  `db:"expected_completion"`
+	CompletedAt        *time.Time `db:"completed_at"`
+	Error              string     `db:"error"`
+}
+
+// IsOpen returns true if the job is not fetched, expired or failed
+func (j *Job) IsOpen() bool {
+	return j.Status == JobStatusPending || j.Status == JobStatusReady
+}
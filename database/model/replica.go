@@ -0,0 +1,29 @@
+package model
+
+import (
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	ColumnReplicaBackupId = "backup_id"
+	ColumnReplicaVolumeId = "volume_id"
+)
+
+// Replica is a copy of a volume in a further vault (or bucket), usually in another region. A replica has the same
+// encrypted content as the archive of its volume, so that it can be downloaded instead of it.
+type Replica struct {
+	gorm.Model
+
+	BackupID  uint    `db:"backup_id"`
+	VolumeID  uint    `db:"volume_id"`
+	Backend   string  `db:"backend"`
+	Vault     string  `db:"vault"`
+	Region    string  `db:"region"`
+	AccountId string  `db:"account_id"`
+	UploadId  *string `db:"upload_id"`
+	ArchiveId *string `db:"archive_id"`
+	Location  *string `db:"location"`
+	Checksum  *string `db:"checksum"`
+	Length    int64   `db:"length"`
+	Error     string  `db:"error"`
+}
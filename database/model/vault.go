@@ -0,0 +1,31 @@
+package model
+
+import (
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+const (
+	ColumnVaultLockVault = "vault"
+)
+
+// The states of a vault lock. InProgress and Locked are the states of glacier, the others are only known by the
+// catalog because glacier forgets aborted and expired locks.
+const (
+	VaultLockStateInProgress = "InProgress"
+	VaultLockStateLocked     = "Locked"
+	VaultLockStateAborted    = "Aborted"
+	VaultLockStateExpired    = "Expired"
+)
+
+// VaultLock is the lock of a vault which was initiated by backup2glacier
+type VaultLock struct {
+	gorm.Model
+
+	Vault          string     `db:"vault"`
+	LockId         string     `db:"lock_id"`
+	State          string     `db:"state"`
+	Policy         string     `db:"policy" gorm:"type:TEXT"`
+	ExpirationDate time.Time  `db:"expiration_date"`
+	CompletedAt    *time.Time `db:"completed_at"`
+}
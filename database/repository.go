@@ -2,8 +2,6 @@ package database
 
 import (
 	"backup2glacier/database/model"
-	_ "github.com/golang-migrate/migrate/database/sqlite3"
-	_ "github.com/golang-migrate/migrate/source/github"
 	"github.com/jinzhu/gorm"
 	_ "github.com/jinzhu/gorm/dialects/sqlite"
 	"github.com/pkg/errors"
@@ -17,12 +15,40 @@ type Repository interface {
 
 	SaveBackup(backup *model.Backup)
 	UpdateBackup(backup *model.Backup)
+	UpdateHeartbeat(id uint, at time.Time)
+	SaveBackupTransition(transition *model.BackupTransition)
 	AddContent(backup *model.Backup, content *model.Content)
+	DeleteContentsByBackupId(uint)
+	SaveVolume(backup *model.Backup, volume *model.Volume)
+	UpdateVolume(volume *model.Volume)
+	SaveReplica(replica *model.Replica)
+	UpdateReplica(replica *model.Replica)
+	DeleteReplica(replica *model.Replica)
+	SaveJob(job *model.Job)
+	UpdateJob(job *model.Job)
+	SaveInventory(inventory *model.Inventory)
+	SaveCatalogSnapshot(snapshot *model.CatalogSnapshot)
+	DeleteCatalogSnapshot(snapshot *model.CatalogSnapshot)
+	SaveVaultLock(lock *model.VaultLock)
+	UpdateVaultLock(lock *model.VaultLock)
 
 	Count() int64
 	List() BackupIterator
 	GetBackupById(uint) *model.Backup
+	GetBackupTransitions(uint) []model.BackupTransition
+	IsBackupIdUsed(uint) bool
 	GetBackupContentsById(uint) (*model.Backup, ContentIterator)
+	GetVolumesByBackupId(uint) []model.Volume
+	GetReplicasByBackupId(uint) []model.Replica
+	GetReplicasByVault(string) []model.Replica
+	GetJobs() []model.Job
+	GetJobsByBackupId(uint) []model.Job
+	GetLastInventory(string) *model.Inventory
+	GetCatalogSnapshots(string) []model.CatalogSnapshot
+	GetVaultLock(string) *model.VaultLock
+	GetByVault(string) BackupIterator
+	GetByStatus(...string) BackupIterator
+	GetStale(time.Time) BackupIterator
 	GetOlderThan(string, time.Time) BackupIterator
 	GetLast(string, int) BackupIterator
 	DeleteBackupById(uint)
@@ -32,19 +58,33 @@ type repository struct {
 	db *gorm.DB
 }
 
+// NewRepository opens the catalog in the given sqlite database file (see OpenRepository). It panics if the catalog
+// can not be opened.
 func NewRepository(dbFile string) Repository {
+	r, err := OpenRepository(dbFile)
+	if err != nil {
+		panic(err)
+	}
+
+	return r
+}
+
+// OpenRepository opens the catalog in the given sqlite database file. Its schema will be migrated to the current
+// version. Catalogs which are written by a newer version can not be opened (see ErrSchemaTooNew).
+func OpenRepository(dbFile string) (Repository, error) {
 	db, err := gorm.Open("sqlite3", dbFile)
 	if err != nil {
-		panic(errors.Wrap(err, "failed to connect database"))
+		return nil, errors.Wrap(err, "failed to connect database")
 	}
 
-	// Migrate the schema
-	db.AutoMigrate(&model.Content{})
-	db.AutoMigrate(&model.Backup{})
+	if err := migrate(db.DB(), dbFile); err != nil {
+		db.Close()
+		return nil, errors.Wrap(err, "failed to migrate database")
+	}
 
 	return &repository{
 		db,
-	}
+	}, nil
 }
 
 func (r *repository) Close() error {
@@ -59,12 +99,131 @@ func (r *repository) UpdateBackup(backup *model.Backup) {
 	r.db.Save(backup)
 }
 
+// UpdateHeartbeat refreshes the heartbeat of the given backup without touching its other columns
+func (r *repository) UpdateHeartbeat(id uint, at time.Time) {
+	r.db.Model(&model.Backup{}).Where(model.ColumnID+" = ?", id).UpdateColumn(model.ColumnBackupHeartbeatAt, at)
+}
+
+func (r *repository) SaveBackupTransition(transition *model.BackupTransition) {
+	r.db.Create(transition)
+}
+
+// GetBackupTransitions returns the status transitions of the given backup. The oldest comes first.
+func (r *repository) GetBackupTransitions(id uint) []model.BackupTransition {
+	var transitions []model.BackupTransition
+	r.db.Where(model.ColumnTransitionBackupId+" = ?", id).Order(model.ColumnID + " ASC").Find(&transitions)
+
+	return transitions
+}
+
 func (r *repository) AddContent(backup *model.Backup, content *model.Content) {
 	content.BackupID = backup.ID
 
 	r.db.Create(content)
 }
 
+func (r *repository) DeleteContentsByBackupId(id uint) {
+	r.db.Where(model.ColumnContentBackupId+" = ?", id).Delete(&model.Content{})
+}
+
+func (r *repository) SaveVolume(backup *model.Backup, volume *model.Volume) {
+	volume.BackupID = backup.ID
+
+	r.db.Create(volume)
+}
+
+func (r *repository) UpdateVolume(volume *model.Volume) {
+	r.db.Save(volume)
+}
+
+func (r *repository) SaveReplica(replica *model.Replica) {
+	r.db.Create(replica)
+}
+
+func (r *repository) UpdateReplica(replica *model.Replica) {
+	r.db.Save(replica)
+}
+
+func (r *repository) DeleteReplica(replica *model.Replica) {
+	r.db.Delete(replica)
+}
+
+func (r *repository) SaveJob(job *model.Job) {
+	r.db.Create(job)
+}
+
+func (r *repository) UpdateJob(job *model.Job) {
+	r.db.Save(job)
+}
+
+func (r *repository) GetJobs() []model.Job {
+	var jobs []model.Job
+	r.db.Order(model.ColumnCreatedAt + " ASC").Find(&jobs)
+
+	return jobs
+}
+
+func (r *repository) GetJobsByBackupId(id uint) []model.Job {
+	var jobs []model.Job
+	r.db.Where(model.ColumnJobBackupId+" = ?", id).Order(model.ColumnCreatedAt + " ASC").Find(&jobs)
+
+	return jobs
+}
+
+func (r *repository) SaveInventory(inventory *model.Inventory) {
+	r.db.Create(inventory)
+}
+
+func (r *repository) SaveCatalogSnapshot(snapshot *model.CatalogSnapshot) {
+	r.db.Create(snapshot)
+}
+
+func (r *repository) DeleteCatalogSnapshot(snapshot *model.CatalogSnapshot) {
+	r.db.Delete(snapshot)
+}
+
+// GetCatalogSnapshots returns all catalog snapshots of the given vault. The newest comes first.
+func (r *repository) GetCatalogSnapshots(vault string) []model.CatalogSnapshot {
+	var snapshots []model.CatalogSnapshot
+	r.db.Where(model.ColumnCatalogSnapshotVault+" = ?", vault).Order(model.ColumnCreatedAt + " DESC").Find(&snapshots)
+
+	return snapshots
+}
+
+func (r *repository) SaveVaultLock(lock *model.VaultLock) {
+	r.db.Create(lock)
+}
+
+func (r *repository) UpdateVaultLock(lock *model.VaultLock) {
+	r.db.Save(lock)
+}
+
+// GetVaultLock returns the newest vault lock of the given vault. If there is no lock, nil will be returned.
+func (r *repository) GetVaultLock(vault string) *model.VaultLock {
+	var lock model.VaultLock
+	r.db.Where(model.ColumnVaultLockVault+" = ?", vault).Order(model.ColumnCreatedAt + " DESC").First(&lock)
+
+	if lock.ID == 0 {
+		return nil
+	}
+	return &lock
+}
+
+// GetLastInventory returns the newest cached inventory of the given vault (including its archives). If there is
+// no inventory, nil will be returned.
+func (r *repository) GetLastInventory(vault string) *model.Inventory {
+	var inventory model.Inventory
+	r.db.Where(model.ColumnInventoryVault+" = ?", vault).
+		Order(model.ColumnInventoryInventoryDate + " DESC").
+		Preload("Archives").
+		First(&inventory)
+
+	if inventory.ID == 0 {
+		return nil
+	}
+	return &inventory
+}
+
 func (r *repository) Count() int64 {
 	var count int64
 	r.db.Table(reflect.TypeOf(&model.Backup{}).Name()).Count(&count)
@@ -81,6 +240,45 @@ func (r *repository) List() BackupIterator {
 	return newBackupIterator(sqlRows, r.db)
 }
 
+func (r *repository) GetByVault(vault string) BackupIterator {
+	sqlRows, err := r.db.Model(&model.Backup{}).
+		Where(model.ColumnBackupVault+" = ?", vault).
+		Rows()
+
+	if err != nil {
+		panic(errors.Wrap(err, "Error while creating rows"))
+	}
+
+	return newBackupIterator(sqlRows, r.db)
+}
+
+// GetByStatus returns the backups which have one of the given states
+func (r *repository) GetByStatus(statuses ...string) BackupIterator {
+	sqlRows, err := r.db.Model(&model.Backup{}).
+		Where(model.ColumnBackupStatus+" IN (?)", statuses).
+		Rows()
+
+	if err != nil {
+		panic(errors.Wrap(err, "Error while creating rows"))
+	}
+
+	return newBackupIterator(sqlRows, r.db)
+}
+
+// GetStale returns the backups which are pending or uploading and whose last heartbeat is before the given time
+func (r *repository) GetStale(before time.Time) BackupIterator {
+	sqlRows, err := r.db.Model(&model.Backup{}).
+		Where(model.ColumnBackupStatus+" IN (?) AND "+model.ColumnBackupHeartbeatAt+" < ?",
+			[]string{model.BackupStatusPending, model.BackupStatusUploading}, before).
+		Rows()
+
+	if err != nil {
+		panic(errors.Wrap(err, "Error while creating rows"))
+	}
+
+	return newBackupIterator(sqlRows, r.db)
+}
+
 func (r *repository) GetOlderThan(vault string, time time.Time) BackupIterator {
 	sqlRows, err := r.db.Model(&model.Backup{}).
 		Where(model.ColumnBackupVault+" = ? AND "+model.ColumnCreatedAt+" < ?", vault, time).
@@ -115,6 +313,14 @@ func (r *repository) GetBackupById(id uint) *model.Backup {
 	return &backup
 }
 
+// IsBackupIdUsed checks if the given id belongs to a backup. Even deleted backups keep their id.
+func (r *repository) IsBackupIdUsed(id uint) bool {
+	var count int
+	r.db.Unscoped().Model(&model.Backup{}).Where(model.ColumnID+" = ?", id).Count(&count)
+
+	return count > 0
+}
+
 func (r *repository) GetBackupContentsById(id uint) (*model.Backup, ContentIterator) {
 	var backup model.Backup
 	r.db.First(&backup, id)
@@ -127,10 +333,54 @@ func (r *repository) GetBackupContentsById(id uint) (*model.Backup, ContentItera
 	return &backup, newContentIterator(sqlRows, r.db)
 }
 
+// GetVolumesByBackupId returns all volumes of the given backup ordered by their number. Backups which
+// were created before volumes were introduced have their archive information in the backup itself. For
+// them a single (not persisted) volume will be returned.
+func (r *repository) GetVolumesByBackupId(id uint) []model.Volume {
+	var volumes []model.Volume
+	r.db.Where(&model.Volume{BackupID: id}).Order(model.ColumnVolumeNumber + " ASC").Find(&volumes)
+
+	if len(volumes) == 0 {
+		backup := r.GetBackupById(id)
+		if backup.ID == id && (backup.ArchiveId != nil || backup.UploadId != nil) {
+			volumes = append(volumes, model.Volume{
+				BackupID:  backup.ID,
+				Number:    1,
+				UploadId:  backup.UploadId,
+				ArchiveId: backup.ArchiveId,
+				Location:  backup.Location,
+				Checksum:  backup.Checksum,
+				Length:    backup.Length,
+				Error:     backup.Error,
+			})
+		}
+	}
+
+	return volumes
+}
+
+// GetReplicasByBackupId returns the replicas of all volumes of the given backup
+func (r *repository) GetReplicasByBackupId(id uint) []model.Replica {
+	var replicas []model.Replica
+	r.db.Where(&model.Replica{BackupID: id}).Order(model.ColumnReplicaVolumeId + " ASC").Find(&replicas)
+
+	return replicas
+}
+
+// GetReplicasByVault returns all replicas which are stored in the given vault
+func (r *repository) GetReplicasByVault(vault string) []model.Replica {
+	var replicas []model.Replica
+	r.db.Where(&model.Replica{Vault: vault}).Find(&replicas)
+
+	return replicas
+}
+
 func (r *repository) DeleteBackupById(id uint) {
 	backup := r.GetBackupById(id)
 	if backup != nil {
 		r.db.Where(&model.Content{BackupID: id}).Delete(&model.Content{})
+		r.db.Where(&model.Volume{BackupID: id}).Delete(&model.Volume{})
+		r.db.Where(&model.Replica{BackupID: id}).Delete(&model.Replica{})
 		r.db.Delete(backup)
 	}
 }
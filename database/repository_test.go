@@ -1,10 +1,105 @@
 package database
 
 import (
+	"backup2glacier/database/model"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path"
 	"testing"
+	"time"
 )
 
-func TestName(t *testing.T) {
-	r := NewRepository("/home/rainu/.aws/backup2glacier/database.db")
-	r.DeleteBackupById(7)
+func newTestRepository(t *testing.T) (Repository, func()) {
+	dir, err := ioutil.TempDir("", "repository")
+	assert.NoError(t, err)
+
+	r := NewRepository(path.Join(dir, "database.db"))
+
+	return r, func() {
+		r.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestRepository_DeleteBackupById(t *testing.T) {
+	r, cleanup := newTestRepository(t)
+	defer cleanup()
+
+	backup := &model.Backup{Vault: "vault"}
+	r.SaveBackup(backup)
+	r.SaveVolume(backup, &model.Volume{Number: 1})
+	r.AddContent(backup, &model.Content{})
+	r.SaveReplica(&model.Replica{BackupID: backup.ID, Vault: "replica"})
+	assert.Len(t, r.GetVolumesByBackupId(backup.ID), 1)
+	assert.Len(t, r.GetReplicasByVault("replica"), 1)
+
+	r.DeleteBackupById(backup.ID)
+
+	assert.Empty(t, r.GetVolumesByBackupId(backup.ID))
+	assert.Empty(t, r.GetReplicasByBackupId(backup.ID))
+	_, next := r.GetByVault("vault").Next()
+	assert.False(t, next)
+
+	//the id of a deleted backup must not be reused
+	assert.True(t, r.IsBackupIdUsed(backup.ID))
+	assert.False(t, r.IsBackupIdUsed(backup.ID+1))
+}
+
+func TestRepository_MigrationBackupStatus(t *testing.T) {
+	r, cleanup := newTestRepository(t)
+	defer cleanup()
+
+	archiveId := "archive"
+	backups := map[string]*model.Backup{
+		model.BackupStatusCompleted:             {ArchiveId: &archiveId},
+		model.BackupStatusCompletedWithWarnings: {Error: "The sources or the description of the backup are truncated"},
+		model.BackupStatusFailed:                {Error: "Could not upload volume 1"},
+		model.BackupStatusCancelled:             {Error: "The backup was cancelled. Its uploads are aborted: context canceled"},
+		model.BackupStatusPending:               {},
+	}
+	for _, backup := range backups {
+		r.SaveBackup(backup)
+	}
+	r.SaveVolume(backups[model.BackupStatusCompletedWithWarnings], &model.Volume{Number: 1, ArchiveId: &archiveId})
+	r.SaveVolume(backups[model.BackupStatusFailed], &model.Volume{Number: 1})
+
+	assert.NoError(t, r.(*repository).db.Exec(migrationBackupStatus).Error)
+
+	for status, backup := range backups {
+		assert.Equal(t, status, r.GetBackupById(backup.ID).Status)
+	}
+
+	iter := r.GetByStatus(model.BackupStatusFailed, model.BackupStatusCancelled)
+	defer iter.Close()
+	count := 0
+	for _, next := iter.Next(); next; _, next = iter.Next() {
+		count++
+	}
+	assert.Equal(t, 2, count)
+}
+
+func TestRepository_GetStale(t *testing.T) {
+	r, cleanup := newTestRepository(t)
+	defer cleanup()
+
+	longAgo := time.Now().Add(-72 * time.Hour)
+	interrupted := &model.Backup{Status: model.BackupStatusUploading, StatusChangedAt: longAgo, HeartbeatAt: longAgo}
+	running := &model.Backup{Status: model.BackupStatusUploading, StatusChangedAt: longAgo, HeartbeatAt: longAgo}
+	completed := &model.Backup{Status: model.BackupStatusCompleted, StatusChangedAt: longAgo, HeartbeatAt: longAgo}
+	for _, backup := range []*model.Backup{interrupted, running, completed} {
+		r.SaveBackup(backup)
+	}
+
+	//a running upload of several days is not stale
+	r.UpdateHeartbeat(running.ID, time.Now())
+	assert.Equal(t, longAgo.Unix(), r.GetBackupById(running.ID).StatusChangedAt.Unix())
+
+	iter := r.GetStale(time.Now().Add(-24 * time.Hour))
+	defer iter.Close()
+	var stale []uint
+	for backup, next := iter.Next(); next; backup, next = iter.Next() {
+		stale = append(stale, backup.ID)
+	}
+	assert.Equal(t, []uint{interrupted.ID}, stale)
 }
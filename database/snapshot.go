@@ -0,0 +1,82 @@
+package database
+
+import (
+	"database/sql"
+	"github.com/mattn/go-sqlite3"
+	"github.com/pkg/errors"
+	"os"
+	"sync"
+)
+
+const snapshotDriver = "sqlite3_snapshot"
+
+// snapshotConns receives the raw connections which are opened by the snapshot driver
+var snapshotConns = make(chan *sqlite3.SQLiteConn, 1)
+var snapshotMutex = sync.Mutex{}
+
+func init() {
+	sql.Register(snapshotDriver, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			select {
+			case snapshotConns <- conn:
+			default:
+			}
+			return nil
+		},
+	})
+}
+
+// Snapshot writes a consistent copy of the given database into the target file. It uses the online backup
+// API of sqlite: so the database can be in use while the snapshot is taken.
+func Snapshot(dbFile, target string) error {
+	snapshotMutex.Lock()
+	defer snapshotMutex.Unlock()
+
+	if _, err := os.Stat(dbFile); err != nil {
+		return errors.Wrap(err, "Could not find database")
+	}
+	if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "Could not remove old snapshot")
+	}
+
+	srcDb, srcConn, err := openSnapshotConn(dbFile)
+	if err != nil {
+		return errors.Wrap(err, "Could not open database")
+	}
+	defer srcDb.Close()
+
+	dstDb, dstConn, err := openSnapshotConn(target)
+	if err != nil {
+		return errors.Wrap(err, "Could not create snapshot")
+	}
+	defer dstDb.Close()
+
+	backup, err := dstConn.Backup("main", srcConn, "main")
+	if err != nil {
+		return errors.Wrap(err, "Could not start snapshot")
+	}
+
+	//copy all pages at once: sqlite restarts the copy if the database is changed in the meantime
+	if _, err := backup.Step(-1); err != nil {
+		backup.Finish()
+		return errors.Wrap(err, "Could not copy database")
+	}
+
+	return errors.Wrap(backup.Finish(), "Could not finish snapshot")
+}
+
+// openSnapshotConn opens the database with exactly one connection and returns the raw connection
+func openSnapshotConn(dbFile string) (*sql.DB, *sqlite3.SQLiteConn, error) {
+	db, err := sql.Open(snapshotDriver, dbFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	db.SetMaxOpenConns(1)
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+
+	return db, <-snapshotConns, nil
+}
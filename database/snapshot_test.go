@@ -0,0 +1,46 @@
+package database
+
+import (
+	"backup2glacier/database/model"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	//given
+	dir, err := ioutil.TempDir("", "snapshot")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	dbFile := path.Join(dir, "database.db")
+	repository := NewRepository(dbFile)
+	defer repository.Close()
+	repository.SaveBackup(&model.Backup{Vault: "vault", Description: "in the snapshot"})
+
+	//when: the database is still open
+	target := path.Join(dir, "snapshot.db")
+	err = Snapshot(dbFile, target)
+
+	//then
+	assert.NoError(t, err)
+	snapshot := NewRepository(target)
+	assert.Equal(t, "in the snapshot", snapshot.GetBackupById(1).Description)
+
+	//a second snapshot replaces the first one
+	repository.SaveBackup(&model.Backup{Vault: "vault", Description: "newer"})
+	snapshot.Close()
+	assert.NoError(t, Snapshot(dbFile, target))
+
+	snapshot = NewRepository(target)
+	assert.Equal(t, "newer", snapshot.GetBackupById(2).Description)
+	snapshot.Close()
+}
+
+func TestSnapshot_MissingDatabase(t *testing.T) {
+	err := Snapshot("/does/not/exist.db", path.Join(os.TempDir(), "snapshot.db"))
+
+	assert.Error(t, err)
+}
@@ -0,0 +1,755 @@
+// Package glaciertest provides an in-process fake of the glacier REST API for end-to-end tests. It supports
+// vaults, multipart uploads, archive retrieval and inventory retrieval jobs (whose completion is controlled by the
+// test), the download of job outputs and the deletion of archives. All data is kept in memory.
+package glaciertest
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go/service/glacier"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The error codes of glacier which are returned by the server
+const (
+	ErrCodeResourceNotFound      = glacier.ErrCodeResourceNotFoundException
+	ErrCodeInvalidParameterValue = glacier.ErrCodeInvalidParameterValueException
+	ErrCodeMissingParameterValue = glacier.ErrCodeMissingParameterValueException
+)
+
+// The status codes of the jobs
+const (
+	StatusInProgress = glacier.StatusCodeInProgress
+	StatusSucceeded  = glacier.StatusCodeSucceeded
+	StatusFailed     = glacier.StatusCodeFailed
+)
+
+// Server is a fake glacier server. Its URL can be used as endpoint of a glacier client. The client needs any
+// credentials and region, because the requests are signed (but the signature will not be checked).
+type Server struct {
+	*httptest.Server
+
+	// AutoComplete completes each job immediately when it is initiated
+	AutoComplete bool
+
+	mutex    sync.Mutex
+	vaults   map[string]*vault
+	nextId   int
+	requests []Request
+}
+
+// Request is a received request. The account is the first segment of the path and the region comes from the
+// credential scope of the signature.
+type Request struct {
+	Method    string
+	Path      string
+	AccountId string
+	Region    string
+}
+
+type vault struct {
+	name         string
+	creationDate time.Time
+	archives     map[string]*archive
+	uploads      map[string]*upload
+	jobs         []*job
+}
+
+type archive struct {
+	id           string
+	description  string
+	content      []byte
+	treeHash     string
+	creationDate time.Time
+}
+
+type upload struct {
+	id           string
+	description  string
+	partSize     int64
+	creationDate time.Time
+	// parts contains the content of the uploaded parts by their offset
+	parts map[int64][]byte
+}
+
+type job struct {
+	description jobDescription
+	output      []byte
+}
+
+// jobDescription is the (json) description of a job like glacier returns it
+type jobDescription struct {
+	Action                string
+	ArchiveId             string `json:",omitempty"`
+	ArchiveSHA256TreeHash string `json:",omitempty"`
+	ArchiveSizeInBytes    int64  `json:",omitempty"`
+	Completed             bool
+	CompletionDate        string `json:",omitempty"`
+	CreationDate          string
+	InventorySizeInBytes  int64 `json:",omitempty"`
+	JobId                 string
+	RetrievalByteRange    string `json:",omitempty"`
+	SHA256TreeHash        string `json:",omitempty"`
+	StatusCode            string
+	StatusMessage         string `json:",omitempty"`
+	Tier                  string `json:",omitempty"`
+	VaultARN              string
+}
+
+// NewServer starts a new fake glacier server without any vault. It must be closed after use.
+func NewServer() *Server {
+	s := &Server{
+		vaults: map[string]*vault{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+
+	return s
+}
+
+// Requests returns all requests which are received so far
+func (s *Server) Requests() []Request {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append([]Request{}, s.requests...)
+}
+
+// CreateVault creates a new (empty) vault. If the vault already exists, nothing happens.
+func (s *Server) CreateVault(vaultName string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.createVault(vaultName)
+}
+
+// ArchiveIds returns the ids of all archives of the vault
+func (s *Server) ArchiveIds(vaultName string) []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var ids []string
+	if v, exists := s.vaults[vaultName]; exists {
+		for id := range v.archives {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	return ids
+}
+
+// Archive returns the content of the given archive
+func (s *Server) Archive(vaultName, archiveId string) ([]byte, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if v, exists := s.vaults[vaultName]; exists {
+		if a, exists := v.archives[archiveId]; exists {
+			return a.content, true
+		}
+	}
+
+	return nil, false
+}
+
+// UploadIds returns the ids of all multipart uploads of the vault which are neither completed nor aborted
+func (s *Server) UploadIds(vaultName string) []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var ids []string
+	if v, exists := s.vaults[vaultName]; exists {
+		for id := range v.uploads {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	return ids
+}
+
+// JobIds returns the ids of all jobs of the vault in the order of their initiation
+func (s *Server) JobIds(vaultName string) []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var ids []string
+	if v, exists := s.vaults[vaultName]; exists {
+		for _, j := range v.jobs {
+			ids = append(ids, j.description.JobId)
+		}
+	}
+
+	return ids
+}
+
+// CompleteJob completes the given job successfully. Its output can be downloaded afterwards.
+func (s *Server) CompleteJob(vaultName, jobId string) bool {
+	return s.finishJob(vaultName, jobId, StatusSucceeded, "Succeeded")
+}
+
+// FailJob completes the given job with the given (error) message
+func (s *Server) FailJob(vaultName, jobId, message string) bool {
+	return s.finishJob(vaultName, jobId, StatusFailed, message)
+}
+
+// CompleteJobs completes all running jobs of the vault and returns their number
+func (s *Server) CompleteJobs(vaultName string) int {
+	count := 0
+	for _, jobId := range s.JobIds(vaultName) {
+		if s.CompleteJob(vaultName, jobId) {
+			count++
+		}
+	}
+
+	return count
+}
+
+// ForgetJob removes the job, so that glacier does not know it anymore (like after its expiration)
+func (s *Server) ForgetJob(vaultName, jobId string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if v, exists := s.vaults[vaultName]; exists {
+		for i, j := range v.jobs {
+			if j.description.JobId == jobId {
+				v.jobs = append(v.jobs[:i], v.jobs[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// finishJob completes the given job (if it is running) with the given status
+func (s *Server) finishJob(vaultName, jobId, statusCode, message string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	v, exists := s.vaults[vaultName]
+	if !exists {
+		return false
+	}
+	j := v.job(jobId)
+	if j == nil || j.description.Completed {
+		return false
+	}
+
+	j.description.Completed = true
+	j.description.CompletionDate = formatDate(time.Now())
+	j.description.StatusCode = statusCode
+	j.description.StatusMessage = message
+
+	return true
+}
+
+func (s *Server) createVault(vaultName string) *vault {
+	if v, exists := s.vaults[vaultName]; exists {
+		return v
+	}
+
+	v := &vault{
+		name:         vaultName,
+		creationDate: time.Now(),
+		archives:     map[string]*archive{},
+		uploads:      map[string]*upload{},
+	}
+	s.vaults[vaultName] = v
+
+	return v
+}
+
+// newId returns a new unique id for an upload, archive or job
+func (s *Server) newId(prefix string) string {
+	s.nextId++
+	return fmt.Sprintf("%s-%08d", prefix, s.nextId)
+}
+
+func (v *vault) arn() string {
+	return "arn:aws:glacier:fake:012345678901:vaults/" + v.name
+}
+
+func (v *vault) job(jobId string) *job {
+	for _, j := range v.jobs {
+		if j.description.JobId == jobId {
+			return j
+		}
+	}
+
+	return nil
+}
+
+// signatureRegion returns the region of the credential scope of an AWS signature (version 4):
+// ... Credential=<key>/<date>/<region>/<service>/aws4_request, ...
+func signatureRegion(authorization string) string {
+	for _, field := range strings.Split(authorization, ",") {
+		field = strings.TrimSpace(field)
+		if i := strings.Index(field, "Credential="); i >= 0 {
+			if scope := strings.Split(field[i+len("Credential="):], "/"); len(scope) > 2 {
+				return scope[2]
+			}
+		}
+	}
+
+	return ""
+}
+
+// serveHTTP dispatches the requests: /{accountId}/vaults[/{vaultName}[/{resource}[/{id}[/output]]]]
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	s.requests = append(s.requests, Request{
+		Method:    r.Method,
+		Path:      r.URL.Path,
+		AccountId: segments[0],
+		Region:    signatureRegion(r.Header.Get("Authorization")),
+	})
+	if len(segments) < 2 || segments[1] != "vaults" {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidParameterValue, "Unsupported operation: %s %s", r.Method, r.URL.Path)
+		return
+	}
+	if len(segments) == 2 {
+		s.listVaults(w)
+		return
+	}
+
+	vaultName := segments[2]
+	if len(segments) == 3 && r.Method == http.MethodPut {
+		s.createVault(vaultName)
+		w.Header().Set("Location", r.URL.Path)
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+
+	v, exists := s.vaults[vaultName]
+	if !exists {
+		writeError(w, http.StatusNotFound, ErrCodeResourceNotFound, "Vault not found: %s", vaultName)
+		return
+	}
+
+	route := r.Method + " " + strings.Join(segments[3:], "/")
+	switch {
+	case route == "GET ":
+		s.describeVault(w, v)
+	case route == "DELETE ":
+		s.deleteVault(w, v)
+	case route == "POST multipart-uploads":
+		s.initiateMultipartUpload(w, r, v)
+	case strings.HasPrefix(route, "PUT multipart-uploads/"):
+		s.uploadMultipartPart(w, r, v, segments[4])
+	case strings.HasPrefix(route, "GET multipart-uploads/"):
+		s.listParts(w, v, segments[4])
+	case strings.HasPrefix(route, "POST multipart-uploads/"):
+		s.completeMultipartUpload(w, r, v, segments[4])
+	case strings.HasPrefix(route, "DELETE multipart-uploads/"):
+		s.abortMultipartUpload(w, v, segments[4])
+	case strings.HasPrefix(route, "DELETE archives/"):
+		s.deleteArchive(w, v, segments[4])
+	case route == "POST jobs":
+		s.initiateJob(w, r, v)
+	case route == "GET jobs":
+		s.listJobs(w, v)
+	case strings.HasPrefix(route, "GET jobs/") && len(segments) == 5:
+		s.describeJob(w, v, segments[4])
+	case strings.HasPrefix(route, "GET jobs/") && len(segments) == 6 && segments[5] == "output":
+		s.getJobOutput(w, r, v, segments[4])
+	default:
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidParameterValue, "Unsupported operation: %s %s", r.Method, r.URL.Path)
+	}
+}
+
+func (s *Server) listVaults(w http.ResponseWriter) {
+	var names []string
+	for name := range s.vaults {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var list []map[string]interface{}
+	for _, name := range names {
+		list = append(list, s.vaults[name].describe())
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"VaultList": list})
+}
+
+func (v *vault) describe() map[string]interface{} {
+	size := int64(0)
+	for _, a := range v.archives {
+		size += int64(len(a.content))
+	}
+
+	return map[string]interface{}{
+		"VaultName":        v.name,
+		"VaultARN":         v.arn(),
+		"CreationDate":     formatDate(v.creationDate),
+		"NumberOfArchives": len(v.archives),
+		"SizeInBytes":      size,
+	}
+}
+
+func (s *Server) describeVault(w http.ResponseWriter, v *vault) {
+	writeJSON(w, http.StatusOK, v.describe())
+}
+
+func (s *Server) deleteVault(w http.ResponseWriter, v *vault) {
+	if len(v.archives) > 0 {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidParameterValue, "Vault not empty: %s", v.name)
+		return
+	}
+
+	delete(s.vaults, v.name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) initiateMultipartUpload(w http.ResponseWriter, r *http.Request, v *vault) {
+	partSize, err := strconv.ParseInt(r.Header.Get("x-amz-part-size"), 10, 64)
+	if err != nil || partSize < 1024*1024 || partSize&(partSize-1) != 0 {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidParameterValue, "Invalid part size: %s", r.Header.Get("x-amz-part-size"))
+		return
+	}
+
+	u := &upload{
+		id:           s.newId("upload"),
+		description:  r.Header.Get("x-amz-archive-description"),
+		partSize:     partSize,
+		creationDate: time.Now(),
+		parts:        map[int64][]byte{},
+	}
+	v.uploads[u.id] = u
+
+	w.Header().Set("x-amz-multipart-upload-id", u.id)
+	w.Header().Set("Location", fmt.Sprintf("/-/vaults/%s/multipart-uploads/%s", v.name, u.id))
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *Server) uploadMultipartPart(w http.ResponseWriter, r *http.Request, v *vault, uploadId string) {
+	u, exists := v.uploads[uploadId]
+	if !exists {
+		writeError(w, http.StatusNotFound, ErrCodeResourceNotFound, "Upload not found: %s", uploadId)
+		return
+	}
+
+	var first, last int64
+	if n, _ := fmt.Sscanf(r.Header.Get("Content-Range"), "bytes %d-%d/*", &first, &last); n != 2 {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidParameterValue, "Invalid content range: %s", r.Header.Get("Content-Range"))
+		return
+	}
+	content, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidParameterValue, "Could not read part: %v", err)
+		return
+	}
+
+	if first%u.partSize != 0 || int64(len(content)) != last-first+1 || int64(len(content)) > u.partSize {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidParameterValue, "The range %d-%d does not match the part size %d", first, last, u.partSize)
+		return
+	}
+	treeHash := treeHash(content)
+	if checksum := r.Header.Get("x-amz-sha256-tree-hash"); checksum != "" && checksum != treeHash {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidParameterValue, "Checksum mismatch: expected %s but got %s", treeHash, checksum)
+		return
+	}
+	u.parts[first] = content
+
+	w.Header().Set("x-amz-sha256-tree-hash", treeHash)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) listParts(w http.ResponseWriter, v *vault, uploadId string) {
+	u, exists := v.uploads[uploadId]
+	if !exists {
+		writeError(w, http.StatusNotFound, ErrCodeResourceNotFound, "Upload not found: %s", uploadId)
+		return
+	}
+
+	var parts []map[string]string
+	for _, offset := range u.offsets() {
+		parts = append(parts, map[string]string{
+			"RangeInBytes":   fmt.Sprintf("%d-%d", offset, offset+int64(len(u.parts[offset]))-1),
+			"SHA256TreeHash": treeHash(u.parts[offset]),
+		})
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"ArchiveDescription": u.description,
+		"CreationDate":       formatDate(u.creationDate),
+		"MultipartUploadId":  u.id,
+		"PartSizeInBytes":    u.partSize,
+		"Parts":              parts,
+		"VaultARN":           v.arn(),
+	})
+}
+
+func (u *upload) offsets() []int64 {
+	var offsets []int64
+	for offset := range u.parts {
+		offsets = append(offsets, offset)
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+
+	return offsets
+}
+
+func (s *Server) completeMultipartUpload(w http.ResponseWriter, r *http.Request, v *vault, uploadId string) {
+	u, exists := v.uploads[uploadId]
+	if !exists {
+		writeError(w, http.StatusNotFound, ErrCodeResourceNotFound, "Upload not found: %s", uploadId)
+		return
+	}
+
+	content := new(bytes.Buffer)
+	for _, offset := range u.offsets() {
+		if offset != int64(content.Len()) {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidParameterValue, "The part at offset %d is missing", content.Len())
+			return
+		}
+		content.Write(u.parts[offset])
+	}
+
+	if size := r.Header.Get("x-amz-archive-size"); size != strconv.Itoa(content.Len()) {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidParameterValue, "Archive size mismatch: expected %d but got %s", content.Len(), size)
+		return
+	}
+	treeHash := treeHash(content.Bytes())
+	if checksum := r.Header.Get("x-amz-sha256-tree-hash"); checksum != treeHash {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidParameterValue, "Checksum mismatch: expected %s but got %s", treeHash, checksum)
+		return
+	}
+
+	a := &archive{
+		id:           s.newId("archive"),
+		description:  u.description,
+		content:      content.Bytes(),
+		treeHash:     treeHash,
+		creationDate: time.Now(),
+	}
+	v.archives[a.id] = a
+	delete(v.uploads, u.id)
+
+	w.Header().Set("x-amz-archive-id", a.id)
+	w.Header().Set("x-amz-sha256-tree-hash", treeHash)
+	w.Header().Set("Location", fmt.Sprintf("/-/vaults/%s/archives/%s", v.name, a.id))
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *Server) abortMultipartUpload(w http.ResponseWriter, v *vault, uploadId string) {
+	if _, exists := v.uploads[uploadId]; !exists {
+		writeError(w, http.StatusNotFound, ErrCodeResourceNotFound, "Upload not found: %s", uploadId)
+		return
+	}
+
+	delete(v.uploads, uploadId)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) deleteArchive(w http.ResponseWriter, v *vault, archiveId string) {
+	if _, exists := v.archives[archiveId]; !exists {
+		writeError(w, http.StatusNotFound, ErrCodeResourceNotFound, "Archive not found: %s", archiveId)
+		return
+	}
+
+	delete(v.archives, archiveId)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// jobParameters are the (json) parameters of InitiateJob
+type jobParameters struct {
+	Type               string
+	ArchiveId          string
+	Tier               string
+	RetrievalByteRange string
+	Format             string
+}
+
+func (s *Server) initiateJob(w http.ResponseWriter, r *http.Request, v *vault) {
+	params := jobParameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidParameterValue, "Invalid job parameters: %v", err)
+		return
+	}
+
+	now := time.Now()
+	j := &job{description: jobDescription{
+		JobId:        s.newId("job"),
+		CreationDate: formatDate(now),
+		StatusCode:   StatusInProgress,
+		Tier:         params.Tier,
+		VaultARN:     v.arn(),
+	}}
+
+	switch params.Type {
+	case "archive-retrieval":
+		a, exists := v.archives[params.ArchiveId]
+		if !exists {
+			writeError(w, http.StatusNotFound, ErrCodeResourceNotFound, "Archive not found: %s", params.ArchiveId)
+			return
+		}
+
+		j.output = a.content
+		if params.RetrievalByteRange != "" {
+			var first, last int64
+			n, _ := fmt.Sscanf(params.RetrievalByteRange, "%d-%d", &first, &last)
+			if n != 2 || first%(1024*1024) != 0 || first > last || last >= int64(len(a.content)) {
+				writeError(w, http.StatusBadRequest, ErrCodeInvalidParameterValue, "Invalid byte range: %s", params.RetrievalByteRange)
+				return
+			}
+			j.output = a.content[first : last+1]
+		}
+
+		j.description.Action = "ArchiveRetrieval"
+		j.description.ArchiveId = a.id
+		j.description.ArchiveSHA256TreeHash = a.treeHash
+		j.description.ArchiveSizeInBytes = int64(len(a.content))
+		j.description.RetrievalByteRange = params.RetrievalByteRange
+		j.description.SHA256TreeHash = treeHash(j.output)
+	case "inventory-retrieval":
+		output, err := v.inventory(now)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, glacier.ErrCodeServiceUnavailableException, "Could not create inventory: %v", err)
+			return
+		}
+
+		j.output = output
+		j.description.Action = "InventoryRetrieval"
+		j.description.InventorySizeInBytes = int64(len(output))
+	default:
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidParameterValue, "Invalid job type: %s", params.Type)
+		return
+	}
+
+	if s.AutoComplete {
+		j.description.Completed = true
+		j.description.CompletionDate = formatDate(now)
+		j.description.StatusCode = StatusSucceeded
+	}
+	v.jobs = append(v.jobs, j)
+
+	w.Header().Set("x-amz-job-id", j.description.JobId)
+	w.Header().Set("Location", fmt.Sprintf("/-/vaults/%s/jobs/%s", v.name, j.description.JobId))
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// inventory returns the (json) inventory of all archives of the vault
+func (v *vault) inventory(date time.Time) ([]byte, error) {
+	var ids []string
+	for id := range v.archives {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	list := []map[string]interface{}{}
+	for _, id := range ids {
+		a := v.archives[id]
+		list = append(list, map[string]interface{}{
+			"ArchiveId":          a.id,
+			"ArchiveDescription": a.description,
+			"CreationDate":       formatDate(a.creationDate),
+			"Size":               len(a.content),
+			"SHA256TreeHash":     a.treeHash,
+		})
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"VaultARN":      v.arn(),
+		"InventoryDate": formatDate(date),
+		"ArchiveList":   list,
+	})
+}
+
+func (s *Server) listJobs(w http.ResponseWriter, v *vault) {
+	list := []jobDescription{}
+	for _, j := range v.jobs {
+		list = append(list, j.description)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"JobList": list})
+}
+
+func (s *Server) describeJob(w http.ResponseWriter, v *vault, jobId string) {
+	j := v.job(jobId)
+	if j == nil {
+		writeError(w, http.StatusNotFound, ErrCodeResourceNotFound, "Job not found: %s", jobId)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, j.description)
+}
+
+func (s *Server) getJobOutput(w http.ResponseWriter, r *http.Request, v *vault, jobId string) {
+	j := v.job(jobId)
+	if j == nil {
+		writeError(w, http.StatusNotFound, ErrCodeResourceNotFound, "Job not found: %s", jobId)
+		return
+	}
+	if j.description.StatusCode != StatusSucceeded {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidParameterValue, "The job is not currently available for download: %s", jobId)
+		return
+	}
+
+	status := http.StatusOK
+	output := j.output
+	if byteRange := r.Header.Get("Range"); byteRange != "" {
+		var first, last int
+		if n, _ := fmt.Sscanf(byteRange, "bytes=%d-%d", &first, &last); n != 2 || first > last || last >= len(output) {
+			writeError(w, http.StatusRequestedRangeNotSatisfiable, ErrCodeInvalidParameterValue, "Invalid range: %s", byteRange)
+			return
+		}
+
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", first, last, len(output)))
+		output = output[first : last+1]
+		status = http.StatusPartialContent
+	}
+
+	if j.description.Action == "InventoryRetrieval" {
+		w.Header().Set("Content-Type", "application/json")
+	} else {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("x-amz-sha256-tree-hash", treeHash(output))
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(output)))
+	w.WriteHeader(status)
+	w.Write(output)
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	content, err := json.Marshal(value)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, glacier.ErrCodeServiceUnavailableException, "Could not marshal response: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(content)
+}
+
+func writeError(w http.ResponseWriter, status int, code, format string, args ...interface{}) {
+	content, _ := json.Marshal(map[string]string{
+		"code":    code,
+		"message": fmt.Sprintf(format, args...),
+		"type":    "Client",
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(content)
+}
+
+func treeHash(content []byte) string {
+	return hex.EncodeToString(glacier.ComputeHashes(bytes.NewReader(content)).TreeHash)
+}
+
+func formatDate(date time.Time) string {
+	return date.UTC().Format("2006-01-02T15:04:05.000Z")
+}
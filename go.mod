@@ -5,10 +5,8 @@ go 1.12
 require (
 	github.com/alexflint/go-arg v1.0.0
 	github.com/aws/aws-sdk-go v1.21.2
-	github.com/golang-migrate/migrate v3.5.4+incompatible
-	github.com/google/go-github v17.0.0+incompatible // indirect
-	github.com/google/go-querystring v1.0.0 // indirect
 	github.com/jinzhu/gorm v1.9.10
+	github.com/mattn/go-sqlite3 v1.10.0
 	github.com/pkg/errors v0.8.1
 	github.com/stretchr/testify v1.2.2
 	golang.org/x/crypto v0.0.0-20190325154230-a5d413f7728c
@@ -8,7 +8,6 @@ import (
 
 func main() {
 	os.Setenv("AWS_SDK_LOAD_CONFIG", "1")
-	os.Setenv("AWS_PROFILE", "default")
 
 	cfg := config.NewConfig()
 
@@ -17,6 +16,8 @@ func main() {
 	switch cfg.Action {
 	case config.ActionCreate:
 		cliAction = cli.NewCreateAction()
+	case config.ActionResume:
+		cliAction = cli.NewResumeAction()
 	case config.ActionGet:
 		cliAction = cli.NewGetAction()
 	case config.ActionDelete:
@@ -27,6 +28,22 @@ func main() {
 		cliAction = cli.NewListAction()
 	case config.ActionCurator:
 		cliAction = cli.NewCuratorAction()
+	case config.ActionJobs:
+		cliAction = cli.NewJobsAction()
+	case config.ActionSync:
+		cliAction = cli.NewSyncAction()
+	case config.ActionCopy:
+		cliAction = cli.NewCopyAction()
+	case config.ActionCleanup:
+		cliAction = cli.NewCleanupAction()
+	case config.ActionRecoverCatalog:
+		cliAction = cli.NewRecoverCatalogAction()
+	case config.ActionBootstrap:
+		cliAction = cli.NewBootstrapAction()
+	case config.ActionVault:
+		cliAction = cli.NewVaultAction()
+	case config.ActionDB:
+		cliAction = cli.NewDBAction()
 	default:
 		panic("This should never happen!")
 	}